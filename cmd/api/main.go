@@ -48,6 +48,27 @@ func main() {
         logger.Error("Failed to initialize navigator", "error", err)
         os.Exit(1)
     }
+    navigator.SetMaxSize(cfg.KB.MaxSize)
+    if err := navigator.SetSearchMode(kb.SearchMode(cfg.Search.Mode), cfg.Search.IndexDir); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    if err := navigator.SetAnalysis(cfg.SearchAnalysis()); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    if err := navigator.SetSynonyms(cfg.Search.Synonyms.File, cfg.Search.Synonyms.Rules); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    navigator.SetSavedSearches(cfg.Search.SavedSearches)
+    semantic, err := cfg.SearchSemantic()
+    if err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    navigator.SetSemantic(semantic)
+    defer navigator.Close()
 
     // Create Echo app
     e := echo.New()
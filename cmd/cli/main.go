@@ -2,14 +2,20 @@ package main
 
 import (
     "bufio"
+    "context"
+    "encoding/json"
     "flag"
     "fmt"
     "log/slog"
+    "math"
     "os"
+    "os/signal"
     //"path/filepath"
     "strings"
+    "time"
 
     "kbnavt/internal/config"
+    "kbnavt/internal/mcpclient"
     "kbnavt/pkg/kb"
 )
 
@@ -24,6 +30,11 @@ func main() {
         os.Exit(0)
     }
 
+    // mcp-client talks to a server and needs no local KB
+    if args[0] == "mcp-client" {
+        os.Exit(cmdMCPClient(*configPath, args[1:]))
+    }
+
     // Load configuration
     cfg, err := config.Load(*configPath)
     if err != nil {
@@ -42,33 +53,140 @@ func main() {
         logger.Error("Failed to initialize navigator", "error", err)
         os.Exit(1)
     }
+    navigator.SetMaxSize(cfg.KB.MaxSize)
+    if err := navigator.SetSearchMode(kb.SearchMode(cfg.Search.Mode), cfg.Search.IndexDir); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    if err := navigator.SetAnalysis(cfg.SearchAnalysis()); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    if err := navigator.SetSynonyms(cfg.Search.Synonyms.File, cfg.Search.Synonyms.Rules); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    navigator.SetSavedSearches(cfg.Search.SavedSearches)
+    semantic, err := cfg.SearchSemantic()
+    if err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    navigator.SetSemantic(semantic)
+    defer navigator.Close()
 
     command := args[0]
     cmdArgs := args[1:]
 
     switch command {
     case "list":
-        cmdList(navigator)
+        cmdList(navigator, cmdArgs)
     case "read":
         cmdRead(navigator, cmdArgs)
     case "search":
         cmdSearch(navigator, cmdArgs)
+    case "suggest":
+        cmdSuggest(navigator, cmdArgs)
+    case "related":
+        cmdRelated(navigator, cmdArgs)
+    case "dupes":
+        cmdDupes(navigator, cmdArgs)
+    case "grep":
+        cmdGrep(navigator, cmdArgs)
+    case "find":
+        cmdFind(navigator, cmdArgs)
     case "repl":
         cmdREPL(navigator)
     default:
         fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
-        os.Exit(1)
+        os.Exit(exitUsage)
+    }
+}
+
+// Exit codes, so that scripts can tell failures apart
+const (
+    exitError       = 1 // anything else
+    exitUsage       = 2
+    exitNotFound    = 3 // document, folder or section missing
+    exitForbidden   = 4 // path outside the KB
+    exitUnsupported = 5 // file type not served
+    exitTooLarge    = 6
+    exitInvalid     = 7 // content or input can't be processed
+    exitConflict    = 8
+)
+
+// exitCodes maps navigator error codes to exit codes
+var exitCodes = map[string]int{
+    "not_found":          exitNotFound,
+    "section_not_found":  exitNotFound,
+    "forbidden_path":     exitForbidden,
+    "unsupported_format": exitUnsupported,
+    "too_large":          exitTooLarge,
+    "invalid":            exitInvalid,
+    "conflict":           exitConflict,
+}
+
+// fail reports err and exits with the code for its kind
+func fail(err error) {
+    fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+    code, ok := exitCodes[kb.ErrorCode(err)]
+    if !ok {
+        code = exitError
+    }
+    os.Exit(code)
+}
+
+// listFlags registers the filtering, sorting and paging flags shared by
+// list and search; the returned function converts them to ListOptions.
+func listFlags(fs *flag.FlagSet, defaultLimit int, sortFields string) *kb.ListQuery {
+    query := &kb.ListQuery{}
+    fs.StringVar(&query.Folder, "folder", "", "Only documents below this folder")
+    fs.Var((*stringsFlag)(&query.Formats), "format", "Only these formats: org, markdown, text (repeatable)")
+    fs.Var((*stringsFlag)(&query.Tags), "tag", "Only documents carrying this tag (repeatable)")
+    fs.StringVar(&query.Since, "since", "", "Only documents modified on or after this date (YYYY-MM-DD, or a time ago such as -14d)")
+    fs.StringVar(&query.Until, "until", "", "Only documents modified before this date (YYYY-MM-DD)")
+    fs.StringVar(&query.Glob, "glob", "", "Path pattern, e.g. projects/**/*.org")
+    fs.StringVar(&query.Sort, "sort", "", "Sort by "+sortFields)
+    fs.StringVar(&query.Order, "order", "asc", "Sort order: asc or desc")
+    fs.IntVar(&query.Limit, "limit", defaultLimit, "Results per page")
+    fs.StringVar(&query.Cursor, "cursor", "", "Continue from a previous page")
+    return query
+}
+
+// stringsFlag collects the values of a repeated flag
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+    return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+    *f = append(*f, value)
+    return nil
+}
+
+// printNextPage tells the user how to get the following page
+func printNextPage(command string, shown, total int, cursor string) {
+    if cursor != "" {
+        fmt.Printf("\nShowing %d of %d. Next page: kbnavt %s -cursor %s ...\n", shown, total, command, cursor)
     }
 }
 
-func cmdList(navigator *kb.Navigator) {
-    docs, err := navigator.ListDocuments()
+func cmdList(navigator *kb.Navigator, args []string) {
+    fs := flag.NewFlagSet("list", flag.ExitOnError)
+    query := listFlags(fs, kb.DefaultPageSize, "path, title, modified or size")
+    fs.Parse(args)
+
+    opts, err := query.Options()
     if err != nil {
-        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-        os.Exit(1)
+        fail(err)
+    }
+    page, err := navigator.ListDocumentsPage(opts)
+    if err != nil {
+        fail(err)
     }
 
-    if len(docs) == 0 {
+    if len(page.Documents) == 0 {
         fmt.Println("No documents found")
         return
     }
@@ -76,15 +194,16 @@ func cmdList(navigator *kb.Navigator) {
     fmt.Printf("%-30s %-10s %-20s\n", "Path", "Format", "Size")
     fmt.Println(strings.Repeat("-", 70))
 
-    for _, doc := range docs {
+    for _, doc := range page.Documents {
         fmt.Printf("%-30s %-10s %-20d\n", doc.Path, doc.Format, doc.Size)
     }
+    printNextPage("list", len(page.Documents), page.Total, page.NextCursor)
 }
 
 func cmdRead(navigator *kb.Navigator, args []string) {
     if len(args) < 1 {
         fmt.Fprintf(os.Stderr, "Usage: kbnavt read <path> [section]\n")
-        os.Exit(1)
+        os.Exit(exitUsage)
     }
 
     path := args[0]
@@ -93,51 +212,425 @@ func cmdRead(navigator *kb.Navigator, args []string) {
         section := strings.Join(args[1:], " ")
         content, err := navigator.ReadSection(path, section)
         if err != nil {
-            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-            os.Exit(1)
+            fail(err)
         }
         fmt.Println(content)
     } else {
         doc, err := navigator.ReadDocument(path)
         if err != nil {
-            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-            os.Exit(1)
+            fail(err)
         }
         fmt.Println(doc.Content)
     }
 }
 
 func cmdSearch(navigator *kb.Navigator, args []string) {
-    if len(args) < 1 {
-        fmt.Fprintf(os.Stderr, "Usage: kbnavt search <query> [limit]\n")
-        os.Exit(1)
+    fs := flag.NewFlagSet("search", flag.ExitOnError)
+    params := listFlags(fs, 10, "relevance, path, title, modified or size")
+    fs.BoolVar(&params.Group, "group", false, "One result per document with its best sections")
+    fs.IntVar(&params.Sections, "sections", kb.DefaultGroupSections, "Sections shown per document with -group")
+    fs.IntVar(&params.SnippetSize, "snippet-size", kb.DefaultSnippetSize, "Characters per snippet fragment")
+    fs.IntVar(&params.Snippets, "snippets", kb.DefaultSnippetCount, "Snippet fragments per result")
+    fs.BoolVar(&params.Fuzzy, "fuzzy", false, "Let words match words a few typos away")
+    fs.BoolVar(&params.Typeahead, "typeahead", false, "Match the last word as a prefix")
+    fs.BoolVar(&params.Explain, "explain", false, "Show how the query was interpreted")
+    fs.BoolVar(&params.KeywordOnly, "keyword-only", false, "Rank by keywords alone, without semantic search")
+    fs.Var((*stringsFlag)(&params.Facets), "facet", "Count results by folder, format, tag, year or todo (repeatable)")
+    fs.IntVar(&params.FacetSize, "facet-size", kb.DefaultFacetSize, "Values shown per facet")
+    marker := string(kb.MarkPlain)
+    if stat, err := os.Stdout.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+        marker = string(kb.MarkANSI)
     }
+    fs.StringVar(&params.Marker, "marker", marker, "How matches are marked: plain, html or ansi")
+    saved := fs.String("saved", "", "Run this saved search; a query and flags narrow it")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt search [flags] <query> [limit]\n       kbnavt search -saved <name> [flags] [query]\n\n%s\n\n", kb.QuerySyntax)
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
 
-    query := args[0]
-    limit := 10
-
-    if len(args) > 1 {
-        fmt.Sscanf(args[1], "%d", &limit)
+    query := ""
+    if *saved != "" {
+        s, err := navigator.SavedSearch(*saved)
+        if err != nil {
+            fail(err)
+        }
+        // The saved search replaces the defaults; flags given still win
+        savedParams := s.ListQuery()
+        if savedParams.Limit == 0 {
+            savedParams.Limit = params.Limit
+        }
+        params.Folder, params.Formats, params.Tags = savedParams.Folder, savedParams.Formats, savedParams.Tags
+        params.Since, params.Until, params.Glob = savedParams.Since, savedParams.Until, savedParams.Glob
+        params.Sort, params.Order, params.Limit = savedParams.Sort, savedParams.Order, savedParams.Limit
+        params.Group = params.Group || savedParams.Group
+        params.Fuzzy = params.Fuzzy || savedParams.Fuzzy
+        fs.Parse(args)
+        query = s.Query
+    }
+    args = fs.Args()
+
+    switch {
+    case len(args) > 0 && query != "":
+        query = "(" + query + ") " + args[0]
+    case len(args) > 0:
+        query = args[0]
+    case *saved == "":
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+    if *saved == "" && len(args) > 1 {
+        fs.Set("limit", args[1])
     }
 
-    results, err := navigator.SearchDocuments(query, limit)
+    opts, err := params.SearchOptions()
     if err != nil {
-        fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-        os.Exit(1)
+        fail(err)
+    }
+    page, err := navigator.Search(context.Background(), query, opts, nil)
+    if err != nil {
+        fail(err)
+    }
+
+    if page.Explain != nil {
+        fmt.Printf("Query: %s\n", page.Explain.Query)
+        for _, e := range page.Explain.Expansions {
+            fmt.Printf("Expanded %s: %s\n", e.Text, strings.Join(e.Synonyms, ", "))
+        }
+        if page.Explain.Semantic != "" {
+            fmt.Printf("Also by meaning: %s\n", page.Explain.Semantic)
+        }
+        fmt.Println()
     }
 
-    if len(results) == 0 {
+    if len(page.Results) == 0 {
         fmt.Println("No results found")
+        if page.DidYouMean != "" {
+            fmt.Printf("Did you mean: %s\n", page.DidYouMean)
+        }
         return
     }
 
-    fmt.Printf("Found %d results for: %s\n\n", len(results), query)
-
-    for _, result := range results {
-        fmt.Printf("Path: %s (Score: %.2f)\n", result.DocumentPath, result.Score)
-        fmt.Printf("Snippet: %s\n", result.Snippet)
+    if *saved != "" {
+        query = strings.TrimSpace(query + " (saved search " + *saved + ")")
+    }
+    fmt.Printf("Found %d results for: %s\n\n", page.Total, query)
+
+    for _, result := range page.Results {
+        fmt.Printf("Path: %s (Score: %.2f)\n", result.Location(), result.Score)
+        printFragments("", result.Fragments)
+        for _, section := range result.Sections {
+            fmt.Printf("  Section: %s (Score: %.2f)\n", section.Location(), section.Score)
+            printFragments("  ", section.Fragments)
+        }
         fmt.Println(strings.Repeat("-", 70))
     }
+    printFacets(page.Facets)
+    printNextPage("search", len(page.Results), page.Total, page.NextCursor)
+}
+
+// printFacets shows the facet counts, one facet per line
+func printFacets(facets map[kb.Facet]*kb.FacetResult) {
+    for _, facet := range kb.Facets {
+        result, ok := facets[facet]
+        if !ok {
+            continue
+        }
+        var counts []string
+        for _, c := range result.Values {
+            counts = append(counts, fmt.Sprintf("%s (%d)", c.Value, c.Count))
+        }
+        if result.Other > 0 {
+            counts = append(counts, fmt.Sprintf("others (%d)", result.Other))
+        }
+        if result.Missing > 0 {
+            counts = append(counts, fmt.Sprintf("none (%d)", result.Missing))
+        }
+        fmt.Printf("%-7s %s\n", string(facet)+":", strings.Join(counts, ", "))
+    }
+}
+
+func cmdSuggest(navigator *kb.Navigator, args []string) {
+    fs := flag.NewFlagSet("suggest", flag.ExitOnError)
+    limit := fs.Int("limit", kb.DefaultSuggestLimit, "Corrections per word, and completions")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt suggest [flags] <query>\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if fs.NArg() < 1 {
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+
+    s, err := navigator.Suggest(context.Background(), strings.Join(fs.Args(), " "), *limit)
+    if err != nil {
+        fail(err)
+    }
+    if s.DidYouMean != "" {
+        fmt.Printf("Did you mean: %s\n", s.DidYouMean)
+    }
+    for _, c := range s.Corrections {
+        var terms []string
+        for _, t := range c.Suggestions {
+            terms = append(terms, fmt.Sprintf("%s (%d)", t.Term, t.Count))
+        }
+        fmt.Printf("  %s: %s\n", c.Word, strings.Join(terms, ", "))
+    }
+    if len(s.Completions) > 0 {
+        fmt.Println("Completions:")
+        for _, completion := range s.Completions {
+            fmt.Printf("  %s\n", completion)
+        }
+    }
+    if s.DidYouMean == "" && len(s.Completions) == 0 {
+        fmt.Println("No suggestions")
+    }
+}
+
+func cmdRelated(navigator *kb.Navigator, args []string) {
+    fs := flag.NewFlagSet("related", flag.ExitOnError)
+    limit := fs.Int("limit", kb.DefaultRelatedLimit, "Maximum related notes")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt related [flags] <path>\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if fs.NArg() != 1 {
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+
+    related, err := navigator.RelatedDocuments(fs.Arg(0), *limit)
+    if err != nil {
+        fail(err)
+    }
+    if len(related) == 0 {
+        fmt.Println("No related notes")
+        return
+    }
+    for _, r := range related {
+        fmt.Printf("%.2f  %s (terms %.2f, tags %.2f, links %.2f)\n",
+            r.Score, r.Path, r.Signals.Terms, r.Signals.Tags, r.Signals.Links)
+        if r.Link != "" {
+            fmt.Printf("      %s\n", r.Link)
+        }
+        if len(r.SharedTags) > 0 {
+            fmt.Printf("      tags: %s\n", strings.Join(r.SharedTags, ", "))
+        }
+        if len(r.SharedTerms) > 0 {
+            fmt.Printf("      words: %s\n", strings.Join(r.SharedTerms, ", "))
+        }
+    }
+}
+
+func cmdDupes(navigator *kb.Navigator, args []string) {
+    fs := flag.NewFlagSet("dupes", flag.ExitOnError)
+    query := &kb.ListQuery{}
+    fs.StringVar(&query.Folder, "folder", "", "Only documents below this folder")
+    fs.Var((*stringsFlag)(&query.Tags), "tag", "Only documents carrying this tag (repeatable)")
+    fs.StringVar(&query.Glob, "glob", "", "Path pattern, e.g. projects/**/*.org")
+    threshold := fs.Float64("threshold", kb.DefaultDuplicateThreshold, "Similarity from which notes and sections are near-duplicates (0 to 1)")
+    diff := fs.Bool("diff", false, "Show a diff of each pair of near-duplicate notes")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt dupes [flags]\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+
+    list, err := query.Options()
+    if err != nil {
+        fail(err)
+    }
+    report, err := navigator.FindDuplicates(kb.DuplicateOptions{Filter: list.Filter, Threshold: *threshold})
+    if err != nil {
+        fail(err)
+    }
+    if len(report.Exact)+len(report.Near)+len(report.Sections) == 0 {
+        fmt.Println("No duplicates found")
+        return
+    }
+
+    if len(report.Exact) > 0 {
+        fmt.Println("Exact duplicates:")
+        for _, group := range report.Exact {
+            fmt.Printf("  %s (%d bytes)\n", strings.Join(group.Paths, ", "), group.Size)
+        }
+    }
+    if len(report.Near) > 0 {
+        fmt.Println("Near duplicates:")
+        for _, pair := range report.Near {
+            fmt.Printf("  %3.0f%%  %s ~ %s\n", pair.Similarity*100, pair.Paths[0], pair.Paths[1])
+            for _, d := range pair.Differences {
+                header := d.Header
+                if header == "" {
+                    header = "(before the first heading)"
+                }
+                if d.Only != "" {
+                    fmt.Printf("        only in %s: %s\n", d.Only, header)
+                } else {
+                    fmt.Printf("        changed: %s (%.0f%%)\n", header, d.Similarity*100)
+                }
+            }
+            if *diff {
+                printDocumentDiff(navigator, pair.Paths[0], pair.Paths[1])
+            }
+        }
+    }
+    if len(report.Sections) > 0 {
+        fmt.Println("Duplicated sections:")
+        for _, pair := range report.Sections {
+            a, b := pair.Sections[0], pair.Sections[1]
+            fmt.Printf("  %3.0f%%  %s:%d %s ~ %s:%d %s\n", pair.Similarity*100, a.Path, a.Line, a.Header, b.Path, b.Line, b.Header)
+        }
+    }
+}
+
+// printDocumentDiff shows the unified diff between two documents
+func printDocumentDiff(navigator *kb.Navigator, oldPath, newPath string) {
+    oldDoc, err := navigator.ReadDocument(oldPath)
+    if err != nil {
+        fail(err)
+    }
+    newDoc, err := navigator.ReadDocument(newPath)
+    if err != nil {
+        fail(err)
+    }
+    fmt.Println(kb.UnifiedDiff(oldPath, newPath, oldDoc.Content, newDoc.Content))
+}
+
+func cmdGrep(navigator *kb.Navigator, args []string) {
+    fs := flag.NewFlagSet("grep", flag.ExitOnError)
+    opts := kb.GrepOptions{}
+    fs.BoolVar(&opts.Regexp, "regex", false, "The pattern is a regular expression (RE2 syntax)")
+    fs.BoolVar(&opts.IgnoreCase, "i", false, "Ignore case")
+    fs.BoolVar(&opts.WholeWord, "w", false, "Match whole words only")
+    fs.Var((*stringsFlag)(&opts.Include), "include", "Only paths matching this glob (repeatable)")
+    fs.Var((*stringsFlag)(&opts.Exclude), "exclude", "Skip paths matching this glob (repeatable)")
+    fs.StringVar(&opts.Filter.Folder, "folder", "", "Only documents below this folder")
+    fs.IntVar(&opts.Before, "B", 0, "Lines of context before each match")
+    fs.IntVar(&opts.After, "A", 0, "Lines of context after each match")
+    contextLines := fs.Int("C", 0, "Lines of context around each match")
+    fs.IntVar(&opts.MaxCount, "max-count", kb.DefaultGrepMaxCount, "Stop after this many matching lines")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt grep [flags] <pattern>\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if fs.NArg() != 1 {
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+    opts.Pattern = fs.Arg(0)
+    // -C sets the context on both sides, unless -B or -A is given
+    set := map[string]bool{}
+    fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+    if !set["B"] {
+        opts.Before = *contextLines
+    }
+    if !set["A"] {
+        opts.After = *contextLines
+    }
+    marker := kb.MarkPlain
+    if stat, err := os.Stdout.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+        marker = kb.MarkANSI
+    }
+
+    // Lines are printed as grep does: path:line:text for matches and
+    // path-line-text for context, with -- between separate groups
+    out := bufio.NewWriter(os.Stdout)
+    defer out.Flush()
+    lastPath, lastLine := "", 0
+    var pending []string // context after the last match, not printed yet
+    flushAfter := func(until int) {
+        for i, line := range pending {
+            if n := lastLine + 1; n < until {
+                fmt.Fprintf(out, "%s-%d-%s\n", lastPath, n, line)
+                lastLine = n
+            } else {
+                pending = pending[i:]
+                return
+            }
+        }
+        pending = nil
+    }
+    summary, err := navigator.Grep(context.Background(), opts, func(m kb.GrepMatch) error {
+        first := m.Line - len(m.Before)
+        if m.Path == lastPath {
+            flushAfter(first)
+        } else {
+            flushAfter(math.MaxInt)
+        }
+        pending = nil
+        if lastPath != "" && (opts.Before > 0 || opts.After > 0) && (m.Path != lastPath || first > lastLine+1) {
+            fmt.Fprintln(out, "--")
+        }
+        for i, line := range m.Before {
+            if n := first + i; m.Path != lastPath || n > lastLine {
+                fmt.Fprintf(out, "%s-%d-%s\n", m.Path, n, line)
+            }
+        }
+        fmt.Fprintf(out, "%s:%d:%s\n", m.Path, m.Line, m.Marked(marker))
+        lastPath, lastLine, pending = m.Path, m.Line, m.After
+        return nil
+    })
+    if err != nil {
+        out.Flush()
+        fail(err)
+    }
+    flushAfter(math.MaxInt)
+    if summary.Truncated {
+        fmt.Fprintf(out, "\nStopped after %d matching lines (-max-count)\n", summary.Matches)
+    }
+    if summary.Matches == 0 {
+        out.Flush()
+        os.Exit(exitError)
+    }
+}
+
+func cmdFind(navigator *kb.Navigator, args []string) {
+    fs := flag.NewFlagSet("find", flag.ExitOnError)
+    limit := fs.Int("limit", kb.DefaultFindLimit, "Maximum notes")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt find [flags] <pattern>\n\n")
+        fs.PrintDefaults()
+    }
+    fs.Parse(args)
+    if fs.NArg() < 1 {
+        fs.Usage()
+        os.Exit(exitUsage)
+    }
+
+    found, err := navigator.FindNotes(strings.Join(fs.Args(), " "), *limit)
+    if err != nil {
+        fail(err)
+    }
+    if len(found) == 0 {
+        fmt.Println("No notes found")
+        os.Exit(exitError)
+    }
+    marker := kb.MarkPlain
+    if stat, err := os.Stdout.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+        marker = kb.MarkANSI
+    }
+    for _, note := range found {
+        if note.Field == "path" {
+            fmt.Println(note.Marked(marker))
+        } else {
+            fmt.Printf("%s  (%s: %s)\n", note.Path, note.Field, note.Marked(marker))
+        }
+    }
+}
+
+// printFragments shows snippet fragments with their line numbers
+func printFragments(indent string, fragments []kb.Fragment) {
+    for _, f := range fragments {
+        text := f.Marked
+        if text == "" {
+            text = f.Text
+        }
+        fmt.Printf("%s%5d: %s\n", indent, f.StartLine, strings.Join(strings.Fields(text), " "))
+    }
 }
 
 func cmdREPL(navigator *kb.Navigator) {
@@ -164,7 +657,7 @@ func cmdREPL(navigator *kb.Navigator) {
         case "exit", "quit":
             return
         case "list":
-            cmdList(navigator)
+            cmdList(navigator, args)
         case "read":
             cmdRead(navigator, args)
         case "search":
@@ -187,6 +680,103 @@ func cmdREPL(navigator *kb.Navigator) {
     }
 }
 
+func cmdMCPClient(configPath string, args []string) int {
+    fs := flag.NewFlagSet("mcp-client", flag.ExitOnError)
+    server := fs.String("server", "kbnavt-mcp", "Server command to spawn (stdio transport)")
+    url := fs.String("url", "", "Connect to a streamable HTTP endpoint instead of spawning a server")
+    script := fs.String("script", "", "Run commands and assertions from a file (- for stdin)")
+    rawJSON := fs.Bool("json", false, "Print results as JSON")
+    timeout := fs.Duration("timeout", 30*time.Second, "Timeout for each request")
+    quiet := fs.Bool("quiet", false, "Don't print server notifications")
+    fs.Usage = func() {
+        fmt.Fprintf(os.Stderr, "Usage: kbnavt mcp-client [flags] [command...]\n\n")
+        fs.PrintDefaults()
+        fmt.Fprintf(os.Stderr, "\n%s\n", mcpclient.ShellHelp)
+    }
+    fs.Parse(args)
+
+    var client *mcpclient.Client
+    if *url != "" {
+        client = mcpclient.NewHTTPClient(*url)
+    } else {
+        parts := strings.Fields(*server)
+        if len(parts) == 0 {
+            fmt.Fprintf(os.Stderr, "Error: empty -server command\n")
+            return 1
+        }
+        // Hand our -config down to a spawned server unless it has its own
+        if configPath != "" && !strings.Contains(*server, "-config") {
+            parts = append(parts, "-config", configPath)
+        }
+        var err error
+        if client, err = mcpclient.NewStdioClient(parts[0], parts[1:]...); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            return 1
+        }
+    }
+    defer client.Close()
+
+    if !*quiet {
+        client.OnNotification = func(method string, params json.RawMessage) {
+            fmt.Fprintf(os.Stderr, "<- %s %s\n", method, params)
+        }
+    }
+
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+    defer stop()
+
+    initCtx, cancel := context.WithTimeout(ctx, *timeout)
+    info, err := client.Initialize(initCtx, "kbnavt-mcp-client", "1.0.0")
+    cancel()
+    if err != nil {
+        fmt.Fprintf(os.Stderr, "Error: initialize failed: %v\n", err)
+        return 1
+    }
+    fmt.Fprintf(os.Stderr, "Connected to %s %s (protocol %s)\n",
+        info.ServerInfo.Name, info.ServerInfo.Version, info.ProtocolVersion)
+
+    shell := mcpclient.NewShell(client, os.Stdout)
+    shell.RawJSON = *rawJSON
+    shell.Timeout = *timeout
+
+    switch {
+    case *script != "":
+        in := os.Stdin
+        if *script != "-" {
+            f, err := os.Open(*script)
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+                return 1
+            }
+            defer f.Close()
+            in = f
+        }
+        if err := shell.RunScript(ctx, in); err != nil {
+            fmt.Fprintf(os.Stderr, "FAIL %s: %v\n", *script, err)
+            return 1
+        }
+        fmt.Fprintf(os.Stderr, "PASS %s\n", *script)
+
+    case fs.NArg() > 0:
+        if err := shell.ExecArgs(ctx, fs.Args()); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            return 1
+        }
+        // A failed request or an isError result fails the command too
+        if shell.Failed() {
+            return exitError
+        }
+
+    default:
+        fmt.Println("Type help for commands, exit to quit")
+        if err := shell.Interact(ctx, os.Stdin); err != nil {
+            fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+            return 1
+        }
+    }
+    return 0
+}
+
 func printHeaders(headers []kb.Header) {
     if len(headers) == 0 {
         fmt.Println("No headers found")
@@ -206,20 +796,36 @@ Usage:
   kbnavt [flags] <command> [args...]
 
 Commands:
-  list                    List all documents
+  list [flags]            List documents (see list -h for filters)
   read <path> [section]   Read document or section
-  search <query>          Search documents
+  search [flags] <query>  Search documents (-saved <name> runs a saved search)
+  suggest <query>         Corrections and completions for a query
+  related <path>          Notes related to a document
+  dupes [flags]           Exact and near-duplicate notes and sections
+  grep [flags] <pattern>  Lines matching a literal or regular expression
+  find <pattern>          Notes by a fuzzy match on paths, titles and aliases
   repl                    Interactive REPL
+  mcp-client [command]    Drive an MCP server (see mcp-client -h)
 
 Flags:
   -config string         Path to config file
 
 Examples:
   kbnavt list
+  kbnavt list -folder projects -format org -sort modified -order desc -limit 20
   kbnavt read notes/2025/daily.org
   kbnavt search "golang tips"
+  kbnavt search -fuzzy "kuberntes upgrade"
+  kbnavt search -saved oncall -since -7d
+  kbnavt suggest "postgress vacu"
+  kbnavt related -limit 5 ops/deploy.md
+  kbnavt dupes -folder meetings -threshold 0.7
+  kbnavt grep -C 2 TICKET-1234
+  kbnavt find dep rb
+  kbnavt grep -regex -include "**/*.org" "^port: \d+"
   kbnavt repl
-`)
+  kbnavt mcp-client call read_document path=notes/2025/daily.org
+  kbnavt mcp-client -script testdata/smoke.mcp`)
 }
 
 func parseLogLevel(level string) slog.Level {
@@ -1,13 +1,13 @@
 package main
 
 import (
-    "bufio"
     "context"
-    "encoding/json"
     "flag"
     "fmt"
     "log/slog"
     "os"
+    "os/signal"
+    "syscall"
 
     "kbnavt/internal/config"
     "kbnavt/internal/mcp"
@@ -36,9 +36,30 @@ func main() {
         logger.Error("Failed to initialize navigator", "error", err)
         os.Exit(1)
     }
+    navigator.SetMaxSize(cfg.KB.MaxSize)
+    if err := navigator.SetSearchMode(kb.SearchMode(cfg.Search.Mode), cfg.Search.IndexDir); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    if err := navigator.SetAnalysis(cfg.SearchAnalysis()); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    if err := navigator.SetSynonyms(cfg.Search.Synonyms.File, cfg.Search.Synonyms.Rules); err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    navigator.SetSavedSearches(cfg.Search.SavedSearches)
+    semantic, err := cfg.SearchSemantic()
+    if err != nil {
+        logger.Error("Invalid search configuration", "error", err)
+        os.Exit(1)
+    }
+    navigator.SetSemantic(semantic)
+    defer navigator.Close()
 
     // Create MCP server
-    mcpServer := mcp.NewMCPServer(navigator, logger)
+    mcpServer := mcp.NewMCPServer(navigator, cfg, logger)
 
     logger.Info("KBNavt MCP Server started", "transport", cfg.MCP.Transport)
 
@@ -47,32 +68,11 @@ func main() {
 }
 
 func runStdioServer(mcpServer *mcp.MCPServer, logger *slog.Logger) {
-    scanner := bufio.NewScanner(os.Stdin)
-
-    for scanner.Scan() {
-        line := scanner.Bytes()
-
-        // Handle JSON-RPC request
-        response, err := mcpServer.HandleRequest(context.Background(), line)
-
-        var respBytes []byte
-        if err != nil {
-            respBytes, _ = json.Marshal(map[string]interface{}{
-                "error": map[string]interface{}{
-                    "code":    -32603,
-                    "message": err.Error(),
-                },
-            })
-        } else {
-            respBytes, _ = json.Marshal(map[string]interface{}{
-                "result": response,
-            })
-        }
-
-        fmt.Println(string(respBytes))
-    }
+    // In-flight requests are cancelled on SIGINT/SIGTERM
+    ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+    defer stop()
 
-    if err := scanner.Err(); err != nil {
+    if err := mcpServer.Serve(ctx, os.Stdin, os.Stdout); err != nil {
         logger.Error("Scanner error", "error", err)
     }
 }
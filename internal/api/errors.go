@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"kbnavt/pkg/kb"
+)
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// problemStatus maps navigator error codes to HTTP status codes
+var problemStatus = map[string]int{
+	"forbidden_path":     http.StatusForbidden,
+	"not_found":          http.StatusNotFound,
+	"section_not_found":  http.StatusNotFound,
+	"too_large":          http.StatusRequestEntityTooLarge,
+	"unsupported_format": http.StatusUnsupportedMediaType,
+	"invalid":            http.StatusUnprocessableEntity,
+	"conflict":           http.StatusConflict,
+}
+
+// problem writes err as application/problem+json, choosing the status from
+// the kind of error; unknown errors become 500.
+func problem(c echo.Context, err error) error {
+	code := kb.ErrorCode(err)
+	status, ok := problemStatus[code]
+	if !ok {
+		status, code = http.StatusInternalServerError, "internal"
+	}
+	return writeProblem(c, status, code, err.Error())
+}
+
+// badRequest writes a 400 problem for a malformed request
+func badRequest(c echo.Context, detail string) error {
+	return writeProblem(c, http.StatusBadRequest, "bad_request", detail)
+}
+
+func writeProblem(c echo.Context, status int, code, detail string) error {
+	c.Response().Header().Set(echo.HeaderContentType, "application/problem+json")
+	return c.JSON(status, Problem{
+		Type:     "/errors/" + strings.ReplaceAll(code, "_", "-"),
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: c.Request().URL.RequestURI(),
+	})
+}
@@ -1,8 +1,12 @@
 package api
 
 import (
+    "encoding/json"
 	"fmt"
     "log/slog"
+    "net/url"
+    "strconv"
+    "strings"
 
     "github.com/labstack/echo/v4"
     "kbnavt/internal/config"
@@ -19,10 +23,20 @@ func SetupRoutes(e *echo.Echo, navigator *kb.Navigator, cfg *config.Config, logg
     api.Use(BasicAuthMiddleware(cfg.API.AuthUser, cfg.API.AuthPass, logger))
 
     api.GET("/documents", ListDocumentsHandler(navigator, logger))
-    api.GET("/documents/:path", ReadDocumentHandler(navigator, logger))
-    api.GET("/documents/:path/section/:section", ReadSectionHandler(navigator, logger))
+    // Nested paths; a section is selected with ?section= or a trailing /section/<name>,
+    // and a trailing /related lists related notes
+    api.GET("/documents/*", ReadDocumentHandler(navigator, logger))
+    api.GET("/tree", TreeHandler(navigator, logger))
+    api.GET("/folders", ListFolderHandler(navigator, logger))
+    api.GET("/folders/*", ListFolderHandler(navigator, logger))
     api.GET("/search", SearchHandler(navigator, logger))
+    api.GET("/search/suggest", SuggestHandler(navigator, logger))
+    api.GET("/grep", GrepHandler(navigator, logger))
+    api.GET("/find", FindHandler(navigator, logger))
+    api.GET("/saved-searches", ListSavedSearchesHandler(navigator, logger))
+    api.GET("/saved-searches/:name", SavedSearchHandler(navigator, logger))
     api.GET("/resources", ListResourcesHandler(navigator, logger))
+    api.GET("/admin/duplicates", DuplicatesHandler(navigator, logger))
 }
 
 // HealthHandler checks server health
@@ -30,26 +44,75 @@ func HealthHandler(c echo.Context) error {
     return c.JSON(200, map[string]string{"status": "ok"})
 }
 
-// ListDocumentsHandler lists all documents
+// ListDocumentsHandler lists documents, one page at a time
 func ListDocumentsHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
     return func(c echo.Context) error {
-        docs, err := navigator.ListDocuments()
+        query, err := listQuery(c, kb.DefaultPageSize)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        opts, err := query.Options()
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        page, err := navigator.ListDocumentsPage(opts)
         if err != nil {
             logger.Error("failed to list documents", "error", err)
-            return c.JSON(500, map[string]string{"error": err.Error()})
+            return problem(c, err)
+        }
+        return c.JSON(200, page)
+    }
+}
+
+// listQuery reads filtering, sorting and paging query parameters
+func listQuery(c echo.Context, defaultLimit int) (kb.ListQuery, error) {
+    query := kb.ListQuery{
+        Folder:  c.QueryParam("folder"),
+        Formats: c.QueryParams()["format"],
+        Since:   c.QueryParam("since"),
+        Until:   c.QueryParam("until"),
+        Glob:    c.QueryParam("glob"),
+        Tags:    c.QueryParams()["tag"],
+        Sort:    c.QueryParam("sort"),
+        Order:   c.QueryParam("order"),
+        Limit:   defaultLimit,
+        Cursor:  c.QueryParam("cursor"),
+    }
+    if l := c.QueryParam("limit"); l != "" {
+        limit, err := strconv.Atoi(l)
+        if err != nil {
+            return query, fmt.Errorf("limit must be an integer")
         }
-        return c.JSON(200, map[string]interface{}{"documents": docs})
+        query.Limit = limit
     }
+    return query, nil
 }
 
-// ReadDocumentHandler reads a specific document
+// ReadDocumentHandler reads a specific document, or one of its sections
 func ReadDocumentHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    readSection := ReadSectionHandler(navigator, logger)
+    related := RelatedDocumentsHandler(navigator, logger)
+
     return func(c echo.Context) error {
-        path := c.Param("path")
+        if path, ok := relatedParam(c, navigator); ok {
+            c.Set("path", path)
+            return related(c)
+        }
+
+        path, section, err := documentParams(c, navigator)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        if section != "" {
+            c.Set("path", path)
+            c.Set("section", section)
+            return readSection(c)
+        }
+
         doc, err := navigator.ReadDocument(path)
         if err != nil {
             logger.Error("failed to read document", "path", path, "error", err)
-            return c.JSON(404, map[string]string{"error": "document not found"})
+            return problem(c, err)
         }
         return c.JSON(200, doc)
     }
@@ -58,32 +121,383 @@ func ReadDocumentHandler(navigator *kb.Navigator, logger *slog.Logger) echo.Hand
 // ReadSectionHandler reads a section from a document
 func ReadSectionHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
     return func(c echo.Context) error {
-        path := c.Param("path")
-        section := c.Param("section")
+        path, _ := c.Get("path").(string)
+        section, _ := c.Get("section").(string)
         content, err := navigator.ReadSection(path, section)
         if err != nil {
             logger.Error("failed to read section", "path", path, "section", section, "error", err)
-            return c.JSON(404, map[string]string{"error": "section not found"})
+            return problem(c, err)
         }
         return c.JSON(200, map[string]string{"content": content})
     }
 }
 
+// RelatedDocumentsHandler lists the notes related to a document
+func RelatedDocumentsHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        path, _ := c.Get("path").(string)
+        limit := kb.DefaultRelatedLimit
+        if l := c.QueryParam("limit"); l != "" {
+            var err error
+            if limit, err = strconv.Atoi(l); err != nil {
+                return badRequest(c, "limit must be an integer")
+            }
+        }
+
+        related, err := navigator.RelatedDocuments(path, limit)
+        if err != nil {
+            logger.Error("failed to find related notes", "path", path, "error", err)
+            return problem(c, err)
+        }
+        return c.JSON(200, map[string]interface{}{"path": path, "related": related})
+    }
+}
+
+// TreeHandler returns the folder hierarchy with document counts and sizes
+func TreeHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        depth := 0
+        if d := c.QueryParam("depth"); d != "" {
+            n, err := strconv.Atoi(d)
+            if err != nil || n < 0 {
+                return badRequest(c, "depth must be a non-negative integer")
+            }
+            depth = n
+        }
+
+        tree, err := navigator.Tree(depth)
+        if err != nil {
+            logger.Error("failed to build tree", "error", err)
+            return problem(c, err)
+        }
+        return c.JSON(200, tree)
+    }
+}
+
+// ListFolderHandler lists the subfolders and documents of one directory
+func ListFolderHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        dir, err := wildcardParam(c)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+
+        listing, err := navigator.ListFolder(dir)
+        if err != nil {
+            logger.Error("failed to list folder", "dir", dir, "error", err)
+            return problem(c, err)
+        }
+        return c.JSON(200, listing)
+    }
+}
+
+// sectionSeparator introduces a section name in a document URL
+const sectionSeparator = "/section/"
+
+// relatedSuffix ends the URL of a document's related notes
+const relatedSuffix = "/related"
+
+// relatedParam returns the document path of a /documents/<path>/related
+// request, unless <path>/related is itself a document
+func relatedParam(c echo.Context, navigator *kb.Navigator) (string, bool) {
+    path, err := wildcardParam(c)
+    if err != nil || !strings.HasSuffix(path, relatedSuffix) || navigator.DocumentExists(path) {
+        return "", false
+    }
+    path = strings.TrimSuffix(path, relatedSuffix)
+    return path, path != ""
+}
+
+// documentParams extracts the document path and optional section from a
+// /documents/* request. The legacy /documents/<path>/section/<name> form is
+// recognised unless <path>/section/<name> is itself a document.
+func documentParams(c echo.Context, navigator *kb.Navigator) (string, string, error) {
+    raw, escaped := c.Param("*"), c.Request().URL.RawPath != ""
+
+    path, section := raw, ""
+    if i := strings.LastIndex(raw, sectionSeparator); i > 0 {
+        path, section = raw[:i], raw[i+len(sectionSeparator):]
+    }
+
+    var err error
+    if escaped {
+        if path, err = url.PathUnescape(path); err != nil {
+            return "", "", fmt.Errorf("invalid document path")
+        }
+        if section, err = url.PathUnescape(section); err != nil {
+            return "", "", fmt.Errorf("invalid section name")
+        }
+    }
+    if section != "" && navigator.DocumentExists(path+"/section/"+section) {
+        path, section = path+"/section/"+section, ""
+    }
+
+    if q := c.QueryParam("section"); q != "" {
+        section = q
+    }
+    if err := checkPathParam(path); err != nil {
+        return "", "", err
+    }
+    return path, section, nil
+}
+
+// wildcardParam returns the decoded value of a trailing * route segment
+func wildcardParam(c echo.Context) (string, error) {
+    value := c.Param("*")
+    if c.Request().URL.RawPath != "" {
+        decoded, err := url.PathUnescape(value)
+        if err != nil {
+            return "", fmt.Errorf("invalid path")
+        }
+        value = decoded
+    }
+    if value == "" {
+        return "", nil
+    }
+    return value, checkPathParam(value)
+}
+
+// checkPathParam rejects values that can never name a file in the KB.
+// Traversal is caught later by the navigator's security checks.
+func checkPathParam(path string) error {
+    if path == "" {
+        return fmt.Errorf("missing document path")
+    }
+    if strings.ContainsRune(path, 0) {
+        return fmt.Errorf("invalid path")
+    }
+    return nil
+}
+
 // SearchHandler searches documents
 func SearchHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
     return func(c echo.Context) error {
         query := c.QueryParam("q")
-        limit := 10
-        if l := c.QueryParam("limit"); l != "" {
-            fmt.Sscanf(l, "%d", &limit)
+        params, err := listQuery(c, 10)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        for name, value := range map[string]*bool{"group": &params.Group, "fuzzy": &params.Fuzzy, "typeahead": &params.Typeahead, "explain": &params.Explain, "keyword_only": &params.KeywordOnly} {
+            if v := c.QueryParam(name); v != "" {
+                if *value, err = strconv.ParseBool(v); err != nil {
+                    return badRequest(c, name+" must be true or false")
+                }
+            }
+        }
+        for name, value := range map[string]*int{"sections": &params.Sections, "snippet_size": &params.SnippetSize, "snippets": &params.Snippets, "facet_size": &params.FacetSize} {
+            if v := c.QueryParam(name); v != "" {
+                if *value, err = strconv.Atoi(v); err != nil {
+                    return badRequest(c, name+" must be an integer")
+                }
+            }
+        }
+        params.Marker = c.QueryParam("marker")
+        params.Facets = c.QueryParams()["facets"]
+        opts, err := params.SearchOptions()
+        if err != nil {
+            return badRequest(c, err.Error())
         }
 
-        results, err := navigator.SearchDocuments(query, limit)
+        page, err := navigator.Search(c.Request().Context(), query, opts, nil)
         if err != nil {
             logger.Error("search failed", "query", query, "error", err)
-            return c.JSON(500, map[string]string{"error": err.Error()})
+            return problem(c, err)
+        }
+        return c.JSON(200, page)
+    }
+}
+
+// SuggestHandler proposes corrections and completions for a search query
+func SuggestHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        query := c.QueryParam("q")
+        limit := 0
+        if l := c.QueryParam("limit"); l != "" {
+            var err error
+            if limit, err = strconv.Atoi(l); err != nil {
+                return badRequest(c, "limit must be an integer")
+            }
+        }
+
+        suggestions, err := navigator.Suggest(c.Request().Context(), query, limit)
+        if err != nil {
+            logger.Error("suggest failed", "query", query, "error", err)
+            return problem(c, err)
+        }
+        return c.JSON(200, suggestions)
+    }
+}
+
+// ListSavedSearchesHandler lists the saved searches
+func ListSavedSearchesHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        searches, err := navigator.SavedSearches()
+        if err != nil {
+            logger.Error("failed to load saved searches", "error", err)
+            return problem(c, err)
+        }
+        if searches == nil {
+            searches = []kb.SavedSearch{}
+        }
+        return c.JSON(200, map[string]interface{}{"searches": searches})
+    }
+}
+
+// SavedSearchHandler runs a saved search; cursor, limit and marker page
+// through its results
+func SavedSearchHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        name := c.Param("name")
+        paging, err := listQuery(c, 0)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        paging.Marker = c.QueryParam("marker")
+
+        search, page, err := navigator.RunSavedSearch(c.Request().Context(), name, paging)
+        if err != nil {
+            logger.Error("saved search failed", "name", name, "error", err)
+            return problem(c, err)
+        }
+        return c.JSON(200, map[string]interface{}{"search": search, "page": page})
+    }
+}
+
+// FindHandler finds notes by a fuzzy match on their names
+func FindHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        pattern := c.QueryParam("q")
+        limit := kb.DefaultFindLimit
+        if l := c.QueryParam("limit"); l != "" {
+            var err error
+            if limit, err = strconv.Atoi(l); err != nil {
+                return badRequest(c, "limit must be an integer")
+            }
+        }
+
+        found, err := navigator.FindNotes(pattern, limit)
+        if err != nil {
+            logger.Error("find failed", "pattern", pattern, "error", err)
+            return problem(c, err)
+        }
+        return c.JSON(200, map[string]interface{}{"notes": found})
+    }
+}
+
+// GrepHandler streams the lines matching a pattern as NDJSON: one match
+// per line, then a {"summary": ...} line
+func GrepHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        // Matches come in path order, over all documents at once
+        for _, name := range []string{"sort", "order", "cursor"} {
+            if c.QueryParam(name) != "" {
+                return badRequest(c, name+" is not supported by grep")
+            }
+        }
+        query, err := listQuery(c, kb.DefaultPageSize)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        list, err := query.Options()
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        opts := kb.GrepOptions{
+            Pattern: c.QueryParam("q"),
+            Include: c.QueryParams()["include"],
+            Exclude: c.QueryParams()["exclude"],
+            Filter:  list.Filter,
+        }
+        for name, value := range map[string]*bool{"regex": &opts.Regexp, "ignore_case": &opts.IgnoreCase, "word": &opts.WholeWord} {
+            if v := c.QueryParam(name); v != "" {
+                if *value, err = strconv.ParseBool(v); err != nil {
+                    return badRequest(c, name+" must be true or false")
+                }
+            }
+        }
+        // In order, so that before and after override context, and
+        // max_count overrides limit, its alias
+        params := []struct {
+            name   string
+            values []*int
+        }{
+            {"context", []*int{&opts.Before, &opts.After}},
+            {"before", []*int{&opts.Before}},
+            {"after", []*int{&opts.After}},
+            {"limit", []*int{&opts.MaxCount}},
+            {"max_count", []*int{&opts.MaxCount}},
+        }
+        for _, param := range params {
+            v := c.QueryParam(param.name)
+            if v == "" {
+                continue
+            }
+            n, err := strconv.Atoi(v)
+            if err != nil {
+                return badRequest(c, param.name+" must be an integer")
+            }
+            for _, value := range param.values {
+                *value = n
+            }
+        }
+
+        // Nothing is written until the first match, so that invalid
+        // patterns still get a problem response
+        res := c.Response()
+        enc := json.NewEncoder(res)
+        started := false
+        start := func() {
+            if !started {
+                res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+                res.WriteHeader(200)
+                started = true
+            }
+        }
+        summary, err := navigator.Grep(c.Request().Context(), opts, func(m kb.GrepMatch) error {
+            start()
+            if err := enc.Encode(m); err != nil {
+                return err
+            }
+            res.Flush()
+            return nil
+        })
+        if err != nil && !started {
+            logger.Error("grep failed", "pattern", opts.Pattern, "error", err)
+            return problem(c, err)
+        }
+        start()
+        if err != nil {
+            logger.Error("grep failed", "pattern", opts.Pattern, "error", err)
+            return enc.Encode(map[string]string{"error": err.Error()})
+        }
+        return enc.Encode(map[string]interface{}{"summary": summary})
+    }
+}
+
+// DuplicatesHandler reports exact and near-duplicate notes and sections
+func DuplicatesHandler(navigator *kb.Navigator, logger *slog.Logger) echo.HandlerFunc {
+    return func(c echo.Context) error {
+        query, err := listQuery(c, kb.DefaultPageSize)
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        list, err := query.Options()
+        if err != nil {
+            return badRequest(c, err.Error())
+        }
+        opts := kb.DuplicateOptions{Filter: list.Filter}
+        if t := c.QueryParam("threshold"); t != "" {
+            if opts.Threshold, err = strconv.ParseFloat(t, 64); err != nil {
+                return badRequest(c, "threshold must be a number")
+            }
+        }
+
+        report, err := navigator.FindDuplicates(opts)
+        if err != nil {
+            logger.Error("failed to find duplicates", "error", err)
+            return problem(c, err)
         }
-        return c.JSON(200, map[string]interface{}{"results": results})
+        return c.JSON(200, report)
     }
 }
 
@@ -93,7 +507,7 @@ func ListResourcesHandler(navigator *kb.Navigator, logger *slog.Logger) echo.Han
         resources, err := navigator.ListResources()
         if err != nil {
             logger.Error("failed to list resources", "error", err)
-            return c.JSON(500, map[string]string{"error": err.Error()})
+            return problem(c, err)
         }
         return c.JSON(200, map[string]interface{}{"resources": resources})
     }
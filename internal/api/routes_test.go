@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"kbnavt/internal/config"
+	"kbnavt/pkg/kb"
+)
+
+// newTestAPI serves a KB made of files, with the credentials user:pass
+func newTestAPI(t *testing.T, files map[string]string) *echo.Echo {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	navigator, err := kb.NewNavigator(dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { navigator.Close() })
+
+	cfg := &config.Config{}
+	cfg.API.AuthUser, cfg.API.AuthPass = "user", "pass"
+	e := echo.New()
+	SetupRoutes(e, navigator, cfg, logger)
+	return e
+}
+
+// get requests target and decodes the JSON response into v
+func get(t *testing.T, e *echo.Echo, target string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.SetBasicAuth("user", "pass")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if v != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s: invalid JSON response %q: %v", target, rec.Body.String(), err)
+		}
+	}
+	return rec
+}
+
+func TestDocumentRoutes(t *testing.T) {
+	e := newTestAPI(t, map[string]string{
+		"notes/2025/weekly review.md": "# Weekly review\nIntro.\n## Wins\nShipped search.\n## Risks\nNone.\n",
+		"notes/2025/weekly plan.md":   "# Weekly plan\nShip search and review the wins.\n",
+		"odd/section/Wins.md":         "# Not a section\n",
+	})
+
+	var doc struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+	var section struct {
+		Content string `json:"content"`
+	}
+
+	// Nested paths, escaped or not
+	for _, target := range []string{
+		"/documents/notes/2025/weekly%20review.md",
+		"/documents/notes%2F2025%2Fweekly%20review.md",
+	} {
+		if rec := get(t, e, target, &doc); rec.Code != 200 || !strings.Contains(doc.Content, "Shipped search") {
+			t.Errorf("%s: expected the document, got %d %s", target, rec.Code, rec.Body)
+		}
+	}
+
+	// A trailing /section/<name> or ?section= selects a section
+	for _, target := range []string{
+		"/documents/notes/2025/weekly%20review.md/section/Wins",
+		"/documents/notes/2025/weekly%20review.md?section=Wins",
+	} {
+		if rec := get(t, e, target, &section); rec.Code != 200 || !strings.Contains(section.Content, "Shipped search") || strings.Contains(section.Content, "None.") {
+			t.Errorf("%s: expected the Wins section, got %d %s", target, rec.Code, rec.Body)
+		}
+	}
+	if rec := get(t, e, "/documents/notes/2025/weekly%20review.md/section/Losses", nil); rec.Code != 404 {
+		t.Errorf("Expected a missing section to be 404, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A document whose path looks like a section is read as a document
+	if rec := get(t, e, "/documents/odd/section/Wins.md", &doc); rec.Code != 200 || !strings.Contains(doc.Content, "Not a section") {
+		t.Errorf("Expected odd/section/Wins.md, got %d %s", rec.Code, rec.Body)
+	}
+
+	// A trailing /related lists related notes
+	var related struct {
+		Path    string            `json:"path"`
+		Related []json.RawMessage `json:"related"`
+	}
+	if rec := get(t, e, "/documents/notes/2025/weekly%20review.md/related", &related); rec.Code != 200 || related.Path != "notes/2025/weekly review.md" || related.Related == nil {
+		t.Errorf("Expected related notes, got %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestDocumentRoutesRejectTraversal(t *testing.T) {
+	e := newTestAPI(t, map[string]string{"a.md": "# A\n"})
+
+	for _, target := range []string{
+		"/documents/..%2F..%2Fetc%2Fpasswd",
+		"/documents/notes/%2E%2E/%2E%2E/secret.md",
+		"/documents/..%2Fsecret.md/section/Intro",
+	} {
+		var p Problem
+		rec := get(t, e, target, &p)
+		if rec.Code != http.StatusForbidden || p.Status != http.StatusForbidden || p.Type != "/errors/forbidden-path" {
+			t.Errorf("%s: expected a 403 problem, got %d %s", target, rec.Code, rec.Body)
+		}
+		if ct := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(ct, "application/problem+json") {
+			t.Errorf("%s: expected application/problem+json, got %q", target, ct)
+		}
+	}
+}
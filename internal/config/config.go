@@ -1,10 +1,13 @@
 package config
 
 import (
+    "fmt"
     "log/slog"
     "os"
     "path/filepath"
 
+    "kbnavt/pkg/kb"
+
     "github.com/knadh/koanf/v2"
     "github.com/knadh/koanf/parsers/yaml"
     "github.com/knadh/koanf/providers/env"
@@ -18,6 +21,40 @@ type Config struct {
         MaxSize int64  `koanf:"max_size"`
     } `koanf:"kb"`
 
+    Search struct {
+        Mode     string `koanf:"mode"`      // "auto", "index" or "scan"
+        IndexDir string `koanf:"index_dir"` // on-disk index, relative to kb.base_dir; empty keeps it in memory
+
+        // Languages notes are detected among; the first is the fallback
+        Languages []SearchLanguage `koanf:"languages"`
+        Folding   *bool            `koanf:"folding"` // ё matches е, é matches e; default true
+
+        // Words and phrases queries also match, see kb.Synonyms
+        Synonyms struct {
+            File  string   `koanf:"file"`  // reread when it changes, relative to kb.base_dir
+            Rules []string `koanf:"rules"` // e.g. "k8s, kubernetes" or "okr => objectives"
+        } `koanf:"synonyms"`
+
+        // Named searches, see kb.SavedSearch; reread when the file changes
+        SavedSearches string `koanf:"saved_searches"` // relative to kb.base_dir
+
+        // Hybrid search: sections are also found by meaning, see kb.Semantic
+        Semantic struct {
+            Enabled       bool    `koanf:"enabled"`
+            Embedder      string  `koanf:"embedder"`       // "hash" (offline) or "http"
+            Dimensions    int     `koanf:"dimensions"`     // of the hash embedder
+            IndexDir      string  `koanf:"index_dir"`      // relative to kb.base_dir; empty keeps vectors in memory
+            MinSimilarity float64 `koanf:"min_similarity"` // depends on the embedder
+
+            // An OpenAI-compatible embeddings endpoint (OpenAI, Ollama, llama.cpp server...)
+            HTTP struct {
+                URL    string `koanf:"url"`
+                Model  string `koanf:"model"`
+                APIKey string `koanf:"api_key"`
+            } `koanf:"http"`
+        } `koanf:"semantic"`
+    } `koanf:"search"`
+
     API struct {
         Host     string `koanf:"host"`
         Port     int    `koanf:"port"`
@@ -26,7 +63,21 @@ type Config struct {
     } `koanf:"api"`
 
     MCP struct {
-        Transport string `koanf:"transport"` // "stdio", "sse"
+        Transport  string `koanf:"transport"`   // "stdio", "sse"
+        PromptsDir string `koanf:"prompts_dir"` // prompt templates, relative to kb.base_dir
+
+        // Write tools are disabled unless switched on one by one
+        Write struct {
+            Tools   map[string]bool `koanf:"tools"`   // e.g. create_note: true
+            Folders []string        `koanf:"folders"` // folders writes may touch; empty means the whole KB but hidden folders
+        } `koanf:"write"`
+
+        // Summaries produced through the client's model (sampling)
+        Summaries struct {
+            ChunkSize int    `koanf:"chunk_size"` // max characters sent per sampling request
+            Cache     bool   `koanf:"cache"`
+            CacheDir  string `koanf:"cache_dir"` // optional on-disk cache, relative to kb.base_dir
+        } `koanf:"summaries"`
     } `koanf:"mcp"`
 
     Logging struct {
@@ -34,6 +85,53 @@ type Config struct {
     } `koanf:"logging"`
 }
 
+// SearchLanguage configures the analysis of one language
+type SearchLanguage struct {
+    Code      string `koanf:"code"`      // en, ru, de, fr...
+    Stemming  *bool  `koanf:"stemming"`  // default true
+    Stopwords *bool  `koanf:"stopwords"` // default true
+}
+
+// SearchAnalysis is the configured text analysis
+func (c *Config) SearchAnalysis() kb.Analysis {
+    enabled := func(b *bool) bool { return b == nil || *b }
+
+    analysis := kb.Analysis{Folding: enabled(c.Search.Folding)}
+    for _, lang := range c.Search.Languages {
+        analysis.Languages = append(analysis.Languages, kb.Language{
+            Code:      lang.Code,
+            Stemming:  enabled(lang.Stemming),
+            Stopwords: enabled(lang.Stopwords),
+        })
+    }
+    if len(analysis.Languages) == 0 {
+        analysis.Languages = kb.DefaultAnalysis().Languages
+    }
+    return analysis
+}
+
+// SearchSemantic is the configured hybrid search; its embedder is nil when
+// it is disabled
+func (c *Config) SearchSemantic() (kb.Semantic, error) {
+    s := c.Search.Semantic
+    semantic := kb.Semantic{IndexDir: s.IndexDir, MinSimilarity: s.MinSimilarity}
+    if !s.Enabled {
+        return semantic, nil
+    }
+    switch s.Embedder {
+    case "", "hash":
+        semantic.Embedder = kb.NewHashEmbedder(s.Dimensions)
+    case "http":
+        if s.HTTP.URL == "" || s.HTTP.Model == "" {
+            return semantic, fmt.Errorf("the http embedder needs search.semantic.http.url and model")
+        }
+        semantic.Embedder = kb.NewHTTPEmbedder(s.HTTP.URL, s.HTTP.Model, s.HTTP.APIKey)
+    default:
+        return semantic, fmt.Errorf("unknown embedder: %s (use hash or http)", s.Embedder)
+    }
+    return semantic, nil
+}
+
 // Load loads configuration from file and environment
 func Load(configPath string) (*Config, error) {
     k := koanf.New(".")
@@ -59,6 +157,21 @@ func Load(configPath string) (*Config, error) {
     if cfg.KB.BaseDir == "" {
         cfg.KB.BaseDir = filepath.Join(os.Getenv("HOME"), ".kb")
     }
+    if cfg.Search.Mode == "" {
+        cfg.Search.Mode = "auto"
+    }
+    if cfg.Search.IndexDir != "" && !filepath.IsAbs(cfg.Search.IndexDir) {
+        cfg.Search.IndexDir = filepath.Join(cfg.KB.BaseDir, cfg.Search.IndexDir)
+    }
+    if cfg.Search.Synonyms.File == "" {
+        cfg.Search.Synonyms.File = ".kbnavt/synonyms.txt"
+    }
+    if cfg.Search.SavedSearches == "" {
+        cfg.Search.SavedSearches = ".kbnavt/saved-searches.yaml"
+    }
+    if cfg.Search.Semantic.IndexDir == "" {
+        cfg.Search.Semantic.IndexDir = ".kbnavt/vectors"
+    }
     if cfg.API.Host == "" {
         cfg.API.Host = "localhost"
     }
@@ -71,6 +184,12 @@ func Load(configPath string) (*Config, error) {
     if cfg.MCP.Transport == "" {
         cfg.MCP.Transport = "stdio"
     }
+    if cfg.MCP.PromptsDir == "" {
+        cfg.MCP.PromptsDir = ".kbnavt/prompts"
+    }
+    if cfg.MCP.Summaries.ChunkSize == 0 {
+        cfg.MCP.Summaries.ChunkSize = 8000
+    }
 
     return cfg, nil
 }
@@ -0,0 +1,220 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kbnavt/pkg/kb"
+)
+
+// defaultPromptBudget caps the characters of KB content embedded in a prompt
+const defaultPromptBudget = 20000
+
+// builtinPrompts are always available unless the KB overrides them
+var builtinPrompts = []map[string]interface{}{
+	{
+		"name":        "summarize_daily",
+		"description": "Summarize the notes touched, scheduled or closed in a date window",
+		"arguments": []promptArgument{
+			{Name: "date", Description: "First day of the window (YYYY-MM-DD), defaults to today"},
+			{Name: "days", Description: "Number of days in the window, defaults to 1"},
+			{Name: "budget", Description: "Maximum characters of note content to include"},
+		},
+	},
+	{
+		"name":        "find_related",
+		"description": "Find related notes about a topic",
+		"arguments": []promptArgument{
+			{Name: "topic", Description: "Topic to search for", Required: true},
+			{Name: "limit", Description: "Maximum notes to include, defaults to 5"},
+			{Name: "budget", Description: "Maximum characters of note content to include"},
+		},
+	},
+}
+
+// promptBuilder collects prompt messages while enforcing a content budget
+type promptBuilder struct {
+	messages []map[string]interface{}
+	budget   int
+	used     int
+	omitted  int
+}
+
+func (b *promptBuilder) text(text string) {
+	b.messages = append(b.messages, map[string]interface{}{
+		"role": "user",
+		"content": map[string]interface{}{
+			"type": "text",
+			"text": text,
+		},
+	})
+}
+
+// resource embeds text as a resource message; it reports false once the budget is spent
+func (b *promptBuilder) resource(uri, mimeType, text string) bool {
+	if b.used+len(text) > b.budget {
+		b.omitted++
+		return false
+	}
+	b.used += len(text)
+	b.messages = append(b.messages, map[string]interface{}{
+		"role": "user",
+		"content": map[string]interface{}{
+			"type": "resource",
+			"resource": map[string]interface{}{
+				"uri":      uri,
+				"mimeType": mimeType,
+				"text":     text,
+			},
+		},
+	})
+	return true
+}
+
+func (b *promptBuilder) result(description string) map[string]interface{} {
+	if b.omitted > 0 {
+		notes := "notes matched but were"
+		if b.omitted == 1 {
+			notes = "note matched but was"
+		}
+		b.text(fmt.Sprintf("%d more %s left out to stay within the %d character budget.", b.omitted, notes, b.budget))
+	}
+	return map[string]interface{}{
+		"description": description,
+		"messages":    b.messages,
+	}
+}
+
+func (s *MCPServer) summarizeDailyPrompt(ctx context.Context, args map[string]string) (interface{}, error) {
+	from := time.Now()
+	if v := args["date"]; v != "" {
+		var err error
+		if from, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return nil, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", v)
+		}
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+
+	days, err := intArgument(args, "days", 1)
+	if err != nil {
+		return nil, err
+	}
+	budget, err := intArgument(args, "budget", defaultPromptBudget)
+	if err != nil {
+		return nil, err
+	}
+	to := from.AddDate(0, 0, days)
+
+	nav := s.nav(ctx)
+	docs, err := nav.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	agenda, err := nav.Agenda(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	window := from.Format("2006-01-02")
+	if days > 1 {
+		window += " to " + to.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+
+	b := &promptBuilder{budget: budget}
+	b.text(fmt.Sprintf("Summarize my notes for %s. Focus on: 1) What I accomplished, 2) Open tasks, 3) Key insights. "+
+		"The notes I touched and the entries scheduled, due or closed in that period follow.", window))
+
+	embedded := map[string]bool{}
+	for _, doc := range docs {
+		if doc.UpdatedAt.Before(from) || !doc.UpdatedAt.Before(to) {
+			continue
+		}
+		full, err := nav.ReadDocument(doc.Path)
+		if err != nil {
+			s.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+		if b.resource(documentURI(doc.Path), mimeTypeFor(doc.Format), full.Content) {
+			embedded[doc.Path] = true
+		}
+	}
+
+	for _, entry := range agenda {
+		if embedded[entry.Path] {
+			continue
+		}
+		uri := documentURI(entry.Path) + "#" + entry.Title
+		b.resource(uri, "text/plain", fmt.Sprintf("%s (%s %s)\n%s", entry.Path, entry.Kind, entry.Date.Format("2006-01-02"), entry.Content))
+	}
+
+	if len(b.messages) == 1 {
+		b.text("No notes were touched or scheduled in this period.")
+	}
+
+	return b.result("Notes for " + window), nil
+}
+
+func (s *MCPServer) findRelatedPrompt(ctx context.Context, args map[string]string) (interface{}, error) {
+	topic := strings.TrimSpace(args["topic"])
+	if topic == "" {
+		return nil, fmt.Errorf("missing required argument: topic")
+	}
+	limit, err := intArgument(args, "limit", 5)
+	if err != nil {
+		return nil, err
+	}
+	budget, err := intArgument(args, "budget", defaultPromptBudget)
+	if err != nil {
+		return nil, err
+	}
+
+	nav := s.nav(ctx)
+	results, err := nav.SearchDocuments(topic, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &promptBuilder{budget: budget}
+	b.text(fmt.Sprintf("Find and summarize all my notes related to: %s. Include connections between them.", topic))
+
+	for _, result := range results {
+		doc, err := nav.ReadDocument(result.DocumentPath)
+		if err != nil {
+			s.logger.Debug("failed to read document", "path", result.DocumentPath, "error", err)
+			continue
+		}
+		b.resource(documentURI(doc.Path), mimeTypeFor(doc.Format), doc.Content)
+	}
+
+	if len(results) == 0 {
+		b.text("The search found no notes about this topic.")
+	}
+
+	return b.result("Notes related to " + topic), nil
+}
+
+func intArgument(args map[string]string, name string, def int) (int, error) {
+	v := strings.TrimSpace(args[name])
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: expected a positive integer", name, v)
+	}
+	return n, nil
+}
+
+func documentURI(path string) string {
+	return "kb://documents/" + strings.ReplaceAll(path, "\\", "/")
+}
+
+func mimeTypeFor(format kb.Format) string {
+	if format == kb.FormatMarkdown {
+		return "text/markdown"
+	}
+	return "text/plain"
+}
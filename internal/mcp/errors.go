@@ -0,0 +1,115 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"kbnavt/pkg/kb"
+)
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+
+	// MCP reserves -32002 for unknown resources
+	codeResourceNotFound = -32002
+)
+
+// kbErrorCodes maps navigator error codes to JSON-RPC error codes
+var kbErrorCodes = map[string]int{
+	"not_found":          codeResourceNotFound,
+	"section_not_found":  codeInvalidParams,
+	"forbidden_path":     codeInvalidParams,
+	"unsupported_format": codeInvalidParams,
+	"too_large":          codeInvalidParams,
+	"invalid":            codeInvalidParams,
+	"conflict":           codeInvalidParams,
+}
+
+// toRPCError converts a handler error into a JSON-RPC error. Navigator
+// errors keep their kind in data.code so that clients can tell them apart.
+func toRPCError(err error) *rpcError {
+	var rpcErr *rpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	if code := kb.ErrorCode(err); code != "" {
+		return &rpcError{
+			Code:    kbErrorCodes[code],
+			Message: err.Error(),
+			Data:    map[string]string{"code": code},
+		}
+	}
+	return &rpcError{Code: codeInternalError, Message: err.Error()}
+}
+
+// invalidParams builds a protocol-level error for malformed requests
+func invalidParams(format string, args ...interface{}) error {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// toolError wraps a failed tool call as a result the model can read
+func toolError(message string) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]interface{}{
+			{
+				"type": "text",
+				"text": message,
+			},
+		},
+		"isError": true,
+	}
+}
+
+// explainToolError turns a tool failure into an actionable message, adding
+// close matches for mistyped paths and sections.
+func (s *MCPServer) explainToolError(ctx context.Context, args map[string]interface{}, err error) string {
+	msg := err.Error()
+	nav := s.nav(ctx)
+
+	path, _ := args["path"].(string)
+	if path == "" {
+		return msg
+	}
+
+	if errors.Is(err, kb.ErrNotFound) && !nav.DocumentExists(path) {
+		msg += "."
+		if suggestions := nav.SuggestPaths(path, 3); len(suggestions) > 0 {
+			msg += fmt.Sprintf(" Did you mean %s?", joinOr(suggestions))
+		}
+		return msg + " Use list_documents or search_documents to find the right path."
+	}
+
+	section, _ := args["section"].(string)
+	if section == "" || !errors.Is(err, kb.ErrSectionNotFound) {
+		return msg
+	}
+	titles, terr := nav.SectionTitles(path)
+	if terr != nil || len(titles) == 0 {
+		return msg + ". The document has no sections; use read_document instead."
+	}
+	if close := kb.ClosestMatches(section, titles, 3); len(close) > 0 {
+		return msg + fmt.Sprintf(". Did you mean %s?", joinOr(close))
+	}
+	if len(titles) > 20 {
+		titles = append(titles[:20], "...")
+	}
+	return msg + ". Available sections: " + strings.Join(titles, ", ")
+}
+
+func joinOr(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = fmt.Sprintf("%q", item)
+	}
+	if len(quoted) == 1 {
+		return quoted[0]
+	}
+	return strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1]
+}
@@ -0,0 +1,412 @@
+package mcp
+
+import (
+	"fmt"
+	"strings"
+
+	"kbnavt/pkg/kb"
+)
+
+// listProperties are the filtering, sorting and paging arguments shared by
+// list_documents and search_documents.
+func listProperties(sortFields []string, defaultLimit int) map[string]interface{} {
+	return map[string]interface{}{
+		"folder": map[string]interface{}{
+			"type":        "string",
+			"description": "Only documents below this folder",
+		},
+		"format": stringOrList("Only these formats: org, markdown, text"),
+		"tag":    stringOrList("Only documents carrying all of these tags"),
+		"since": map[string]interface{}{
+			"type":        "string",
+			"description": "Only documents modified on or after this date (YYYY-MM-DD, RFC 3339, or a time ago such as -14d or -2w)",
+		},
+		"until": map[string]interface{}{
+			"type":        "string",
+			"description": "Only documents modified before this date",
+		},
+		"glob": map[string]interface{}{
+			"type":        "string",
+			"description": "Path pattern, e.g. projects/**/*.org; without a slash it matches file names",
+		},
+		"sort": map[string]interface{}{
+			"type": "string",
+			"enum": sortFields,
+		},
+		"order": map[string]interface{}{
+			"type": "string",
+			"enum": []string{"asc", "desc"},
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum results per page",
+			"default":     defaultLimit,
+		},
+		"cursor": map[string]interface{}{
+			"type":        "string",
+			"description": "next_cursor from the previous page",
+		},
+	}
+}
+
+// stringOrList describes an argument taking one string or several
+func stringOrList(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"description": description,
+		"oneOf": []interface{}{
+			map[string]interface{}{"type": "string"},
+			map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+}
+
+// listOptionsFrom reads the arguments described by listProperties
+func listOptionsFrom(args map[string]interface{}, defaultLimit int) (kb.ListOptions, error) {
+	return listQueryFrom(args, defaultLimit).Options()
+}
+
+// searchOptionsFrom reads the arguments described by searchProperties
+func searchOptionsFrom(args map[string]interface{}, defaultLimit int) (kb.SearchOptions, error) {
+	query := listQueryFrom(args, defaultLimit)
+	query.Group, _ = args["group"].(bool)
+	query.Fuzzy, _ = args["fuzzy"].(bool)
+	query.Typeahead, _ = args["typeahead"].(bool)
+	query.Explain, _ = args["explain"].(bool)
+	query.KeywordOnly, _ = args["keyword_only"].(bool)
+	query.Marker, _ = args["marker"].(string)
+	query.Facets = stringList(args["facets"])
+	for name, value := range map[string]*int{"sections": &query.Sections, "snippet_size": &query.SnippetSize, "snippets": &query.Snippets, "facet_size": &query.FacetSize} {
+		if n, ok := args[name].(float64); ok {
+			*value = int(n)
+		}
+	}
+	return query.SearchOptions()
+}
+
+func listQueryFrom(args map[string]interface{}, defaultLimit int) kb.ListQuery {
+	query := kb.ListQuery{Limit: defaultLimit}
+	query.Folder, _ = args["folder"].(string)
+	query.Since, _ = args["since"].(string)
+	query.Until, _ = args["until"].(string)
+	query.Glob, _ = args["glob"].(string)
+	query.Sort, _ = args["sort"].(string)
+	query.Order, _ = args["order"].(string)
+	query.Cursor, _ = args["cursor"].(string)
+	query.Formats = stringList(args["format"])
+	query.Tags = stringList(args["tag"])
+	if l, ok := args["limit"].(float64); ok {
+		query.Limit = int(l)
+	}
+	return query
+}
+
+// stringList accepts a string or an array of strings
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func formatDocumentPage(page *kb.DocumentPage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d documents", page.Total)
+	if len(page.Documents) < page.Total {
+		fmt.Fprintf(&b, ", showing %d", len(page.Documents))
+	}
+	b.WriteString("\n")
+	for _, doc := range page.Documents {
+		fmt.Fprintf(&b, "- %s (%s, %d bytes, modified %s)\n", doc.Path, doc.Format, doc.Size, doc.UpdatedAt.Format("2006-01-02 15:04"))
+	}
+	writeNextCursor(&b, page.NextCursor)
+	return b.String()
+}
+
+func formatSearchPage(query string, page *kb.SearchPage) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Found %d results for: %s\n", page.Total, query)
+	if page.Explain != nil {
+		writeExplanation(&b, page.Explain)
+	}
+	for _, r := range page.Results {
+		fmt.Fprintf(&b, "- %s (score %.2f)\n", r.Location(), r.Score)
+		writeFragments(&b, "  ", r.Fragments)
+		for _, section := range r.Sections {
+			fmt.Fprintf(&b, "  - %s (score %.2f)\n", section.Location(), section.Score)
+			writeFragments(&b, "    ", section.Fragments)
+		}
+	}
+	writeFacets(&b, page.Facets)
+	if page.DidYouMean != "" {
+		fmt.Fprintf(&b, "Hint: did you mean %q? Search again with it, or set fuzzy to tolerate typos.\n", page.DidYouMean)
+	}
+	writeNextCursor(&b, page.NextCursor)
+	return b.String()
+}
+
+func formatFoundNotes(pattern string, found []kb.FoundNote) string {
+	var b strings.Builder
+	if len(found) == 0 {
+		fmt.Fprintf(&b, "No notes match %q\n", pattern)
+		return b.String()
+	}
+	for _, note := range found {
+		fmt.Fprintf(&b, "- %s", note.Path)
+		if note.Field != "path" {
+			fmt.Fprintf(&b, " (%s: %s)", note.Field, note.Text)
+		} else if note.Title != "" {
+			fmt.Fprintf(&b, " (%s)", note.Title)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// defaultGrepMaxCount keeps grep results within what a model reads
+const defaultGrepMaxCount = 100
+
+// grepProperties are the arguments of grep_documents
+func grepProperties() map[string]interface{} {
+	list := listProperties(nil, 0)
+	props := map[string]interface{}{
+		"pattern": map[string]interface{}{
+			"type":        "string",
+			"description": "Text to find, or a regular expression (RE2 syntax) with regex",
+		},
+		"regex": map[string]interface{}{
+			"type":        "boolean",
+			"description": "The pattern is a regular expression",
+		},
+		"ignore_case": map[string]interface{}{
+			"type": "boolean",
+		},
+		"whole_word": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Only matches not preceded or followed by a letter, digit or underscore",
+		},
+		"include": stringOrList("Only paths matching one of these globs, e.g. **/*.org"),
+		"exclude": stringOrList("Skip paths matching one of these globs"),
+		"context": map[string]interface{}{
+			"type":        "integer",
+			"description": "Lines shown before and after each match",
+		},
+		"max_count": map[string]interface{}{
+			"type":        "integer",
+			"description": "Maximum matching lines",
+			"default":     defaultGrepMaxCount,
+		},
+	}
+	for _, name := range []string{"folder", "format", "tag", "since", "until"} {
+		props[name] = list[name]
+	}
+	return props
+}
+
+// grepOptionsFrom reads the arguments described by grepProperties
+func grepOptionsFrom(args map[string]interface{}) (kb.GrepOptions, error) {
+	list, err := listOptionsFrom(args, defaultGrepMaxCount)
+	if err != nil {
+		return kb.GrepOptions{}, err
+	}
+	opts := kb.GrepOptions{Filter: list.Filter, MaxCount: defaultGrepMaxCount}
+	opts.Pattern, _ = args["pattern"].(string)
+	if opts.Pattern == "" {
+		return opts, fmt.Errorf("missing pattern parameter")
+	}
+	opts.Regexp, _ = args["regex"].(bool)
+	opts.IgnoreCase, _ = args["ignore_case"].(bool)
+	opts.WholeWord, _ = args["whole_word"].(bool)
+	opts.Include = stringList(args["include"])
+	opts.Exclude = stringList(args["exclude"])
+	if n, ok := args["context"].(float64); ok {
+		opts.Before, opts.After = int(n), int(n)
+	}
+	if n, ok := args["max_count"].(float64); ok {
+		opts.MaxCount = int(n)
+	}
+	return opts, nil
+}
+
+// formatGrep lists matching lines as grep does: path:line: for matches,
+// path-line- for context lines, and -- between the matches when they have
+// context
+func formatGrep(opts kb.GrepOptions, matches []kb.GrepMatch, summary *kb.GrepSummary) string {
+	var b strings.Builder
+	if len(matches) == 0 {
+		fmt.Fprintf(&b, "No lines match %q\n", opts.Pattern)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d matching lines in %d documents:\n", summary.Matches, summary.Documents)
+	for i, m := range matches {
+		if i > 0 && (opts.Before > 0 || opts.After > 0) {
+			b.WriteString("--\n")
+		}
+		for j, line := range m.Before {
+			fmt.Fprintf(&b, "%s-%d-%s\n", m.Path, m.Line-len(m.Before)+j, line)
+		}
+		fmt.Fprintf(&b, "%s:%d:%s\n", m.Path, m.Line, m.Text)
+		for j, line := range m.After {
+			fmt.Fprintf(&b, "%s-%d-%s\n", m.Path, m.Line+1+j, line)
+		}
+	}
+	if summary.Truncated {
+		fmt.Fprintf(&b, "\nStopped after %d lines; narrow the pattern or raise max_count.\n", summary.Matches)
+	}
+	return b.String()
+}
+
+func formatRelated(path string, related []kb.RelatedDocument) string {
+	var b strings.Builder
+	if len(related) == 0 {
+		fmt.Fprintf(&b, "No notes related to %s\n", path)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Notes related to %s:\n", path)
+	for _, r := range related {
+		fmt.Fprintf(&b, "- %s (score %.2f: terms %.2f, tags %.2f, links %.2f)\n",
+			r.Path, r.Score, r.Signals.Terms, r.Signals.Tags, r.Signals.Links)
+		writeRelatedReasons(&b, "  ", r)
+	}
+	return b.String()
+}
+
+// writeRelatedReasons lists what a related note shares, one reason per line
+func writeRelatedReasons(b *strings.Builder, indent string, r kb.RelatedDocument) {
+	if r.Link != "" {
+		fmt.Fprintf(b, "%s%s\n", indent, r.Link)
+	}
+	if len(r.SharedTags) > 0 {
+		fmt.Fprintf(b, "%stags: %s\n", indent, strings.Join(r.SharedTags, ", "))
+	}
+	if len(r.SharedTerms) > 0 {
+		fmt.Fprintf(b, "%swords: %s\n", indent, strings.Join(r.SharedTerms, ", "))
+	}
+}
+
+// writeFragments lists snippet fragments with their line numbers, one per line
+func writeFragments(b *strings.Builder, indent string, fragments []kb.Fragment) {
+	for _, f := range fragments {
+		text := f.Marked
+		if text == "" {
+			text = f.Text
+		}
+		lines := fmt.Sprintf("line %d", f.StartLine)
+		if f.EndLine > f.StartLine {
+			lines = fmt.Sprintf("lines %d-%d", f.StartLine, f.EndLine)
+		}
+		fmt.Fprintf(b, "%s%s: %s\n", indent, lines, strings.Join(strings.Fields(text), " "))
+	}
+}
+
+// writeFacets lists the facet counts, one facet per line
+func writeFacets(b *strings.Builder, facets map[kb.Facet]*kb.FacetResult) {
+	for _, facet := range kb.Facets {
+		result, ok := facets[facet]
+		if !ok {
+			continue
+		}
+		var counts []string
+		for _, c := range result.Values {
+			counts = append(counts, fmt.Sprintf("%s (%d)", c.Value, c.Count))
+		}
+		if result.Other > 0 {
+			counts = append(counts, fmt.Sprintf("others (%d)", result.Other))
+		}
+		if result.Missing > 0 {
+			counts = append(counts, fmt.Sprintf("none (%d)", result.Missing))
+		}
+		fmt.Fprintf(b, "Facet %s: %s\n", facet, strings.Join(counts, ", "))
+	}
+}
+
+// writeExplanation shows how a query was interpreted
+func writeExplanation(b *strings.Builder, explain *kb.Explanation) {
+	fmt.Fprintf(b, "Query: %s\n", explain.Query)
+	for _, e := range explain.Expansions {
+		fmt.Fprintf(b, "Expanded %s: %s\n", e.Text, strings.Join(e.Synonyms, ", "))
+	}
+	if explain.Semantic != "" {
+		fmt.Fprintf(b, "Also by meaning: %s\n", explain.Semantic)
+	}
+}
+
+func writeNextCursor(b *strings.Builder, cursor string) {
+	if cursor != "" {
+		fmt.Fprintf(b, "More results: call again with cursor %q\n", cursor)
+	}
+}
+
+// searchProperties describes the search_documents arguments
+func searchProperties() map[string]interface{} {
+	props := listProperties([]string{"relevance", "path", "title", "modified", "size"}, 10)
+	props["query"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Search query.\n" + kb.QuerySyntax,
+	}
+	props["group"] = map[string]interface{}{
+		"type":        "boolean",
+		"description": "One result per document with its best sections, instead of one result per section",
+		"default":     false,
+	}
+	props["fuzzy"] = map[string]interface{}{
+		"type":        "boolean",
+		"description": "Let words match words a few typos away (one edit for up to 5 letters, two beyond); for a single word, write word~ or word~1",
+		"default":     false,
+	}
+	props["typeahead"] = map[string]interface{}{
+		"type":        "boolean",
+		"description": "Match the last word of the query as a prefix, as it is being typed",
+		"default":     false,
+	}
+	props["explain"] = map[string]interface{}{
+		"type":        "boolean",
+		"description": "Show how the query was interpreted, with the synonyms it was expanded with",
+		"default":     false,
+	}
+	props["keyword_only"] = map[string]interface{}{
+		"type":        "boolean",
+		"description": "Rank by keywords alone, without the sections found by meaning when semantic search is enabled",
+		"default":     false,
+	}
+	props["facets"] = map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string", "enum": kb.Facets},
+		"description": "Count all results by these facets, to narrow the search: folder (refine with folder), format, tag, year (refine with modified:YYYY) or todo",
+	}
+	props["facet_size"] = map[string]interface{}{
+		"type":        "integer",
+		"description": "Values listed per facet",
+		"default":     kb.DefaultFacetSize,
+	}
+	props["sections"] = map[string]interface{}{
+		"type":        "integer",
+		"description": "Sections listed per document when grouping",
+		"default":     kb.DefaultGroupSections,
+	}
+	props["snippet_size"] = map[string]interface{}{
+		"type":        "integer",
+		"description": "Characters per snippet fragment",
+		"default":     kb.DefaultSnippetSize,
+	}
+	props["snippets"] = map[string]interface{}{
+		"type":        "integer",
+		"description": "Snippet fragments per result",
+		"default":     kb.DefaultSnippetCount,
+	}
+	props["marker"] = map[string]interface{}{
+		"type":        "string",
+		"description": "How matches are marked in snippets",
+		"enum":        []string{"plain", "html", "ansi"},
+		"default":     "plain",
+	}
+	return props
+}
@@ -0,0 +1,194 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// loggerName identifies the server in notifications/message
+const loggerName = "kbnavt"
+
+// clientLogLevels maps MCP (syslog) levels onto slog levels
+var clientLogLevels = map[string]slog.Level{
+	"debug":     slog.LevelDebug,
+	"info":      slog.LevelInfo,
+	"notice":    slog.LevelInfo + 2,
+	"warning":   slog.LevelWarn,
+	"error":     slog.LevelError,
+	"critical":  slog.LevelError + 4,
+	"alert":     slog.LevelError + 8,
+	"emergency": slog.LevelError + 12,
+}
+
+// mcpLevel names a slog level the way MCP clients expect
+func mcpLevel(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < slog.LevelInfo+2:
+		return "info"
+	case level < slog.LevelWarn:
+		return "notice"
+	case level < slog.LevelError:
+		return "warning"
+	case level < slog.LevelError+4:
+		return "error"
+	case level < slog.LevelError+8:
+		return "critical"
+	case level < slog.LevelError+12:
+		return "alert"
+	default:
+		return "emergency"
+	}
+}
+
+// logHub fans log records out to the sessions that asked for them with
+// logging/setLevel.
+type logHub struct {
+	mu       sync.Mutex
+	sessions map[*session]slog.Level
+}
+
+func newLogHub() *logHub {
+	return &logHub{sessions: map[*session]slog.Level{}}
+}
+
+func (h *logHub) setLevel(sess *session, level slog.Level) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sessions[sess] = level
+}
+
+func (h *logHub) remove(sess *session) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.sessions, sess)
+}
+
+// enabled reports whether any session wants records at level
+func (h *logHub) enabled(level slog.Level) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, threshold := range h.sessions {
+		if level >= threshold {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *logHub) recipients(level slog.Level) []*session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []*session
+	for sess, threshold := range h.sessions {
+		if level >= threshold {
+			out = append(out, sess)
+		}
+	}
+	return out
+}
+
+// clientLogHandler passes records to the wrapped handler and forwards them
+// to subscribed clients as notifications/message.
+type clientLogHandler struct {
+	inner  slog.Handler
+	hub    *logHub
+	attrs  []slog.Attr
+	groups []string
+}
+
+func (h *clientLogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.inner.Enabled(ctx, level) || h.hub.enabled(level)
+}
+
+func (h *clientLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	if h.inner.Enabled(ctx, r.Level) {
+		err = h.inner.Handle(ctx, r)
+	}
+
+	recipients := h.hub.recipients(r.Level)
+	if len(recipients) == 0 {
+		return err
+	}
+
+	data := map[string]interface{}{"message": r.Message}
+	for _, a := range h.attrs {
+		addLogAttr(data, a)
+	}
+	prefix := strings.Join(h.groups, ".")
+	r.Attrs(func(a slog.Attr) bool {
+		if prefix != "" {
+			a.Key = prefix + "." + a.Key
+		}
+		addLogAttr(data, a)
+		return true
+	})
+
+	params := map[string]interface{}{
+		"level":  mcpLevel(r.Level),
+		"logger": loggerName,
+		"data":   data,
+	}
+	for _, sess := range recipients {
+		sess.notify("notifications/message", params)
+	}
+	return err
+}
+
+func (h *clientLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	prefix := strings.Join(h.groups, ".")
+	merged := append([]slog.Attr(nil), h.attrs...)
+	for _, a := range attrs {
+		if prefix != "" {
+			a.Key = prefix + "." + a.Key
+		}
+		merged = append(merged, a)
+	}
+	return &clientLogHandler{inner: h.inner.WithAttrs(attrs), hub: h.hub, attrs: merged, groups: h.groups}
+}
+
+func (h *clientLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := append(append([]string(nil), h.groups...), name)
+	return &clientLogHandler{inner: h.inner.WithGroup(name), hub: h.hub, attrs: h.attrs, groups: groups}
+}
+
+// addLogAttr stores an attribute as a JSON-friendly value
+func addLogAttr(data map[string]interface{}, a slog.Attr) {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindGroup:
+		group := map[string]interface{}{}
+		for _, ga := range v.Group() {
+			addLogAttr(group, ga)
+		}
+		data[a.Key] = group
+	case slog.KindString, slog.KindInt64, slog.KindUint64, slog.KindFloat64, slog.KindBool:
+		data[a.Key] = v.Any()
+	default:
+		data[a.Key] = v.String()
+	}
+}
+
+func (s *MCPServer) handleSetLevel(ctx context.Context, params interface{}) (interface{}, error) {
+	paramMap, _ := params.(map[string]interface{})
+	name, _ := paramMap["level"].(string)
+	level, ok := clientLogLevels[name]
+	if !ok {
+		return nil, invalidParams("invalid log level: %q", name)
+	}
+
+	sess := sessionFrom(ctx)
+	if sess == nil {
+		return nil, fmt.Errorf("logging/setLevel needs a client session")
+	}
+	s.logs.setLevel(sess, level)
+	return map[string]interface{}{}, nil
+}
@@ -0,0 +1,112 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// progressInterval throttles progress notifications for a single request
+const progressInterval = 200 * time.Millisecond
+
+// progressReporter sends notifications/progress for one request that
+// carried a progressToken. A nil reporter discards all reports.
+type progressReporter struct {
+	sess  *session
+	token json.RawMessage
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+type progressKey struct{}
+
+func withProgress(ctx context.Context, p *progressReporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, p)
+}
+
+// progressFrom returns the reporter for the request handling ctx, or nil
+func progressFrom(ctx context.Context) *progressReporter {
+	p, _ := ctx.Value(progressKey{}).(*progressReporter)
+	return p
+}
+
+// report tells the client how far a long operation got. Intermediate reports
+// are throttled; the final one (done == total) is always sent.
+func (p *progressReporter) report(done, total int, message string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	if done < total && now.Sub(p.last) < progressInterval {
+		p.mu.Unlock()
+		return
+	}
+	p.last = now
+	p.mu.Unlock()
+
+	params := map[string]interface{}{
+		"progressToken": p.token,
+		"progress":      done,
+	}
+	if total > 0 {
+		params["total"] = total
+	}
+	if message != "" {
+		params["message"] = message
+	}
+	p.sess.notify("notifications/progress", params)
+}
+
+// requestMeta extracts the progress token from a request's params._meta
+func requestMeta(data []byte) (progressToken json.RawMessage) {
+	var msg struct {
+		Params struct {
+			Meta struct {
+				ProgressToken json.RawMessage `json:"progressToken"`
+			} `json:"_meta"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil
+	}
+	return msg.Params.Meta.ProgressToken
+}
+
+// requestKey normalises a JSON-RPC id so that ids from requests and from
+// notifications/cancelled compare equal regardless of formatting.
+func requestKey(id json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil {
+		return string(id)
+	}
+	return buf.String()
+}
+
+// track registers the cancel function of an in-flight request
+func (sess *session) track(id json.RawMessage, cancel context.CancelFunc) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.inflight[requestKey(id)] = cancel
+}
+
+func (sess *session) untrack(id json.RawMessage) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	delete(sess.inflight, requestKey(id))
+}
+
+// cancel aborts an in-flight request; it reports whether one was found
+func (sess *session) cancel(id json.RawMessage) bool {
+	sess.mu.Lock()
+	cancel, ok := sess.inflight[requestKey(id)]
+	sess.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return ok
+}
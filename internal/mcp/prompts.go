@@ -0,0 +1,243 @@
+package mcp
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"kbnavt/pkg/kb"
+)
+
+// promptArgument describes one argument of a prompt template
+type promptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required"`
+}
+
+// promptTemplate is a prompt authored as a note in the KB
+type promptTemplate struct {
+	Name        string
+	Description string
+	Role        string
+	Arguments   []promptArgument
+	Source      string
+	body        *template.Template
+}
+
+// promptLibrary serves prompt templates from a folder and reloads them
+// whenever a file in that folder is added, removed or modified.
+type promptLibrary struct {
+	dir    string
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	fingerprint string
+	prompts     map[string]*promptTemplate
+}
+
+func newPromptLibrary(dir string, logger *slog.Logger) *promptLibrary {
+	return &promptLibrary{
+		dir:     dir,
+		logger:  logger,
+		prompts: map[string]*promptTemplate{},
+	}
+}
+
+// list returns all prompts sorted by name
+func (l *promptLibrary) list() []*promptTemplate {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh()
+
+	prompts := make([]*promptTemplate, 0, len(l.prompts))
+	for _, p := range l.prompts {
+		prompts = append(prompts, p)
+	}
+	sort.Slice(prompts, func(i, j int) bool { return prompts[i].Name < prompts[j].Name })
+	return prompts
+}
+
+// get returns a prompt by name
+func (l *promptLibrary) get(name string) (*promptTemplate, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refresh()
+
+	p, ok := l.prompts[name]
+	return p, ok
+}
+
+// refresh reloads the library if the folder contents changed. Callers hold l.mu.
+func (l *promptLibrary) refresh() bool {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil && !os.IsNotExist(err) {
+		l.logger.Warn("failed to read prompts folder", "dir", l.dir, "error", err)
+	}
+
+	var fp strings.Builder
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || !isPromptFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&fp, "%s:%d:%d;", entry.Name(), info.ModTime().UnixNano(), info.Size())
+		files = append(files, entry.Name())
+	}
+
+	if fp.String() == l.fingerprint {
+		return false
+	}
+
+	prompts := map[string]*promptTemplate{}
+	for _, name := range files {
+		p, err := loadPromptTemplate(filepath.Join(l.dir, name))
+		if err != nil {
+			l.logger.Warn("skipping invalid prompt", "file", name, "error", err)
+			continue
+		}
+		if _, dup := prompts[p.Name]; dup {
+			l.logger.Warn("duplicate prompt name", "name", p.Name, "file", name)
+			continue
+		}
+		prompts[p.Name] = p
+	}
+
+	l.prompts = prompts
+	l.fingerprint = fp.String()
+	l.logger.Debug("prompt library loaded", "dir", l.dir, "prompts", len(prompts))
+	return true
+}
+
+func isPromptFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".md", ".markdown", ".txt":
+		return true
+	}
+	return false
+}
+
+// loadPromptTemplate parses a prompt file: YAML front matter followed by a
+// Go text/template body.
+func loadPromptTemplate(file string) (*promptTemplate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	meta, body, err := kb.ParseFrontMatter(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	p := &promptTemplate{
+		Name:   strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)),
+		Role:   "user",
+		Source: file,
+	}
+	if v, ok := meta["name"].(string); ok && v != "" {
+		p.Name = v
+	}
+	if v, ok := meta["description"].(string); ok {
+		p.Description = v
+	}
+	if v, ok := meta["role"].(string); ok && v != "" {
+		if v != "user" && v != "assistant" {
+			return nil, fmt.Errorf("invalid role: %s", v)
+		}
+		p.Role = v
+	}
+
+	if raw, ok := meta["arguments"].([]interface{}); ok {
+		for _, item := range raw {
+			arg, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid argument definition: %v", item)
+			}
+			name, _ := arg["name"].(string)
+			if name == "" {
+				return nil, fmt.Errorf("argument without name")
+			}
+			desc, _ := arg["description"].(string)
+			required, _ := arg["required"].(bool)
+			p.Arguments = append(p.Arguments, promptArgument{
+				Name:        name,
+				Description: desc,
+				Required:    required,
+			})
+		}
+	}
+
+	p.body, err = template.New(p.Name).Option("missingkey=zero").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return p, nil
+}
+
+// render validates args and executes the template
+func (p *promptTemplate) render(args map[string]string) (map[string]interface{}, error) {
+	for _, arg := range p.Arguments {
+		if arg.Required && strings.TrimSpace(args[arg.Name]) == "" {
+			return nil, fmt.Errorf("missing required argument: %s", arg.Name)
+		}
+	}
+
+	data := map[string]string{}
+	for _, arg := range p.Arguments {
+		data[arg.Name] = ""
+	}
+	for k, v := range args {
+		data[k] = v
+	}
+
+	var text strings.Builder
+	if err := p.body.Execute(&text, data); err != nil {
+		return nil, fmt.Errorf("failed to render prompt %s: %w", p.Name, err)
+	}
+
+	return map[string]interface{}{
+		"description": p.Description,
+		"messages": []map[string]interface{}{
+			{
+				"role": p.Role,
+				"content": map[string]interface{}{
+					"type": "text",
+					"text": strings.TrimSpace(text.String()),
+				},
+			},
+		},
+	}, nil
+}
+
+// definition returns the prompts/list entry
+func (p *promptTemplate) definition() map[string]interface{} {
+	args := p.Arguments
+	if args == nil {
+		args = []promptArgument{}
+	}
+	return map[string]interface{}{
+		"name":        p.Name,
+		"description": p.Description,
+		"arguments":   args,
+	}
+}
+
+// promptArguments extracts string arguments from prompts/get params
+func promptArguments(paramMap map[string]interface{}) map[string]string {
+	args := map[string]string{}
+	raw, _ := paramMap["arguments"].(map[string]interface{})
+	for k, v := range raw {
+		args[k] = fmt.Sprint(v)
+	}
+	return args
+}
@@ -0,0 +1,72 @@
+package mcp
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const standupPrompt = `---
+description: Prepare a standup update
+arguments:
+  - name: team
+    description: Team name
+    required: true
+  - name: focus
+---
+Write a standup update for {{.team}}.{{if .focus}} Focus on {{.focus}}.{{end}}
+`
+
+func TestPromptLibrary(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "standup.md")
+	if err := os.WriteFile(file, []byte(standupPrompt), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lib := newPromptLibrary(dir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	prompts := lib.list()
+	if len(prompts) != 1 || prompts[0].Name != "standup" {
+		t.Fatalf("Expected one prompt named standup, got %v", prompts)
+	}
+	if len(prompts[0].Arguments) != 2 || !prompts[0].Arguments[0].Required {
+		t.Errorf("Unexpected arguments: %+v", prompts[0].Arguments)
+	}
+
+	p, _ := lib.get("standup")
+	if _, err := p.render(map[string]string{}); err == nil {
+		t.Error("Expected error for missing required argument")
+	}
+
+	result, err := p.render(map[string]string{"team": "infra", "focus": "deploys"})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	messages := result["messages"].([]map[string]interface{})
+	text := messages[0]["content"].(map[string]interface{})["text"]
+	if text != "Write a standup update for infra. Focus on deploys." {
+		t.Errorf("Unexpected prompt text: %q", text)
+	}
+
+	// Changing the file is picked up without restarting
+	updated := "---\nname: standup\n---\nShort update please.\n"
+	if err := os.WriteFile(file, []byte(updated), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := lib.get("standup")
+	if !ok {
+		t.Fatal("Expected prompt after reload")
+	}
+	if len(p.Arguments) != 0 {
+		t.Errorf("Expected reloaded prompt without arguments, got %+v", p.Arguments)
+	}
+}
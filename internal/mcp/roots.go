@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kbnavt/pkg/kb"
+)
+
+// rootsTimeout bounds how long requests wait for the client's roots
+const rootsTimeout = 5 * time.Second
+
+// nav returns the navigator for a request, narrowed to the client's roots
+func (s *MCPServer) nav(ctx context.Context) *kb.Navigator {
+	sess := sessionFrom(ctx)
+	if sess == nil {
+		return s.navigator
+	}
+
+	sess.waitRoots(ctx)
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.nav != nil {
+		return sess.nav
+	}
+	return s.navigator
+}
+
+// refreshRoots asks the client for its roots and narrows the session's view
+// of the KB to their intersection with the KB root.
+func (s *MCPServer) refreshRoots(ctx context.Context, sess *session) {
+	defer sess.markRootsReady()
+
+	ctx, cancel := context.WithTimeout(ctx, rootsTimeout)
+	defer cancel()
+
+	raw, err := sess.request(ctx, "roots/list", map[string]interface{}{})
+	if err != nil {
+		s.logger.Warn("failed to list client roots, keeping current scope", "error", err)
+		return
+	}
+
+	var result struct {
+		Roots []struct {
+			URI  string `json:"uri"`
+			Name string `json:"name"`
+		} `json:"roots"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		s.logger.Warn("invalid roots/list result", "error", err)
+		return
+	}
+
+	var uris []string
+	for _, root := range result.Roots {
+		uris = append(uris, root.URI)
+	}
+	folders := intersectRoots(s.navigator.BaseDir(), uris)
+	nav := s.navigator.WithScope(folders)
+
+	sess.mu.Lock()
+	sess.nav = nav
+	sess.mu.Unlock()
+
+	if nav.Scope() == nil {
+		s.logger.Info("client roots cover the whole KB", "roots", uris)
+	} else if len(nav.Scope()) == 0 {
+		s.logger.Warn("client roots do not overlap the KB, nothing is visible", "roots", uris)
+	} else {
+		s.logger.Info("scoped KB to client roots", "folders", nav.Scope())
+	}
+}
+
+// intersectRoots maps client root URIs onto folders of the KB. It returns nil
+// when a root contains the whole KB (or no roots were declared) and an empty
+// slice when no root overlaps it.
+func intersectRoots(baseDir string, uris []string) []string {
+	if len(uris) == 0 {
+		return nil
+	}
+
+	base := resolvePath(baseDir)
+	folders := []string{}
+	for _, uri := range uris {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		root := resolvePath(filepath.FromSlash(u.Path))
+
+		// The root lies inside the KB: expose just that folder
+		if rel, err := filepath.Rel(base, root); err == nil && !isOutside(rel) {
+			if rel == "." {
+				return nil
+			}
+			folders = append(folders, rel)
+			continue
+		}
+
+		// The KB lies inside the root: expose everything
+		if rel, err := filepath.Rel(root, base); err == nil && !isOutside(rel) {
+			return nil
+		}
+	}
+	return folders
+}
+
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolvePath makes a path absolute and resolves symlinks where possible
+func resolvePath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	if real, err := filepath.EvalSymlinks(p); err == nil {
+		p = real
+	}
+	return filepath.Clean(p)
+}
+
+// expectRoots makes requests wait until the client's roots are (re)loaded
+func (sess *session) expectRoots() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.rootsReady != nil {
+		select {
+		case <-sess.rootsReady:
+		default:
+			return // a refresh is already pending
+		}
+	}
+	sess.rootsReady = make(chan struct{})
+}
+
+func (sess *session) markRootsReady() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.rootsReady != nil {
+		select {
+		case <-sess.rootsReady:
+		default:
+			close(sess.rootsReady)
+		}
+	}
+}
+
+// waitRoots blocks until the pending roots/list completed, the request is
+// cancelled or rootsTimeout passed.
+func (sess *session) waitRoots(ctx context.Context) {
+	sess.mu.Lock()
+	ready := sess.rootsReady
+	sess.mu.Unlock()
+	if ready == nil {
+		return
+	}
+
+	timer := time.NewTimer(rootsTimeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
@@ -0,0 +1,76 @@
+package mcp
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIntersectRoots(t *testing.T) {
+	base := t.TempDir()
+
+	tests := []struct {
+		name string
+		uris []string
+		want []string
+	}{
+		{"No roots", nil, nil},
+		{"Root is the KB", []string{"file://" + base}, nil},
+		{"Root contains the KB", []string{"file://" + filepath.Dir(base)}, nil},
+		{"Root inside the KB", []string{"file://" + filepath.Join(base, "work", "projA")}, []string{"work/projA"}},
+		{"Disjoint root", []string{"file:///nonexistent/elsewhere"}, []string{}},
+		{"Non-file root", []string{"https://example.com/repo"}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := intersectRoots(base, tt.uris)
+			for i := range got {
+				got[i] = filepath.ToSlash(got[i])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRootsScopeSession(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"projA/notes.md": "# A\nalpha\n",
+		"projB/notes.md": "# B\nbeta\n",
+	})
+	base := s.navigator.BaseDir()
+
+	root := filepath.Join(base, "projA")
+	c := startFakeClient(t, s, map[string]interface{}{"roots": map[string]interface{}{"listChanged": true}})
+	c.handlers["roots/list"] = func(json.RawMessage) (interface{}, error) {
+		return map[string]interface{}{
+			"roots": []map[string]interface{}{{"uri": "file://" + root, "name": "project"}},
+		}, nil
+	}
+
+	resp := c.call("resources/list", nil)
+	if !strings.Contains(string(resp.Result), "projA/notes.md") || strings.Contains(string(resp.Result), "projB") {
+		t.Errorf("Expected only projA to be listed, got %s", resp.Result)
+	}
+
+	resp = c.call("tools/call", map[string]interface{}{
+		"name":      "read_document",
+		"arguments": map[string]interface{}{"path": "projB/notes.md"},
+	})
+	if !strings.Contains(string(resp.Result), `"isError":true`) {
+		t.Errorf("Expected reading outside the roots to fail, got %s", resp.Result)
+	}
+
+	// Switching roots is picked up after list_changed
+	root = filepath.Join(base, "projB")
+	c.send(rpcMessage{JSONRPC: "2.0", Method: "notifications/roots/list_changed"})
+
+	resp = c.call("resources/list", nil)
+	if !strings.Contains(string(resp.Result), "projB/notes.md") || strings.Contains(string(resp.Result), "projA") {
+		t.Errorf("Expected only projB after roots changed, got %s", resp.Result)
+	}
+}
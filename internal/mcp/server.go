@@ -3,32 +3,63 @@ package mcp
 import (
     "context"
     "encoding/json"
+    "errors"
     "fmt"
     "log/slog"
+    "path/filepath"
 	"strings"
 
+    "kbnavt/internal/config"
     "kbnavt/pkg/kb"
 )
 
 // MCPServer implements the Model Context Protocol
 type MCPServer struct {
     navigator *kb.Navigator
+    cfg       *config.Config
+    prompts   *promptLibrary
+    summaries *summaryCache
+    logs      *logHub
     logger    *slog.Logger
     version   string
 }
 
 // NewMCPServer creates a new MCP server
-func NewMCPServer(navigator *kb.Navigator, logger *slog.Logger) *MCPServer {
-    return &MCPServer{
+func NewMCPServer(navigator *kb.Navigator, cfg *config.Config, logger *slog.Logger) *MCPServer {
+    promptsDir := cfg.MCP.PromptsDir
+    if !filepath.IsAbs(promptsDir) {
+        promptsDir = filepath.Join(cfg.KB.BaseDir, promptsDir)
+    }
+
+    // Server logs also go to clients that subscribed with logging/setLevel
+    logs := newLogHub()
+    logger = slog.New(&clientLogHandler{inner: logger.Handler(), hub: logs})
+
+    s := &MCPServer{
         navigator: navigator,
+        cfg:       cfg,
+        prompts:   newPromptLibrary(promptsDir, logger),
+        logs:      logs,
         logger:    logger,
         version:   "1.0.0",
     }
+
+    if cfg.MCP.Summaries.Cache {
+        cacheDir := cfg.MCP.Summaries.CacheDir
+        if cacheDir != "" && !filepath.IsAbs(cacheDir) {
+            cacheDir = filepath.Join(cfg.KB.BaseDir, cacheDir)
+        }
+        s.summaries = newSummaryCache(cacheDir)
+    }
+
+    return s
 }
 
 // InitializeRequest handles the initialize request
 type InitializeRequest struct {
-    ClientInfo struct {
+    ProtocolVersion string                 `json:"protocolVersion"`
+    Capabilities    map[string]interface{} `json:"capabilities"`
+    ClientInfo      struct {
         Name    string `json:"name"`
         Version string `json:"version"`
     } `json:"clientInfo"`
@@ -36,33 +67,62 @@ type InitializeRequest struct {
 
 // InitializeResponse is the initialize response
 type InitializeResponse struct {
-    ProtocolVersion string `json:"protocolVersion"`
-    Capabilities    struct {
-        Tools     bool `json:"tools"`
-        Resources bool `json:"resources"`
-        Prompts   bool `json:"prompts"`
-    } `json:"capabilities"`
-    ServerInfo struct {
+    ProtocolVersion string             `json:"protocolVersion"`
+    Capabilities    ServerCapabilities `json:"capabilities"`
+    ServerInfo      struct {
         Name    string `json:"name"`
         Version string `json:"version"`
     } `json:"serverInfo"`
 }
 
+// ServerCapabilities advertises the features the server implements
+type ServerCapabilities struct {
+    Tools     *ListChangedCapability `json:"tools,omitempty"`
+    Resources *ResourcesCapability   `json:"resources,omitempty"`
+    Prompts   *ListChangedCapability `json:"prompts,omitempty"`
+    Logging   *struct{}              `json:"logging,omitempty"`
+}
+
+// ListChangedCapability is shared by the tools and prompts capabilities
+type ListChangedCapability struct {
+    ListChanged bool `json:"listChanged"`
+}
+
+// ResourcesCapability describes resource support
+type ResourcesCapability struct {
+    Subscribe   bool `json:"subscribe"`
+    ListChanged bool `json:"listChanged"`
+}
+
+// supportedProtocolVersions lists the MCP revisions the server speaks, newest first
+var supportedProtocolVersions = []string{"2025-06-18", "2025-03-26", "2024-11-05"}
+
+// negotiateProtocolVersion echoes the client's version when supported and
+// otherwise offers the newest version the server knows.
+func negotiateProtocolVersion(requested string) string {
+    for _, v := range supportedProtocolVersions {
+        if v == requested {
+            return v
+        }
+    }
+    return supportedProtocolVersions[0]
+}
+
 // HandleRequest routes incoming JSON-RPC requests
 func (s *MCPServer) HandleRequest(ctx context.Context, data []byte) (interface{}, error) {
     var msg map[string]interface{}
     if err := json.Unmarshal(data, &msg); err != nil {
-        return nil, fmt.Errorf("invalid JSON: %w", err)
+        return nil, &rpcError{Code: codeParseError, Message: "invalid JSON: " + err.Error()}
     }
 
     method, ok := msg["method"].(string)
     if !ok {
-        return nil, fmt.Errorf("missing method")
+        return nil, &rpcError{Code: codeInvalidRequest, Message: "missing method"}
     }
 
     switch method {
     case "initialize":
-        return s.handleInitialize(ctx)
+        return s.handleInitialize(ctx, msg["params"])
     case "resources/list":
         return s.handleListResources(ctx)
     case "resources/read":
@@ -75,22 +135,40 @@ func (s *MCPServer) HandleRequest(ctx context.Context, data []byte) (interface{}
         return s.handleListPrompts(ctx)
     case "prompts/get":
         return s.handleGetPrompt(ctx, msg["params"])
+    case "logging/setLevel":
+        return s.handleSetLevel(ctx, msg["params"])
+    case "ping":
+        return map[string]interface{}{}, nil
     default:
-        return nil, fmt.Errorf("unknown method: %s", method)
+        return nil, &rpcError{Code: codeMethodNotFound, Message: "unknown method: " + method}
     }
 }
 
-func (s *MCPServer) handleInitialize(ctx context.Context) (interface{}, error) {
+func (s *MCPServer) handleInitialize(ctx context.Context, params interface{}) (interface{}, error) {
+    var req InitializeRequest
+    if raw, err := json.Marshal(params); err == nil {
+        json.Unmarshal(raw, &req)
+    }
+    version := negotiateProtocolVersion(req.ProtocolVersion)
+    if sess := sessionFrom(ctx); sess != nil {
+        sess.setClientCapabilities(req.Capabilities)
+        sess.mu.Lock()
+        sess.protocol = version
+        sess.mu.Unlock()
+        if sess.supports("roots") {
+            sess.expectRoots()
+        }
+    }
+    s.logger.Info("client connected", "name", req.ClientInfo.Name, "version", req.ClientInfo.Version,
+        "requested_protocol", req.ProtocolVersion, "protocol", version)
+
     return InitializeResponse{
-        ProtocolVersion: "2024-11-05",
-        Capabilities: struct {
-            Tools     bool `json:"tools"`
-            Resources bool `json:"resources"`
-            Prompts   bool `json:"prompts"`
-        }{
-            Tools:     true,
-            Resources: true,
-            Prompts:   true,
+        ProtocolVersion: version,
+        Capabilities: ServerCapabilities{
+            Tools:     &ListChangedCapability{},
+            Resources: &ResourcesCapability{},
+            Prompts:   &ListChangedCapability{},
+            Logging:   &struct{}{},
         },
         ServerInfo: struct {
             Name    string `json:"name"`
@@ -103,11 +181,25 @@ func (s *MCPServer) handleInitialize(ctx context.Context) (interface{}, error) {
 }
 
 func (s *MCPServer) handleListResources(ctx context.Context) (interface{}, error) {
-    resources, err := s.navigator.ListResources()
+    resources, err := s.nav(ctx).ListResources()
     if err != nil {
         s.logger.Error("failed to list resources", "error", err)
         return nil, err
     }
+    // Saved searches read as their live results; a broken file doesn't
+    // hide the documents
+    searches, err := s.nav(ctx).SavedSearches()
+    if err != nil {
+        s.logger.Warn("failed to load saved searches", "error", err)
+    }
+    for _, search := range searches {
+        resources = append(resources, kb.Resource{
+            URI:         savedSearchURIPrefix + search.Name,
+            Name:        "Saved search: " + search.Name,
+            MimeType:    "text/plain",
+            Description: search.Description,
+        })
+    }
 
     return map[string]interface{}{
         "resources": resources,
@@ -122,16 +214,20 @@ func (s *MCPServer) handleReadResource(ctx context.Context, params interface{})
 
     uri, ok := paramMap["uri"].(string)
     if !ok {
-        return nil, fmt.Errorf("missing uri")
+        return nil, invalidParams("missing uri")
+    }
+
+    if name, ok := strings.CutPrefix(uri, savedSearchURIPrefix); ok {
+        return s.readSavedSearch(ctx, uri, name)
     }
 
     // Parse URI: kb://documents/path/to/doc
     docPath := extractDocPathFromURI(uri)
     if docPath == "" {
-        return nil, fmt.Errorf("invalid resource URI: %s", uri)
+        return nil, invalidParams("invalid resource URI: %s", uri)
     }
 
-    doc, err := s.navigator.ReadDocument(docPath)
+    doc, err := s.nav(ctx).ReadDocument(docPath)
     if err != nil {
         s.logger.Error("failed to read resource", "uri", uri, "error", err)
         return nil, err
@@ -140,8 +236,35 @@ func (s *MCPServer) handleReadResource(ctx context.Context, params interface{})
     return map[string]interface{}{
         "contents": []map[string]string{
             {
-                "type": "text",
-                "text": doc.Content,
+                "uri":      uri,
+                "mimeType": mimeTypeFor(doc.Format),
+                "text":     doc.Content,
+            },
+        },
+    }, nil
+}
+
+// savedSearchURIPrefix starts the URIs of saved searches, kb://saved/<name>
+const savedSearchURIPrefix = "kb://saved/"
+
+// readSavedSearch runs a saved search, returning its first page of results
+func (s *MCPServer) readSavedSearch(ctx context.Context, uri, name string) (interface{}, error) {
+    search, page, err := s.nav(ctx).RunSavedSearch(ctx, name, kb.ListQuery{})
+    if err != nil {
+        s.logger.Error("failed to run saved search", "uri", uri, "error", err)
+        return nil, err
+    }
+    query := search.Query
+    if query == "" {
+        query = search.Name
+    }
+
+    return map[string]interface{}{
+        "contents": []map[string]string{
+            {
+                "uri":      uri,
+                "mimeType": "text/plain",
+                "text":     formatSearchPage(query, page),
             },
         },
     }, nil
@@ -151,12 +274,13 @@ func (s *MCPServer) handleListTools(ctx context.Context) (interface{}, error) {
     tools := []map[string]interface{}{
         {
             "name":        "list_documents",
-            "description": "List all documents in the knowledge base",
+            "description": "List documents in the knowledge base, optionally filtered and sorted, one page at a time",
             "inputSchema": map[string]interface{}{
                 "type":       "object",
-                "properties": map[string]interface{}{},
+                "properties": listProperties([]string{"path", "title", "modified", "size"}, kb.DefaultPageSize),
                 "required":   []string{},
             },
+            "annotations": readOnlyAnnotations,
         },
         {
             "name":        "read_document",
@@ -171,6 +295,7 @@ func (s *MCPServer) handleListTools(ctx context.Context) (interface{}, error) {
                 },
                 "required": []string{"path"},
             },
+            "annotations": readOnlyAnnotations,
         },
         {
             "name":        "read_section",
@@ -189,28 +314,75 @@ func (s *MCPServer) handleListTools(ctx context.Context) (interface{}, error) {
                 },
                 "required": []string{"path", "section"},
             },
+            "annotations": readOnlyAnnotations,
         },
         {
             "name":        "search_documents",
-            "description": "Search documents by keyword",
+            "description": "Search the sections of documents with a query language (fields, phrases, wildcards, AND/OR/NOT, date and size ranges; see the query argument), optionally filtered; ranked by relevance (titles, headings and tags weigh more than body text). Results name the matching section, e.g. notes/infra.org › Incidents › 2026-03 outage; set group to get documents with their best sections. When nothing matches, a corrected query is suggested; set fuzzy to tolerate typos",
+            "inputSchema": map[string]interface{}{
+                "type":       "object",
+                "properties": searchProperties(),
+                "required":   []string{"query"},
+            },
+            "annotations": readOnlyAnnotations,
+        },
+        {
+            "name":        "find_note",
+            "description": "Find notes by name with a fuzzy match on their paths, titles, aliases and first headings, best first. Call it to get the path for read_document when you only know roughly what a note is called.",
+            "inputSchema": map[string]interface{}{
+                "type": "object",
+                "properties": map[string]interface{}{
+                    "pattern": map[string]interface{}{
+                        "type":        "string",
+                        "description": "Letters of the name in order, e.g. \"dep runbk\"; words may match anywhere",
+                    },
+                    "limit": map[string]interface{}{
+                        "type":        "integer",
+                        "description": "Maximum notes",
+                        "default":     kb.DefaultFindLimit,
+                    },
+                },
+                "required": []string{"pattern"},
+            },
+            "annotations": readOnlyAnnotations,
+        },
+        {
+            "name":        "grep_documents",
+            "description": "Find every line matching a literal text or regular expression, with its path, line number and context lines. Use it for exact identifiers such as TICKET-1234 or config values; use search_documents to find notes about a topic.",
+            "inputSchema": map[string]interface{}{
+                "type":       "object",
+                "properties": grepProperties(),
+                "required":   []string{"pattern"},
+            },
+            "annotations": readOnlyAnnotations,
+        },
+        {
+            "name":        "find_related_notes",
+            "description": "Find the notes most related to a document, by shared words (TF-IDF), shared tags and links between them, with the score of each signal",
             "inputSchema": map[string]interface{}{
                 "type": "object",
                 "properties": map[string]interface{}{
-                    "query": map[string]interface{}{
+                    "path": map[string]interface{}{
                         "type":        "string",
-                        "description": "Search query",
+                        "description": "Path to the document (relative to KB root)",
                     },
                     "limit": map[string]interface{}{
                         "type":        "integer",
-                        "description": "Maximum results",
-                        "default":     10,
+                        "description": "Maximum related notes",
+                        "default":     kb.DefaultRelatedLimit,
                     },
                 },
-                "required": []string{"query"},
+                "required": []string{"path"},
             },
+            "annotations": readOnlyAnnotations,
         },
     }
 
+    if sessionFrom(ctx).supports("sampling") {
+        tools = append(tools, summarizeToolDefinitions...)
+    }
+    tools = append(tools, s.enabledWriteTools()...)
+
     return map[string]interface{}{
         "tools": tools,
     }, nil
@@ -219,12 +391,12 @@ func (s *MCPServer) handleListTools(ctx context.Context) (interface{}, error) {
 func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (interface{}, error) {
     paramMap, ok := params.(map[string]interface{})
     if !ok {
-        return nil, fmt.Errorf("invalid params")
+        return nil, invalidParams("invalid params")
     }
 
     toolName, ok := paramMap["name"].(string)
     if !ok {
-        return nil, fmt.Errorf("missing tool name")
+        return nil, invalidParams("missing tool name")
     }
 
     args, ok := paramMap["arguments"].(map[string]interface{})
@@ -232,9 +404,28 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
         args = make(map[string]interface{})
     }
 
+    // Failures inside a tool are reported to the model as isError results;
+    // only protocol problems such as an unknown tool become JSON-RPC errors.
+    result, err := s.callTool(ctx, toolName, args)
+    if err != nil {
+        var rpcErr *rpcError
+        if errors.As(err, &rpcErr) {
+            return nil, err
+        }
+        s.logger.Debug("tool call failed", "tool", toolName, "error", err)
+        return toolError(s.explainToolError(ctx, args, err)), nil
+    }
+    return result, nil
+}
+
+func (s *MCPServer) callTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
     switch toolName {
     case "list_documents":
-        docs, err := s.navigator.ListDocuments()
+        opts, err := listOptionsFrom(args, kb.DefaultPageSize)
+        if err != nil {
+            return nil, err
+        }
+        page, err := s.nav(ctx).ListDocumentsPage(opts)
         if err != nil {
             return nil, err
         }
@@ -242,9 +433,13 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
             "content": []map[string]interface{}{
                 {
                     "type": "text",
-                    "text": fmt.Sprintf("Found %d documents", len(docs)),
+                    "text": formatDocumentPage(page),
                 },
             },
+            "_meta": map[string]interface{}{
+                "total":      page.Total,
+                "nextCursor": page.NextCursor,
+            },
         }, nil
 
     case "read_document":
@@ -252,7 +447,7 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
         if !ok {
             return nil, fmt.Errorf("missing path parameter")
         }
-        doc, err := s.navigator.ReadDocument(path)
+        doc, err := s.nav(ctx).ReadDocument(path)
         if err != nil {
             return nil, err
         }
@@ -263,6 +458,9 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
                     "text": doc.Content,
                 },
             },
+            "_meta": map[string]interface{}{
+                "hash": doc.Hash,
+            },
         }, nil
 
     case "read_section":
@@ -274,7 +472,7 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
         if !ok {
             return nil, fmt.Errorf("missing section parameter")
         }
-        content, err := s.navigator.ReadSection(path, section)
+        content, err := s.nav(ctx).ReadSection(path, section)
         if err != nil {
             return nil, err
         }
@@ -292,11 +490,50 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
         if !ok {
             return nil, fmt.Errorf("missing query parameter")
         }
-        limit := 10
+        opts, err := searchOptionsFrom(args, 10)
+        if err != nil {
+            return nil, err
+        }
+        progress := progressFrom(ctx)
+        page, err := s.nav(ctx).Search(ctx, query, opts, func(done, total int) {
+            progress.report(done, total, "searching documents")
+        })
+        if err != nil {
+            return nil, err
+        }
+        meta := map[string]interface{}{
+            "total":      page.Total,
+            "nextCursor": page.NextCursor,
+        }
+        if page.DidYouMean != "" {
+            meta["didYouMean"] = page.DidYouMean
+        }
+        if page.Explain != nil {
+            meta["explain"] = page.Explain
+        }
+        if page.Facets != nil {
+            meta["facets"] = page.Facets
+        }
+        return map[string]interface{}{
+            "content": []map[string]interface{}{
+                {
+                    "type": "text",
+                    "text": formatSearchPage(query, page),
+                },
+            },
+            "_meta": meta,
+        }, nil
+
+    case "find_note":
+        pattern, ok := args["pattern"].(string)
+        if !ok {
+            return nil, fmt.Errorf("missing pattern parameter")
+        }
+        limit := kb.DefaultFindLimit
         if l, ok := args["limit"].(float64); ok {
             limit = int(l)
         }
-        results, err := s.navigator.SearchDocuments(query, limit)
+        found, err := s.nav(ctx).FindNotes(pattern, limit)
         if err != nil {
             return nil, err
         }
@@ -304,35 +541,93 @@ func (s *MCPServer) handleCallTool(ctx context.Context, params interface{}) (int
             "content": []map[string]interface{}{
                 {
                     "type": "text",
-                    "text": fmt.Sprintf("Found %d results for: %s", len(results), query),
+                    "text": formatFoundNotes(pattern, found),
                 },
             },
+            "_meta": map[string]interface{}{
+                "notes": found,
+            },
         }, nil
 
+    case "grep_documents":
+        opts, err := grepOptionsFrom(args)
+        if err != nil {
+            return nil, err
+        }
+        var matches []kb.GrepMatch
+        summary, err := s.nav(ctx).Grep(ctx, opts, func(m kb.GrepMatch) error {
+            matches = append(matches, m)
+            return nil
+        })
+        if err != nil {
+            return nil, err
+        }
+        return map[string]interface{}{
+            "content": []map[string]interface{}{
+                {
+                    "type": "text",
+                    "text": formatGrep(opts, matches, summary),
+                },
+            },
+            "_meta": map[string]interface{}{
+                "summary": summary,
+            },
+        }, nil
+
+    case "find_related_notes":
+        path, ok := args["path"].(string)
+        if !ok {
+            return nil, fmt.Errorf("missing path parameter")
+        }
+        limit := kb.DefaultRelatedLimit
+        if l, ok := args["limit"].(float64); ok {
+            limit = int(l)
+        }
+        related, err := s.nav(ctx).RelatedDocuments(path, limit)
+        if err != nil {
+            return nil, err
+        }
+        return map[string]interface{}{
+            "content": []map[string]interface{}{
+                {
+                    "type": "text",
+                    "text": formatRelated(path, related),
+                },
+            },
+            "_meta": map[string]interface{}{
+                "related": related,
+            },
+        }, nil
+
+    case "summarize_document", "summarize_folder":
+        return s.callSummarizeTool(ctx, toolName, args)
+
     default:
-        return nil, fmt.Errorf("unknown tool: %s", toolName)
+        if isWriteTool(toolName) && s.cfg.MCP.Write.Tools[toolName] {
+            return s.callWriteTool(ctx, toolName, args)
+        }
+        return nil, invalidParams("unknown tool: %s", toolName)
     }
 }
 
 func (s *MCPServer) handleListPrompts(ctx context.Context) (interface{}, error) {
-    prompts := []map[string]interface{}{
-        {
-            "name":        "summarize_daily",
-            "description": "Summarize today's notes",
-            "arguments": []map[string]interface{}{},
-        },
-        {
-            "name":        "find_related",
-            "description": "Find related notes about a topic",
-            "arguments": []map[string]interface{}{
-                {
-                    "name":        "topic",
-                    "description": "Topic to search for",
-                    "required":    true,
-                },
-            },
-        },
+    prompts := make([]map[string]interface{}, len(builtinPrompts))
+    copy(prompts, builtinPrompts)
+
+    // Prompts authored in the KB replace built-ins of the same name
+    for _, p := range s.prompts.list() {
+        replaced := false
+        for i, builtin := range prompts {
+            if builtin["name"] == p.Name {
+                prompts[i] = p.definition()
+                replaced = true
+            }
+        }
+        if !replaced {
+            prompts = append(prompts, p.definition())
+        }
     }
+
     return map[string]interface{}{
         "prompts": prompts,
     }, nil
@@ -349,31 +644,26 @@ func (s *MCPServer) handleGetPrompt(ctx context.Context, params interface{}) (in
         return nil, fmt.Errorf("missing prompt name")
     }
 
+    if p, ok := s.prompts.get(promptName); ok {
+        return p.render(promptArguments(paramMap))
+    }
+
     switch promptName {
     case "summarize_daily":
-        return map[string]interface{}{
-            "messages": []map[string]interface{}{
-                {
-                    "role": "user",
-                    "content": "Summarize my notes from today. Focus on: 1) What I accomplished, 2) Open tasks, 3) Key insights",
-                },
-            },
-        }, nil
+        return s.summarizeDailyPrompt(ctx, promptArguments(paramMap))
     case "find_related":
-        topic, _ := paramMap["topic"].(string)
-        return map[string]interface{}{
-            "messages": []map[string]interface{}{
-                {
-                    "role": "user",
-                    "content": fmt.Sprintf("Find and summarize all my notes related to: %s. Include connections between them.", topic),
-                },
-            },
-        }, nil
+        return s.findRelatedPrompt(ctx, promptArguments(paramMap))
     default:
         return nil, fmt.Errorf("unknown prompt: %s", promptName)
     }
 }
 
+// readOnlyAnnotations marks tools that never modify the knowledge base
+var readOnlyAnnotations = map[string]interface{}{
+    "readOnlyHint":  true,
+    "openWorldHint": false,
+}
+
 func extractDocPathFromURI(uri string) string {
     // Parse kb://documents/path/to/doc -> path/to/doc
     if !strings.HasPrefix(uri, "kb://documents/") {
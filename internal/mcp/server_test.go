@@ -0,0 +1,453 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kbnavt/internal/config"
+	"kbnavt/pkg/kb"
+)
+
+func newTestServer(t *testing.T, files map[string]string) *MCPServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	nav, err := kb.NewNavigator(dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{}
+	cfg.KB.BaseDir = dir
+	cfg.MCP.PromptsDir = ".kbnavt/prompts"
+	return NewMCPServer(nav, cfg, logger)
+}
+
+// call sends a JSON-RPC request and returns the JSON-encoded result
+func call(t *testing.T, s *MCPServer, method string, params interface{}) string {
+	t.Helper()
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  method,
+		"params":  params,
+	})
+	result, err := s.HandleRequest(context.Background(), data)
+	if err != nil {
+		t.Fatalf("%s failed: %v", method, err)
+	}
+	out, _ := json.Marshal(result)
+	return string(out)
+}
+
+func TestSummarizeDailyPrompt(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+	s := newTestServer(t, map[string]string{
+		"journal.md":   "# Today\nShipped the release.\n",
+		"old/plan.org": "* TODO Call vendor\nSCHEDULED: <" + today + " Mon>\n* TODO Later\nSCHEDULED: <2001-01-01 Mon>\n",
+	})
+	old := time.Now().AddDate(0, 0, -10)
+	if err := os.Chtimes(filepath.Join(s.cfg.KB.BaseDir, "old/plan.org"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	out := call(t, s, "prompts/get", map[string]interface{}{"name": "summarize_daily"})
+
+	if !strings.Contains(out, `"uri":"kb://documents/journal.md"`) || !strings.Contains(out, "Shipped the release.") {
+		t.Errorf("Expected today's note to be embedded, got %s", out)
+	}
+	if !strings.Contains(out, "Call vendor") {
+		t.Errorf("Expected scheduled entry to be embedded, got %s", out)
+	}
+	if strings.Contains(out, "Later") {
+		t.Errorf("Expected entries outside the window to be left out, got %s", out)
+	}
+}
+
+func TestFindRelatedPromptArguments(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"infra.md": "# Infra\nKubernetes upgrade notes.\n",
+		"cats.md":  "# Cats\nNothing relevant.\n",
+	})
+
+	out := call(t, s, "prompts/get", map[string]interface{}{
+		"name":      "find_related",
+		"arguments": map[string]interface{}{"topic": "kubernetes", "budget": "10"},
+	})
+
+	if !strings.Contains(out, "related to: kubernetes") {
+		t.Errorf("Expected topic from arguments, got %s", out)
+	}
+	if strings.Contains(out, "Kubernetes upgrade notes.") || !strings.Contains(out, "1 more note matched but was left out") {
+		t.Errorf("Expected budget to leave the note out, got %s", out)
+	}
+}
+
+func TestToolErrorsAreResults(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"notes/2025/daily.org": "* Morning\nCoffee.\n* Evening\nTea.\n",
+	})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "read_document",
+		"arguments": map[string]interface{}{"path": "notes/2025/dialy.org"},
+	})
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, `Did you mean \"notes/2025/daily.org\"?`) {
+		t.Errorf("Expected isError result with a suggestion, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "read_document",
+		"arguments": map[string]interface{}{"path": "zzzzzz.md"},
+	})
+	if !strings.Contains(out, `zzzzzz.md. Use list_documents or search_documents`) || strings.Contains(out, "Did you mean") {
+		t.Errorf("Expected the hint as a sentence of its own, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "read_section",
+		"arguments": map[string]interface{}{"path": "notes/2025/daily.org", "section": "Evenin"},
+	})
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, `Did you mean \"Evening\"?`) {
+		t.Errorf("Expected section suggestion, got %s", out)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1, "method": "tools/call",
+		"params": map[string]interface{}{"name": "no_such_tool"},
+	})
+	_, err := s.HandleRequest(context.Background(), data)
+	var rpcErr *rpcError
+	if !errors.As(err, &rpcErr) || rpcErr.Code != codeInvalidParams {
+		t.Errorf("Expected invalid params error for unknown tool, got %v", err)
+	}
+}
+
+func TestProtocolVersionNegotiation(t *testing.T) {
+	s := newTestServer(t, nil)
+
+	tests := []struct {
+		requested string
+		want      string
+	}{
+		{"2024-11-05", "2024-11-05"},
+		{"2025-03-26", "2025-03-26"},
+		{"2025-06-18", "2025-06-18"},
+		{"1999-01-01", supportedProtocolVersions[0]},
+		{"", supportedProtocolVersions[0]},
+	}
+
+	for _, tt := range tests {
+		out := call(t, s, "initialize", map[string]interface{}{
+			"protocolVersion": tt.requested,
+			"clientInfo":      map[string]interface{}{"name": "test", "version": "1"},
+		})
+		if !strings.Contains(out, `"protocolVersion":"`+tt.want+`"`) {
+			t.Errorf("Expected %s for %q, got %s", tt.want, tt.requested, out)
+		}
+		if !strings.Contains(out, `"tools":{"listChanged":false}`) {
+			t.Errorf("Expected spec capabilities, got %s", out)
+		}
+	}
+}
+
+func TestNavigatorErrorsMapToRPCCodes(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\n"})
+
+	tests := []struct {
+		uri  string
+		code int
+		kind string
+	}{
+		{"kb://documents/missing.md", codeResourceNotFound, "not_found"},
+		{"kb://documents/../secret.md", codeInvalidParams, "forbidden_path"},
+	}
+
+	for _, tt := range tests {
+		data, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0", "id": 1, "method": "resources/read",
+			"params": map[string]interface{}{"uri": tt.uri},
+		})
+		_, err := s.HandleRequest(context.Background(), data)
+		rpcErr := toRPCError(err)
+		if rpcErr.Code != tt.code {
+			t.Errorf("Expected code %d for %s, got %d (%v)", tt.code, tt.uri, rpcErr.Code, err)
+		}
+		if data, _ := rpcErr.Data.(map[string]string); data["code"] != tt.kind {
+			t.Errorf("Expected data.code %q for %s, got %v", tt.kind, tt.uri, rpcErr.Data)
+		}
+	}
+}
+
+func TestListDocumentsPaging(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"inbox/a.md":   "# A\n",
+		"inbox/b.org":  "* B\n",
+		"inbox/c.org":  "* C\n",
+		"archive/d.md": "# D\n",
+	})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "list_documents",
+		"arguments": map[string]interface{}{"folder": "inbox", "format": []interface{}{"org"}, "limit": 1},
+	})
+	if !strings.Contains(out, "Found 2 documents, showing 1") || !strings.Contains(out, "inbox/b.org") || strings.Contains(out, "inbox/c.org") {
+		t.Errorf("Expected the first filtered page, got %s", out)
+	}
+
+	var result struct {
+		Meta struct {
+			NextCursor string `json:"nextCursor"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal([]byte(out), &result); err != nil || result.Meta.NextCursor == "" {
+		t.Fatalf("Expected a next cursor, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name": "list_documents",
+		"arguments": map[string]interface{}{
+			"folder": "inbox", "format": "org", "limit": 1, "cursor": result.Meta.NextCursor,
+		},
+	})
+	if !strings.Contains(out, "inbox/c.org") || strings.Contains(out, "More results") {
+		t.Errorf("Expected the last page, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "search_documents",
+		"arguments": map[string]interface{}{"query": "B", "sort": "sideways"},
+	})
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, "unknown sort field") {
+		t.Errorf("Expected an invalid sort to fail the tool, got %s", out)
+	}
+}
+
+func TestSearchHint(t *testing.T) {
+	s := newTestServer(t, map[string]string{"db/postgres.org": "* Postgres\nVacuum tables weekly.\n"})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "search_documents",
+		"arguments": map[string]interface{}{"query": "postgress"},
+	})
+	if !strings.Contains(out, `did you mean \"postgres\"?`) || !strings.Contains(out, `"didYouMean":"postgres"`) {
+		t.Errorf("Expected a did you mean hint, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "search_documents",
+		"arguments": map[string]interface{}{"query": "postgress", "fuzzy": true},
+	})
+	if !strings.Contains(out, "Found 1 results") || strings.Contains(out, "did you mean") {
+		t.Errorf("Expected a fuzzy match, got %s", out)
+	}
+}
+
+func TestWritesAvoidHiddenFolders(t *testing.T) {
+	s := newTestServer(t, map[string]string{"inbox/a.md": "# A\n"})
+	s.cfg.MCP.Write.Tools = map[string]bool{"create_note": true}
+
+	create := func(p string) string {
+		return call(t, s, "tools/call", map[string]interface{}{
+			"name":      "create_note",
+			"arguments": map[string]interface{}{"path": p, "content": "# Planted\n"},
+		})
+	}
+	for _, folders := range [][]string{nil, {"."}, {"inbox"}} {
+		s.cfg.MCP.Write.Folders = folders
+		for _, p := range []string{".kbnavt/prompts/evil.md", ".kbnavt/templates/evil.md", "inbox/.hidden/evil.md"} {
+			if out := create(p); !strings.Contains(out, `"isError":true`) || !strings.Contains(out, "not allowed") {
+				t.Errorf("folders %v: expected %s to be refused, got %s", folders, p, out)
+			}
+		}
+	}
+	if _, err := os.Stat(filepath.Join(s.cfg.KB.BaseDir, ".kbnavt")); !os.IsNotExist(err) {
+		t.Errorf("Expected nothing written under .kbnavt, got %v", err)
+	}
+
+	s.cfg.MCP.Write.Folders = nil
+	if out := create("inbox/b.md"); strings.Contains(out, `"isError":true`) {
+		t.Errorf("Expected a visible folder to be writable, got %s", out)
+	}
+
+	// Listing a hidden folder allows it
+	s.cfg.MCP.Write.Folders = []string{".kbnavt/templates"}
+	if out := create(".kbnavt/templates/meeting.md"); strings.Contains(out, `"isError":true`) {
+		t.Errorf("Expected a listed hidden folder to be writable, got %s", out)
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ops/kubernetes.md":    "# Kubernetes\nDrain nodes first.\n",
+		".kbnavt/synonyms.txt": "k8s, kubernetes\n",
+	})
+	if err := s.navigator.SetSynonyms(".kbnavt/synonyms.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "search_documents",
+		"arguments": map[string]interface{}{"query": "k8s", "explain": true},
+	})
+	if !strings.Contains(out, "ops/kubernetes.md") || !strings.Contains(out, "Expanded k8s: kubernetes") ||
+		!strings.Contains(out, `"expansions":[{"text":"k8s","synonyms":["kubernetes"]}]`) {
+		t.Errorf("Expected the synonym expansion explained, got %s", out)
+	}
+}
+
+func TestSavedSearchResources(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ops/deploy.md":               "# Deploy runbook\nRoll back first.\n",
+		"notes/idea.md":               "# Ideas\nWrite more.\n",
+		".kbnavt/saved-searches.yaml": "searches:\n  - name: runbooks\n    description: All runbooks\n    query: runbook\n",
+	})
+	s.navigator.SetSavedSearches(".kbnavt/saved-searches.yaml")
+
+	out := call(t, s, "resources/list", nil)
+	if !strings.Contains(out, `"uri":"kb://saved/runbooks"`) || !strings.Contains(out, `"description":"All runbooks"`) ||
+		!strings.Contains(out, `"uri":"kb://documents/ops/deploy.md"`) {
+		t.Errorf("Expected the saved search listed with the documents, got %s", out)
+	}
+
+	out = call(t, s, "resources/read", map[string]interface{}{"uri": "kb://saved/runbooks"})
+	if !strings.Contains(out, "Found 1 results for: runbook") || !strings.Contains(out, "ops/deploy.md") ||
+		strings.Contains(out, "notes/idea.md") {
+		t.Errorf("Expected the live results of the saved search, got %s", out)
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0", "id": 1, "method": "resources/read",
+		"params": map[string]interface{}{"uri": "kb://saved/missing"},
+	})
+	if _, err := s.HandleRequest(context.Background(), data); toRPCError(err).Code != codeResourceNotFound {
+		t.Errorf("Expected a missing saved search not to be found, got %v", err)
+	}
+}
+
+func TestSearchFacets(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"work/deploy.org": "* TODO Deploy the API :infra:\n",
+		"home/deploy.md":  "# Deploy the sprinklers\n",
+	})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "search_documents",
+		"arguments": map[string]interface{}{"query": "deploy", "facets": []interface{}{"folder", "todo"}},
+	})
+	if !strings.Contains(out, "Facet folder: home (1), work (1)") || !strings.Contains(out, "Facet todo: TODO (1), none (1)") ||
+		!strings.Contains(out, `"facets":{"folder":{"values":[`) {
+		t.Errorf("Expected facet counts, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "search_documents",
+		"arguments": map[string]interface{}{"query": "deploy", "facets": "author"},
+	})
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, "unknown facet") {
+		t.Errorf("Expected an unknown facet to fail the tool, got %s", out)
+	}
+}
+
+func TestFindRelatedNotes(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ops/deploy.md":   "---\ntags: [release]\n---\n# Deploy\nRoll back with the previous image. See [[rollback]].\n",
+		"ops/rollback.md": "---\ntags: [release]\n---\n# Rollback\nRedeploy the previous image.\n",
+		"garden.md":       "# Garden\nWater the lawn.\n",
+	})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "find_related_notes",
+		"arguments": map[string]interface{}{"path": "ops/deploy.md"},
+	})
+	if !strings.Contains(out, "- ops/rollback.md (score") || !strings.Contains(out, "links to") ||
+		!strings.Contains(out, "tags: release") || strings.Contains(out, "garden.md") ||
+		!strings.Contains(out, `"related":[{"path":"ops/rollback.md"`) {
+		t.Errorf("Expected the rollback note with its reasons, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "find_related_notes",
+		"arguments": map[string]interface{}{"path": "ops/missing.md"},
+	})
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, "not found") {
+		t.Errorf("Expected a missing note to fail the tool, got %s", out)
+	}
+}
+
+func TestGrepDocuments(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ops/incident.md": "# Outage\nOpened TICKET-1234 for the DNS outage.\nRoot cause: TTL.\n",
+		"notes/todo.org":  "* TODO Close ticket-1234\n",
+	})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "grep_documents",
+		"arguments": map[string]interface{}{"pattern": `ticket-\d+`, "regex": true, "ignore_case": true, "context": 1},
+	})
+	if !strings.Contains(out, "2 matching lines in 2 documents") || !strings.Contains(out, "notes/todo.org:1:* TODO Close ticket-1234") ||
+		!strings.Contains(out, "ops/incident.md-1-# Outage") || !strings.Contains(out, "ops/incident.md:2:Opened TICKET-1234") ||
+		!strings.Contains(out, `"summary":{"matches":2`) {
+		t.Errorf("Expected both matches with context, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "grep_documents",
+		"arguments": map[string]interface{}{"pattern": "TICKET-1234", "exclude": "ops/**"},
+	})
+	if !strings.Contains(out, `No lines match \"TICKET-1234\"`) {
+		t.Errorf("Expected the case-sensitive match to be excluded, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "grep_documents",
+		"arguments": map[string]interface{}{"pattern": "(", "regex": true},
+	})
+	if !strings.Contains(out, `"isError":true`) || !strings.Contains(out, "invalid regular expression") {
+		t.Errorf("Expected an invalid pattern to fail the tool, got %s", out)
+	}
+}
+
+func TestFindNote(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"ops/deploy-runbook.md": "---\naliases: [Release checklist]\n---\n# Deploying the API\n",
+		"notes/garden.md":       "# Garden\n",
+	})
+
+	out := call(t, s, "tools/call", map[string]interface{}{
+		"name":      "find_note",
+		"arguments": map[string]interface{}{"pattern": "dep rbk"},
+	})
+	if !strings.Contains(out, "- ops/deploy-runbook.md\\n") || strings.Contains(out, "garden") ||
+		!strings.Contains(out, `"notes":[{"path":"ops/deploy-runbook.md"`) {
+		t.Errorf("Expected the runbook, got %s", out)
+	}
+
+	out = call(t, s, "tools/call", map[string]interface{}{
+		"name":      "find_note",
+		"arguments": map[string]interface{}{"pattern": "release chk"},
+	})
+	if !strings.Contains(out, "- ops/deploy-runbook.md (alias: Release checklist)") {
+		t.Errorf("Expected the runbook by its alias, got %s", out)
+	}
+}
@@ -0,0 +1,396 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"kbnavt/pkg/kb"
+)
+
+const summarySystemPrompt = "You summarize notes from a personal knowledge base. " +
+	"Be concise and factual, keep names, dates, decisions and open tasks, and do not invent anything."
+
+// summarizeToolDefinitions are listed only for clients that support sampling
+var summarizeToolDefinitions = []map[string]interface{}{
+	{
+		"name":        "summarize_document",
+		"description": "Summarize a document (or one section) using the client's model. Large documents are summarized section by section and then combined.",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the document",
+				},
+				"section": map[string]interface{}{
+					"type":        "string",
+					"description": "Only summarize this section/header",
+				},
+				"focus": map[string]interface{}{
+					"type":        "string",
+					"description": "What the summary should concentrate on",
+				},
+				"max_tokens": map[string]interface{}{
+					"type":        "integer",
+					"description": "Token limit for each sampling request",
+					"default":     512,
+				},
+				"refresh": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Ignore cached summaries",
+					"default":     false,
+				},
+			},
+			"required": []string{"path"},
+		},
+		"annotations": readOnlyAnnotations,
+	},
+	{
+		"name":        "summarize_folder",
+		"description": "Summarize every document in a folder using the client's model",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"folder": map[string]interface{}{
+					"type":        "string",
+					"description": "Folder path relative to the KB root; empty for the whole KB",
+				},
+				"focus": map[string]interface{}{
+					"type":        "string",
+					"description": "What the summary should concentrate on",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": "Maximum documents to include",
+					"default":     50,
+				},
+				"max_tokens": map[string]interface{}{
+					"type":        "integer",
+					"description": "Token limit for each sampling request",
+					"default":     512,
+				},
+				"refresh": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Ignore cached summaries",
+					"default":     false,
+				},
+			},
+			"required": []string{},
+		},
+		"annotations": readOnlyAnnotations,
+	},
+}
+
+// summaryCache keeps summaries keyed by a hash of their input, in memory
+// and optionally on disk.
+type summaryCache struct {
+	dir string
+	mu  sync.Mutex
+	mem map[string]string
+}
+
+func newSummaryCache(dir string) *summaryCache {
+	return &summaryCache{dir: dir, mem: map[string]string{}}
+}
+
+func (c *summaryCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.mem[key]; ok {
+		return v, true
+	}
+	if c.dir == "" {
+		return "", false
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, key+".txt"))
+	if err != nil {
+		return "", false
+	}
+	c.mem[key] = string(data)
+	return string(data), true
+}
+
+func (c *summaryCache) put(key, summary string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.mem[key] = summary
+	if c.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, key+".txt"), []byte(summary), 0o644)
+}
+
+// summarizer runs map-reduce summarization over sampling requests
+type summarizer struct {
+	server    *MCPServer
+	sess      *session
+	focus     string
+	maxTokens int
+	refresh   bool
+}
+
+// sample asks the client's model to answer prompt
+func (z *summarizer) sample(ctx context.Context, prompt string) (string, error) {
+	raw, err := z.sess.request(ctx, "sampling/createMessage", map[string]interface{}{
+		"messages": []map[string]interface{}{
+			{
+				"role": "user",
+				"content": map[string]interface{}{
+					"type": "text",
+					"text": prompt,
+				},
+			},
+		},
+		"systemPrompt":   summarySystemPrompt,
+		"includeContext": "none",
+		"maxTokens":      z.maxTokens,
+	})
+	if err != nil {
+		return "", fmt.Errorf("sampling request failed: %w", err)
+	}
+
+	var result struct {
+		Content struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return "", fmt.Errorf("invalid sampling result: %w", err)
+	}
+	if result.Content.Type != "text" {
+		return "", fmt.Errorf("sampling returned %q content, expected text", result.Content.Type)
+	}
+	return strings.TrimSpace(result.Content.Text), nil
+}
+
+func (z *summarizer) focusLine() string {
+	if z.focus == "" {
+		return ""
+	}
+	return "\nFocus on: " + z.focus
+}
+
+// cacheKey identifies a summary by what was summarized and how
+func (z *summarizer) cacheKey(kind, contentHash string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("v1|%s|%s|%s|%d", kind, contentHash, z.focus, z.maxTokens)))
+	return hex.EncodeToString(sum[:])
+}
+
+// cached returns a cached summary or computes and stores a new one
+func (z *summarizer) cached(ctx context.Context, key string, compute func() (string, error)) (string, error) {
+	cache := z.server.summaries
+	if cache != nil && !z.refresh {
+		if v, ok := cache.get(key); ok {
+			return v, nil
+		}
+	}
+
+	summary, err := compute()
+	if err != nil {
+		return "", err
+	}
+
+	if cache != nil {
+		if err := cache.put(key, summary); err != nil {
+			z.server.logger.Warn("failed to cache summary", "error", err)
+		}
+	}
+	return summary, nil
+}
+
+// summarizeText summarizes one document's content
+func (z *summarizer) summarizeText(ctx context.Context, title, content string, format kb.Format) (string, error) {
+	key := z.cacheKey("document", kb.ContentHash(content))
+	return z.cached(ctx, key, func() (string, error) {
+		chunks := kb.ChunkDocument(content, format, z.server.cfg.MCP.Summaries.ChunkSize)
+		if len(chunks) == 0 {
+			return "(empty document)", nil
+		}
+		if len(chunks) == 1 {
+			return z.sample(ctx, fmt.Sprintf("Summarize the note %q.%s\n\n%s", title, z.focusLine(), chunks[0].Text))
+		}
+
+		// Map: one summary per chunk
+		var parts []string
+		for i, chunk := range chunks {
+			heading := chunk.Heading
+			if heading == "" {
+				heading = "introduction"
+			}
+			summary, err := z.sample(ctx, fmt.Sprintf("Summarize part %d of %d (%s) of the note %q.%s\n\n%s",
+				i+1, len(chunks), heading, title, z.focusLine(), chunk.Text))
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, fmt.Sprintf("## %s\n%s", heading, summary))
+		}
+
+		// Reduce: combine the partial summaries
+		return z.reduce(ctx, fmt.Sprintf("the note %q", title), parts)
+	})
+}
+
+// reduce combines partial summaries, in rounds if they do not fit one request
+func (z *summarizer) reduce(ctx context.Context, subject string, parts []string) (string, error) {
+	limit := z.server.cfg.MCP.Summaries.ChunkSize
+
+	for {
+		var batches [][]string
+		size := 0
+		for _, part := range parts {
+			if len(batches) == 0 || (limit > 0 && size+len(part) > limit && len(batches[len(batches)-1]) > 0) {
+				batches = append(batches, nil)
+				size = 0
+			}
+			batches[len(batches)-1] = append(batches[len(batches)-1], part)
+			size += len(part)
+		}
+
+		// One batch left, or no batch holds two parts so another round
+		// would not shrink anything: combine everything at once
+		if len(batches) == 1 || len(batches) == len(parts) {
+			return z.sample(ctx, fmt.Sprintf("Combine these partial summaries of %s into one coherent summary.%s\n\n%s",
+				subject, z.focusLine(), strings.Join(parts, "\n\n")))
+		}
+
+		var next []string
+		for _, batch := range batches {
+			summary, err := z.sample(ctx, fmt.Sprintf("Condense these partial summaries of %s.%s\n\n%s",
+				subject, z.focusLine(), strings.Join(batch, "\n\n")))
+			if err != nil {
+				return "", err
+			}
+			next = append(next, summary)
+		}
+		parts = next
+	}
+}
+
+func (s *MCPServer) callSummarizeTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
+	sess := sessionFrom(ctx)
+	if !sess.supports("sampling") {
+		return nil, fmt.Errorf("%s needs a client that supports sampling", toolName)
+	}
+
+	z := &summarizer{server: s, sess: sess, maxTokens: 512}
+	z.focus, _ = args["focus"].(string)
+	z.refresh, _ = args["refresh"].(bool)
+	if v, ok := args["max_tokens"].(float64); ok && v > 0 {
+		z.maxTokens = int(v)
+	}
+
+	var summary string
+	switch toolName {
+	case "summarize_document":
+		path, ok := args["path"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing path parameter")
+		}
+		nav := s.nav(ctx)
+		doc, err := nav.ReadDocument(path)
+		if err != nil {
+			return nil, err
+		}
+		content, title := doc.Content, doc.Title
+		if section, _ := args["section"].(string); section != "" {
+			if content, err = nav.ReadSection(path, section); err != nil {
+				return nil, err
+			}
+			title = doc.Title + kb.HeaderPathSeparator + section
+		}
+		if summary, err = z.summarizeText(ctx, title, content, doc.Format); err != nil {
+			return nil, err
+		}
+
+	case "summarize_folder":
+		folder, _ := args["folder"].(string)
+		limit := 50
+		if v, ok := args["limit"].(float64); ok && v > 0 {
+			limit = int(v)
+		}
+		var err error
+		if summary, err = s.summarizeFolder(ctx, z, folder, limit); err != nil {
+			return nil, err
+		}
+	}
+
+	return map[string]interface{}{
+		"content": []map[string]interface{}{
+			{
+				"type": "text",
+				"text": summary,
+			},
+		},
+	}, nil
+}
+
+func (s *MCPServer) summarizeFolder(ctx context.Context, z *summarizer, folder string, limit int) (string, error) {
+	prefix := strings.Trim(filepath.ToSlash(filepath.Clean(folder)), "/")
+	if prefix == "." {
+		prefix = ""
+	}
+
+	nav := s.nav(ctx)
+	docs, err := nav.ListDocuments()
+	if err != nil {
+		return "", err
+	}
+
+	var selected []kb.Document
+	for _, doc := range docs {
+		p := filepath.ToSlash(doc.Path)
+		if prefix != "" && !strings.HasPrefix(p, prefix+"/") {
+			continue
+		}
+		if len(selected) == limit {
+			break
+		}
+		selected = append(selected, doc)
+	}
+
+	progress := progressFrom(ctx)
+	var parts, hashes []string
+	for i, doc := range selected {
+		p := filepath.ToSlash(doc.Path)
+		progress.report(i, len(selected), "summarizing "+p)
+
+		full, err := nav.ReadDocument(doc.Path)
+		if err != nil {
+			s.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+		summary, err := z.summarizeText(ctx, doc.Title, full.Content, full.Format)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, fmt.Sprintf("## %s\n%s", p, summary))
+		hashes = append(hashes, full.Hash)
+	}
+	progress.report(len(selected), len(selected), "combining summaries")
+
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no documents found in folder: %s", folder)
+	}
+
+	subject := "the folder " + prefix
+	if prefix == "" {
+		subject = "the knowledge base"
+	}
+	key := z.cacheKey("folder:"+prefix, kb.ContentHash(strings.Join(hashes, ",")))
+	return z.cached(ctx, key, func() (string, error) {
+		return z.reduce(ctx, subject, parts)
+	})
+}
@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scriptedSampler answers sampling requests with a numbered canned summary
+type scriptedSampler struct {
+	prompts []string
+}
+
+func (s *scriptedSampler) handle(params json.RawMessage) (interface{}, error) {
+	var req struct {
+		Messages []struct {
+			Content struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"messages"`
+		MaxTokens int `json:"maxTokens"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil {
+		return nil, err
+	}
+	s.prompts = append(s.prompts, req.Messages[0].Content.Text)
+
+	return map[string]interface{}{
+		"role":  "assistant",
+		"model": "scripted",
+		"content": map[string]interface{}{
+			"type": "text",
+			"text": "summary " + string(rune('A'+len(s.prompts)-1)),
+		},
+	}, nil
+}
+
+func TestSummarizeDocumentMapReduce(t *testing.T) {
+	long := "* Alpha\n" + strings.Repeat("alpha text. ", 30) + "\n* Beta\n" + strings.Repeat("beta text. ", 30) + "\n"
+	s := newTestServer(t, map[string]string{"notes/long.org": long})
+	s.cfg.MCP.Summaries.ChunkSize = 400
+	s.summaries = newSummaryCache("")
+
+	sampler := &scriptedSampler{}
+	c := startFakeClient(t, s, map[string]interface{}{"sampling": map[string]interface{}{}})
+	c.handlers["sampling/createMessage"] = sampler.handle
+
+	if tools := c.call("tools/list", nil); !strings.Contains(string(tools.Result), "summarize_document") {
+		t.Fatalf("Expected summarize tools for a sampling client, got %s", tools.Result)
+	}
+
+	resp := c.call("tools/call", map[string]interface{}{
+		"name":      "summarize_document",
+		"arguments": map[string]interface{}{"path": "notes/long.org"},
+	})
+	if resp.Error != nil {
+		t.Fatalf("summarize_document failed: %v", resp.Error)
+	}
+
+	// Two sections map to two requests, then one reduce request
+	if len(sampler.prompts) != 3 {
+		t.Fatalf("Expected 3 sampling requests, got %d: %q", len(sampler.prompts), sampler.prompts)
+	}
+	if !strings.Contains(sampler.prompts[0], "Alpha") || !strings.Contains(sampler.prompts[1], "Beta") {
+		t.Errorf("Expected one map request per section, got %q", sampler.prompts[:2])
+	}
+	if !strings.Contains(sampler.prompts[2], "summary A") || !strings.Contains(sampler.prompts[2], "summary B") {
+		t.Errorf("Expected reduce request to combine partial summaries, got %q", sampler.prompts[2])
+	}
+	if !strings.Contains(string(resp.Result), "summary C") {
+		t.Errorf("Expected final summary in result, got %s", resp.Result)
+	}
+
+	// The second call is served from the cache
+	resp = c.call("tools/call", map[string]interface{}{
+		"name":      "summarize_document",
+		"arguments": map[string]interface{}{"path": "notes/long.org"},
+	})
+	if len(sampler.prompts) != 3 || !strings.Contains(string(resp.Result), "summary C") {
+		t.Errorf("Expected cached summary without new sampling requests, got %d requests", len(sampler.prompts))
+	}
+}
+
+func TestSummarizeFolderReduceTerminates(t *testing.T) {
+	// Partial summaries over half of chunk_size, or no chunk_size at all,
+	// leave no batch holding two of them
+	for _, chunkSize := range []int{30, 0} {
+		s := newTestServer(t, map[string]string{
+			"notes/a.md": "# A\nalpha\n",
+			"notes/b.md": "# B\nbeta\n",
+			"notes/c.md": "# C\ngamma\n",
+		})
+		s.cfg.MCP.Summaries.ChunkSize = chunkSize
+
+		sampler := &scriptedSampler{}
+		c := startFakeClient(t, s, map[string]interface{}{"sampling": map[string]interface{}{}})
+		c.handlers["sampling/createMessage"] = func(params json.RawMessage) (interface{}, error) {
+			if len(sampler.prompts) == 10 {
+				return nil, errors.New("too many sampling requests")
+			}
+			return sampler.handle(params)
+		}
+
+		resp := c.call("tools/call", map[string]interface{}{
+			"name":      "summarize_folder",
+			"arguments": map[string]interface{}{"folder": "notes"},
+		})
+
+		// Three notes map to three requests, then one combines them
+		if len(sampler.prompts) != 4 || !strings.HasPrefix(sampler.prompts[3], "Combine") {
+			t.Errorf("chunk_size %d: expected 3 map requests and one combine, got %d: %q", chunkSize, len(sampler.prompts), sampler.prompts)
+		}
+		if !strings.Contains(string(resp.Result), "summary D") {
+			t.Errorf("chunk_size %d: expected final summary in result, got %+v", chunkSize, resp)
+		}
+	}
+}
+
+func TestSummarizeRequiresSampling(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\ntext\n"})
+	c := startFakeClient(t, s, nil)
+
+	if tools := c.call("tools/list", nil); strings.Contains(string(tools.Result), "summarize_document") {
+		t.Error("Expected summarize tools to be hidden without sampling support")
+	}
+
+	resp := c.call("tools/call", map[string]interface{}{
+		"name":      "summarize_document",
+		"arguments": map[string]interface{}{"path": "a.md"},
+	})
+	if !strings.Contains(string(resp.Result), `"isError":true`) || !strings.Contains(string(resp.Result), "sampling") {
+		t.Errorf("Expected sampling error, got %+v", resp)
+	}
+}
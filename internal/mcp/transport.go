@@ -0,0 +1,305 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"kbnavt/pkg/kb"
+)
+
+// maxMessageSize bounds a single JSON-RPC line read from the client
+const maxMessageSize = 16 << 20
+
+// rpcMessage is any JSON-RPC 2.0 message: request, notification or response
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// session is one connected client. It serialises writes and routes the
+// client's responses back to requests the server sent (sampling, roots).
+type session struct {
+	w       io.Writer
+	writeMu sync.Mutex
+
+	abort func() // cancels in-flight requests once the client can't be written to
+
+	mu         sync.Mutex
+	nextID     int64
+	closed     bool // the client went away; requests to it fail at once
+	pending    map[string]chan *rpcMessage
+	inflight   map[string]context.CancelFunc // requests from the client being handled
+	clientCaps map[string]interface{}
+	protocol   string        // negotiated protocol version
+	nav        *kb.Navigator // narrowed to the client's roots, nil until known
+	rootsReady chan struct{} // closed once the pending roots/list completes
+}
+
+func newSession(w io.Writer) *session {
+	return &session{
+		w:        w,
+		pending:  map[string]chan *rpcMessage{},
+		inflight: map[string]context.CancelFunc{},
+	}
+}
+
+type sessionKey struct{}
+
+func withSession(ctx context.Context, sess *session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, sess)
+}
+
+// sessionFrom returns the client session handling ctx, or nil outside a session
+func sessionFrom(ctx context.Context) *session {
+	sess, _ := ctx.Value(sessionKey{}).(*session)
+	return sess
+}
+
+// Serve runs a JSON-RPC session reading newline-delimited messages from r
+// and writing to w. Requests are handled concurrently so that a tool can
+// wait on a request it sent to the client, and each can be cancelled with
+// notifications/cancelled. At the end of r, requests in flight still
+// finish and respond, so that a client may send its requests and close
+// its end; they are abandoned only when ctx is cancelled or a response
+// can't be written.
+func (s *MCPServer) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	sess := newSession(w)
+	ctx = withSession(ctx, sess)
+	defer s.logs.remove(sess)
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+	sess.abort = stop
+
+	var wg sync.WaitGroup
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		line := append([]byte(nil), scanner.Bytes()...)
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg rpcMessage
+		if err := json.Unmarshal(line, &msg); err != nil {
+			sess.write(rpcMessage{
+				JSONRPC: "2.0",
+				ID:      json.RawMessage("null"),
+				Error:   &rpcError{Code: codeParseError, Message: "parse error: " + err.Error()},
+			})
+			continue
+		}
+
+		switch {
+		case msg.Method == "" && msg.ID != nil:
+			sess.deliver(&msg)
+		case msg.ID == nil:
+			s.handleNotification(ctx, msg.Method, msg.Params)
+		case msg.Method == "initialize":
+			// The client's capabilities decide what later requests see
+			s.respond(ctx, sess, msg.ID, line)
+		default:
+			reqCtx, cancel := context.WithCancel(ctx)
+			if token := requestMeta(line); token != nil {
+				reqCtx = withProgress(reqCtx, &progressReporter{sess: sess, token: token})
+			}
+			sess.track(msg.ID, cancel)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer cancel()
+				defer sess.untrack(msg.ID)
+				s.respond(reqCtx, sess, msg.ID, line)
+			}()
+		}
+	}
+
+	// The client can't answer requests from the server any more, but it
+	// may still read the responses to its own
+	sess.closePending()
+	wg.Wait()
+	return scanner.Err()
+}
+
+// respond handles one request and writes its response
+func (s *MCPServer) respond(ctx context.Context, sess *session, id json.RawMessage, data []byte) {
+	result, err := s.HandleRequest(ctx, data)
+	if ctx.Err() != nil {
+		// Cancelled by the client or the connection closed: no response
+		s.logger.Debug("request cancelled", "id", string(id))
+		return
+	}
+
+	resp := rpcMessage{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		resp.Error = toRPCError(err)
+	} else {
+		raw, merr := json.Marshal(result)
+		if merr != nil {
+			resp.Error = &rpcError{Code: codeInternalError, Message: merr.Error()}
+		} else {
+			resp.Result = raw
+		}
+	}
+	sess.write(resp)
+}
+
+// handleNotification processes messages that expect no response
+func (s *MCPServer) handleNotification(ctx context.Context, method string, params json.RawMessage) {
+	s.logger.Debug("notification received", "method", method)
+
+	sess := sessionFrom(ctx)
+	switch method {
+	case "notifications/initialized", "notifications/roots/list_changed":
+		if sess.supports("roots") {
+			sess.expectRoots()
+			go s.refreshRoots(ctx, sess)
+		}
+	case "notifications/cancelled":
+		var p struct {
+			RequestID json.RawMessage `json:"requestId"`
+			Reason    string          `json:"reason"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil || p.RequestID == nil {
+			return
+		}
+		if sess.cancel(p.RequestID) {
+			s.logger.Debug("request cancelled by client", "id", string(p.RequestID), "reason", p.Reason)
+		}
+	}
+}
+
+func (sess *session) write(msg rpcMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	sess.writeMu.Lock()
+	defer sess.writeMu.Unlock()
+	if _, err = sess.w.Write(data); err != nil && sess.abort != nil {
+		sess.abort()
+	}
+	return err
+}
+
+// notify sends a notification to the client
+func (sess *session) notify(method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return sess.write(rpcMessage{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+// request sends a request to the client and waits for its response
+func (sess *session) request(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return nil, fmt.Errorf("client disconnected before answering %s", method)
+	}
+	sess.nextID++
+	id := json.RawMessage(strconv.Quote("kbnavt-" + strconv.FormatInt(sess.nextID, 10)))
+	ch := make(chan *rpcMessage, 1)
+	sess.pending[string(id)] = ch
+	sess.mu.Unlock()
+
+	defer func() {
+		sess.mu.Lock()
+		delete(sess.pending, string(id))
+		sess.mu.Unlock()
+	}()
+
+	if err := sess.write(rpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: raw}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("client disconnected before answering %s", method)
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// deliver hands a client response to the request waiting for it. Only
+// the first response to a request counts; duplicate and late ones are
+// dropped, so that the read loop never blocks on them.
+func (sess *session) deliver(msg *rpcMessage) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	ch, ok := sess.pending[string(msg.ID)]
+	if !ok {
+		return
+	}
+	delete(sess.pending, string(msg.ID))
+	select {
+	case ch <- msg:
+	default:
+	}
+}
+
+// closePending fails the requests waiting on the client, and any sent
+// later, once it went away
+func (sess *session) closePending() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.closed = true
+	for id, ch := range sess.pending {
+		close(ch)
+		delete(sess.pending, id)
+	}
+}
+
+func (sess *session) setClientCapabilities(caps map[string]interface{}) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.clientCaps = caps
+}
+
+// supports reports whether the client declared a capability during initialize
+func (sess *session) supports(capability string) bool {
+	if sess == nil {
+		return false
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	_, ok := sess.clientCaps[capability]
+	return ok
+}
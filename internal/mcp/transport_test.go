@@ -0,0 +1,303 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClient drives a server over pipes and answers the server's own
+// requests from scripted handlers.
+type fakeClient struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	out      *bufio.Scanner
+	nextID   int
+	handlers map[string]func(params json.RawMessage) (interface{}, error)
+	notes    []rpcMessage
+	done     chan struct{}
+}
+
+func startFakeClient(t *testing.T, s *MCPServer, caps map[string]interface{}) *fakeClient {
+	t.Helper()
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+
+	c := &fakeClient{
+		t:        t,
+		in:       clientW,
+		out:      bufio.NewScanner(clientR),
+		handlers: map[string]func(json.RawMessage) (interface{}, error){},
+		done:     make(chan struct{}),
+	}
+	c.out.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	go func() {
+		defer close(c.done)
+		s.Serve(context.Background(), serverR, serverW)
+		serverW.Close()
+	}()
+	t.Cleanup(func() {
+		clientW.Close()
+		go io.Copy(io.Discard, clientR)
+		<-c.done
+	})
+
+	if caps == nil {
+		caps = map[string]interface{}{}
+	}
+	c.call("initialize", map[string]interface{}{
+		"protocolVersion": "2024-11-05",
+		"capabilities":    caps,
+		"clientInfo":      map[string]interface{}{"name": "fake", "version": "0"},
+	})
+	c.send(rpcMessage{JSONRPC: "2.0", Method: "notifications/initialized"})
+	return c
+}
+
+func (c *fakeClient) send(msg rpcMessage) {
+	data, _ := json.Marshal(msg)
+	if _, err := c.in.Write(append(data, '\n')); err != nil {
+		c.t.Fatalf("write failed: %v", err)
+	}
+}
+
+// call sends a request and serves the server's requests until the response arrives
+func (c *fakeClient) call(method string, params interface{}) rpcMessage {
+	c.t.Helper()
+
+	c.nextID++
+	id := json.RawMessage(fmt.Sprint(c.nextID))
+	raw, _ := json.Marshal(params)
+	c.send(rpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: raw})
+
+	for c.out.Scan() {
+		var msg rpcMessage
+		if err := json.Unmarshal(c.out.Bytes(), &msg); err != nil {
+			c.t.Fatalf("invalid message from server: %s", c.out.Text())
+		}
+
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			c.answer(msg)
+		case msg.Method != "":
+			c.notes = append(c.notes, msg)
+		case string(msg.ID) == string(id):
+			return msg
+		}
+	}
+	c.t.Fatalf("server closed the connection while waiting for %s", method)
+	return rpcMessage{}
+}
+
+func (c *fakeClient) answer(req rpcMessage) {
+	resp := rpcMessage{JSONRPC: "2.0", ID: req.ID}
+	handler, ok := c.handlers[req.Method]
+	if !ok {
+		resp.Error = &rpcError{Code: -32601, Message: "method not found"}
+	} else if result, err := handler(req.Params); err != nil {
+		resp.Error = &rpcError{Code: -32603, Message: err.Error()}
+	} else {
+		resp.Result, _ = json.Marshal(result)
+	}
+	c.send(resp)
+}
+
+func TestServeEchoesRequestIDs(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\n"})
+	c := startFakeClient(t, s, nil)
+
+	resp := c.call("tools/list", nil)
+	if string(resp.ID) != "2" || resp.JSONRPC != "2.0" {
+		t.Errorf("Expected JSON-RPC response with id 2, got id=%s jsonrpc=%q", resp.ID, resp.JSONRPC)
+	}
+	if !strings.Contains(string(resp.Result), "read_document") {
+		t.Errorf("Expected tool list, got %s", resp.Result)
+	}
+
+	resp = c.call("no/such/method", nil)
+	if resp.Error == nil {
+		t.Error("Expected error for unknown method")
+	}
+}
+
+// next reads the next message from the server
+func (c *fakeClient) next() rpcMessage {
+	c.t.Helper()
+	if !c.out.Scan() {
+		c.t.Fatal("server closed the connection")
+	}
+	var msg rpcMessage
+	if err := json.Unmarshal(c.out.Bytes(), &msg); err != nil {
+		c.t.Fatalf("invalid message from server: %s", c.out.Text())
+	}
+	return msg
+}
+
+func TestProgressNotifications(t *testing.T) {
+	s := newTestServer(t, map[string]string{
+		"notes/a.md": "# A\nalpha\n",
+		"notes/b.md": "# B\nbeta\n",
+	})
+	sampler := &scriptedSampler{}
+	c := startFakeClient(t, s, map[string]interface{}{"sampling": map[string]interface{}{}})
+	c.handlers["sampling/createMessage"] = sampler.handle
+
+	resp := c.call("tools/call", map[string]interface{}{
+		"name":      "summarize_folder",
+		"arguments": map[string]interface{}{"folder": "notes"},
+		"_meta":     map[string]interface{}{"progressToken": "tok-1"},
+	})
+	if resp.Error != nil {
+		t.Fatalf("summarize_folder failed: %v", resp.Error)
+	}
+
+	var last map[string]interface{}
+	for _, note := range c.notes {
+		if note.Method == "notifications/progress" {
+			last = nil
+			json.Unmarshal(note.Params, &last)
+		}
+	}
+	if last == nil {
+		t.Fatal("Expected progress notifications")
+	}
+	if last["progressToken"] != "tok-1" || last["progress"] != float64(2) || last["total"] != float64(2) {
+		t.Errorf("Expected final progress 2/2 for tok-1, got %v", last)
+	}
+}
+
+func TestCancelledRequestGetsNoResponse(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\ntext\n"})
+	c := startFakeClient(t, s, map[string]interface{}{"sampling": map[string]interface{}{}})
+
+	if resp := c.call("logging/setLevel", map[string]interface{}{"level": "debug"}); resp.Error != nil {
+		t.Fatalf("logging/setLevel failed: %v", resp.Error)
+	}
+
+	params, _ := json.Marshal(map[string]interface{}{
+		"name":      "summarize_document",
+		"arguments": map[string]interface{}{"path": "a.md"},
+	})
+	c.send(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(`"slow"`), Method: "tools/call", Params: params})
+
+	// Cancel while the server waits on its sampling request
+	for msg := c.next(); msg.Method != "sampling/createMessage"; msg = c.next() {
+	}
+	cancel, _ := json.Marshal(map[string]interface{}{"requestId": "slow", "reason": "user aborted"})
+	c.send(rpcMessage{JSONRPC: "2.0", Method: "notifications/cancelled", Params: cancel})
+
+	for {
+		msg := c.next()
+		if string(msg.ID) == `"slow"` && msg.Method == "" {
+			t.Fatalf("Expected no response for a cancelled request, got %+v", msg)
+		}
+		if msg.Method == "notifications/message" && strings.Contains(string(msg.Params), `"message":"request cancelled"`) {
+			if !strings.Contains(string(msg.Params), `"level":"debug"`) || !strings.Contains(string(msg.Params), `"logger":"kbnavt"`) {
+				t.Errorf("Expected debug log from kbnavt, got %s", msg.Params)
+			}
+			break
+		}
+	}
+
+	if resp := c.call("logging/setLevel", map[string]interface{}{"level": "loud"}); resp.Error == nil || resp.Error.Code != codeInvalidParams {
+		t.Errorf("Expected invalid params for unknown level, got %+v", resp.Error)
+	}
+}
+
+func TestDuplicateResponsesDoNotBlock(t *testing.T) {
+	sess := newSession(io.Discard)
+	ch := make(chan *rpcMessage, 1)
+	sess.pending[`"kbnavt-1"`] = ch
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 3; i++ {
+			sess.deliver(&rpcMessage{ID: json.RawMessage(`"kbnavt-1"`)})
+		}
+		sess.closePending()
+		sess.deliver(&rpcMessage{ID: json.RawMessage(`"kbnavt-1"`)})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected duplicate responses to be dropped, but deliver blocked")
+	}
+	if msg := <-ch; msg == nil {
+		t.Error("Expected the first response to be delivered")
+	}
+}
+
+// rpcRequest is a request for serveAll
+type rpcRequest struct {
+	method string
+	params interface{}
+}
+
+// serveAll sends requests, numbered from 1, and closes the connection at
+// once. It returns the responses by ID.
+func serveAll(t *testing.T, s *MCPServer, requests ...rpcRequest) map[string]rpcMessage {
+	t.Helper()
+
+	var input strings.Builder
+	for i, req := range requests {
+		raw, _ := json.Marshal(req.params)
+		data, _ := json.Marshal(rpcMessage{JSONRPC: "2.0", ID: json.RawMessage(fmt.Sprint(i + 1)), Method: req.method, Params: raw})
+		input.Write(append(data, '\n'))
+	}
+	var output strings.Builder
+	if err := s.Serve(context.Background(), strings.NewReader(input.String()), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string]rpcMessage{}
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var msg rpcMessage
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("invalid message from server: %s", line)
+		}
+		if msg.Method == "" {
+			responses[string(msg.ID)] = msg
+		}
+	}
+	return responses
+}
+
+func TestServeAnswersRequestsAfterEOF(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\ntext\n"})
+
+	responses := serveAll(t, s,
+		rpcRequest{"initialize", map[string]interface{}{"protocolVersion": "2024-11-05", "capabilities": map[string]interface{}{}}},
+		rpcRequest{"tools/list", nil},
+		rpcRequest{"tools/call", map[string]interface{}{"name": "read_document", "arguments": map[string]interface{}{"path": "a.md"}}},
+	)
+	for _, id := range []string{"1", "2", "3"} {
+		resp, ok := responses[id]
+		if !ok {
+			t.Errorf("Expected a response to request %s", id)
+		} else if resp.Error != nil {
+			t.Errorf("Request %s failed: %v", id, resp.Error)
+		}
+	}
+}
+
+func TestInitializeBeforeLaterRequests(t *testing.T) {
+	s := newTestServer(t, map[string]string{"a.md": "# A\ntext\n"})
+
+	// Sent without waiting for the initialize response
+	responses := serveAll(t, s,
+		rpcRequest{"initialize", map[string]interface{}{"protocolVersion": "2024-11-05", "capabilities": map[string]interface{}{"sampling": map[string]interface{}{}}}},
+		rpcRequest{"tools/list", nil},
+	)
+	if !strings.Contains(string(responses["2"].Result), "summarize_document") {
+		t.Errorf("Expected the sampling tools to be listed, got %s", responses["2"].Result)
+	}
+}
@@ -0,0 +1,365 @@
+package mcp
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"kbnavt/pkg/kb"
+)
+
+// writeToolOrder lists the write tools in the order they are advertised
+var writeToolOrder = []string{
+	"create_note",
+	"append_to_section",
+	"replace_section",
+	"set_todo_state",
+	"rename_note",
+}
+
+var dryRunProperty = map[string]interface{}{
+	"type":        "boolean",
+	"description": "Preview the change as a unified diff without writing anything",
+	"default":     false,
+}
+
+var expectedHashProperty = map[string]interface{}{
+	"type":        "string",
+	"description": "Content hash returned by a previous read or dry run; the write fails if the note changed since",
+}
+
+// writeToolDefinitions describes every write tool, keyed by name
+var writeToolDefinitions = map[string]map[string]interface{}{
+	"create_note": {
+		"name":        "create_note",
+		"description": "Create a new note, optionally from a template in .kbnavt/templates",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path of the new note (relative to KB root)",
+				},
+				"template": map[string]interface{}{
+					"type":        "string",
+					"description": "Template name without extension",
+				},
+				"variables": map[string]interface{}{
+					"type":                 "object",
+					"description":          "Values for the template placeholders",
+					"additionalProperties": map[string]interface{}{"type": "string"},
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "Note body, used when no template is given",
+				},
+				"dry_run": dryRunProperty,
+			},
+			"required": []string{"path"},
+		},
+		"annotations": map[string]interface{}{
+			"title":           "Create note",
+			"readOnlyHint":    false,
+			"destructiveHint": false,
+			"idempotentHint":  false,
+			"openWorldHint":   false,
+		},
+	},
+	"append_to_section": {
+		"name":        "append_to_section",
+		"description": "Append text to the end of a section, or to the end of the note when no section is given",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the document",
+				},
+				"section": map[string]interface{}{
+					"type":        "string",
+					"description": "Section/header title to append to",
+				},
+				"text": map[string]interface{}{
+					"type":        "string",
+					"description": "Text to append",
+				},
+				"expected_hash": expectedHashProperty,
+				"dry_run":       dryRunProperty,
+			},
+			"required": []string{"path", "text"},
+		},
+		"annotations": map[string]interface{}{
+			"title":           "Append to section",
+			"readOnlyHint":    false,
+			"destructiveHint": false,
+			"idempotentHint":  false,
+			"openWorldHint":   false,
+		},
+	},
+	"replace_section": {
+		"name":        "replace_section",
+		"description": "Replace the body of a section, keeping its header line",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the document",
+				},
+				"section": map[string]interface{}{
+					"type":        "string",
+					"description": "Section/header title to replace",
+				},
+				"text": map[string]interface{}{
+					"type":        "string",
+					"description": "New section body",
+				},
+				"expected_hash": expectedHashProperty,
+				"dry_run":       dryRunProperty,
+			},
+			"required": []string{"path", "section", "text"},
+		},
+		"annotations": map[string]interface{}{
+			"title":           "Replace section",
+			"readOnlyHint":    false,
+			"destructiveHint": true,
+			"idempotentHint":  true,
+			"openWorldHint":   false,
+		},
+	},
+	"set_todo_state": {
+		"name":        "set_todo_state",
+		"description": "Set the TODO keyword of an Org headline or check/uncheck a Markdown task",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Path to the document",
+				},
+				"item": map[string]interface{}{
+					"type":        "string",
+					"description": "Headline title (Org) or task text (Markdown)",
+				},
+				"state": map[string]interface{}{
+					"type":        "string",
+					"description": "New state; empty clears the Org keyword",
+					"enum":        []string{"TODO", "NEXT", "WAITING", "DONE", "CANCELLED", ""},
+				},
+				"expected_hash": expectedHashProperty,
+				"dry_run":       dryRunProperty,
+			},
+			"required": []string{"path", "item", "state"},
+		},
+		"annotations": map[string]interface{}{
+			"title":           "Set TODO state",
+			"readOnlyHint":    false,
+			"destructiveHint": false,
+			"idempotentHint":  true,
+			"openWorldHint":   false,
+		},
+	},
+	"rename_note": {
+		"name":        "rename_note",
+		"description": "Move a note to a new path",
+		"inputSchema": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path": map[string]interface{}{
+					"type":        "string",
+					"description": "Current path of the note",
+				},
+				"new_path": map[string]interface{}{
+					"type":        "string",
+					"description": "New path of the note",
+				},
+				"expected_hash": expectedHashProperty,
+				"dry_run":       dryRunProperty,
+			},
+			"required": []string{"path", "new_path"},
+		},
+		"annotations": map[string]interface{}{
+			"title":           "Rename note",
+			"readOnlyHint":    false,
+			"destructiveHint": true,
+			"idempotentHint":  false,
+			"openWorldHint":   false,
+		},
+	},
+}
+
+// enabledWriteTools returns the definitions of write tools switched on in config
+func (s *MCPServer) enabledWriteTools() []map[string]interface{} {
+	var tools []map[string]interface{}
+	for _, name := range writeToolOrder {
+		if s.cfg.MCP.Write.Tools[name] {
+			tools = append(tools, writeToolDefinitions[name])
+		}
+	}
+	return tools
+}
+
+// isWriteTool reports whether name is a write tool, enabled or not
+func isWriteTool(name string) bool {
+	_, ok := writeToolDefinitions[name]
+	return ok
+}
+
+func (s *MCPServer) callWriteTool(ctx context.Context, toolName string, args map[string]interface{}) (interface{}, error) {
+	if !s.cfg.MCP.Write.Tools[toolName] {
+		return nil, fmt.Errorf("tool is disabled: %s", toolName)
+	}
+	nav := s.nav(ctx)
+
+	docPath, ok := args["path"].(string)
+	if !ok || docPath == "" {
+		return nil, fmt.Errorf("missing path parameter")
+	}
+	if !s.writeAllowed(docPath) {
+		return nil, fmt.Errorf("writes are not allowed in this folder: %s", docPath)
+	}
+
+	opts := kb.WriteOptions{}
+	opts.DryRun, _ = args["dry_run"].(bool)
+	opts.ExpectedHash, _ = args["expected_hash"].(string)
+
+	var result *kb.WriteResult
+	var err error
+
+	switch toolName {
+	case "create_note":
+		content, _ := args["content"].(string)
+		if name, _ := args["template"].(string); name != "" {
+			vars := map[string]string{
+				"title": strings.TrimSuffix(path.Base(docPath), path.Ext(docPath)),
+				"path":  docPath,
+			}
+			if v, ok := args["variables"].(map[string]interface{}); ok {
+				for k, val := range v {
+					vars[k] = fmt.Sprint(val)
+				}
+			}
+			if content, err = nav.RenderTemplate(name, vars); err != nil {
+				return nil, err
+			}
+		}
+		result, err = nav.CreateNote(docPath, content, opts)
+
+	case "append_to_section":
+		section, _ := args["section"].(string)
+		text, ok := args["text"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing text parameter")
+		}
+		result, err = nav.AppendToSection(docPath, section, text, opts)
+
+	case "replace_section":
+		section, ok := args["section"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing section parameter")
+		}
+		text, ok := args["text"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing text parameter")
+		}
+		result, err = nav.ReplaceSection(docPath, section, text, opts)
+
+	case "set_todo_state":
+		item, ok := args["item"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing item parameter")
+		}
+		state, ok := args["state"].(string)
+		if !ok {
+			return nil, fmt.Errorf("missing state parameter")
+		}
+		result, err = nav.SetTodoState(docPath, item, state, opts)
+
+	case "rename_note":
+		newPath, ok := args["new_path"].(string)
+		if !ok || newPath == "" {
+			return nil, fmt.Errorf("missing new_path parameter")
+		}
+		if !s.writeAllowed(newPath) {
+			return nil, fmt.Errorf("writes are not allowed in this folder: %s", newPath)
+		}
+		result, err = nav.RenameNote(docPath, newPath, opts)
+	}
+
+	if err != nil {
+		s.logger.Warn("write tool failed", "tool", toolName, "path", docPath, "error", err)
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"content": []map[string]interface{}{
+			{
+				"type": "text",
+				"text": formatWriteResult(result),
+			},
+		},
+	}, nil
+}
+
+// writeAllowed checks a document path against the configured write
+// folders. Hidden folders such as .kbnavt, whose prompts and templates are
+// served back as trusted content, must be listed explicitly.
+func (s *MCPServer) writeAllowed(docPath string) bool {
+	clean := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(docPath)), "/")
+	folders := s.cfg.MCP.Write.Folders
+	if len(folders) == 0 {
+		return !inHiddenFolder(clean)
+	}
+
+	for _, folder := range folders {
+		folder = strings.Trim(filepath.ToSlash(filepath.Clean(folder)), "/")
+		if folder == "." || folder == "" {
+			if !inHiddenFolder(clean) {
+				return true
+			}
+		} else if rest, ok := strings.CutPrefix(clean, folder+"/"); ok && !inHiddenFolder(rest) {
+			return true
+		}
+	}
+	return false
+}
+
+// inHiddenFolder tells whether a slash-separated path is below a folder
+// whose name starts with a dot
+func inHiddenFolder(p string) bool {
+	dir := path.Dir(p)
+	if dir == "." {
+		return false
+	}
+	for _, name := range strings.Split(dir, "/") {
+		if strings.HasPrefix(name, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func formatWriteResult(r *kb.WriteResult) string {
+	var b strings.Builder
+
+	switch {
+	case r.Applied:
+		fmt.Fprintf(&b, "Wrote %s\n", r.Path)
+	case r.Diff == "":
+		fmt.Fprintf(&b, "No changes to %s\n", r.Path)
+	default:
+		fmt.Fprintf(&b, "Dry run: nothing was written to %s\n", r.Path)
+	}
+	if r.BaseHash != "" {
+		fmt.Fprintf(&b, "base_hash: %s\n", r.BaseHash)
+	}
+	fmt.Fprintf(&b, "hash: %s\n", r.Hash)
+
+	if r.Diff != "" {
+		b.WriteString("\n")
+		b.WriteString(r.Diff)
+	}
+	return b.String()
+}
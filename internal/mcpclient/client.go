@@ -0,0 +1,383 @@
+// Package mcpclient is a small MCP client used to drive and debug MCP
+// servers, over stdio or HTTP.
+package mcpclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ProtocolVersion is the MCP revision the client asks for
+const ProtocolVersion = "2025-06-18"
+
+// maxMessageSize bounds a single JSON-RPC message read from the server
+const maxMessageSize = 16 << 20
+
+// Message is any JSON-RPC 2.0 message
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+// RPCError is a JSON-RPC error returned by the server
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// InitializeResult is the server's answer to initialize
+type InitializeResult struct {
+	ProtocolVersion string                 `json:"protocolVersion"`
+	Capabilities    map[string]interface{} `json:"capabilities"`
+	ServerInfo      struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"serverInfo"`
+}
+
+// transport moves JSON-RPC messages between client and server
+type transport interface {
+	// send delivers a message; responses and server messages arrive
+	// through the handler passed to the client.
+	send(ctx context.Context, msg Message) error
+	close() error
+}
+
+// Client is a connected MCP client
+type Client struct {
+	t transport
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan Message
+
+	// OnNotification, if set, receives notifications from the server
+	OnNotification func(method string, params json.RawMessage)
+}
+
+func newClient() *Client {
+	return &Client{pending: map[string]chan Message{}}
+}
+
+// NewClient speaks newline-delimited JSON-RPC over r and w
+func NewClient(r io.Reader, w io.WriteCloser) *Client {
+	c := newClient()
+	st := &streamTransport{w: w}
+	c.t = st
+	go st.readLoop(r, c.dispatch, c.closePending)
+	return c
+}
+
+// NewStdioClient starts a server process and talks to it over its stdin and
+// stdout. The server's stderr is passed through to stderr.
+func NewStdioClient(command string, args ...string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", command, err)
+	}
+
+	c := newClient()
+	st := &streamTransport{w: stdin, cmd: cmd}
+	c.t = st
+	go st.readLoop(stdout, c.dispatch, c.closePending)
+	return c, nil
+}
+
+// NewHTTPClient talks to a server exposing the streamable HTTP transport
+func NewHTTPClient(url string) *Client {
+	c := newClient()
+	c.t = &httpTransport{url: url, client: http.DefaultClient, handle: c.dispatch}
+	return c
+}
+
+// Initialize performs the MCP handshake
+func (c *Client) Initialize(ctx context.Context, clientName, clientVersion string) (*InitializeResult, error) {
+	raw, err := c.Call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]interface{}{"name": clientName, "version": clientVersion},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result InitializeResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid initialize result: %w", err)
+	}
+	if err := c.Notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Call sends a request and waits for its result. JSON-RPC errors are
+// returned as *RPCError.
+func (c *Client) Call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.nextID++
+	id := json.RawMessage(strconv.FormatInt(c.nextID, 10))
+	ch := make(chan Message, 1)
+	c.pending[string(id)] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, string(id))
+		c.mu.Unlock()
+	}()
+
+	if err := c.t.send(ctx, Message{JSONRPC: "2.0", ID: id, Method: method, Params: raw}); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp, ok := <-ch:
+		if !ok {
+			return nil, fmt.Errorf("server closed the connection before answering %s", method)
+		}
+		if resp.Error != nil {
+			return nil, resp.Error
+		}
+		return resp.Result, nil
+	case <-ctx.Done():
+		cancel, _ := json.Marshal(map[string]interface{}{"requestId": id, "reason": ctx.Err().Error()})
+		c.t.send(context.Background(), Message{JSONRPC: "2.0", Method: "notifications/cancelled", Params: cancel})
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends a notification
+func (c *Client) Notify(ctx context.Context, method string, params interface{}) error {
+	raw, err := marshalParams(params)
+	if err != nil {
+		return err
+	}
+	return c.t.send(ctx, Message{JSONRPC: "2.0", Method: method, Params: raw})
+}
+
+// Close shuts the connection down and, for stdio, waits for the server to exit
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+// dispatch routes a message from the server
+func (c *Client) dispatch(msg Message) {
+	switch {
+	case msg.Method == "" && msg.ID != nil:
+		c.mu.Lock()
+		ch, ok := c.pending[string(msg.ID)]
+		c.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+
+	case msg.ID != nil:
+		// The client declares no capabilities, so only ping is answered
+		resp := Message{JSONRPC: "2.0", ID: msg.ID}
+		if msg.Method == "ping" {
+			resp.Result = json.RawMessage("{}")
+		} else {
+			resp.Error = &RPCError{Code: -32601, Message: "method not supported by client: " + msg.Method}
+		}
+		c.t.send(context.Background(), resp)
+
+	case c.OnNotification != nil:
+		c.OnNotification(msg.Method, msg.Params)
+	}
+}
+
+// closePending fails all requests waiting for a response
+func (c *Client) closePending() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, ch := range c.pending {
+		close(ch)
+		delete(c.pending, id)
+	}
+}
+
+func marshalParams(params interface{}) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
+
+// streamTransport is newline-delimited JSON-RPC over a pair of streams
+type streamTransport struct {
+	w   io.WriteCloser
+	cmd *exec.Cmd
+
+	writeMu sync.Mutex
+}
+
+func (t *streamTransport) send(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.w.Write(append(data, '\n'))
+	return err
+}
+
+// readLoop hands every message to handle and calls done when the server
+// closes its end.
+func (t *streamTransport) readLoop(r io.Reader, handle func(Message), done func()) {
+	defer done()
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		var msg Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			fmt.Fprintf(os.Stderr, "mcpclient: ignoring invalid message: %s\n", scanner.Text())
+			continue
+		}
+		handle(msg)
+	}
+}
+
+func (t *streamTransport) close() error {
+	err := t.w.Close()
+	if t.cmd != nil {
+		if werr := t.cmd.Wait(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// httpTransport posts each message to the server and reads the answer from
+// either a JSON body or a server-sent event stream.
+type httpTransport struct {
+	url     string
+	client  *http.Client
+	handle  func(Message)
+	session string
+	mu      sync.Mutex
+}
+
+func (t *httpTransport) send(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set("Mcp-Session-Id", t.session)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.session = id
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		resp.Body.Close()
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	// Responses are read in the background so that Call can wait on them
+	go func() {
+		defer resp.Body.Close()
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+			readEvents(resp.Body, t.handle)
+			return
+		}
+		var out Message
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxMessageSize)).Decode(&out); err == nil {
+			t.handle(out)
+		}
+	}()
+	return nil
+}
+
+func (t *httpTransport) close() error {
+	return nil
+}
+
+// readEvents decodes the data lines of a server-sent event stream
+func readEvents(r io.Reader, handle func(Message)) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	var data strings.Builder
+	flush := func() {
+		if data.Len() == 0 {
+			return
+		}
+		var msg Message
+		if err := json.Unmarshal([]byte(data.String()), &msg); err == nil {
+			handle(msg)
+		}
+		data.Reset()
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	flush()
+}
@@ -0,0 +1,148 @@
+package mcpclient
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kbnavt/internal/config"
+	"kbnavt/internal/mcp"
+	"kbnavt/pkg/kb"
+)
+
+// startServer runs an in-process MCP server and returns a client connected to it
+func startServer(t *testing.T, files map[string]string) *Client {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	nav, err := kb.NewNavigator(dir, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{}
+	cfg.KB.BaseDir = dir
+	server := mcp.NewMCPServer(nav, cfg, logger)
+
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.Serve(context.Background(), serverR, serverW)
+		serverW.Close()
+	}()
+
+	c := NewClient(clientR, clientW)
+	t.Cleanup(func() {
+		c.Close()
+		<-done
+	})
+
+	if _, err := c.Initialize(context.Background(), "test", "0"); err != nil {
+		t.Fatalf("initialize failed: %v", err)
+	}
+	return c
+}
+
+func TestSmokeScript(t *testing.T) {
+	c := startServer(t, map[string]string{"notes/a.md": "# A\nalpha\n"})
+
+	script, err := os.Open("testdata/smoke.mcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer script.Close()
+
+	var out bytes.Buffer
+	if err := NewShell(c, &out).RunScript(context.Background(), script); err != nil {
+		t.Fatalf("script failed: %v\n%s", err, out.String())
+	}
+}
+
+func TestScriptReportsFailedAssertion(t *testing.T) {
+	c := startServer(t, map[string]string{"notes/a.md": "# A\nalpha\n"})
+
+	script := strings.Join([]string{
+		`call read_document path=notes/a.md`,
+		`expect alpha`,
+		`expect "no such text"`,
+	}, "\n")
+
+	err := NewShell(c, io.Discard).RunScript(context.Background(), strings.NewReader(script))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Expected failure on line 3, got %v", err)
+	}
+}
+
+func TestShellFailed(t *testing.T) {
+	c := startServer(t, map[string]string{"notes/a.md": "# A\nalpha\n"})
+	sh := NewShell(c, io.Discard)
+
+	for command, want := range map[string]bool{
+		`call read_document path=notes/a.md`:       false,
+		`call read_document path=notes/missing.md`: true,
+		`raw no/such/method`:                       true,
+	} {
+		if err := sh.Exec(context.Background(), command); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+		if sh.Failed() != want {
+			t.Errorf("%s: expected Failed() to be %v", command, want)
+		}
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`call read_document path=a.md`, []string{"call", "read_document", "path=a.md"}},
+		{`call search_documents query="two words" limit=5`, []string{"call", "search_documents", "query=two words", "limit=5"}},
+		{`expect 'it"s'`, []string{"expect", `it"s`}},
+		{`  `, nil},
+	}
+
+	for _, tt := range tests {
+		got, err := splitWords(tt.line)
+		if err != nil {
+			t.Errorf("splitWords(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected %q for %q, got %q", tt.want, tt.line, got)
+		}
+	}
+
+	if _, err := splitWords(`call x path="open`); err == nil {
+		t.Error("Expected error for unterminated quote")
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	args, err := parseAssignments([]string{"path=a.md", "limit=5", "dry_run=true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"path": "a.md", "limit": float64(5), "dry_run": true}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("Expected %v, got %v", want, args)
+	}
+}
@@ -0,0 +1,441 @@
+package mcpclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Shell runs interactive or scripted commands against a Client
+type Shell struct {
+	client *Client
+	out    io.Writer
+
+	// RawJSON prints results as indented JSON instead of text
+	RawJSON bool
+	// Timeout bounds each request; zero means no limit
+	Timeout time.Duration
+
+	last      string // printed output of the last command
+	lastError bool   // the last command failed or returned isError
+}
+
+// NewShell creates a shell that prints to out
+func NewShell(client *Client, out io.Writer) *Shell {
+	return &Shell{client: client, out: out}
+}
+
+// ShellHelp describes the commands understood by Exec
+const ShellHelp = `Commands:
+  tools                          List tools
+  call <tool> [key=value ...]    Call a tool
+  resources                      List resources
+  read <uri>                     Read a resource
+  prompts                        List prompts
+  prompts get <name> [key=value ...]
+                                 Render a prompt
+  raw <method> [json]            Send any request
+  help                           Show this help
+  exit                           Leave the shell
+
+Script assertions (on the output of the previous command):
+  expect <text>                  Output contains text
+  expect-not <text>              Output does not contain text
+  expect-error                   The command failed or returned isError
+  expect-ok                      The command succeeded
+
+Values are parsed as JSON when possible (42, true, {"a":1}) and used as
+strings otherwise. Quote values containing spaces.`
+
+// errExit is returned by Exec when the user asked to leave
+var errExit = errors.New("exit")
+
+// Exec runs one command line
+func (sh *Shell) Exec(ctx context.Context, line string) error {
+	// raw keeps its JSON params verbatim, quotes included
+	if fields := strings.Fields(line); len(fields) > 0 && fields[0] == "raw" {
+		return sh.raw(ctx, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "raw")))
+	}
+
+	words, err := splitWords(line)
+	if err != nil {
+		return err
+	}
+	return sh.ExecArgs(ctx, words)
+}
+
+// ExecArgs runs a command that is already split into words, as given on
+// the command line.
+func (sh *Shell) ExecArgs(ctx context.Context, words []string) error {
+	if len(words) == 0 || strings.HasPrefix(words[0], "#") {
+		return nil
+	}
+	if words[0] == "raw" {
+		return sh.raw(ctx, strings.Join(words[1:], " "))
+	}
+
+	cmd, args := words[0], words[1:]
+	switch cmd {
+	case "exit", "quit":
+		return errExit
+	case "help":
+		fmt.Fprintln(sh.out, ShellHelp)
+		return nil
+	case "expect", "expect-not", "expect-error", "expect-ok":
+		return sh.expect(cmd, strings.Join(args, " "))
+	}
+
+	method, params, err := sh.request(cmd, args)
+	if err != nil {
+		return err
+	}
+
+	return sh.call(ctx, cmd, method, params)
+}
+
+// raw sends "<method> [json]" as is
+func (sh *Shell) raw(ctx context.Context, rest string) error {
+	method, paramsText, _ := strings.Cut(rest, " ")
+	if method == "" {
+		return fmt.Errorf("usage: raw <method> [json]")
+	}
+	var params interface{}
+	if paramsText = strings.TrimSpace(paramsText); paramsText != "" {
+		if err := json.Unmarshal([]byte(paramsText), &params); err != nil {
+			return fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	return sh.call(ctx, "raw", method, params)
+}
+
+func (sh *Shell) call(ctx context.Context, cmd, method string, params interface{}) error {
+	if sh.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sh.Timeout)
+		defer cancel()
+	}
+
+	raw, err := sh.client.Call(ctx, method, params)
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			return err
+		}
+		sh.print(fmt.Sprintf("Error: %s", rpcErr.Error()), true)
+		return nil
+	}
+	sh.show(cmd, raw)
+	return nil
+}
+
+// RunScript executes commands from r, stopping at the first failure.
+// Errors carry the line number of the failing command.
+func (sh *Shell) RunScript(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		err := sh.Exec(ctx, scanner.Text())
+		if errors.Is(err, errExit) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Interact reads commands from in until EOF or exit, reporting errors
+// without stopping.
+func (sh *Shell) Interact(ctx context.Context, in io.Reader) error {
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprint(sh.out, "mcp> ")
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if xerr := sh.Exec(ctx, line); errors.Is(xerr, errExit) {
+				return nil
+			} else if xerr != nil {
+				fmt.Fprintf(sh.out, "Error: %v\n", xerr)
+			}
+		}
+		if err == io.EOF {
+			fmt.Fprintln(sh.out)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// request maps a shell command onto a JSON-RPC method and params
+func (sh *Shell) request(cmd string, args []string) (string, interface{}, error) {
+	switch cmd {
+	case "tools":
+		return "tools/list", map[string]interface{}{}, nil
+
+	case "call":
+		if len(args) < 1 {
+			return "", nil, fmt.Errorf("usage: call <tool> [key=value ...]")
+		}
+		arguments, err := parseAssignments(args[1:])
+		if err != nil {
+			return "", nil, err
+		}
+		return "tools/call", map[string]interface{}{"name": args[0], "arguments": arguments}, nil
+
+	case "resources":
+		return "resources/list", map[string]interface{}{}, nil
+
+	case "read":
+		if len(args) != 1 {
+			return "", nil, fmt.Errorf("usage: read <uri>")
+		}
+		return "resources/read", map[string]interface{}{"uri": args[0]}, nil
+
+	case "prompts":
+		if len(args) == 0 {
+			return "prompts/list", map[string]interface{}{}, nil
+		}
+		if args[0] != "get" || len(args) < 2 {
+			return "", nil, fmt.Errorf("usage: prompts get <name> [key=value ...]")
+		}
+		arguments, err := parseAssignments(args[2:])
+		if err != nil {
+			return "", nil, err
+		}
+		// Prompt arguments are strings on the wire
+		stringArgs := map[string]string{}
+		for k, v := range arguments {
+			if s, ok := v.(string); ok {
+				stringArgs[k] = s
+			} else {
+				data, _ := json.Marshal(v)
+				stringArgs[k] = string(data)
+			}
+		}
+		return "prompts/get", map[string]interface{}{"name": args[1], "arguments": stringArgs}, nil
+
+	default:
+		return "", nil, fmt.Errorf("unknown command: %s (try help)", cmd)
+	}
+}
+
+// show pretty-prints a result according to the command that produced it
+func (sh *Shell) show(cmd string, raw json.RawMessage) {
+	if sh.RawJSON {
+		sh.print(indentJSON(raw), resultIsError(raw))
+		return
+	}
+
+	var b strings.Builder
+	switch cmd {
+	case "tools":
+		var res struct {
+			Tools []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			} `json:"tools"`
+		}
+		json.Unmarshal(raw, &res)
+		for _, t := range res.Tools {
+			fmt.Fprintf(&b, "%-22s %s\n", t.Name, t.Description)
+		}
+
+	case "resources":
+		var res struct {
+			Resources []struct {
+				URI  string `json:"uri"`
+				Name string `json:"name"`
+			} `json:"resources"`
+		}
+		json.Unmarshal(raw, &res)
+		for _, r := range res.Resources {
+			fmt.Fprintf(&b, "%-40s %s\n", r.URI, r.Name)
+		}
+
+	case "prompts":
+		var res struct {
+			Prompts []struct {
+				Name        string `json:"name"`
+				Description string `json:"description"`
+			} `json:"prompts"`
+			Messages []struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			} `json:"messages"`
+		}
+		json.Unmarshal(raw, &res)
+		for _, p := range res.Prompts {
+			fmt.Fprintf(&b, "%-22s %s\n", p.Name, p.Description)
+		}
+		for _, m := range res.Messages {
+			fmt.Fprintf(&b, "[%s]\n%s\n", m.Role, contentText([]json.RawMessage{m.Content}))
+		}
+
+	case "call", "read":
+		var res struct {
+			Content  []json.RawMessage `json:"content"`
+			Contents []json.RawMessage `json:"contents"`
+		}
+		json.Unmarshal(raw, &res)
+		text := contentText(append(res.Content, res.Contents...))
+		if resultIsError(raw) {
+			text = "Error: " + text
+		}
+		b.WriteString(text)
+		b.WriteString("\n")
+	}
+
+	if b.Len() == 0 {
+		b.WriteString(indentJSON(raw))
+	}
+	sh.print(strings.TrimRight(b.String(), "\n"), resultIsError(raw))
+}
+
+// Failed reports whether the last command failed or returned isError
+func (sh *Shell) Failed() bool {
+	return sh.lastError
+}
+
+func (sh *Shell) print(text string, isError bool) {
+	sh.last = text
+	sh.lastError = isError
+	fmt.Fprintln(sh.out, text)
+}
+
+func (sh *Shell) expect(kind, text string) error {
+	switch kind {
+	case "expect":
+		if !strings.Contains(sh.last, text) {
+			return fmt.Errorf("expected output to contain %q, got:\n%s", text, sh.last)
+		}
+	case "expect-not":
+		if strings.Contains(sh.last, text) {
+			return fmt.Errorf("expected output not to contain %q, got:\n%s", text, sh.last)
+		}
+	case "expect-error":
+		if !sh.lastError {
+			return fmt.Errorf("expected an error, got:\n%s", sh.last)
+		}
+	case "expect-ok":
+		if sh.lastError {
+			return fmt.Errorf("expected success, got:\n%s", sh.last)
+		}
+	}
+	return nil
+}
+
+// contentText joins the text of MCP content items; other items are shown
+// as JSON.
+func contentText(items []json.RawMessage) string {
+	var parts []string
+	for _, item := range items {
+		var c struct {
+			Type     string `json:"type"`
+			Text     string `json:"text"`
+			URI      string `json:"uri"`
+			Resource *struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"resource"`
+		}
+		json.Unmarshal(item, &c)
+		switch {
+		case c.Resource != nil:
+			parts = append(parts, fmt.Sprintf("--- %s\n%s", c.Resource.URI, c.Resource.Text))
+		case c.Text != "" || c.Type == "text":
+			parts = append(parts, c.Text)
+		default:
+			parts = append(parts, indentJSON(item))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func resultIsError(raw json.RawMessage) bool {
+	var res struct {
+		IsError bool `json:"isError"`
+	}
+	json.Unmarshal(raw, &res)
+	return res.IsError
+}
+
+func indentJSON(raw json.RawMessage) string {
+	var v interface{}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return string(raw)
+	}
+	data, _ := json.MarshalIndent(v, "", "  ")
+	return string(data)
+}
+
+// parseAssignments turns key=value words into arguments. Values that parse
+// as JSON keep their type; everything else is a string.
+func parseAssignments(words []string) (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	for _, w := range words {
+		key, value, ok := strings.Cut(w, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", w)
+		}
+		var v interface{}
+		if err := json.Unmarshal([]byte(value), &v); err == nil {
+			args[key] = v
+		} else {
+			args[key] = value
+		}
+	}
+	return args, nil
+}
+
+// splitWords splits a command line on spaces, honouring single and double
+// quotes and backslash escapes inside double quotes.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(strings.TrimSpace(line))
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else if r == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in: %s", line)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
@@ -0,0 +1,79 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var orgPlanningRe = regexp.MustCompile(`(SCHEDULED|DEADLINE|CLOSED):\s*[<\[](\d{4}-\d{2}-\d{2})`)
+
+// Agenda returns Org entries scheduled, due or closed in [from, to)
+func (n *Navigator) Agenda(from, to time.Time) ([]AgendaEntry, error) {
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AgendaEntry
+	for _, doc := range docs {
+		if doc.Format != FormatOrg {
+			continue
+		}
+
+		content, err := os.ReadFile(filepath.Join(n.baseDir, doc.Path))
+		if err != nil {
+			n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+
+		entries = append(entries, orgAgendaEntries(doc.Path, string(content), from, to)...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return entries, nil
+}
+
+func orgAgendaEntries(path, content string, from, to time.Time) []AgendaEntry {
+	lines := strings.Split(content, "\n")
+	spans := scanSections(content, FormatOrg)
+
+	var entries []AgendaEntry
+	for i, span := range spans {
+		// Planning lines belong to the headline's own body, not its children
+		bodyEnd := span.End
+		if i+1 < len(spans) && spans[i+1].Line < bodyEnd {
+			bodyEnd = spans[i+1].Line
+		}
+
+		seen := map[string]bool{}
+		for _, line := range lines[span.Line+1 : bodyEnd] {
+			for _, m := range orgPlanningRe.FindAllStringSubmatch(line, -1) {
+				date, err := time.ParseInLocation("2006-01-02", m[2], from.Location())
+				if err != nil || date.Before(from) || !date.Before(to) {
+					continue
+				}
+				kind := strings.ToLower(m[1])
+				if seen[kind] {
+					continue
+				}
+				seen[kind] = true
+
+				entries = append(entries, AgendaEntry{
+					Path:    path,
+					Title:   span.Title,
+					Todo:    span.Todo,
+					Kind:    kind,
+					Date:    date,
+					Content: strings.TrimSpace(strings.Join(lines[span.Line:bodyEnd], "\n")),
+				})
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,129 @@
+package kb
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// HeaderPathSeparator joins the titles of nested headings for display
+const HeaderPathSeparator = " › "
+
+// Chunk is a contiguous piece of a document, cut along section boundaries
+type Chunk struct {
+	Heading string `json:"heading,omitempty"` // header path of the first section in the chunk
+	Text    string `json:"text"`
+	Line    int    `json:"line"` // one-based line where the chunk starts
+}
+
+// ChunkDocument splits content into chunks of at most maxChars characters.
+// Sections are kept whole where possible and small neighbours are merged;
+// oversized sections are split at paragraph breaks.
+func ChunkDocument(content string, format Format, maxChars int) []Chunk {
+	if maxChars <= 0 || utf8.RuneCountInString(content) <= maxChars {
+		if strings.TrimSpace(content) == "" {
+			return nil
+		}
+		return []Chunk{{Text: content, Line: 1}}
+	}
+
+	lines := strings.Split(content, "\n")
+	spans := scanSections(content, format)
+
+	// Each block is a heading's own body, up to its first child heading
+	type block struct {
+		heading string
+		line    int
+		text    string
+	}
+	var blocks []block
+
+	first := len(lines)
+	if len(spans) > 0 {
+		first = spans[0].Line
+	}
+	if first > 0 {
+		blocks = append(blocks, block{line: 0, text: strings.Join(lines[:first], "\n")})
+	}
+	for i, span := range spans {
+		end := span.End
+		if i+1 < len(spans) && spans[i+1].Line < end {
+			end = spans[i+1].Line
+		}
+		heading := strings.Join(append(append([]string{}, span.Path...), span.Title), HeaderPathSeparator)
+		blocks = append(blocks, block{heading: heading, line: span.Line, text: strings.Join(lines[span.Line:end], "\n")})
+	}
+
+	var chunks []Chunk
+	var cur *Chunk
+	curLen := 0
+
+	flush := func() {
+		if cur != nil && strings.TrimSpace(cur.Text) != "" {
+			chunks = append(chunks, *cur)
+		}
+		cur = nil
+		curLen = 0
+	}
+
+	for _, b := range blocks {
+		for _, piece := range splitText(b.text, maxChars) {
+			n := utf8.RuneCountInString(piece)
+			if cur != nil && curLen+n+1 > maxChars {
+				flush()
+			}
+			if cur == nil {
+				cur = &Chunk{Heading: b.heading, Line: b.line + 1, Text: piece}
+				curLen = n
+				continue
+			}
+			cur.Text += "\n" + piece
+			curLen += n + 1
+		}
+	}
+	flush()
+
+	return chunks
+}
+
+// splitText cuts text into pieces of at most maxChars characters, preferring
+// paragraph breaks, then line breaks, then arbitrary rune boundaries.
+func splitText(text string, maxChars int) []string {
+	if utf8.RuneCountInString(text) <= maxChars {
+		return []string{text}
+	}
+
+	for _, sep := range []string{"\n\n", "\n"} {
+		parts := strings.Split(text, sep)
+		if len(parts) < 2 {
+			continue
+		}
+
+		var pieces []string
+		var cur strings.Builder
+		for _, part := range parts {
+			if cur.Len() > 0 && utf8.RuneCountInString(cur.String())+len(sep)+utf8.RuneCountInString(part) > maxChars {
+				pieces = append(pieces, cur.String())
+				cur.Reset()
+			}
+			if cur.Len() > 0 {
+				cur.WriteString(sep)
+			}
+			cur.WriteString(part)
+		}
+		pieces = append(pieces, cur.String())
+
+		var out []string
+		for _, p := range pieces {
+			out = append(out, splitText(p, maxChars)...)
+		}
+		return out
+	}
+
+	var out []string
+	runes := []rune(text)
+	for len(runes) > maxChars {
+		out = append(out, string(runes[:maxChars]))
+		runes = runes[maxChars:]
+	}
+	return append(out, string(runes))
+}
@@ -0,0 +1,356 @@
+package kb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultDuplicateThreshold is the similarity from which notes and sections
+// count as near-duplicates
+const DefaultDuplicateThreshold = 0.8
+
+// Near-duplicates are found with MinHash signatures of word shingles,
+// bucketed by locality-sensitive hashing: lshBands bands of lshRows
+// hashes. Pairs sharing a band are then compared exactly. Pairs as similar
+// as 0.5 share a band with a probability of 87%, pairs at 0.8 almost
+// always.
+const (
+	shingleWords = 5 // words per shingle
+	lshBands     = 32
+	lshRows      = 4
+	minHashes    = lshBands * lshRows
+)
+
+// minDuplicateWords is the size from which sections are compared, so that
+// short boilerplate such as an empty "Attendees" list doesn't count
+const minDuplicateWords = 20
+
+// DuplicateOptions selects the notes compared and how similar they must be
+type DuplicateOptions struct {
+	Filter    DocumentFilter
+	Threshold float64 // from 0 to 1; 0 means DefaultDuplicateThreshold
+}
+
+// DuplicateReport lists the copies found in the KB
+type DuplicateReport struct {
+	Exact    []ExactDuplicates  `json:"exact"`
+	Near     []NearDuplicate    `json:"near"`
+	Sections []SectionDuplicate `json:"sections"` // between notes that aren't duplicates themselves
+}
+
+// ExactDuplicates are notes with the same content, ignoring line endings
+// and trailing whitespace
+type ExactDuplicates struct {
+	Hash  string   `json:"hash"` // SHA-256 of the content
+	Size  int64    `json:"size"`
+	Paths []string `json:"paths"`
+}
+
+// NearDuplicate is a pair of notes with mostly the same text
+type NearDuplicate struct {
+	Paths       [2]string           `json:"paths"`
+	Similarity  float64             `json:"similarity"` // Jaccard index of the notes' word shingles
+	Differences []SectionDifference `json:"differences"`
+}
+
+// SectionDifference is a section that differs between two near-duplicate
+// notes, or that only one of them has
+type SectionDifference struct {
+	Header     string  `json:"header"`         // header path, empty for the text before the first heading
+	Similarity float64 `json:"similarity"`     // 0 when only one note has the section
+	Only       string  `json:"only,omitempty"` // the note that has the section, when the other lacks it
+}
+
+// SectionDuplicate is a pair of sections with mostly the same text
+type SectionDuplicate struct {
+	Sections   [2]DuplicateSection `json:"sections"`
+	Similarity float64             `json:"similarity"`
+}
+
+// DuplicateSection locates a duplicated section
+type DuplicateSection struct {
+	Path   string `json:"path"`
+	Header string `json:"header"` // header path, empty for the text before the first heading
+	Line   int    `json:"line"`   // one-based line of the heading
+}
+
+// shingled is a note or section as it is compared
+type shingled struct {
+	doc       int // index of the note
+	section   DuplicateSection
+	text      string // normalized
+	shingles  map[uint64]bool
+	signature [minHashes]uint64
+}
+
+// FindDuplicates finds notes with the same content, notes with mostly the
+// same text along with the sections that differ between them, and sections
+// copied between otherwise different notes.
+func (n *Navigator) FindDuplicates(opts DuplicateOptions) (*DuplicateReport, error) {
+	threshold := opts.Threshold
+	if threshold == 0 {
+		threshold = DefaultDuplicateThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, newError(ErrInvalid, "threshold must be between 0 and 1")
+	}
+
+	docs, err := n.filterDocuments(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].Path < docs[j].Path })
+
+	report := &DuplicateReport{Exact: []ExactDuplicates{}, Near: []NearDuplicate{}, Sections: []SectionDuplicate{}}
+	byHash := map[string]*ExactDuplicates{}
+	var notes, sections []*shingled
+	var paths []string
+	var noteSections [][]*sectionText
+	for _, doc := range docs {
+		fullDoc, err := n.ReadDocument(doc.Path)
+		if err != nil {
+			n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+		text := normalizeContent(fullDoc.Content)
+		if text == "" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(text))
+		hash := hex.EncodeToString(sum[:])
+		if group, ok := byHash[hash]; ok {
+			// Copies are compared once, as the first of them
+			group.Paths = append(group.Paths, filepath.ToSlash(doc.Path))
+			continue
+		}
+		byHash[hash] = &ExactDuplicates{Hash: hash, Size: doc.Size, Paths: []string{filepath.ToSlash(doc.Path)}}
+
+		index := len(paths)
+		paths = append(paths, filepath.ToSlash(doc.Path))
+		notes = append(notes, newShingled(index, DuplicateSection{Path: paths[index]}, text))
+		noteSections = append(noteSections, duplicateSections(paths[index], fullDoc))
+		for _, s := range noteSections[index] {
+			if s.words >= minDuplicateWords {
+				s.doc = index
+				sections = append(sections, s.shingled)
+			}
+		}
+	}
+	for _, group := range byHash {
+		if len(group.Paths) > 1 {
+			report.Exact = append(report.Exact, *group)
+		}
+	}
+	sort.Slice(report.Exact, func(i, j int) bool { return report.Exact[i].Paths[0] < report.Exact[j].Paths[0] })
+
+	near := map[[2]int]bool{}
+	for _, pair := range similarPairs(notes, threshold) {
+		a, b := notes[pair.a], notes[pair.b]
+		near[[2]int{a.doc, b.doc}] = true
+		report.Near = append(report.Near, NearDuplicate{
+			Paths:       [2]string{paths[a.doc], paths[b.doc]},
+			Similarity:  pair.similarity,
+			Differences: sectionDifferences(noteSections[a.doc], noteSections[b.doc]),
+		})
+	}
+
+	for _, pair := range similarPairs(sections, threshold) {
+		a, b := sections[pair.a], sections[pair.b]
+		if a.doc == b.doc || near[[2]int{a.doc, b.doc}] || near[[2]int{b.doc, a.doc}] {
+			continue
+		}
+		report.Sections = append(report.Sections, SectionDuplicate{
+			Sections:   [2]DuplicateSection{a.section, b.section},
+			Similarity: pair.similarity,
+		})
+	}
+	return report, nil
+}
+
+// sectionDifferences compares the sections of two near-duplicate notes,
+// matching them by header path, in order when a header path repeats
+func sectionDifferences(a, b []*sectionText) []SectionDifference {
+	others := map[string][]*sectionText{}
+	for _, s := range b {
+		others[s.section.Header] = append(others[s.section.Header], s)
+	}
+	differences := []SectionDifference{}
+	for _, s := range a {
+		matches := others[s.section.Header]
+		if len(matches) == 0 {
+			differences = append(differences, SectionDifference{Header: s.section.Header, Only: s.section.Path})
+			continue
+		}
+		other := matches[0]
+		others[s.section.Header] = matches[1:]
+		if s.text != other.text {
+			differences = append(differences, SectionDifference{Header: s.section.Header, Similarity: jaccard(s.shingles, other.shingles)})
+		}
+	}
+	for _, s := range b {
+		if rest := others[s.section.Header]; len(rest) > 0 && rest[0] == s {
+			others[s.section.Header] = rest[1:]
+			differences = append(differences, SectionDifference{Header: s.section.Header, Only: s.section.Path})
+		}
+	}
+	return differences
+}
+
+// sectionText is a section of a note with its size in words
+type sectionText struct {
+	*shingled
+	words int
+}
+
+// duplicateSections splits a note into the text before its first heading
+// and its headings, each with its text up to the next heading
+func duplicateSections(path string, doc *Document) []*sectionText {
+	lines := strings.Split(doc.Content, "\n")
+	spans := scanSections(doc.Content, doc.Format)
+
+	var sections []*sectionText
+	add := func(section DuplicateSection, text string) {
+		text = normalizeContent(text)
+		s := newShingled(0, section, text)
+		sections = append(sections, &sectionText{shingled: s, words: len(analyzeTerms(text))})
+	}
+	first := len(lines)
+	if len(spans) > 0 {
+		first = spans[0].Line
+	}
+	if preamble := strings.Join(lines[:first], "\n"); strings.TrimSpace(preamble) != "" {
+		add(DuplicateSection{Path: path, Line: 1}, preamble)
+	}
+	for i, span := range spans {
+		end := span.End
+		if i+1 < len(spans) && spans[i+1].Line < end {
+			end = spans[i+1].Line
+		}
+		header := strings.Join(append(append([]string{}, span.Path...), span.Title), HeaderPathSeparator)
+		add(DuplicateSection{Path: path, Header: header, Line: span.Line + 1}, strings.Join(lines[span.Line+1:end], "\n"))
+	}
+	return sections
+}
+
+func newShingled(doc int, section DuplicateSection, text string) *shingled {
+	s := &shingled{doc: doc, section: section, text: text, shingles: shingles(text)}
+	s.signature = minHash(s.shingles)
+	return s
+}
+
+// normalizeContent drops carriage returns, trailing whitespace and blank
+// lines at either end, which copies often differ by
+func normalizeContent(content string) string {
+	lines := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Trim(strings.Join(lines, "\n"), "\n")
+}
+
+// shingles hashes every run of shingleWords consecutive words of text, or
+// all of its words when it has fewer
+func shingles(text string) map[uint64]bool {
+	words := analyzeTerms(text)
+	set := map[uint64]bool{}
+	size := min(shingleWords, len(words))
+	for i := 0; size > 0 && i+size <= len(words); i++ {
+		h := fnv.New64a()
+		for _, word := range words[i : i+size] {
+			h.Write([]byte(word))
+			h.Write([]byte{0})
+		}
+		set[h.Sum64()] = true
+	}
+	return set
+}
+
+// minHash keeps the smallest of each of minHashes hashes of the shingles;
+// two sets agree on a hash as often as their Jaccard index
+func minHash(set map[uint64]bool) [minHashes]uint64 {
+	var signature [minHashes]uint64
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+	for shingle := range set {
+		for i := range signature {
+			if h := mix64(shingle ^ uint64(i+1)*0x9e3779b97f4a7c15); h < signature[i] {
+				signature[i] = h
+			}
+		}
+	}
+	return signature
+}
+
+// mix64 is the SplitMix64 finalizer
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
+
+func jaccard(a, b map[uint64]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for shingle := range a {
+		if b[shingle] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+type similarPair struct {
+	a, b       int
+	similarity float64
+}
+
+// similarPairs returns the pairs of items at least threshold similar, most
+// similar first
+func similarPairs(items []*shingled, threshold float64) []similarPair {
+	candidates := map[[2]int]bool{}
+	for band := 0; band < lshBands; band++ {
+		buckets := map[[lshRows]uint64][]int{}
+		for i, item := range items {
+			if len(item.shingles) == 0 {
+				continue
+			}
+			var key [lshRows]uint64
+			copy(key[:], item.signature[band*lshRows:])
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, bucket := range buckets {
+			for x := 0; x < len(bucket); x++ {
+				for y := x + 1; y < len(bucket); y++ {
+					candidates[[2]int{bucket[x], bucket[y]}] = true
+				}
+			}
+		}
+	}
+
+	var pairs []similarPair
+	for c := range candidates {
+		if s := jaccard(items[c[0]].shingles, items[c[1]].shingles); s >= threshold {
+			pairs = append(pairs, similarPair{a: c[0], b: c[1], similarity: s})
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].similarity != pairs[j].similarity {
+			return pairs[i].similarity > pairs[j].similarity
+		}
+		if pairs[i].a != pairs[j].a {
+			return pairs[i].a < pairs[j].a
+		}
+		return pairs[i].b < pairs[j].b
+	})
+	return pairs
+}
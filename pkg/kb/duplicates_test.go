@@ -0,0 +1,97 @@
+package kb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	meeting := "# Weekly sync\n" +
+		"We agreed to move the launch to March because the payment provider needs two more weeks of testing and the new pricing is not approved yet.\n" +
+		"## Actions\n" +
+		"Alice drafts the migration plan, Bob reviews the rollback steps and Carol books the load test environment for the last week of February.\n"
+	runbook := "* Restart the API\n" +
+		"Drain the node first, then restart the service with systemctl and watch the error rate on the dashboard for ten minutes.\n" +
+		"* Escalation\n" +
+		"Page the on-call engineer when the error rate stays above one percent after the restart, and open an incident.\n" +
+		"* Checks\n" +
+		"Confirm the health endpoint answers, the queue depth is back to normal and no customer reported errors in the support channel since the restart began.\n" +
+		"* Follow-up\n" +
+		"Write a short summary in the incident channel with the timeline, the root cause if known, the customers affected and the tickets created, then schedule a review for the next working day with everyone involved.\n"
+	forked := strings.Replace(runbook, "ten minutes", "fifteen minutes", 1) + "* Notes\nOld hosts need a reboot.\n"
+
+	nav := newTestNavigator(t, map[string]string{
+		"meetings/sync.md":    meeting,
+		"inbox/sync copy.md":  strings.ReplaceAll(meeting, "\n", "\r\n") + "\n\n",
+		"projects/launch.md":  "# Launch\nThe launch needs a press release, updated pricing pages, a support rota for the first week and a go or no-go review with every team lead two days before.\n" + meeting,
+		"ops/restart.org":     runbook,
+		"ops/old/restart.org": forked,
+		"garden.md":           "# Garden\nWater the lawn every morning before the sun gets too hot for the seedlings.\n",
+		"empty.md":            "",
+		"also-empty.md":       "\n",
+	})
+
+	report, err := nav.FindDuplicates(DuplicateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Exact) != 1 || strings.Join(report.Exact[0].Paths, "|") != "inbox/sync copy.md|meetings/sync.md" {
+		t.Errorf("Expected the pasted meeting notes to be exact copies, got %+v", report.Exact)
+	}
+
+	if len(report.Near) != 1 || report.Near[0].Paths != [2]string{"ops/old/restart.org", "ops/restart.org"} {
+		t.Fatalf("Expected the forked runbook to be a near-duplicate, got %+v", report.Near)
+	}
+	fork := report.Near[0]
+	if fork.Similarity < 0.8 || fork.Similarity == 1 {
+		t.Errorf("Unexpected similarity %v", fork.Similarity)
+	}
+	if len(fork.Differences) != 2 ||
+		fork.Differences[0].Header != "Restart the API" || fork.Differences[0].Similarity == 0 || fork.Differences[0].Only != "" ||
+		fork.Differences[1].Header != "Notes" || fork.Differences[1].Only != "ops/old/restart.org" {
+		t.Errorf("Expected the changed and the added section, got %+v", fork.Differences)
+	}
+
+	// The meeting pasted into a longer note is found by section
+	var sections []string
+	for _, d := range report.Sections {
+		sections = append(sections, d.Sections[0].Path+" › "+d.Sections[0].Header+" = "+d.Sections[1].Path+" › "+d.Sections[1].Header)
+	}
+	want := []string{
+		"inbox/sync copy.md › Weekly sync = projects/launch.md › Weekly sync",
+		"inbox/sync copy.md › Weekly sync › Actions = projects/launch.md › Weekly sync › Actions",
+	}
+	if strings.Join(sections, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Expected the copied sections, got:\n%s", strings.Join(sections, "\n"))
+	}
+
+	// Only the notes matching the filter are compared
+	report, err = nav.FindDuplicates(DuplicateOptions{Filter: DocumentFilter{Folder: "meetings"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Exact)+len(report.Near)+len(report.Sections) != 0 {
+		t.Errorf("Expected no duplicates in a folder with a single note, got %+v", report)
+	}
+
+	if _, err := nav.FindDuplicates(DuplicateOptions{Threshold: 1.5}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid threshold to be rejected, got %v", err)
+	}
+}
+
+func TestFindDuplicatesWithinNote(t *testing.T) {
+	body := "Review the open incidents, check the deployment calendar for the coming days and agree who takes the on-call shift over the weekend.\n"
+	nav := newTestNavigator(t, map[string]string{
+		"weekly.md": "# Week 1\n" + body + "# Week 2\n" + body,
+	})
+
+	report, err := nav.FindDuplicates(DuplicateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Sections) != 0 {
+		t.Errorf("Expected sections of the same note not to be reported, got %+v", report.Sections)
+	}
+}
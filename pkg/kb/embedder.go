@@ -0,0 +1,191 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Embedder turns texts into vectors whose cosine similarity measures how
+// close the texts are in meaning. Implementations must be safe for
+// concurrent use.
+type Embedder interface {
+	// Name identifies the model and its settings. Vectors are only compared
+	// with vectors of the same name; a new name re-embeds the KB.
+	Name() string
+	// Embed returns one vector per text, all of the same length
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// DefaultHashDimensions is the vector length of the hash embedder
+const DefaultHashDimensions = 512
+
+// HashEmbedder embeds texts offline by hashing their words and the
+// character trigrams of those words into a fixed number of dimensions. It
+// needs no model, and brings together texts that share words or parts of
+// words ("deploys", "redeploy"), not synonyms.
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder returns a hash embedder; dimensions <= 0 means
+// DefaultHashDimensions
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = DefaultHashDimensions
+	}
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+// Name implements Embedder
+func (e *HashEmbedder) Name() string {
+	return fmt.Sprintf("hash-v1/%d", e.dimensions)
+}
+
+// Embed implements Embedder
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	features := map[string]float64{}
+	words := strings.FieldsFunc(foldText(strings.ToLower(text)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		features["w:"+word]++
+		runes := []rune("<" + word + ">")
+		for i := 0; i+3 <= len(runes); i++ {
+			features["t:"+string(runes[i:i+3])] += 0.5
+		}
+	}
+
+	vector := make([]float32, e.dimensions)
+	for feature, count := range features {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		weight := 1 + math.Log(count) // repeated words count less and less
+		if count < 1 {
+			weight = count
+		}
+		if sum&(1<<63) != 0 {
+			weight = -weight // signed hashing keeps collisions from adding up
+		}
+		vector[sum%uint64(e.dimensions)] += float32(weight)
+	}
+	return normalize(vector)
+}
+
+// HTTPEmbedder calls an OpenAI-compatible embeddings endpoint, such as
+// OpenAI's, Ollama's or a llama.cpp server's /v1/embeddings.
+type HTTPEmbedder struct {
+	URL    string // e.g. http://localhost:11434/v1/embeddings
+	Model  string
+	APIKey string // sent as a bearer token when set
+	Client *http.Client
+}
+
+// NewHTTPEmbedder returns an embedder for the endpoint at url
+func NewHTTPEmbedder(url, model, apiKey string) *HTTPEmbedder {
+	return &HTTPEmbedder{URL: url, Model: model, APIKey: apiKey, Client: &http.Client{Timeout: time.Minute}}
+}
+
+// Name implements Embedder
+func (e *HTTPEmbedder) Name() string {
+	return "http/" + e.Model
+}
+
+// Embed implements Embedder
+func (e *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, _ := json.Marshal(map[string]interface{}{"model": e.Model, "input": texts})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.APIKey)
+	}
+
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("embedding request failed: %s: %s", resp.Status, strings.TrimSpace(string(detail)))
+	}
+
+	var result struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid embedding response: %w", err)
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range result.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, fmt.Errorf("invalid embedding response: index %d out of range", d.Index)
+		}
+		vectors[d.Index] = normalize(d.Embedding)
+	}
+	for i, v := range vectors {
+		if v == nil {
+			return nil, fmt.Errorf("invalid embedding response: no vector for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// normalize scales v to unit length in place, so that cosine similarity is
+// a dot product
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// dot is the cosine similarity of two normalized vectors
+func dot(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,82 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error kinds returned by the navigator. Callers test for them with
+// errors.Is; the error text carries the details (path, section, ...).
+var (
+	// ErrNotFound means a document, folder or template does not exist
+	ErrNotFound = errors.New("not found")
+	// ErrForbiddenPath means a path escapes the KB or the navigator's scope
+	ErrForbiddenPath = errors.New("forbidden path")
+	// ErrUnsupportedFormat means the file type is not one the KB serves
+	ErrUnsupportedFormat = errors.New("unsupported format")
+	// ErrTooLarge means a document exceeds the configured size limit
+	ErrTooLarge = errors.New("document too large")
+	// ErrSectionNotFound means a heading, headline or task is missing
+	ErrSectionNotFound = errors.New("section not found")
+	// ErrInvalid means the input or document content can't be processed:
+	// parse failures, broken templates, unknown TODO states
+	ErrInvalid = errors.New("invalid input")
+	// ErrConflict means a write clashes with the current state of the KB
+	ErrConflict = errors.New("conflict")
+)
+
+// kbError gives an error kind a specific message
+type kbError struct {
+	kind error
+	msg  string
+	err  error
+}
+
+func (e *kbError) Error() string {
+	if e.err != nil {
+		return e.msg + ": " + e.err.Error()
+	}
+	return e.msg
+}
+
+func (e *kbError) Unwrap() []error {
+	if e.err != nil {
+		return []error{e.kind, e.err}
+	}
+	return []error{e.kind}
+}
+
+// newError returns an error of the given kind with a formatted message
+func newError(kind error, format string, args ...interface{}) error {
+	return &kbError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// wrapError is newError for a failure caused by err
+func wrapError(kind error, err error, format string, args ...interface{}) error {
+	return &kbError{kind: kind, msg: fmt.Sprintf(format, args...), err: err}
+}
+
+// errorCodes names each error kind for clients, most specific first
+var errorCodes = []struct {
+	kind error
+	code string
+}{
+	{ErrForbiddenPath, "forbidden_path"},
+	{ErrSectionNotFound, "section_not_found"},
+	{ErrNotFound, "not_found"},
+	{ErrUnsupportedFormat, "unsupported_format"},
+	{ErrTooLarge, "too_large"},
+	{ErrInvalid, "invalid"},
+	{ErrConflict, "conflict"},
+}
+
+// ErrorCode returns a stable, machine-readable name for the kind of err,
+// or "" if it is not one of the navigator's error kinds.
+func ErrorCode(err error) string {
+	for _, e := range errorCodes {
+		if errors.Is(err, e.kind) {
+			return e.code
+		}
+	}
+	return ""
+}
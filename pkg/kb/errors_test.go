@@ -0,0 +1,55 @@
+package kb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorKinds(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"notes/a.md":  "# A\nalpha\n",
+		"notes/b.bin": "binary",
+		"big.md":      strings.Repeat("x", 100),
+	})
+	nav.SetMaxSize(50)
+
+	tests := []struct {
+		name string
+		err  error
+		kind error
+		code string
+	}{
+		{"Missing document", second(nav.ReadDocument("notes/missing.md")), ErrNotFound, "not_found"},
+		{"Traversal", second(nav.ReadDocument("../etc/passwd")), ErrForbiddenPath, "forbidden_path"},
+		{"Out of scope", second(nav.WithScope([]string{"other"}).ReadDocument("notes/a.md")), ErrForbiddenPath, "forbidden_path"},
+		{"Unsupported format", second(nav.ReadDocument("notes/b.bin")), ErrUnsupportedFormat, "unsupported_format"},
+		{"Too large", second(nav.ReadDocument("big.md")), ErrTooLarge, "too_large"},
+		{"Missing section", second(nav.ReadSection("notes/a.md", "Nope")), ErrSectionNotFound, "section_not_found"},
+		{"Existing note", second(nav.CreateNote("notes/a.md", "x", WriteOptions{})), ErrConflict, "conflict"},
+		{"Bad todo state", second(nav.SetTodoState("notes/a.md", "A", "MAYBE", WriteOptions{})), ErrInvalid, "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.kind) {
+				t.Errorf("Expected %v, got %v", tt.kind, tt.err)
+			}
+			if code := ErrorCode(tt.err); code != tt.code {
+				t.Errorf("Expected code %q, got %q", tt.code, code)
+			}
+		})
+	}
+
+	if !strings.Contains(second(nav.ReadDocument("notes/missing.md")).Error(), "document not found: notes/missing.md") {
+		t.Error("Expected the message to name the document")
+	}
+	if ErrorCode(errors.New("boom")) != "" {
+		t.Error("Expected no code for foreign errors")
+	}
+}
+
+// second returns the error of a (value, error) pair
+func second[T any](_ T, err error) error {
+	return err
+}
@@ -0,0 +1,389 @@
+package kb
+
+import (
+	"context"
+	"math"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// Facet is a property search results are counted by
+type Facet string
+
+const (
+	FacetFolder Facet = "folder" // the next folder level below the filtered folder
+	FacetFormat Facet = "format"
+	FacetTag    Facet = "tag"  // Org and front matter tags, lowercased
+	FacetYear   Facet = "year" // year of the last modification
+	FacetTodo   Facet = "todo" // TODO state of Org headlines
+)
+
+// Facets lists every facet, in the order they are reported
+var Facets = []Facet{FacetFolder, FacetFormat, FacetTag, FacetYear, FacetTodo}
+
+// DefaultFacetSize is the number of values reported per facet
+const DefaultFacetSize = 10
+
+// FacetCount is the number of results having a value
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// FacetResult counts the results by the values of a facet, most frequent
+// first. A result with several values (tags, TODO states of grouped
+// sections) counts once under each.
+type FacetResult struct {
+	Values  []FacetCount `json:"values"`
+	Missing int          `json:"missing,omitempty"` // results without a value
+	Other   int          `json:"other,omitempty"`   // counts of the values beyond the size
+}
+
+// parseFacets validates facet names, which may be comma-separated
+func parseFacets(names []string) ([]Facet, error) {
+	var facets []Facet
+	for _, name := range splitList(names) {
+		facet := Facet(strings.ToLower(name))
+		found := false
+		for _, f := range Facets {
+			found = found || f == facet
+		}
+		if !found {
+			return nil, newError(ErrInvalid, "unknown facet: %s (use folder, format, tag, year or todo)", name)
+		}
+		facets = append(facets, facet)
+	}
+	return facets, nil
+}
+
+// facetFields are the keyword fields the tag and todo facets are indexed
+// as, one value per term
+var facetFields = map[Facet]string{
+	FacetTag:  "facet_tag",
+	FacetTodo: "facet_todo",
+}
+
+// countFacets counts all hits, not just a page, by the facets of opts.
+// Grouped results count each document once, with the tags and TODO states
+// of its matching sections. A whole-document hit has those of every
+// section.
+//
+// Folders, formats and years come from the documents' metadata. Tags and
+// TODO states come from the index when there is one, and are otherwise
+// read from the documents.
+func (n *Navigator) countFacets(ctx context.Context, hits []searchHit, opts SearchOptions) (map[Facet]*FacetResult, error) {
+	size := opts.FacetSize
+	if size <= 0 {
+		size = DefaultFacetSize
+	}
+
+	// The results, as the hits each of them covers
+	var results [][]searchHit
+	if opts.GroupByDocument {
+		index := map[string]int{}
+		for _, hit := range hits {
+			i, ok := index[hit.doc.Path]
+			if !ok {
+				i = len(results)
+				index[hit.doc.Path] = i
+				results = append(results, nil)
+			}
+			results[i] = append(results[i], hit)
+		}
+	} else {
+		for _, hit := range hits {
+			results = append(results, []searchHit{hit})
+		}
+	}
+
+	facets := map[Facet]*FacetResult{}
+	var indexed []Facet
+	for _, facet := range opts.Facets {
+		if _, ok := facetFields[facet]; ok {
+			indexed = append(indexed, facet)
+			continue
+		}
+		facets[facet] = countValues(results, func(hit searchHit) []string {
+			return metadataFacetValues(facet, hit, opts.Filter.Folder)
+		}, size)
+	}
+	if len(indexed) == 0 {
+		return facets, nil
+	}
+
+	engine, err := n.searchEngine(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if engine != nil {
+		counted, err := engine.countFacets(ctx, results, indexed, size)
+		if err != nil {
+			return nil, err
+		}
+		for facet, result := range counted {
+			facets[facet] = result
+		}
+		return facets, nil
+	}
+
+	units := n.facetUnits()
+	for _, facet := range indexed {
+		facets[facet] = countValues(results, func(hit searchHit) []string {
+			var values []string
+			for _, unit := range units(hit) {
+				values = append(values, unitFacetValues(facet, unit)...)
+			}
+			return values
+		}, size)
+	}
+	return facets, nil
+}
+
+// countValues counts results by the values of their hits; a result counts
+// once under each value
+func countValues(results [][]searchHit, values func(searchHit) []string, size int) *FacetResult {
+	counts := map[string]int{}
+	missing := 0
+	for _, covered := range results {
+		seen := map[string]bool{}
+		for _, hit := range covered {
+			for _, value := range values(hit) {
+				seen[value] = true
+			}
+		}
+		if len(seen) == 0 {
+			missing++
+		}
+		for value := range seen {
+			counts[value]++
+		}
+	}
+	return topFacetValues(counts, missing, size)
+}
+
+// metadataFacetValues returns the value of a facet known from a hit's
+// document metadata
+func metadataFacetValues(facet Facet, hit searchHit, folder string) []string {
+	switch facet {
+	case FacetFolder:
+		return []string{facetFolder(filepath.ToSlash(hit.doc.Path), folder)}
+	case FacetFormat:
+		return []string{string(hit.doc.Format)}
+	case FacetYear:
+		return []string{strconv.Itoa(hit.doc.UpdatedAt.Year())}
+	}
+	return nil
+}
+
+// unitFacetValues returns the tags or TODO state of a unit, as they are
+// indexed and counted
+func unitFacetValues(facet Facet, unit searchUnit) []string {
+	var values []string
+	switch facet {
+	case FacetTag:
+		seen := map[string]bool{}
+		for _, tag := range strings.Fields(unit.fields["tags"]) {
+			tag = strings.ToLower(strings.Trim(tag, ":#"))
+			if tag != "" && !seen[tag] {
+				seen[tag] = true
+				values = append(values, tag)
+			}
+		}
+	case FacetTodo:
+		if unit.span != nil && unit.span.Todo != "" {
+			values = append(values, unit.span.Todo)
+		}
+	}
+	return values
+}
+
+// facetDocument adds the facet fields to the indexed fields of a unit
+func facetDocument(unit searchUnit) map[string]interface{} {
+	doc := make(map[string]interface{}, len(unit.fields)+len(facetFields))
+	for name, value := range unit.fields {
+		doc[name] = value
+	}
+	for facet, field := range facetFields {
+		if values := unitFacetValues(facet, unit); len(values) > 0 {
+			doc[field] = values
+		}
+	}
+	return doc
+}
+
+// countFacets counts results by indexed facets. Each result covering a
+// single unit, the index counts them with facet requests. A result
+// covering several units, such as a grouped document, counts once under
+// each value of its units, which a facet request can't tell; those units'
+// stored values are fetched and counted instead.
+func (se *SearchEngine) countFacets(ctx context.Context, results [][]searchHit, facets []Facet, size int) (map[Facet]*FacetResult, error) {
+	covered := make([][]string, len(results))
+	var ids []string
+	single := true
+	se.mu.Lock()
+	for i, hits := range results {
+		for _, hit := range hits {
+			if hit.line >= 0 {
+				covered[i] = append(covered[i], unitID(hit.doc.Path, hit.line))
+			} else {
+				covered[i] = append(covered[i], se.documentUnitIDs(hit.doc.Path)...)
+			}
+		}
+		single = single && len(covered[i]) == 1
+		ids = append(ids, covered[i]...)
+	}
+	se.mu.Unlock()
+	counted := map[Facet]*FacetResult{}
+	if len(ids) == 0 {
+		for _, facet := range facets {
+			counted[facet] = topFacetValues(nil, len(results), size)
+		}
+		return counted, nil
+	}
+
+	if single {
+		request := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), 0, 0, false)
+		for _, facet := range facets {
+			// Every value is asked for, so that ties are broken as in the scan
+			request.AddFacet(string(facet), bleve.NewFacetRequest(facetFields[facet], math.MaxInt32))
+		}
+		found, err := se.index.SearchInContext(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+		// Units missing from the index have no value either
+		unindexed := len(results) - int(found.Total)
+		for _, facet := range facets {
+			counts := map[string]int{}
+			missing := unindexed
+			if result := found.Facets[string(facet)]; result != nil {
+				for _, term := range result.Terms.Terms() {
+					counts[term.Term] = term.Count
+				}
+				missing += result.Missing
+			}
+			counted[facet] = topFacetValues(counts, missing, size)
+		}
+		return counted, nil
+	}
+
+	fields := make([]string, 0, len(facets))
+	for _, facet := range facets {
+		fields = append(fields, facetFields[facet])
+	}
+	request := bleve.NewSearchRequestOptions(bleve.NewDocIDQuery(ids), len(ids), 0, false)
+	request.Fields = fields
+	found, err := se.index.SearchInContext(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	stored := make(map[string]map[string]interface{}, len(found.Hits))
+	for _, hit := range found.Hits {
+		stored[hit.ID] = hit.Fields
+	}
+	for _, facet := range facets {
+		counts := map[string]int{}
+		missing := 0
+		for _, unitIDs := range covered {
+			seen := map[string]bool{}
+			for _, id := range unitIDs {
+				for _, value := range storedValues(stored[id][facetFields[facet]]) {
+					seen[value] = true
+				}
+			}
+			if len(seen) == 0 {
+				missing++
+			}
+			for value := range seen {
+				counts[value]++
+			}
+		}
+		counted[facet] = topFacetValues(counts, missing, size)
+	}
+	return counted, nil
+}
+
+// storedValues reads a stored field, which holds a string for one value
+// and a list for several
+func storedValues(field interface{}) []string {
+	switch v := field.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// facetFolder names the folder below parent that p is in, or parent itself
+// ("." for the KB root) for documents directly inside it
+func facetFolder(p, parent string) string {
+	rest := p
+	if parent != "" {
+		rest = strings.TrimPrefix(p, parent+"/")
+	}
+	first, _, nested := strings.Cut(rest, "/")
+	switch {
+	case nested:
+		return path.Join(parent, first)
+	case parent == "":
+		return "."
+	}
+	return parent
+}
+
+// facetUnits returns a function giving the units a hit covers: its section,
+// or every unit of a whole-document hit. Each document is read at most once.
+func (n *Navigator) facetUnits() func(hit searchHit) []searchUnit {
+	loaded := map[string][]searchUnit{}
+	return func(hit searchHit) []searchUnit {
+		units, ok := loaded[hit.doc.Path]
+		if !ok {
+			if fullDoc, err := n.ReadDocument(hit.doc.Path); err == nil {
+				units = n.textAnalysis().documentUnits(fullDoc)
+			}
+			loaded[hit.doc.Path] = units
+		}
+		if hit.line >= 0 {
+			for i := range units {
+				if units[i].line == hit.line {
+					return units[i : i+1]
+				}
+			}
+		}
+		return units
+	}
+}
+
+// topFacetValues keeps the size most frequent values, ties broken by value
+func topFacetValues(counts map[string]int, missing, size int) *FacetResult {
+	result := &FacetResult{Values: []FacetCount{}, Missing: missing}
+	for value, count := range counts {
+		result.Values = append(result.Values, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(result.Values, func(i, j int) bool {
+		a, b := result.Values[i], result.Values[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Value < b.Value
+	})
+	if len(result.Values) > size {
+		for _, c := range result.Values[size:] {
+			result.Other += c.Count
+		}
+		result.Values = result.Values[:size]
+	}
+	return result
+}
@@ -0,0 +1,143 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// facetString renders a facet result as "value=count ..." for comparisons
+func facetString(r *FacetResult) string {
+	if r == nil {
+		return "<nil>"
+	}
+	var parts []string
+	for _, c := range r.Values {
+		parts = append(parts, fmt.Sprintf("%s=%d", c.Value, c.Count))
+	}
+	if r.Other > 0 {
+		parts = append(parts, fmt.Sprintf("other=%d", r.Other))
+	}
+	if r.Missing > 0 {
+		parts = append(parts, fmt.Sprintf("missing=%d", r.Missing))
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestSearchFacets(t *testing.T) {
+	files := map[string]string{
+		"work/infra/rollout.org": "#+FILETAGS: :infra:\n* TODO Deploy the API :urgent:\nRoll out slowly.\n* DONE Deploy the web app\nShipped.\n",
+		"work/notes.md":          "---\ntags: [infra, Meetings]\n---\n# Deploy review\nWhat went wrong.\n",
+		"home/garden.txt":        "Deploy the sprinklers.\n",
+		"inbox.md":               "# Deploy ideas\nCanary releases.\n",
+	}
+	modified := map[string]time.Time{
+		"work/infra/rollout.org": time.Date(2025, 6, 1, 12, 0, 0, 0, time.Local),
+		"work/notes.md":          time.Date(2026, 2, 1, 12, 0, 0, 0, time.Local),
+		"home/garden.txt":        time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local),
+		"inbox.md":               time.Date(2026, 4, 1, 12, 0, 0, 0, time.Local),
+	}
+
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		for name, at := range modified {
+			if err := os.Chtimes(filepath.Join(nav.BaseDir(), name), at, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		search := func(query string, opts SearchOptions) *SearchPage {
+			t.Helper()
+			opts.Facets = Facets
+			page, err := nav.Search(context.Background(), query, opts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return page
+		}
+		expect := func(page *SearchPage, facet Facet, want string) {
+			t.Helper()
+			if got := facetString(page.Facets[facet]); got != want {
+				t.Errorf("%s: expected %q, got %q", facet, want, got)
+			}
+		}
+
+		// Section hits count one by one, over all pages
+		page := search("deploy", SearchOptions{ListOptions: ListOptions{Limit: 1}})
+		if page.Total != 5 || len(page.Results) != 1 {
+			t.Fatalf("Expected 5 section hits, got %+v", page)
+		}
+		expect(page, FacetFolder, "work=3 .=1 home=1")
+		expect(page, FacetFormat, "markdown=2 org=2 text=1")
+		expect(page, FacetTag, "infra=3 meetings=1 urgent=1 missing=2")
+		expect(page, FacetYear, "2026=3 2025=2")
+		expect(page, FacetTodo, "DONE=1 TODO=1 missing=3")
+
+		// Grouped documents count once, with their matching sections' values
+		page = search("deploy", SearchOptions{GroupByDocument: true})
+		expect(page, FacetFolder, "work=2 .=1 home=1")
+		expect(page, FacetTodo, "DONE=1 TODO=1 missing=3")
+
+		// Folders break down below the filtered folder
+		page = search("deploy", SearchOptions{ListOptions: ListOptions{Filter: DocumentFilter{Folder: "work"}}, GroupByDocument: true})
+		expect(page, FacetFolder, "work=1 work/infra=1")
+
+		// Without a query, whole documents count every section
+		page = search("", SearchOptions{FacetSize: 1})
+		expect(page, FacetTag, "infra=2 other=2 missing=2")
+		expect(page, FacetTodo, "DONE=1 other=1 missing=3")
+	})
+}
+
+func TestParseFacets(t *testing.T) {
+	opts, err := ListQuery{Facets: []string{"folder,Tag", "year"}}.SearchOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.Facets) != 3 || opts.Facets[1] != FacetTag {
+		t.Errorf("Expected three facets, got %v", opts.Facets)
+	}
+
+	if _, err := (ListQuery{Facets: []string{"author"}}).SearchOptions(); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an unknown facet to be invalid, got %v", err)
+	}
+}
+
+func TestSearchFacetsFromIndex(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"a.md": "---\ntags: [alpha]\n---\n# Deploy\n"})
+	if err := nav.SetSearchMode(SearchIndex, ""); err != nil {
+		t.Fatal(err)
+	}
+	defer nav.Close()
+
+	tags := func() string {
+		t.Helper()
+		page, err := nav.Search(context.Background(), "deploy", SearchOptions{Facets: []Facet{FacetTag}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return facetString(page.Facets[FacetTag])
+	}
+	if got := tags(); got != "alpha=1" {
+		t.Fatalf("Expected alpha=1, got %q", got)
+	}
+
+	// An edit the index can't tell from its stamp still counts the indexed tags
+	name := filepath.Join(nav.BaseDir(), "a.md")
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte("---\ntags: [omega]\n---\n# Deploy\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(name, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tags(); got != "alpha=1" {
+		t.Errorf("Expected the indexed alpha=1, got %q", got)
+	}
+}
@@ -0,0 +1,403 @@
+package kb
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// DefaultFindLimit is the number of notes FindNotes returns by default
+const DefaultFindLimit = 20
+
+// FoundNote is a note whose name matches a FindNotes pattern
+type FoundNote struct {
+	Path    string  `json:"path"`
+	Title   string  `json:"title,omitempty"` // the declared title, if any
+	Score   int     `json:"score"`
+	Field   string  `json:"field"` // what matched: path, title, alias or heading
+	Text    string  `json:"text"`  // the value that matched
+	Matches []Match `json:"matches"`
+}
+
+// Marked returns the matched value with its matches marked in style
+func (f FoundNote) Marked(style MarkerStyle) string {
+	if style == MarkPlain {
+		return f.Text
+	}
+	return markMatches(f.Text, f.Matches, style)
+}
+
+// Scores of the fuzzy matcher, as in fzf. Every matched character scores
+// scoreMatch; a gap between matched characters costs scoreGapStart plus
+// scoreGapExtension per further character. Characters at the start of a
+// word score a bonus, doubled for the first character of the pattern, and
+// characters right after another match keep the bonus of the first.
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	bonusBoundary          = scoreMatch / 2
+	bonusBoundaryWhite     = bonusBoundary + 2 // after a space, or at the start
+	bonusBoundaryDelimiter = bonusBoundary + 1 // after a slash or other delimiter
+	bonusNonWord           = scoreMatch / 2
+	bonusCamel123          = bonusBoundary + scoreGapExtension // fooBar, foo123
+	bonusConsecutive       = -(scoreGapStart + scoreGapExtension)
+	bonusFirstCharFactor   = 2
+)
+
+// FindNotes finds notes by name, like fzf: the characters of each
+// whitespace-separated word of pattern must appear in order, with gaps,
+// in a note's path, title, aliases or first heading. Matches at the start
+// of words and path segments, and runs of consecutive characters, score
+// higher. Case is ignored unless pattern has upper case letters. Notes
+// over the size limit (see SetMaxSize) are left out.
+func (n *Navigator) FindNotes(pattern string, limit int) ([]FoundNote, error) {
+	terms := strings.Fields(pattern)
+	if len(terms) == 0 {
+		return nil, newError(ErrInvalid, "empty pattern")
+	}
+	if limit <= 0 {
+		limit = DefaultFindLimit
+	}
+	caseSensitive := strings.ToLower(pattern) != pattern
+
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	found := []FoundNote{}
+	for _, doc := range docs {
+		if n.maxSize > 0 && doc.Size > n.maxSize {
+			continue
+		}
+		p := filepath.ToSlash(doc.Path)
+		head, err := readNoteHead(filepath.Join(n.baseDir, doc.Path), doc.Format)
+		if err != nil {
+			n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+		title := declaredTitle(head, doc.Format)
+
+		best := FoundNote{Score: math.MinInt}
+		for _, field := range noteNames(p, title, head, doc.Format) {
+			score, matches, ok := fuzzyMatch(terms, field.text, caseSensitive)
+			if ok && (score > best.Score || score == best.Score && len(field.text) < len(best.Text)) {
+				best = FoundNote{Path: p, Title: title, Score: score, Field: field.name, Text: field.text, Matches: matches}
+			}
+		}
+		if best.Path != "" {
+			found = append(found, best)
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Score != found[j].Score {
+			return found[i].Score > found[j].Score
+		}
+		if len(found[i].Text) != len(found[j].Text) {
+			return len(found[i].Text) < len(found[j].Text)
+		}
+		return found[i].Path < found[j].Path
+	})
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+// readNoteHead reads a note up to its first heading, which holds what it
+// can be found by: its front matter or Org keywords and property drawer,
+// and the heading itself
+func readNoteHead(name string, format Format) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var head strings.Builder
+	r := bufio.NewReader(f)
+	inFrontMatter, inFence := false, false
+	for first := true; ; first = false {
+		line, err := r.ReadString('\n')
+		head.WriteString(line)
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case format == FormatOrg:
+			if _, ok := parseOrgHeadline(trimmed); ok {
+				return head.String(), nil
+			}
+		case first && trimmed == "---":
+			inFrontMatter = true
+		case inFrontMatter:
+			inFrontMatter = trimmed != "---"
+		case mdFenceRe.MatchString(trimmed):
+			inFence = !inFence
+		case !inFence:
+			if _, ok := parseMarkdownHeading(trimmed); ok {
+				return head.String(), nil
+			}
+		}
+		if err == io.EOF {
+			return head.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+type noteName struct {
+	name, text string
+}
+
+// noteNames lists the names a note can be found by
+func noteNames(p, title, content string, format Format) []noteName {
+	names := []noteName{{"path", p}}
+	seen := map[string]bool{p: true}
+	add := func(name, text string) {
+		if text = strings.TrimSpace(text); text != "" && !seen[text] {
+			seen[text] = true
+			names = append(names, noteName{name, text})
+		}
+	}
+	add("title", title)
+	for _, alias := range noteAliases(content, format) {
+		add("alias", alias)
+	}
+	if spans := scanSections(content, format); len(spans) > 0 {
+		add("heading", spans[0].Title)
+	}
+	return names
+}
+
+// noteAliases are the other names of a note: "aliases" (or "alias") in
+// Markdown front matter, as Obsidian writes them, or an Org file's
+// :ROAM_ALIASES: property, as org-roam does
+func noteAliases(content string, format Format) []string {
+	var aliases []string
+	switch format {
+	case FormatOrg:
+		for _, line := range strings.Split(content, "\n") {
+			if value, ok := cutKeyword(strings.TrimSpace(line), ":roam_aliases:"); ok {
+				aliases = append(aliases, splitQuoted(value)...)
+			}
+		}
+	case FormatMarkdown:
+		meta, _, err := ParseFrontMatter(content)
+		if err != nil {
+			return nil
+		}
+		for _, key := range []string{"aliases", "alias"} {
+			switch v := meta[key].(type) {
+			case string:
+				aliases = append(aliases, v)
+			case []interface{}:
+				for _, item := range v {
+					if s, ok := item.(string); ok {
+						aliases = append(aliases, s)
+					}
+				}
+			}
+		}
+	}
+	return aliases
+}
+
+// splitQuoted splits a property value into words, keeping "quoted
+// phrases" together
+func splitQuoted(value string) []string {
+	var words []string
+	for value = strings.TrimSpace(value); value != ""; value = strings.TrimSpace(value) {
+		if value[0] == '"' {
+			if end := strings.IndexByte(value[1:], '"'); end >= 0 {
+				if word, err := strconv.Unquote(value[:end+2]); err == nil {
+					words = append(words, word)
+				}
+				value = value[end+2:]
+				continue
+			}
+		}
+		word, rest, _ := strings.Cut(value, " ")
+		words = append(words, word)
+		value = rest
+	}
+	return words
+}
+
+// fuzzyMatch scores text against every term, each of which must match;
+// the matched characters are returned in text order
+func fuzzyMatch(terms []string, text string, caseSensitive bool) (int, []Match, bool) {
+	runes := []rune(text)
+	folded := runes
+	if !caseSensitive {
+		folded = []rune(strings.ToLower(text))
+		if len(folded) != len(runes) {
+			folded = runes // lowering changed the length; compare as written
+		}
+	}
+
+	total := 0
+	matched := map[int]bool{}
+	for _, term := range terms {
+		score, positions, ok := fuzzyTerm([]rune(term), folded, runes, caseSensitive)
+		if !ok {
+			return 0, nil, false
+		}
+		total += score
+		for _, pos := range positions {
+			matched[pos] = true
+		}
+	}
+
+	var matches []Match
+	for i := range runes {
+		if !matched[i] {
+			continue
+		}
+		if len(matches) > 0 && matches[len(matches)-1].End == i {
+			matches[len(matches)-1].End++
+		} else {
+			matches = append(matches, Match{Start: i, End: i + 1})
+		}
+	}
+	return total, matches, true
+}
+
+// fuzzyTerm finds the best-scoring way to match the characters of pattern,
+// in order, in text, by dynamic programming over pattern characters and
+// text positions
+func fuzzyTerm(pattern, text, original []rune, caseSensitive bool) (int, []int, bool) {
+	if !caseSensitive {
+		pattern = []rune(strings.ToLower(string(pattern)))
+	}
+	m, n := len(pattern), len(text)
+	if m > n {
+		return 0, nil, false
+	}
+
+	bonus := make([]int, n)
+	prev := charWhite
+	for j, r := range original {
+		class := classOf(r)
+		bonus[j] = bonusFor(prev, class)
+		prev = class
+	}
+
+	const none = math.MinInt / 2
+	// score[i][j] is the best score of pattern[:i+1] with pattern[i] at
+	// text[j]; chunk[i][j] the bonus of the run of consecutive matches
+	// ending there; from[i][j] the position of pattern[i-1]
+	score := make([][]int, m)
+	chunk := make([][]int, m)
+	from := make([][]int, m)
+	for i := range score {
+		score[i], chunk[i], from[i] = make([]int, n), make([]int, n), make([]int, n)
+		for j := range score[i] {
+			score[i][j] = none
+		}
+	}
+
+	for i := 0; i < m; i++ {
+		gap, gapFrom := none, -1 // best score of pattern[:i] ending two or more positions back
+		for j := i; j < n; j++ {
+			if i > 0 && j >= 2 {
+				gap += scoreGapExtension
+				if origin := score[i-1][j-2]; origin > none && origin+scoreGapStart > gap {
+					gap, gapFrom = origin+scoreGapStart, j-2
+				}
+			}
+			if text[j] != pattern[i] {
+				continue
+			}
+			if i == 0 {
+				score[0][j], chunk[0][j] = scoreMatch+bonus[j]*bonusFirstCharFactor, bonus[j]
+				continue
+			}
+			if s := score[i-1][j-1]; s > none {
+				b := max(bonus[j], chunk[i-1][j-1], bonusConsecutive)
+				score[i][j], chunk[i][j], from[i][j] = s+scoreMatch+b, b, j-1
+			}
+			if gapFrom >= 0 && gap+scoreMatch+bonus[j] > score[i][j] {
+				score[i][j], chunk[i][j], from[i][j] = gap+scoreMatch+bonus[j], bonus[j], gapFrom
+			}
+		}
+	}
+
+	best, end := none, -1
+	for j := m - 1; j < n; j++ {
+		if score[m-1][j] > best {
+			best, end = score[m-1][j], j
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+	positions := make([]int, m)
+	for i := m - 1; i >= 0; i-- {
+		positions[i] = end
+		end = from[i][end]
+	}
+	return best, positions, true
+}
+
+type charClass int
+
+const (
+	charWhite charClass = iota
+	charNonWord
+	charDelimiter
+	charLower
+	charUpper
+	charLetter
+	charNumber
+)
+
+func classOf(r rune) charClass {
+	switch {
+	case unicode.IsSpace(r):
+		return charWhite
+	case strings.ContainsRune("/,:;|", r):
+		return charDelimiter
+	case unicode.IsLower(r):
+		return charLower
+	case unicode.IsUpper(r):
+		return charUpper
+	case unicode.IsLetter(r):
+		return charLetter
+	case unicode.IsDigit(r):
+		return charNumber
+	}
+	return charNonWord
+}
+
+// bonusFor is the bonus of a character of class after one of class prev
+func bonusFor(prev, class charClass) int {
+	if class > charDelimiter {
+		switch prev {
+		case charWhite:
+			return bonusBoundaryWhite
+		case charDelimiter:
+			return bonusBoundaryDelimiter
+		case charNonWord:
+			return bonusBoundary
+		}
+	}
+	if prev == charLower && class == charUpper || prev != charNumber && class == charNumber {
+		return bonusCamel123
+	}
+	switch class {
+	case charNonWord, charDelimiter:
+		return bonusNonWord
+	case charWhite:
+		return bonusBoundaryWhite
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+package kb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	score := func(pattern, text string) int {
+		t.Helper()
+		s, _, ok := fuzzyMatch([]string{pattern}, text, false)
+		if !ok {
+			t.Fatalf("Expected %q to match %q", pattern, text)
+		}
+		return s
+	}
+
+	// Word starts beat letters inside words, and runs beat scattered letters
+	if score("dr", "ops/deploy-runbook.md") <= score("dr", "ops/hydrant.md") {
+		t.Error("Expected word starts to score higher")
+	}
+	if score("plan", "q3-plan.md") <= score("plan", "p-l-a-n.md") {
+		t.Error("Expected consecutive letters to score higher")
+	}
+	if score("kc", "KubeCluster.md") <= score("kc", "kickoff.md") {
+		t.Error("Expected a camelCase start to score higher")
+	}
+	if score("daily", "journal/daily.org") <= score("daily", "d/a/i/l/y.org") {
+		t.Error("Expected fewer gaps to score higher")
+	}
+
+	_, matches, _ := fuzzyMatch([]string{"ops", "rb"}, "ops/deploy-runbook.md", false)
+	if len(matches) != 3 || matches[0] != (Match{0, 3}) || matches[1] != (Match{11, 12}) || matches[2] != (Match{14, 15}) {
+		t.Errorf("Unexpected matches %v", matches)
+	}
+	if _, _, ok := fuzzyMatch([]string{"ops", "xyz"}, "ops/deploy.md", false); ok {
+		t.Error("Expected every term to have to match")
+	}
+	if _, _, ok := fuzzyMatch([]string{"Ops"}, "ops/deploy.md", true); ok {
+		t.Error("Expected an upper case pattern to match case")
+	}
+}
+
+func TestFindNotes(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"ops/deploy-runbook.md":  "---\naliases: [Release checklist]\n---\n# Deploying the API\n",
+		"infra/k8s.org":          "#+TITLE: Kubernetes cluster\n:PROPERTIES:\n:ROAM_ALIASES: \"Container platform\" kube\n:END:\n* Nodes\n",
+		"notes/relationships.md": "# Relationships\n",
+		"daily/2026-03-01.org":   "* Standup with the platform team\n",
+	})
+
+	found, err := nav.FindNotes("runbook", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Path != "ops/deploy-runbook.md" || found[0].Field != "path" {
+		t.Errorf("Expected the runbook by path, got %+v", found)
+	}
+
+	for pattern, want := range map[string]string{
+		"relchk":    "alias",
+		"kubclus":   "title",
+		"cont plat": "alias",
+		"standup":   "heading",
+	} {
+		found, err := nav.FindNotes(pattern, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 1 || found[0].Field != want {
+			t.Errorf("Expected %q to match a %s, got %+v", pattern, want, found)
+		}
+	}
+
+	found, err = nav.FindNotes("kube", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Path != "infra/k8s.org" || found[0].Title != "Kubernetes cluster" || found[0].Text != "kube" {
+		t.Errorf("Expected the exact alias to match best, got %+v", found)
+	}
+
+	if _, err := nav.FindNotes("  ", 0); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an empty pattern to be rejected, got %v", err)
+	}
+}
+
+func TestFindNotesReadsHeads(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"small.md": "# Sprint review\n",
+		"large.md": "# Sprint planning\n" + strings.Repeat("Backlog items.\n", 100),
+		"roam.org": "#+TITLE: Roadmap\n* Milestones\n:PROPERTIES:\n:ROAM_ALIASES: Quarterly goals\n:END:\n",
+	})
+	nav.SetMaxSize(200)
+
+	// Notes over the size limit are left out, as they are from search
+	found, err := nav.FindNotes("sprint", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Path != "small.md" {
+		t.Errorf("Expected only the small note, got %+v", found)
+	}
+
+	// Aliases of a heading are not the note's
+	found, err = nav.FindNotes("quarterly", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("Expected no note by a heading's alias, got %+v", found)
+	}
+}
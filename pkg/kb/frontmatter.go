@@ -0,0 +1,41 @@
+package kb
+
+import (
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// ParseFrontMatter splits a leading YAML block delimited by "---" lines from
+// the rest of the content. Content without front matter is returned as is.
+func ParseFrontMatter(content string) (map[string]interface{}, string, error) {
+	rest, ok := strings.CutPrefix(content, "---\n")
+	if !ok {
+		rest, ok = strings.CutPrefix(content, "---\r\n")
+	}
+	if !ok {
+		return nil, content, nil
+	}
+
+	var block, body string
+	for offset := 0; ; {
+		idx := strings.Index(rest[offset:], "\n---")
+		if idx < 0 {
+			// No closing delimiter: not front matter after all
+			return nil, content, nil
+		}
+		end := offset + idx + len("\n---")
+		if end == len(rest) || rest[end] == '\n' || rest[end] == '\r' {
+			block = rest[:offset+idx]
+			body = strings.TrimLeft(rest[end:], "\r\n")
+			break
+		}
+		offset = end
+	}
+
+	meta := map[string]interface{}{}
+	if err := yaml.Unmarshal([]byte(block), &meta); err != nil {
+		return nil, content, err
+	}
+	return meta, body, nil
+}
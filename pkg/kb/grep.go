@@ -0,0 +1,243 @@
+package kb
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultGrepMaxCount is the number of matching lines returned by default
+const DefaultGrepMaxCount = 1000
+
+// GrepOptions select the lines Grep returns
+type GrepOptions struct {
+	Pattern    string
+	Regexp     bool // Pattern is a regular expression (RE2 syntax) rather than literal text
+	IgnoreCase bool
+	WholeWord  bool     // matches must not be preceded or followed by a letter, digit or underscore
+	Include    []string // only paths matching one of these globs
+	Exclude    []string // no paths matching one of these globs
+	Filter     DocumentFilter
+	Before     int // context lines before each match
+	After      int // context lines after each match
+	MaxCount   int // matching lines over all documents; 0 means DefaultGrepMaxCount
+}
+
+// GrepMatch is a line matching a grep pattern
+type GrepMatch struct {
+	Path    string   `json:"path"`
+	Line    int      `json:"line"` // one-based
+	Text    string   `json:"text"`
+	Matches []Match  `json:"matches"`          // in characters, like the matches of a snippet
+	Before  []string `json:"before,omitempty"` // the lines before, nearest last
+	After   []string `json:"after,omitempty"`
+}
+
+// Marked returns the line with its matches marked in style
+func (m GrepMatch) Marked(style MarkerStyle) string {
+	if style == MarkPlain {
+		return m.Text
+	}
+	return markMatches(m.Text, m.Matches, style)
+}
+
+// GrepSummary counts what a grep found
+type GrepSummary struct {
+	Matches   int  `json:"matches"` // matching lines returned
+	Documents int  `json:"documents"`
+	Searched  int  `json:"searched"`  // documents read
+	Truncated bool `json:"truncated"` // MaxCount was reached
+}
+
+// Grep finds the lines of the documents matching opts.Pattern and passes
+// each of them to emit, document by document in path order. Documents are
+// read in parallel. Grep stops at the first error emit returns.
+func (n *Navigator) Grep(ctx context.Context, opts GrepOptions, emit func(GrepMatch) error) (*GrepSummary, error) {
+	re, err := grepRegexp(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, glob := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(glob, ""); err != nil {
+			return nil, newError(ErrInvalid, "invalid glob %q", glob)
+		}
+	}
+	if opts.Before < 0 || opts.After < 0 {
+		return nil, newError(ErrInvalid, "context lines must not be negative")
+	}
+	maxCount := opts.MaxCount
+	if maxCount <= 0 {
+		maxCount = DefaultGrepMaxCount
+	}
+
+	docs, err := n.filterDocuments(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, doc := range docs {
+		p := filepath.ToSlash(doc.Path)
+		if grepSelects(p, opts.Include, opts.Exclude) && (n.maxSize <= 0 || doc.Size <= n.maxSize) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	ctx, cancel := context.WithCancel(ctx)
+	// Workers grep documents in any order; their matches are emitted in
+	// path order
+	results := make([]chan []GrepMatch, len(paths))
+	for i := range results {
+		results[i] = make(chan []GrepMatch, 1)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				// One more than needed tells whether matches were left out
+				results[i] <- n.grepDocument(paths[i], re, opts, maxCount+1)
+			}
+		}()
+	}
+	go func() {
+		defer close(next)
+		for i := range paths {
+			select {
+			case next <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	summary := &GrepSummary{}
+	for i := range paths {
+		var matches []GrepMatch
+		select {
+		case matches = <-results[i]:
+		case <-ctx.Done():
+			return summary, ctx.Err()
+		}
+		summary.Searched++
+		if len(matches) > 0 {
+			summary.Documents++
+		}
+		for _, m := range matches {
+			if summary.Matches == maxCount {
+				summary.Truncated = true
+				return summary, nil
+			}
+			if err := emit(m); err != nil {
+				return summary, err
+			}
+			summary.Matches++
+		}
+	}
+	return summary, nil
+}
+
+// grepRegexp compiles the pattern of opts
+func grepRegexp(opts GrepOptions) (*regexp.Regexp, error) {
+	if opts.Pattern == "" {
+		return nil, newError(ErrInvalid, "empty pattern")
+	}
+	pattern := opts.Pattern
+	if !opts.Regexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, newError(ErrInvalid, "invalid regular expression: %v", err)
+	}
+	return re, nil
+}
+
+// grepSelects applies the include and exclude globs to a path
+func grepSelects(p string, include, exclude []string) bool {
+	for _, glob := range exclude {
+		if matchGlob(glob, p) {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, glob := range include {
+		if matchGlob(glob, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// grepDocument returns the matching lines of one document, at most limit
+// of them
+func (n *Navigator) grepDocument(p string, re *regexp.Regexp, opts GrepOptions, limit int) []GrepMatch {
+	content, err := os.ReadFile(filepath.Join(n.baseDir, filepath.FromSlash(p)))
+	if err != nil {
+		n.logger.Debug("failed to read document", "path", p, "error", err)
+		return nil
+	}
+	lines := strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var matches []GrepMatch
+	for i, line := range lines {
+		var ranges []Match
+		for _, loc := range re.FindAllStringIndex(line, -1) {
+			if opts.WholeWord && !wordBounded(line, loc[0], loc[1]) {
+				continue
+			}
+			start := utf8.RuneCountInString(line[:loc[0]])
+			ranges = append(ranges, Match{Start: start, End: start + utf8.RuneCountInString(line[loc[0]:loc[1]])})
+		}
+		if len(ranges) == 0 {
+			continue
+		}
+		m := GrepMatch{Path: p, Line: i + 1, Text: line, Matches: ranges}
+		if opts.Before > 0 {
+			m.Before = lines[max(i-opts.Before, 0):i]
+		}
+		if opts.After > 0 {
+			m.After = lines[i+1 : min(i+1+opts.After, len(lines))]
+		}
+		matches = append(matches, m)
+		if len(matches) == limit {
+			break
+		}
+	}
+	return matches
+}
+
+// wordBounded tells whether line[start:end] is neither preceded nor
+// followed by a word character
+func wordBounded(line string, start, end int) bool {
+	isWord := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	if r, _ := utf8.DecodeLastRuneInString(line[:start]); start > 0 && isWord(r) {
+		return false
+	}
+	if r, _ := utf8.DecodeRuneInString(line[end:]); end < len(line) && isWord(r) {
+		return false
+	}
+	return true
+}
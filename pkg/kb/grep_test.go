@@ -0,0 +1,75 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"ops/incident.md": "# Outage\nOpened TICKET-1234 for the DNS outage.\nSee also ticket-1234b.\nRoot cause: TTL.\n",
+		"ops/config.org":  "* Config\n#+begin_src yaml\nport: 8080\nhost: db.internal\nport: 5432\n#+end_src\n",
+		"notes/todo.txt":  "Close TICKET-1234 after the review.\n",
+		"archive/old.md":  "TICKET-1234 was a duplicate.\n",
+	})
+
+	grep := func(opts GrepOptions) ([]string, *GrepSummary) {
+		t.Helper()
+		var lines []string
+		summary, err := nav.Grep(context.Background(), opts, func(m GrepMatch) error {
+			lines = append(lines, fmt.Sprintf("%s:%d:%s", m.Path, m.Line, m.Text))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lines, summary
+	}
+
+	lines, summary := grep(GrepOptions{Pattern: "TICKET-1234"})
+	want := "archive/old.md:1:TICKET-1234 was a duplicate.|notes/todo.txt:1:Close TICKET-1234 after the review.|ops/incident.md:2:Opened TICKET-1234 for the DNS outage."
+	if strings.Join(lines, "|") != want {
+		t.Errorf("Expected the literal matches in path order, got %v", lines)
+	}
+	if summary.Matches != 3 || summary.Documents != 3 || summary.Searched != 4 || summary.Truncated {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+
+	lines, _ = grep(GrepOptions{Pattern: "ticket-1234", IgnoreCase: true, Include: []string{"ops/**"}})
+	if len(lines) != 2 {
+		t.Errorf("Expected both case-insensitive matches in ops, got %v", lines)
+	}
+	lines, _ = grep(GrepOptions{Pattern: "ticket-1234", IgnoreCase: true, WholeWord: true, Exclude: []string{"archive/**", "*.txt"}})
+	if len(lines) != 1 || !strings.HasPrefix(lines[0], "ops/incident.md:2:") {
+		t.Errorf("Expected ticket-1234b to fail the whole word match, got %v", lines)
+	}
+
+	var match GrepMatch
+	_, err := nav.Grep(context.Background(), GrepOptions{Pattern: `^port: (\d+)$`, Regexp: true, Before: 1, After: 1, MaxCount: 1}, func(m GrepMatch) error {
+		match = m
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.Path != "ops/config.org" || match.Line != 3 || match.Matches[0] != (Match{0, 10}) ||
+		strings.Join(match.Before, "|") != "#+begin_src yaml" || strings.Join(match.After, "|") != "host: db.internal" {
+		t.Errorf("Unexpected regexp match %+v", match)
+	}
+
+	_, summary = grep(GrepOptions{Pattern: "port", MaxCount: 1})
+	if summary.Matches != 1 || !summary.Truncated {
+		t.Errorf("Expected the max count to truncate the matches, got %+v", summary)
+	}
+
+	stop := errors.New("stop")
+	if _, err := nav.Grep(context.Background(), GrepOptions{Pattern: "TICKET"}, func(GrepMatch) error { return stop }); err != stop {
+		t.Errorf("Expected the emit error, got %v", err)
+	}
+	if _, err := nav.Grep(context.Background(), GrepOptions{Pattern: "(", Regexp: true}, nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an invalid regexp to be rejected, got %v", err)
+	}
+}
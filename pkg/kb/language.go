@@ -0,0 +1,423 @@
+package kb
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/lang/da"
+	"github.com/blevesearch/bleve/v2/analysis/lang/de"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/analysis/lang/es"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fi"
+	"github.com/blevesearch/bleve/v2/analysis/lang/fr"
+	"github.com/blevesearch/bleve/v2/analysis/lang/it"
+	"github.com/blevesearch/bleve/v2/analysis/lang/nl"
+	"github.com/blevesearch/bleve/v2/analysis/lang/no"
+	"github.com/blevesearch/bleve/v2/analysis/lang/pt"
+	"github.com/blevesearch/bleve/v2/analysis/lang/ru"
+	"github.com/blevesearch/bleve/v2/analysis/lang/sv"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	unicodetokenizer "github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/registry"
+	index "github.com/blevesearch/bleve_index_api"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Language configures the analysis of one language
+type Language struct {
+	Code      string // ISO 639-1 code, e.g. en or ru
+	Stemming  bool   // match word forms: "deployment" finds "deployments"
+	Stopwords bool   // leave out words such as "the" or "и"
+}
+
+// Analysis configures how text is cut into search terms
+type Analysis struct {
+	Languages []Language // detected among; the first is the fallback
+	Folding   bool       // ignore diacritics: ё matches е, é matches e
+}
+
+// DefaultAnalysis analyzes English and Russian with stemming, stop words
+// and folding
+func DefaultAnalysis() Analysis {
+	return Analysis{
+		Languages: []Language{
+			{Code: "en", Stemming: true, Stopwords: true},
+			{Code: "ru", Stemming: true, Stopwords: true},
+		},
+		Folding: true,
+	}
+}
+
+// languageFilters are the Bleve token filters of each supported language
+var languageFilters = map[string]struct {
+	script  string
+	stop    string
+	stemmer string
+}{
+	"da": {"latin", da.StopName, da.SnowballStemmerName},
+	"de": {"latin", de.StopName, de.SnowballStemmerName},
+	"en": {"latin", en.StopName, en.SnowballStemmerName},
+	"es": {"latin", es.StopName, es.SnowballStemmerName},
+	"fi": {"latin", fi.StopName, fi.SnowballStemmerName},
+	"fr": {"latin", fr.StopName, fr.LightStemmerName},
+	"it": {"latin", it.StopName, it.SnowballStemmerName},
+	"nl": {"latin", nl.StopName, nl.SnowballStemmerName},
+	"no": {"latin", no.StopName, no.SnowballStemmerName},
+	"pt": {"latin", pt.StopName, pt.LightStemmerName},
+	"ru": {"cyrillic", ru.StopName, ru.SnowballStemmerName},
+	"sv": {"latin", sv.StopName, sv.SnowballStemmerName},
+}
+
+func supportedLanguages() string {
+	codes := make([]string, 0, len(languageFilters))
+	for code := range languageFilters {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return strings.Join(codes, ", ")
+}
+
+// Token filter types registered with Bleve
+const (
+	foldFilterType   = "kbnavt_fold"
+	scriptFilterType = "kbnavt_script"
+)
+
+func init() {
+	registry.RegisterTokenFilter(foldFilterType, func(map[string]interface{}, *registry.Cache) (analysis.TokenFilter, error) {
+		return foldFilter{}, nil
+	})
+	registry.RegisterTokenFilter(scriptFilterType, newScriptFilter)
+}
+
+// foldFilter removes diacritics from terms. Й is kept: it is a letter of its
+// own, and Russian stemming depends on it.
+type foldFilter struct{}
+
+func (foldFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	for _, token := range input {
+		token.Term = []byte(foldText(string(token.Term)))
+	}
+	return input
+}
+
+func foldText(s string) string {
+	ascii := true
+	for i := 0; i < len(s) && ascii; i++ {
+		ascii = s[i] < utf8.RuneSelf
+	}
+	if ascii {
+		return s
+	}
+
+	var b strings.Builder
+	var prev rune
+	for _, r := range norm.NFD.String(s) {
+		if unicode.Is(unicode.Mn, r) && !(r == '\u0306' && (prev == 'и' || prev == 'И')) {
+			continue
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return norm.NFC.String(b.String())
+}
+
+// scriptFilter applies its filters to the tokens written in one script and
+// passes the others through, so that every word is stemmed in a language
+// of its own script: English terms in a Russian note stay English.
+type scriptFilter struct {
+	script  string
+	filters []analysis.TokenFilter
+}
+
+func newScriptFilter(config map[string]interface{}, cache *registry.Cache) (analysis.TokenFilter, error) {
+	f := &scriptFilter{}
+	f.script, _ = config["script"].(string)
+
+	var names []string
+	switch v := config["filters"].(type) {
+	case []string:
+		names = v
+	case []interface{}: // as read back from an index's stored mapping
+		for _, name := range v {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+	for _, name := range names {
+		filter, err := cache.TokenFilterNamed(name)
+		if err != nil {
+			return nil, err
+		}
+		f.filters = append(f.filters, filter)
+	}
+	return f, nil
+}
+
+func (f *scriptFilter) Filter(input analysis.TokenStream) analysis.TokenStream {
+	out := make(analysis.TokenStream, 0, len(input))
+	for _, token := range input {
+		if termScript(token.Term) != f.script {
+			out = append(out, token)
+			continue
+		}
+		stream := analysis.TokenStream{token}
+		for _, filter := range f.filters {
+			stream = filter.Filter(stream)
+		}
+		out = append(out, stream...)
+	}
+	return out
+}
+
+// termScript names the script a term is written in, after its first letter
+func termScript(term []byte) string {
+	for _, r := range string(term) {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			return "cyrillic"
+		case unicode.Is(unicode.Latin, r):
+			return "latin"
+		case unicode.IsLetter(r):
+			return "other"
+		}
+	}
+	return ""
+}
+
+// textAnalysis holds the analyzers of the configured languages
+type textAnalysis struct {
+	config    Analysis
+	mapping   *mapping.IndexMappingImpl
+	analyzers map[string]analysis.Analyzer // by language code
+	words     analysis.Analyzer            // words as written, for wildcards
+	stopwords map[string]analysis.TokenMap // for detection
+	signature string                       // changes with the configuration
+}
+
+func newTextAnalysis(cfg Analysis) (*textAnalysis, error) {
+	if len(cfg.Languages) == 0 {
+		return nil, newError(ErrInvalid, "no search languages configured")
+	}
+	cfg.Languages = append([]Language(nil), cfg.Languages...)
+
+	ta := &textAnalysis{
+		analyzers: map[string]analysis.Analyzer{},
+		stopwords: map[string]analysis.TokenMap{},
+	}
+	im := bleve.NewIndexMapping()
+	im.ScoringModel = index.BM25Scoring
+
+	// The first language written in each script stems that script's words
+	// in documents of other scripts
+	primary := map[string]Language{}
+	var signature []string
+	for i, lang := range cfg.Languages {
+		lang.Code = strings.ToLower(lang.Code)
+		cfg.Languages[i] = lang
+		filters, ok := languageFilters[lang.Code]
+		if !ok {
+			return nil, newError(ErrInvalid, "unsupported search language: %s (use %s)", lang.Code, supportedLanguages())
+		}
+		if _, ok := primary[filters.script]; !ok {
+			primary[filters.script] = lang
+		}
+		signature = append(signature, fmt.Sprintf("%s:%t:%t", lang.Code, lang.Stemming, lang.Stopwords))
+	}
+	ta.config = cfg
+	ta.signature = fmt.Sprintf("%s;fold:%t", strings.Join(signature, ","), cfg.Folding)
+
+	// Wildcards match words as written, since stems are cut short
+	wordFilters := []string{lowercase.Name}
+	if cfg.Folding {
+		wordFilters = append(wordFilters, foldFilterType)
+	}
+	err := im.AddCustomAnalyzer(wordsAnalyzer, map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicodetokenizer.Name,
+		"token_filters": wordFilters,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cache := registry.NewCache()
+	for _, lang := range cfg.Languages {
+		own := languageFilters[lang.Code].script
+		// Folding comes before stemming: Snowball leaves Russian words
+		// with ё unstemmed, so ёлка would never meet елка
+		tokenFilters := []string{lowercase.Name}
+		if cfg.Folding {
+			tokenFilters = append(tokenFilters, foldFilterType)
+		}
+		sorted := len(tokenFilters)
+		for script, other := range primary {
+			if script == own {
+				other = lang
+			}
+			var chain []string
+			if other.Stopwords {
+				chain = append(chain, languageFilters[other.Code].stop)
+			}
+			if other.Stemming {
+				chain = append(chain, languageFilters[other.Code].stemmer)
+			}
+			if len(chain) == 0 {
+				continue
+			}
+			name := fmt.Sprintf("kbnavt_%s_%s", lang.Code, script)
+			err := im.AddCustomTokenFilter(name, map[string]interface{}{
+				"type":    scriptFilterType,
+				"script":  script,
+				"filters": chain,
+			})
+			if err != nil {
+				return nil, err
+			}
+			tokenFilters = append(tokenFilters, name)
+		}
+		sort.Strings(tokenFilters[sorted:]) // map order must not change the mapping
+
+		name := analyzerName(lang.Code)
+		err := im.AddCustomAnalyzer(name, map[string]interface{}{
+			"type":          custom.Name,
+			"tokenizer":     unicodetokenizer.Name,
+			"token_filters": tokenFilters,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		doc := bleve.NewDocumentStaticMapping()
+		for _, f := range searchFields {
+			fm := bleve.NewTextFieldMapping()
+			fm.Analyzer = name
+			fm.Store = false
+			words := bleve.NewTextFieldMapping()
+			words.Name = wordsField(f.name)
+			words.Analyzer = wordsAnalyzer
+			words.Store = false
+			doc.AddFieldMappingsAt(f.name, fm, words)
+		}
+		for _, field := range facetFields {
+			fm := bleve.NewKeywordFieldMapping()
+			fm.IncludeInAll = false
+			doc.AddFieldMappingsAt(field, fm)
+		}
+		im.AddDocumentMapping(lang.Code, doc)
+
+		stopwords, err := cache.TokenMapNamed(languageFilters[lang.Code].stop)
+		if err != nil {
+			return nil, err
+		}
+		ta.stopwords[lang.Code] = stopwords
+	}
+	im.DefaultMapping = im.TypeMapping[cfg.Languages[0].Code]
+	im.DefaultAnalyzer = analyzerName(cfg.Languages[0].Code)
+	if err := im.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid search analysis: %w", err)
+	}
+
+	for _, lang := range cfg.Languages {
+		ta.analyzers[lang.Code] = im.AnalyzerNamed(analyzerName(lang.Code))
+	}
+	ta.words = im.AnalyzerNamed(wordsAnalyzer)
+	ta.mapping = im
+	return ta, nil
+}
+
+// wordsAnalyzer names the analyzer of the words fields
+const wordsAnalyzer = "kbnavt_words"
+
+func analyzerName(code string) string {
+	return "kbnavt_" + code
+}
+
+// wordsField names the copy of a field that keeps words as written
+func wordsField(field string) string {
+	return field + "_words"
+}
+
+// analyzer returns the analyzer of a language, or of the default one
+func (ta *textAnalysis) analyzer(code string) analysis.Analyzer {
+	if a, ok := ta.analyzers[code]; ok {
+		return a
+	}
+	return ta.analyzers[ta.config.Languages[0].Code]
+}
+
+// fold applies the configured folding to a query pattern
+func (ta *textAnalysis) fold(s string) string {
+	if ta.config.Folding {
+		return foldText(s)
+	}
+	return s
+}
+
+// minDetectWords is the number of words from which a section's language is
+// detected on its own rather than taken from its document
+const minDetectWords = 8
+
+// detect guesses which configured language text is written in: one of the
+// languages of its most common script, the one whose stop words occur most.
+// Ties and texts without words go to the first candidate.
+func (ta *textAnalysis) detect(text string) string {
+	tokens := analyzeTerms(text)
+	scripts := map[string]int{}
+	for _, term := range tokens {
+		scripts[termScript([]byte(term))]++
+	}
+	script, most := "", 0
+	for s, n := range scripts {
+		if s != "" && (n > most || n == most && s < script) {
+			script, most = s, n
+		}
+	}
+
+	best, bestHits := ta.config.Languages[0].Code, -1
+	for _, lang := range ta.config.Languages {
+		if languageFilters[lang.Code].script != script {
+			continue
+		}
+		hits := 0
+		for _, term := range tokens {
+			if ta.stopwords[lang.Code][term] {
+				hits++
+			}
+		}
+		if hits > bestHits {
+			best, bestHits = lang.Code, hits
+		}
+	}
+	return best
+}
+
+// declaredLanguage is a Markdown front matter lang or an Org #+LANGUAGE,
+// reduced to its language code: "ru-RU" gives "ru"
+func declaredLanguage(content string, format Format) string {
+	var value string
+	switch format {
+	case FormatOrg:
+		for _, line := range strings.Split(content, "\n") {
+			if v, ok := cutKeyword(line, "#+language:"); ok {
+				value = v
+				break
+			}
+		}
+	case FormatMarkdown:
+		if meta, _, err := ParseFrontMatter(content); err == nil {
+			value, _ = meta["lang"].(string)
+		}
+	}
+	code, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(value)), "-")
+	code, _, _ = strings.Cut(code, "_")
+	return code
+}
@@ -0,0 +1,139 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchWordForms(t *testing.T) {
+	files := map[string]string{
+		"ru.md":  "# Инфраструктура\nПлан развертывания сервиса.\n",
+		"en.md":  "# Releases\nWe deploy the services on Fridays.\n",
+		"mix.md": "# Заметки\nКоманда kubectl drain выселяет поды.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		// Stemming finds other word forms; ё matches е
+		expectPaths(t, searchPaths(t, nav, "развёртывание"), "ru.md")
+		expectPaths(t, searchPaths(t, nav, "service"), "en.md")
+		expectPaths(t, searchPaths(t, nav, "deploying"), "en.md")
+
+		// English words in a Russian note are stemmed as English
+		expectPaths(t, searchPaths(t, nav, "draining"), "mix.md")
+
+		// Stop words are left out, in phrases too
+		expectPaths(t, searchPaths(t, nav, `"deploy the services"`), "en.md")
+		expectPaths(t, searchPaths(t, nav, `the deploy`), "en.md")
+
+		// Wildcards match words as written rather than stems
+		expectPaths(t, searchPaths(t, nav, "развёртыв*"), "ru.md")
+		expectPaths(t, searchPaths(t, nav, "servic?s"), "en.md")
+	})
+}
+
+func TestSearchFoldsBeforeStemming(t *testing.T) {
+	files := map[string]string{
+		"yo.md": "# Праздник\nВ гостиной стоит ёлка.\n",
+		"ye.md": "# Двор\nВо дворе растет елка.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		expectPaths(t, searchPaths(t, nav, "елка"), "ye.md", "yo.md")
+		expectPaths(t, searchPaths(t, nav, "ёлка"), "ye.md", "yo.md")
+		expectPaths(t, searchPaths(t, nav, "ёлки"), "ye.md", "yo.md")
+	})
+}
+
+func TestSearchDeclaredLanguage(t *testing.T) {
+	files := map[string]string{
+		"declared.md": "---\nlang: de-DE\n---\n# Häuser\n",
+		"detected.md": "# Häuser\n",
+		"long.md":     "# Notizen\nDie Häuser sind alt, und die Gärten sind nicht groß genug für uns.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		analysis := Analysis{Languages: []Language{
+			{Code: "en", Stemming: true, Stopwords: true},
+			{Code: "de", Stemming: true, Stopwords: true},
+		}}
+		if err := nav.SetAnalysis(analysis); err != nil {
+			t.Fatal(err)
+		}
+
+		// Too short to detect, a note falls back to English unless it
+		// declares its language; longer German text is detected
+		expectPaths(t, searchPaths(t, nav, "haus"), "declared.md", "long.md")
+		expectPaths(t, searchPaths(t, nav, "häuser"), "declared.md", "detected.md", "long.md")
+	})
+}
+
+func TestSetAnalysis(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"a.md": "# A\nDeployments.\n"})
+	if err := nav.SetSearchMode(SearchIndex, filepath.Join(t.TempDir(), "index")); err != nil {
+		t.Fatal(err)
+	}
+	defer nav.Close()
+
+	expectPaths(t, searchPaths(t, nav, "deploy"), "a.md")
+
+	// The on-disk index is rebuilt for the new analysis
+	if err := nav.SetAnalysis(Analysis{Languages: []Language{{Code: "en"}}}); err != nil {
+		t.Fatal(err)
+	}
+	expectPaths(t, searchPaths(t, nav, "deploy"))
+	expectPaths(t, searchPaths(t, nav, "deployments"), "a.md")
+
+	for _, analysis := range []Analysis{{}, {Languages: []Language{{Code: "xx"}}}} {
+		if err := nav.SetAnalysis(analysis); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%+v: expected an invalid analysis error, got %v", analysis, err)
+		}
+	}
+}
+
+func TestFoldText(t *testing.T) {
+	tests := map[string]string{
+		"ёлка":       "елка",
+		"ЁЖ":         "ЕЖ",
+		"café":       "cafe",
+		"Ærøskøbing": "Ærøskøbing", // letters of their own, not marks
+		"йод":        "йод",
+		"deploy":     "deploy",
+	}
+	for in, want := range tests {
+		if got := foldText(in); got != want {
+			t.Errorf("%s: expected %s, got %s", in, want, got)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	ta, err := newTextAnalysis(Analysis{Languages: []Language{
+		{Code: "en"}, {Code: "de"}, {Code: "ru"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"The plan is to ship the release on Friday":       "en",
+		"Der Plan ist, die Version am Freitag zu liefern": "de",
+		"План в том, чтобы выпустить релиз в пятницу":     "ru",
+		"kubectl": "en",
+		"":        "en",
+	}
+	for text, want := range tests {
+		if got := ta.detect(text); got != want {
+			t.Errorf("%q: expected %s, got %s", text, want, got)
+		}
+	}
+}
+
+func TestSearchSnippetStems(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"ru.md": "# План\nРазвертывания идут по пятницам.\n"})
+	page, err := nav.Search(context.Background(), "развёртывание", SearchOptions{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 1 || len(page.Results[0].Fragments) != 1 {
+		t.Fatalf("Expected one hit with a fragment, got %+v", page.Results)
+	}
+	expectPaths(t, matched(page.Results[0].Fragments[0]), "Развертывания")
+}
@@ -0,0 +1,110 @@
+package kb
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	mdLinkRe   = regexp.MustCompile(`\[[^\]]*\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	wikiLinkRe = regexp.MustCompile(`\[\[([^\]|#]+)(?:#[^\]|]*)?(?:\|[^\]]*)?\]\]`)
+	orgLinkRe  = regexp.MustCompile(`\[\[file:([^\]:]+)(?:::[^\]]*)?\](?:\[[^\]]*\])?\]`)
+	schemeRe   = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+)
+
+// noteLink is a link from one note to another, as written
+type noteLink struct {
+	target string
+	wiki   bool // [[Name]]: found by name rather than by path
+}
+
+// parseLinks finds the links to other notes in content: Markdown
+// [text](path.md) links and [[Name]] wikilinks, or Org [[file:path.org]]
+// links. Links to web pages and anchors within the note are left out.
+func parseLinks(content string, format Format) []noteLink {
+	var links []noteLink
+	switch format {
+	case FormatOrg:
+		for _, m := range orgLinkRe.FindAllStringSubmatch(content, -1) {
+			links = append(links, noteLink{target: m[1]})
+		}
+	default:
+		for _, m := range mdLinkRe.FindAllStringSubmatch(content, -1) {
+			target, _, _ := strings.Cut(m[1], "#")
+			if target == "" || schemeRe.MatchString(target) {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(target); err == nil {
+				target = unescaped
+			}
+			links = append(links, noteLink{target: target})
+		}
+		for _, m := range wikiLinkRe.FindAllStringSubmatch(content, -1) {
+			links = append(links, noteLink{target: strings.TrimSpace(m[1]), wiki: true})
+		}
+	}
+	return links
+}
+
+// linkResolver maps link targets onto the documents of the KB
+type linkResolver struct {
+	paths  map[string]bool     // slash-separated paths
+	byName map[string][]string // lowercased names without extension, shortest path first
+}
+
+func newLinkResolver(docs []Document) *linkResolver {
+	r := &linkResolver{paths: map[string]bool{}, byName: map[string][]string{}}
+	for _, doc := range docs {
+		p := strings.ToLower(path.Clean(strings.ReplaceAll(doc.Path, "\\", "/")))
+		r.paths[p] = true
+		name := strings.TrimSuffix(path.Base(p), path.Ext(p))
+		r.byName[name] = append(r.byName[name], p)
+	}
+	for _, paths := range r.byName {
+		sort.Slice(paths, func(i, j int) bool {
+			if len(paths[i]) != len(paths[j]) {
+				return len(paths[i]) < len(paths[j])
+			}
+			return paths[i] < paths[j]
+		})
+	}
+	return r
+}
+
+// resolve returns the lowercased path of the document a link from the
+// document at from points to. Paths are relative to the linking note, or
+// to the KB root when they start with a slash; wikilinks name a note by
+// its path or, like Obsidian, by its file name alone.
+func (r *linkResolver) resolve(from string, link noteLink) (string, bool) {
+	target := strings.ToLower(strings.ReplaceAll(link.target, "\\", "/"))
+	from = strings.ToLower(strings.ReplaceAll(from, "\\", "/"))
+
+	var candidates []string
+	switch {
+	case link.wiki:
+		candidates = []string{path.Clean(target)}
+		if path.Ext(target) == "" {
+			candidates = []string{target + ".md", target + ".org", target + ".txt"}
+		}
+	case strings.HasPrefix(target, "/"):
+		candidates = []string{path.Clean(strings.TrimPrefix(target, "/"))}
+	default:
+		candidates = []string{path.Join(path.Dir(from), target)}
+	}
+	for _, c := range candidates {
+		if r.paths[c] {
+			return c, true
+		}
+	}
+
+	if link.wiki {
+		name := strings.TrimSuffix(path.Base(target), path.Ext(target))
+		if paths := r.byName[name]; len(paths) > 0 {
+			return paths[0], true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,554 @@
+package kb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes for listings and search results
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+// SortField orders listings and search results. Ties are broken by path.
+type SortField string
+
+const (
+	SortPath      SortField = "path"
+	SortTitle     SortField = "title"
+	SortModified  SortField = "modified"
+	SortSize      SortField = "size"
+	SortRelevance SortField = "relevance" // search only: best match first
+)
+
+// DocumentFilter selects documents; zero fields match everything
+type DocumentFilter struct {
+	Folder  string    // folder prefix, relative to the KB root
+	Formats []Format  // any of these formats
+	Since   time.Time // modified at or after
+	Until   time.Time // modified before
+	Glob    string    // path pattern; without a slash it matches the file name
+	Tags    []string  // Org file and headline tags, or "tags" in Markdown front matter; all must be present
+}
+
+// ListOptions controls filtering, ordering and paging of documents
+type ListOptions struct {
+	Filter DocumentFilter
+	Sort   SortField // defaults to path for listings, relevance for search
+	Desc   bool
+	Limit  int    // page size; 0 means DefaultPageSize
+	Cursor string // NextCursor of the previous page
+}
+
+// DocumentPage is one page of a document listing
+type DocumentPage struct {
+	Documents  []Document `json:"documents"`
+	Total      int        `json:"total"` // matching documents over all pages
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+// DefaultGroupSections is the number of sections kept per document when
+// search results are grouped
+const DefaultGroupSections = 3
+
+// SearchOptions adds the search-only settings to ListOptions
+type SearchOptions struct {
+	ListOptions
+	GroupByDocument bool // one result per document, carrying its best sections
+	Sections        int  // sections kept per document; 0 means DefaultGroupSections
+	Snippets        SnippetOptions
+	Fuzzy           bool // plain words also match words a few typos away
+	Typeahead       bool // the last word is being typed: match it as a prefix
+	Explain         bool // describe how the query was interpreted
+	KeywordOnly     bool // rank by keywords alone, even with an embedder
+	Facets          []Facet
+	FacetSize       int // values per facet; 0 means DefaultFacetSize
+}
+
+// SearchPage is one page of search results
+type SearchPage struct {
+	Results    []SearchResult `json:"results"`
+	Total      int            `json:"total"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	DidYouMean string         `json:"did_you_mean,omitempty"` // a corrected query, when nothing matched
+	Explain    *Explanation   `json:"explain,omitempty"`
+
+	Facets map[Facet]*FacetResult `json:"facets,omitempty"` // over all results, not just the page
+}
+
+// Explanation shows how a search query was interpreted
+type Explanation struct {
+	Query      string      `json:"query"` // the parsed query, after expansion
+	Expansions []Expansion `json:"expansions,omitempty"`
+	Semantic   string      `json:"semantic,omitempty"` // the text also searched by meaning
+}
+
+// ListQuery is the textual form of ListOptions, as it arrives in query
+// parameters, tool arguments or command-line flags.
+type ListQuery struct {
+	Folder  string
+	Formats []string // each may hold a comma-separated list
+	Since   string   // RFC 3339 time or YYYY-MM-DD
+	Until   string
+	Glob    string
+	Tags    []string // each may hold a comma-separated list
+	Sort    string
+	Order   string // asc or desc
+	Limit   int
+	Cursor  string
+
+	// Search only
+	Group       bool // group section hits by document
+	Sections    int  // sections per grouped document
+	SnippetSize int  // characters per snippet fragment
+	Snippets    int  // fragments per hit
+	Marker      string
+	Fuzzy       bool
+	Typeahead   bool
+	Explain     bool
+	KeywordOnly bool
+	Facets      []string // each may hold a comma-separated list
+	FacetSize   int
+}
+
+// Options validates the query and converts it to ListOptions
+func (q ListQuery) Options() (ListOptions, error) {
+	opts := ListOptions{
+		Filter: DocumentFilter{Glob: q.Glob},
+		Sort:   SortField(q.Sort),
+		Limit:  q.Limit,
+		Cursor: q.Cursor,
+	}
+
+	if q.Folder != "" {
+		folder := path.Clean(filepath.ToSlash(q.Folder))
+		if folder == ".." || strings.HasPrefix(folder, "../") || path.IsAbs(folder) {
+			return opts, newError(ErrForbiddenPath, "folder outside the knowledge base: %s", q.Folder)
+		}
+		if folder != "." {
+			opts.Filter.Folder = folder
+		}
+	}
+
+	for _, name := range splitList(q.Formats) {
+		format, ok := formatNames[strings.ToLower(name)]
+		if !ok {
+			return opts, newError(ErrInvalid, "unknown format: %s (use org, markdown or text)", name)
+		}
+		opts.Filter.Formats = append(opts.Filter.Formats, format)
+	}
+	opts.Filter.Tags = splitList(q.Tags)
+
+	var err error
+	if opts.Filter.Since, err = parseDate("since", q.Since); err != nil {
+		return opts, err
+	}
+	if opts.Filter.Until, err = parseDate("until", q.Until); err != nil {
+		return opts, err
+	}
+
+	if q.Glob != "" {
+		if _, err := path.Match(strings.ReplaceAll(q.Glob, "**", "*"), ""); err != nil {
+			return opts, newError(ErrInvalid, "invalid glob: %s", q.Glob)
+		}
+	}
+
+	switch opts.Sort {
+	case "", SortPath, SortTitle, SortModified, SortSize, SortRelevance:
+	default:
+		return opts, newError(ErrInvalid, "unknown sort field: %s (use path, title, modified, size or relevance)", q.Sort)
+	}
+
+	switch strings.ToLower(q.Order) {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, newError(ErrInvalid, "unknown order: %s (use asc or desc)", q.Order)
+	}
+
+	if q.Limit < 0 {
+		return opts, newError(ErrInvalid, "limit must not be negative")
+	}
+	return opts, nil
+}
+
+// SearchOptions validates the query and converts it to SearchOptions
+func (q ListQuery) SearchOptions() (SearchOptions, error) {
+	list, err := q.Options()
+	opts := SearchOptions{
+		ListOptions:     list,
+		GroupByDocument: q.Group,
+		Sections:        q.Sections,
+		Fuzzy:           q.Fuzzy,
+		Typeahead:       q.Typeahead,
+		Explain:         q.Explain,
+		KeywordOnly:     q.KeywordOnly,
+	}
+	if err != nil {
+		return opts, err
+	}
+	if q.Sections < 0 {
+		return opts, newError(ErrInvalid, "sections must not be negative")
+	}
+	if q.SnippetSize < 0 || q.Snippets < 0 {
+		return opts, newError(ErrInvalid, "snippet size and count must not be negative")
+	}
+	if q.FacetSize < 0 {
+		return opts, newError(ErrInvalid, "facet size must not be negative")
+	}
+	if opts.Facets, err = parseFacets(q.Facets); err != nil {
+		return opts, err
+	}
+	opts.FacetSize = q.FacetSize
+	opts.Snippets = SnippetOptions{Size: q.SnippetSize, Count: q.Snippets}
+	opts.Snippets.Marker, err = parseMarkerStyle(q.Marker)
+	return opts, err
+}
+
+// formatNames accepts format names as well as file extensions
+var formatNames = map[string]Format{
+	"org":      FormatOrg,
+	"markdown": FormatMarkdown,
+	"md":       FormatMarkdown,
+	"text":     FormatText,
+	"txt":      FormatText,
+}
+
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
+
+// relativeDateRe matches a time ago in days or weeks, such as -14d or -2w
+var relativeDateRe = regexp.MustCompile(`^-(\d+)([dw])$`)
+
+// parseDate reads a date, an RFC 3339 time or a time ago, which starts
+// at midnight that many days or weeks back
+func parseDate(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if m := relativeDateRe.FindStringSubmatch(value); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err == nil {
+			if m[2] == "w" {
+				days *= 7
+			}
+			year, month, day := time.Now().Date()
+			return time.Date(year, month, day-days, 0, 0, 0, 0, time.Local), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, newError(ErrInvalid, "invalid %s date: %s (use YYYY-MM-DD, RFC 3339 or a time ago such as -14d)", name, value)
+}
+
+// ListDocumentsPage returns one page of the documents matching opts.Filter
+func (n *Navigator) ListDocumentsPage(opts ListOptions) (*DocumentPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortPath
+	}
+	if opts.Sort == SortRelevance {
+		return nil, newError(ErrInvalid, "relevance ordering needs a search query")
+	}
+
+	docs, err := n.filterDocuments(opts.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]sortKey, len(docs))
+	for i, doc := range docs {
+		keys[i] = documentKey(doc)
+	}
+	order, next, err := paginate(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &DocumentPage{Documents: []Document{}, Total: len(docs), NextCursor: next}
+	for _, i := range order {
+		page.Documents = append(page.Documents, docs[i])
+	}
+	return page, nil
+}
+
+// filterDocuments lists the documents matching filter
+func (n *Navigator) filterDocuments(filter DocumentFilter) ([]Document, error) {
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Document
+	for _, doc := range docs {
+		if n.matchFilter(doc, filter) {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+func (n *Navigator) matchFilter(doc Document, f DocumentFilter) bool {
+	p := filepath.ToSlash(doc.Path)
+
+	if f.Folder != "" && !strings.HasPrefix(p, f.Folder+"/") {
+		return false
+	}
+	if len(f.Formats) > 0 {
+		found := false
+		for _, format := range f.Formats {
+			found = found || doc.Format == format
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && doc.UpdatedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !doc.UpdatedAt.Before(f.Until) {
+		return false
+	}
+	if f.Glob != "" && !matchGlob(f.Glob, p) {
+		return false
+	}
+	if len(f.Tags) > 0 {
+		// Tags need the content, so they are checked last
+		content, err := os.ReadFile(filepath.Join(n.baseDir, doc.Path))
+		if err != nil {
+			n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			return false
+		}
+		tags := map[string]bool{}
+		for _, tag := range documentTags(string(content), doc.Format) {
+			tags[strings.ToLower(tag)] = true
+		}
+		for _, tag := range f.Tags {
+			if !tags[strings.ToLower(strings.Trim(tag, ":#"))] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchGlob matches a slash-separated path against a pattern in which "**"
+// spans any number of folders. A pattern without a slash matches the file
+// name alone.
+func matchGlob(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(p, "/"))
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// documentTags collects an Org file's #+FILETAGS and headline tags, or the
+// tags of a Markdown front matter block.
+func documentTags(content string, format Format) []string {
+	tags := fileTags(content, format)
+	if format == FormatOrg {
+		for _, span := range scanSections(content, format) {
+			tags = append(tags, span.Tags...)
+		}
+	}
+	return tags
+}
+
+// fileTags are the tags of a whole document: an Org file's #+FILETAGS or
+// the tags of a Markdown front matter block.
+func fileTags(content string, format Format) []string {
+	var tags []string
+	switch format {
+	case FormatOrg:
+		for _, line := range strings.Split(content, "\n") {
+			if value, ok := cutKeyword(line, "#+filetags:"); ok {
+				tags = append(tags, strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == ' ' })...)
+			}
+		}
+	case FormatMarkdown:
+		meta, _, err := ParseFrontMatter(content)
+		if err != nil {
+			return nil
+		}
+		switch v := meta["tags"].(type) {
+		case string:
+			tags = splitList(strings.Fields(v))
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					tags = append(tags, s)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// cutKeyword returns the value of an Org "#+KEYWORD:" line, ignoring case
+func cutKeyword(line, keyword string) (string, bool) {
+	if len(line) < len(keyword) || !strings.EqualFold(line[:len(keyword)], keyword) {
+		return "", false
+	}
+	return strings.TrimSpace(line[len(keyword):]), true
+}
+
+// sortKey holds the values an item can be ordered by
+type sortKey struct {
+	Path     string    `json:"p"`
+	Title    string    `json:"t,omitempty"`
+	Modified time.Time `json:"m"`
+	Size     int64     `json:"z,omitempty"`
+	Score    float64   `json:"r,omitempty"`
+	Line     int       `json:"l,omitempty"` // section hits within a document
+}
+
+func documentKey(doc Document) sortKey {
+	return sortKey{Path: filepath.ToSlash(doc.Path), Title: doc.Title, Modified: doc.UpdatedAt, Size: doc.Size}
+}
+
+// compareKeys orders a before b (negative), after b (positive) or equal
+func compareKeys(field SortField, a, b sortKey) int {
+	c := 0
+	switch field {
+	case SortTitle:
+		c = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	case SortModified:
+		c = a.Modified.Compare(b.Modified)
+	case SortSize:
+		c = compareNumbers(a.Size, b.Size)
+	case SortRelevance:
+		c = compareNumbers(b.Score, a.Score)
+	}
+	if c == 0 {
+		c = strings.Compare(a.Path, b.Path)
+	}
+	if c == 0 {
+		c = compareNumbers(int64(a.Line), int64(b.Line))
+	}
+	return c
+}
+
+func compareNumbers[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// pageCursor is the position after the last item of a page. It carries the
+// sort order so that a cursor can't be replayed against another ordering.
+type pageCursor struct {
+	Sort SortField `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	Last sortKey   `json:"k"`
+}
+
+func encodeCursor(c pageCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (pageCursor, error) {
+	var c pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, newError(ErrInvalid, "invalid cursor")
+	}
+	return c, nil
+}
+
+// paginate sorts keys and returns the indexes of the requested page along
+// with the cursor of the next one ("" on the last page).
+func paginate(keys []sortKey, opts ListOptions) ([]int, string, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+
+	less := func(a, b sortKey) bool {
+		if opts.Desc {
+			return compareKeys(opts.Sort, a, b) > 0
+		}
+		return compareKeys(opts.Sort, a, b) < 0
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return less(keys[order[i]], keys[order[j]]) })
+
+	start := 0
+	if opts.Cursor != "" {
+		cursor, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if cursor.Sort != opts.Sort || cursor.Desc != opts.Desc {
+			return nil, "", newError(ErrInvalid, "cursor belongs to a different sort order")
+		}
+		// Keyset paging: documents added or removed before the cursor don't
+		// shift the following pages
+		start = sort.Search(len(order), func(i int) bool { return less(cursor.Last, keys[order[i]]) })
+	}
+
+	end := start + limit
+	if end >= len(order) {
+		return order[start:], "", nil
+	}
+	next := encodeCursor(pageCursor{Sort: opts.Sort, Desc: opts.Desc, Last: keys[order[end-1]]})
+	return order[start:end], next, nil
+}
@@ -0,0 +1,176 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListDocumentsPage(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"a.md":                "# A\n",
+		"b.org":               "#+FILETAGS: :work:urgent:\n* B\n",
+		"notes/c.md":          "---\ntags: [work, ideas]\n---\n# C\n",
+		"notes/deep/d.org":    "* D :ideas:\n",
+		"projects/x/plan.txt": "plan plan plan plan\n",
+	})
+
+	// Walk all pages and check that they cover every document once, in order
+	var paths []string
+	opts := ListOptions{Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := nav.ListDocumentsPage(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Total != 5 {
+			t.Fatalf("Expected a total of 5, got %d", page.Total)
+		}
+		for _, doc := range page.Documents {
+			paths = append(paths, filepath.ToSlash(doc.Path))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("Pagination doesn't terminate")
+		}
+		opts.Cursor = page.NextCursor
+	}
+	want := []string{"a.md", "b.org", "notes/c.md", "notes/deep/d.org", "projects/x/plan.txt"}
+	if len(paths) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, paths)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, paths)
+		}
+	}
+
+	page, err := nav.ListDocumentsPage(ListOptions{Sort: SortSize, Desc: true, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := filepath.ToSlash(page.Documents[0].Path); got != "notes/c.md" {
+		t.Errorf("Expected the largest document first, got %s", got)
+	}
+
+	_, err = nav.ListDocumentsPage(ListOptions{Sort: SortTitle, Cursor: page.NextCursor})
+	if !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected a cursor from another ordering to be rejected, got %v", err)
+	}
+}
+
+func TestDocumentFilter(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"a.md":                "# A\n",
+		"b.org":               "#+FILETAGS: :work:urgent:\n* B\n",
+		"notes/c.md":          "---\ntags: [work, ideas]\n---\n# C\n",
+		"notes/deep/d.org":    "* D :ideas:\n",
+		"projects/x/plan.txt": "plan\n",
+	})
+	old := time.Date(2024, 1, 10, 12, 0, 0, 0, time.Local)
+	if err := os.Chtimes(filepath.Join(nav.BaseDir(), "a.md"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query ListQuery
+		want  []string
+	}{
+		{"folder", ListQuery{Folder: "notes/"}, []string{"notes/c.md", "notes/deep/d.org"}},
+		{"formats", ListQuery{Formats: []string{"org,txt"}}, []string{"b.org", "notes/deep/d.org", "projects/x/plan.txt"}},
+		{"glob name", ListQuery{Glob: "*.md"}, []string{"a.md", "notes/c.md"}},
+		{"glob path", ListQuery{Glob: "notes/**/*.org"}, []string{"notes/deep/d.org"}},
+		{"tags", ListQuery{Tags: []string{"work"}}, []string{"b.org", "notes/c.md"}},
+		{"all tags", ListQuery{Tags: []string{"ideas", "work"}}, []string{"notes/c.md"}},
+		{"until", ListQuery{Until: "2024-01-11"}, []string{"a.md"}},
+		{"since", ListQuery{Since: "2024-01-11", Folder: "notes"}, []string{"notes/c.md", "notes/deep/d.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, err := tt.query.Options()
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, err := nav.ListDocumentsPage(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, doc := range page.Documents {
+				got = append(got, filepath.ToSlash(doc.Path))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestListQueryErrors(t *testing.T) {
+	tests := []struct {
+		query ListQuery
+		kind  error
+	}{
+		{ListQuery{Formats: []string{"pdf"}}, ErrInvalid},
+		{ListQuery{Since: "last week"}, ErrInvalid},
+		{ListQuery{Sort: "color"}, ErrInvalid},
+		{ListQuery{Order: "up"}, ErrInvalid},
+		{ListQuery{Glob: "[a"}, ErrInvalid},
+		{ListQuery{Folder: "../outside"}, ErrForbiddenPath},
+	}
+
+	for _, tt := range tests {
+		if _, err := tt.query.Options(); !errors.Is(err, tt.kind) {
+			t.Errorf("%+v: expected %v, got %v", tt.query, tt.kind, err)
+		}
+	}
+}
+
+func TestSearchPage(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"one.md":       "# One\ngolang\n",
+		"three.md":     "# Three\ngolang golang golang\n",
+		"two.md":       "# Two\ngolang golang\n",
+		"other/two.md": "# Two\ngolang golang\n",
+		"none.md":      "# None\n",
+	})
+
+	page, err := nav.Search(context.Background(), "golang", SearchOptions{ListOptions: ListOptions{Limit: 2}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 4 || len(page.Results) != 2 || page.NextCursor == "" {
+		t.Fatalf("Expected the first 2 of 4 results and a cursor, got %+v", page)
+	}
+	if page.Results[0].DocumentPath != "three.md" {
+		t.Errorf("Expected the best match first, got %s", page.Results[0].DocumentPath)
+	}
+
+	next, err := nav.Search(context.Background(), "golang", SearchOptions{ListOptions: ListOptions{Limit: 2, Cursor: page.NextCursor}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(next.Results) != 2 || next.NextCursor != "" || next.Results[1].DocumentPath != "one.md" {
+		t.Errorf("Expected the remaining 2 results ending with one.md, got %+v", next.Results)
+	}
+
+	filtered, err := nav.Search(context.Background(), "golang", SearchOptions{ListOptions: ListOptions{Filter: DocumentFilter{Folder: "other"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filtered.Total != 1 {
+		t.Errorf("Expected the folder filter to apply to search, got %+v", filtered.Results)
+	}
+}
@@ -1,11 +1,13 @@
 package kb
 
 import (
+    "context"
     "fmt"
     "io/ioutil"
     "log/slog"
     "os"
     "path/filepath"
+    "sort"
     "strings"
     //"time"
 )
@@ -16,6 +18,9 @@ type Navigator struct {
     security   *SecurityManager
     parser     *Parser
     logger     *slog.Logger
+    scope      []string // folders visible through this navigator; nil means the whole KB
+    maxSize    int64    // largest document served, in bytes; 0 means no limit
+    search     *searchState
 }
 
 // NewNavigator creates a new navigator
@@ -30,11 +35,73 @@ func NewNavigator(baseDir string, logger *slog.Logger) (*Navigator, error) {
         security: NewSecurityManager(filepath.Clean(baseDir)),
         parser:   NewParser(),
         logger:   logger,
+        search:   &searchState{mode: SearchAuto},
     }
 
     return nav, nil
 }
 
+// SetMaxSize limits the size of documents that are read or edited; 0 lifts the limit
+func (n *Navigator) SetMaxSize(bytes int64) {
+    n.maxSize = bytes
+}
+
+// BaseDir returns the KB root directory
+func (n *Navigator) BaseDir() string {
+    return n.baseDir
+}
+
+// WithScope returns a navigator that only sees documents inside folders
+// (relative to the KB root). A nil slice lifts the restriction; an empty,
+// non-nil slice hides everything.
+func (n *Navigator) WithScope(folders []string) *Navigator {
+    scoped := *n
+    scoped.scope = nil
+    if folders != nil {
+        scoped.scope = []string{}
+        for _, folder := range folders {
+            folder = strings.Trim(filepath.ToSlash(filepath.Clean(folder)), "/")
+            if folder == "." || folder == "" {
+                scoped.scope = nil
+                break
+            }
+            scoped.scope = append(scoped.scope, folder)
+        }
+    }
+    return &scoped
+}
+
+// Scope returns the folders this navigator is restricted to, or nil
+func (n *Navigator) Scope() []string {
+    return n.scope
+}
+
+// inScope reports whether a relative path is visible through this navigator
+func (n *Navigator) inScope(relativePath string) bool {
+    if n.scope == nil {
+        return true
+    }
+    p := strings.TrimPrefix(filepath.ToSlash(filepath.Clean(relativePath)), "/")
+    for _, folder := range n.scope {
+        if p == folder || strings.HasPrefix(p, folder+"/") {
+            return true
+        }
+    }
+    return false
+}
+
+// validatePath checks a relative path against the sandbox and the scope
+func (n *Navigator) validatePath(relativePath string) (string, error) {
+    fullPath, err := n.security.ValidatePath(relativePath)
+    if err != nil {
+        return "", err
+    }
+    if !n.inScope(relativePath) {
+        return "", newError(ErrForbiddenPath, "path not in scope: %s", relativePath)
+    }
+    return fullPath, nil
+}
+
 // ListDocuments returns all documents in the KB
 func (n *Navigator) ListDocuments() ([]Document, error) {
     var documents []Document
@@ -44,11 +111,19 @@ func (n *Navigator) ListDocuments() ([]Document, error) {
             return err
         }
 
+        // Skip hidden folders such as .git and .kbnavt
+        if info.IsDir() && path != n.baseDir && strings.HasPrefix(info.Name(), ".") {
+            return filepath.SkipDir
+        }
+
         if info.IsDir() || !n.security.IsAllowedFile(info.Name()) {
             return nil
         }
 
         relPath, _ := filepath.Rel(n.baseDir, path)
+        if !n.inScope(relPath) {
+            return nil
+        }
         format := detectFormat(info.Name())
 
         doc := Document{
@@ -70,15 +145,15 @@ func (n *Navigator) ListDocuments() ([]Document, error) {
 // ReadDocument reads a full document
 func (n *Navigator) ReadDocument(relativePath string) (*Document, error) {
     // Security check
-    fullPath, err := n.security.ValidatePath(relativePath)
+    fullPath, err := n.validatePath(relativePath)
     if err != nil {
         n.logger.Warn("path validation failed", "path", relativePath, "error", err)
         return nil, err
     }
 
-    info, err := os.Stat(fullPath)
+    info, err := n.statDocument(fullPath, relativePath)
     if err != nil {
-        return nil, fmt.Errorf("document not found: %s", relativePath)
+        return nil, err
     }
 
     content, err := ioutil.ReadFile(fullPath)
@@ -99,7 +174,7 @@ func (n *Navigator) ReadDocument(relativePath string) (*Document, error) {
     }
 
     if err != nil {
-        return nil, fmt.Errorf("parsing error: %w", err)
+        return nil, wrapError(ErrInvalid, err, "parsing error")
     }
 
     doc.Path = relativePath
@@ -107,16 +182,20 @@ func (n *Navigator) ReadDocument(relativePath string) (*Document, error) {
     doc.CreatedAt = info.ModTime()
     doc.UpdatedAt = info.ModTime()
     doc.Size = info.Size()
+    doc.Hash = ContentHash(string(content))
 
     return doc, nil
 }
 
 // ReadSection reads a specific section from a document
 func (n *Navigator) ReadSection(relativePath, sectionTitle string) (string, error) {
-    fullPath, err := n.security.ValidatePath(relativePath)
+    fullPath, err := n.validatePath(relativePath)
     if err != nil {
         return "", err
     }
+    if _, err := n.statDocument(fullPath, relativePath); err != nil {
+        return "", err
+    }
 
     content, err := ioutil.ReadFile(fullPath)
     if err != nil {
@@ -127,6 +206,21 @@ func (n *Navigator) ReadSection(relativePath, sectionTitle string) (string, erro
     return n.parser.ReadSection(string(content), format, sectionTitle)
 }
 
+// statDocument checks that a validated path names a document that may be read
+func (n *Navigator) statDocument(fullPath, relativePath string) (os.FileInfo, error) {
+    info, err := os.Stat(fullPath)
+    if err != nil || info.IsDir() {
+        return nil, newError(ErrNotFound, "document not found: %s", relativePath)
+    }
+    if !n.security.IsAllowedFile(info.Name()) {
+        return nil, newError(ErrUnsupportedFormat, "unsupported file type: %s", relativePath)
+    }
+    if n.maxSize > 0 && info.Size() > n.maxSize {
+        return nil, newError(ErrTooLarge, "document too large: %s (%d bytes, limit %d)", relativePath, info.Size(), n.maxSize)
+    }
+    return info, nil
+}
+
 // ListResources returns all resources as MCP-compatible URIs
 func (n *Navigator) ListResources() ([]Resource, error) {
     docs, err := n.ListDocuments()
@@ -148,82 +242,256 @@ func (n *Navigator) ListResources() ([]Resource, error) {
     return resources, nil
 }
 
+// ProgressFunc is called as a long operation advances through total items
+type ProgressFunc func(done, total int)
+
 // SearchDocuments performs keyword search
 func (n *Navigator) SearchDocuments(query string, limit int) ([]SearchResult, error) {
-    var results []SearchResult
-    docs, err := n.ListDocuments()
+    return n.SearchDocumentsContext(context.Background(), query, limit, nil)
+}
+
+// SearchDocumentsContext is SearchDocuments with cancellation and progress
+// reporting; progress may be nil. Results are whole documents.
+func (n *Navigator) SearchDocumentsContext(ctx context.Context, query string, limit int, progress ProgressFunc) ([]SearchResult, error) {
+    opts := SearchOptions{ListOptions: ListOptions{Limit: limit}, GroupByDocument: true}
+    page, err := n.Search(ctx, query, opts, progress)
     if err != nil {
         return nil, err
     }
+    return page.Results, nil
+}
 
-    for _, doc := range docs {
-        fullDoc, err := n.ReadDocument(doc.Path)
-        if err != nil {
-            n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
-            continue
+// Search returns one page of the sections matching query among the
+// documents selected by opts.Filter, best match first unless opts.Sort says
+// otherwise. Each heading is searched on its own, with its header path and
+// the document's title and tags; the text before the first heading is a
+// unit of its own. With opts.GroupByDocument, results are documents carrying
+// their best sections instead. The query language is described in query.go;
+// matches are ranked with BM25, favouring titles, headings and tags over
+// body text. With an embedder (see SetSemantic), sections close in meaning
+// are found too, and both rankings fused. Words and phrases with synonyms
+// also match those. When nothing matches, the page may suggest a corrected
+// query. opts.Facets count all results by folder, format, tag, year or TODO
+// state.
+func (n *Navigator) Search(ctx context.Context, query string, opts SearchOptions, progress ProgressFunc) (*SearchPage, error) {
+    if opts.Sort == "" {
+        opts.Sort = SortRelevance
+    }
+
+    q, err := parseSearchQuery(query)
+    if err != nil {
+        return nil, err
+    }
+    if opts.Typeahead {
+        q.typeahead(query)
+    }
+    meaning := q.semanticText()
+    expansions := q.expandSynonyms(n.synonyms())
+    q.analyze(n.textAnalysis())
+    if opts.Fuzzy {
+        q.tolerateTypos()
+    }
+    docs, err := n.filterDocuments(opts.Filter)
+    if err != nil {
+        return nil, err
+    }
+
+    var hits []searchHit
+    if q.empty() {
+        // Nothing to rank: the filters alone select documents
+        for _, doc := range docs {
+            hits = append(hits, searchHit{doc: doc, line: -1})
+        }
+    } else if hits, err = n.rankDocuments(ctx, q, docs, progress); err != nil {
+        return nil, err
+    }
+    hybrid := false
+    if !q.empty() && !opts.KeywordOnly {
+        if hits, hybrid, err = n.hybridHits(ctx, q, meaning, docs, hits, progress); err != nil {
+            return nil, err
         }
+    }
+
+    var didYouMean string
+    if len(hits) == 0 && !q.empty() {
+        didYouMean = n.didYouMean(ctx, query, q)
+    }
 
-        if score := calculateRelevance(fullDoc.Content, query); score > 0 {
-            results = append(results, SearchResult{
-                DocumentID:   doc.Path,
-                DocumentPath: doc.Path,
-                Score:        score,
-                Snippet:      extractSnippet(fullDoc.Content, query, 150),
-            })
+    var explain *Explanation
+    if opts.Explain {
+        explain = &Explanation{Query: q.String(), Expansions: expansions}
+        if hybrid {
+            explain.Semantic = meaning
+        }
+    }
+    var facets map[Facet]*FacetResult
+    if len(opts.Facets) > 0 {
+        if facets, err = n.countFacets(ctx, hits, opts); err != nil {
+            return nil, err
         }
     }
 
-    // Sort by score (simplified)
-    if len(results) > limit {
-        results = results[:limit]
+    if opts.GroupByDocument {
+        page, err := n.groupedPage(q, hits, opts)
+        if err != nil {
+            return nil, err
+        }
+        page.DidYouMean, page.Explain, page.Facets = didYouMean, explain, facets
+        return page, nil
     }
 
-    return results, nil
-}
+    keys := make([]sortKey, len(hits))
+    for i, hit := range hits {
+        keys[i] = documentKey(hit.doc)
+        keys[i].Score = hit.score
+        keys[i].Line = hit.line + 1
+    }
+    order, next, err := paginate(keys, opts.ListOptions)
+    if err != nil {
+        return nil, err
+    }
 
-func detectFormat(filename string) Format {
-    ext := strings.ToLower(filepath.Ext(filename))
-    switch ext {
-    case ".org":
-        return FormatOrg
-    case ".md", ".markdown":
-        return FormatMarkdown
-    default:
-        return FormatText
+    page := &SearchPage{Results: []SearchResult{}, Total: len(hits), NextCursor: next, DidYouMean: didYouMean, Explain: explain, Facets: facets}
+    units := n.unitLoader()
+    for _, i := range order {
+        page.Results = append(page.Results, searchResult(q, units(hits[i]), opts.Snippets))
     }
+    return page, nil
 }
 
-func calculateRelevance(content, query string) float64 {
-    contentLower := strings.ToLower(content)
-    queryLower := strings.ToLower(query)
+// groupedPage pages through the documents of hits, each with its best
+// sections.
+func (n *Navigator) groupedPage(q *searchQuery, hits []searchHit, opts SearchOptions) (*SearchPage, error) {
+    sections := opts.Sections
+    if sections <= 0 {
+        sections = DefaultGroupSections
+    }
 
-    if !strings.Contains(contentLower, queryLower) {
-        return 0
+    // Group the hits by document, best first; a document scores as its best
+    // section
+    sort.SliceStable(hits, func(i, j int) bool {
+        if hits[i].score != hits[j].score {
+            return hits[i].score > hits[j].score
+        }
+        return hits[i].line < hits[j].line
+    })
+    var groups [][]searchHit
+    index := map[string]int{}
+    for _, hit := range hits {
+        i, ok := index[hit.doc.Path]
+        if !ok {
+            i = len(groups)
+            index[hit.doc.Path] = i
+            groups = append(groups, nil)
+        }
+        groups[i] = append(groups[i], hit)
+    }
+
+    keys := make([]sortKey, len(groups))
+    for i, group := range groups {
+        keys[i] = documentKey(group[0].doc)
+        keys[i].Score = group[0].score
+    }
+    order, next, err := paginate(keys, opts.ListOptions)
+    if err != nil {
+        return nil, err
     }
 
-    // Simple scoring: count occurrences
-    count := strings.Count(contentLower, queryLower)
-    return float64(count) / float64(len(content)) * 100
+    page := &SearchPage{Results: []SearchResult{}, Total: len(groups), NextCursor: next}
+    units := n.unitLoader()
+    for _, i := range order {
+        group := groups[i]
+        result := searchResult(q, units(group[0]), opts.Snippets)
+        result.Header, result.HeaderPath = nil, nil
+        for j := 0; j < len(group) && j < sections && group[j].line >= 0; j++ {
+            result.Sections = append(result.Sections, searchResult(q, units(group[j]), opts.Snippets))
+        }
+        page.Results = append(page.Results, result)
+    }
+    return page, nil
 }
 
-func extractSnippet(content, query string, length int) string {
-    idx := strings.Index(strings.ToLower(content), strings.ToLower(query))
-    if idx == -1 {
-        if len(content) > length {
-            return content[:length] + "..."
+// unitLoader returns a function filling in the unit of a hit, reading each
+// document at most once. Hits on sections that no longer exist fall back to
+// the whole document.
+func (n *Navigator) unitLoader() func(hit searchHit) searchHit {
+    loaded := map[string][]searchUnit{}
+    contents := map[string]string{}
+    return func(hit searchHit) searchHit {
+        if hit.unit != nil {
+            return hit
+        }
+        units, ok := loaded[hit.doc.Path]
+        if !ok {
+            if fullDoc, err := n.ReadDocument(hit.doc.Path); err == nil {
+                units = n.textAnalysis().documentUnits(fullDoc)
+                contents[hit.doc.Path] = fullDoc.Content
+            }
+            loaded[hit.doc.Path] = units
+        }
+        for i := range units {
+            if units[i].line == hit.line {
+                hit.unit = &units[i]
+                return hit
+            }
         }
-        return content
+        hit.unit = &searchUnit{text: contents[hit.doc.Path]}
+        return hit
     }
+}
 
-    start := idx
-    if start > 0 {
-        start -= 50
+// searchResult describes a hit, with snippets of the matching section
+func searchResult(q *searchQuery, hit searchHit, snippets SnippetOptions) SearchResult {
+    result := SearchResult{
+        DocumentID:   hit.doc.Path,
+        DocumentPath: hit.doc.Path,
+        Score:        hit.score,
+    }
+    result.Fragments, result.Snippet = q.snippets(hit.unit.text, hit.unit.textLine, hit.unit.lang, snippets)
+    if span := hit.unit.span; span != nil {
+        result.Header = &Header{Level: span.Level, Title: span.Title, LineNum: span.Line + 1}
+        result.HeaderPath = append(append([]string{}, span.Path...), span.Title)
     }
+    return result
+}
 
-    end := idx + len(query) + 100
-    if end > len(content) {
-        end = len(content)
+// rankDocuments scores the sections matching q, through the index when
+// there is one.
+func (n *Navigator) rankDocuments(ctx context.Context, q *searchQuery, docs []Document, progress ProgressFunc) ([]searchHit, error) {
+    engine, err := n.searchEngine(ctx, progress)
+    if err != nil {
+        return nil, err
+    }
+    if engine == nil {
+        return n.scanSearch(ctx, q, docs, progress)
     }
 
-    return "..." + strings.TrimSpace(content[start:end]) + "..."
+    scores, err := engine.search(ctx, q, docs)
+    if err != nil {
+        return nil, err
+    }
+    byPath := make(map[string]Document, len(docs))
+    for _, doc := range docs {
+        byPath[filepath.ToSlash(doc.Path)] = doc
+    }
+    var hits []searchHit
+    for id, score := range scores {
+        path, line, ok := parseUnitID(id)
+        if doc, found := byPath[path]; ok && found {
+            hits = append(hits, searchHit{doc: doc, line: line, score: score})
+        }
+    }
+    return hits, nil
+}
+
+func detectFormat(filename string) Format {
+    ext := strings.ToLower(filepath.Ext(filename))
+    switch ext {
+    case ".org":
+        return FormatOrg
+    case ".md", ".markdown":
+        return FormatMarkdown
+    default:
+        return FormatText
+    }
 }
@@ -3,7 +3,6 @@ package kb
 import (
 	"bufio"
 	"bytes"
-	"fmt"
 	"regexp"
 	"strings"
 
@@ -150,32 +149,18 @@ func (p *Parser) extractMarkdownHeaders(root ast.Node, content string) []Header
 
 // ReadSection reads a specific header section from a document
 func (p *Parser) ReadSection(content string, format Format, headerTitle string) (string, error) {
-    var headers []Header
-
     switch format {
-    case FormatOrg:
-        doc, err := p.ParseOrgMode(content)
-        if err != nil {
-            return "", err
-        }
-        headers = doc.Headers
-    case FormatMarkdown:
-        doc, err := p.ParseMarkdown(content)
-        if err != nil {
-            return "", err
+    case FormatOrg, FormatMarkdown:
+        // Cut the section by line range, including its subsections
+        if span, ok := findSection(scanSections(content, format), headerTitle); ok {
+            lines := strings.Split(content, "\n")
+            return strings.Join(lines[span.Line+1:span.End], "\n"), nil
         }
-        headers = doc.Headers
     default:
         return content, nil
     }
 
-    for _, h := range headers {
-        if strings.EqualFold(h.Title, headerTitle) {
-            return h.Content, nil
-        }
-    }
-
-    return "", fmt.Errorf("header not found: %s", headerTitle)
+    return "", newError(ErrSectionNotFound, "header not found: %s", headerTitle)
 }
 
 // Helper to convert Org nodes to string
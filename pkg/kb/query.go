@@ -0,0 +1,901 @@
+package kb
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/analysis"
+)
+
+// The search query language:
+//
+//	query    = or
+//	or       = and { "OR" and }
+//	and      = unary { [ "AND" ] unary }
+//	unary    = ( "-" | "NOT" ) unary | primary
+//	primary  = "(" or ")" | [ field ":" ] value
+//	value    = word | "quoted phrase" | word with * or ? wildcards | word~[edits]
+//
+// Text fields are title, heading, body and tag; a value without a field
+// searches all of them. Metadata fields are format, path, modified and size;
+// modified and size take comparisons (>, >=, <, <=) and ranges (a..b).
+// Words next to each other must all match.
+
+// QuerySyntax explains the query language to people and models
+const QuerySyntax = `Words must all match; OR, NOT/-word and (parentheses) combine them.
+"quoted phrase" matches words in sequence; deploy* and k?s are wildcards;
+kuberntes~ allows typos (word~1 or word~2 sets the edits).
+Fields: title:, heading:, body:, tag: search one part of a note;
+format:org|markdown|text, path:work/ (prefix) or path:*/notes.md (glob),
+modified:2026-03 / modified:>=2026-01-01 / modified:2025-01..2025-06,
+size:<10k filter by metadata.
+Example: title:deploy tag:infra path:work/ modified:>2026-01-01 "rollback plan" -draft`
+
+// clauseKind says how a text clause matches
+type clauseKind int
+
+const (
+	clauseTerm     clauseKind = iota // a single word
+	clausePhrase                     // words in sequence
+	clausePrefix                     // words starting with the text
+	clauseWildcard                   // words matching a * and ? pattern
+	clauseFuzzy                      // words within a few edits of the text
+)
+
+// maxFuzziness is the most edits a fuzzy word may be away from a match
+const maxFuzziness = 2
+
+// autoFuzziness is the edits allowed for a word, by its length: none for
+// one or two letters, one up to five letters and two beyond
+func autoFuzziness(word string) int {
+	switch n := utf8.RuneCountInString(word); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	}
+	return maxFuzziness
+}
+
+// textFields maps query field names onto searchable fields
+var textFields = map[string]string{
+	"title":   "title",
+	"heading": "headers",
+	"headers": "headers",
+	"body":    "content",
+	"content": "content",
+	"tag":     "tags",
+	"tags":    "tags",
+}
+
+// queryFieldNames are the field names offered in error messages
+var queryFieldNames = []string{"title", "heading", "body", "tag", "format", "path", "modified", "size"}
+
+// queryNode is a node of a parsed query
+type queryNode interface {
+	String() string
+}
+
+type andNode struct{ children []queryNode }
+
+type orNode struct{ children []queryNode }
+
+type notNode struct{ child queryNode }
+
+// textNode matches words in one searchable field, or in all of them
+type textNode struct {
+	field   string // name in searchFields; "" for all fields
+	kind    clauseKind
+	text    string   // as typed, without quotes
+	terms   []string // analyzed terms
+	pattern *regexp.Regexp
+
+	// start and end are the byte range of the value in the query, without
+	// its field; end is 0 for phrases
+	start, end int
+
+	// word is the text as written, lowercased and folded; fuzzy clauses,
+	// and words under typo tolerance, match words up to fuzziness edits away
+	word      string
+	fuzziness int
+
+	// variants are the terms to look for, one sequence per distinct
+	// analysis in the configured languages; "" stands for a left-out stop
+	// word. A clause of stop words only has none and matches everything.
+	variants [][]string
+}
+
+// metaNode matches a document's metadata; it doesn't affect scores
+type metaNode struct {
+	source string // as typed, for String
+	match  func(doc Document) bool
+}
+
+func (n *andNode) String() string  { return "(" + joinNodes(n.children, " AND ") + ")" }
+func (n *orNode) String() string   { return "(" + joinNodes(n.children, " OR ") + ")" }
+func (n *notNode) String() string  { return "-" + n.child.String() }
+func (n *metaNode) String() string { return n.source }
+
+func (n *textNode) String() string {
+	s := n.text
+	switch n.kind {
+	case clausePhrase:
+		s = strconv.Quote(n.text)
+	case clausePrefix:
+		s += "*"
+	case clauseFuzzy:
+		s += "~" + strconv.Itoa(n.fuzziness)
+	}
+	if n.field != "" {
+		s = n.field + ":" + s
+	}
+	return s
+}
+
+func joinNodes(nodes []queryNode, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, sep)
+}
+
+// searchQuery is a parsed search query
+type searchQuery struct {
+	root     queryNode     // nil matches every document
+	texts    []*textNode   // every text node, in query order
+	analysis *textAnalysis // nil until analyzed
+}
+
+// String shows the parsed query; "" for one that matches everything
+func (q *searchQuery) String() string {
+	if q.root == nil {
+		return ""
+	}
+	return q.root.String()
+}
+
+// empty reports whether the query matches everything
+func (q *searchQuery) empty() bool {
+	return q.root == nil
+}
+
+// parseSearchQuery parses a query written in the query language
+func parseSearchQuery(query string) (*searchQuery, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, query: query}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		if tok.kind == tokRParen {
+			return nil, p.errorAt(tok, "unexpected ')'")
+		}
+		return nil, p.errorAt(tok, "unexpected %q", tok.text)
+	}
+
+	q := &searchQuery{root: root}
+	collectTexts(root, &q.texts)
+	q.analyze(nil)
+	return q, nil
+}
+
+// analyze finds the variants of each text clause. Words and phrases are
+// analyzed in every language, since a query is too short to tell which one
+// it is written in; wildcard patterns are only folded. Without an analysis
+// the clauses match their plain terms.
+func (q *searchQuery) analyze(ta *textAnalysis) {
+	q.analysis = ta
+	for _, t := range q.texts {
+		if ta == nil {
+			t.variants = [][]string{t.terms}
+			if len(t.terms) == 1 {
+				t.word = t.terms[0]
+			}
+			continue
+		}
+		switch t.kind {
+		case clausePrefix, clauseWildcard, clauseFuzzy:
+			pattern := ta.fold(t.terms[0])
+			t.variants = [][]string{{pattern}}
+			if t.kind == clauseWildcard {
+				t.pattern = wildcardRegexp(pattern)
+			}
+			t.word = pattern
+		default:
+			if t.kind == clauseTerm {
+				t.word = ta.fold(t.terms[0])
+			}
+			t.variants = nil
+			seen := map[string]bool{}
+			for _, lang := range ta.config.Languages {
+				terms := sequenceTerms(ta.analyzer(lang.Code).Analyze([]byte(t.text)))
+				key := strings.Join(terms, "\x00")
+				if len(terms) == 0 || seen[key] {
+					continue
+				}
+				seen[key] = true
+				t.variants = append(t.variants, terms)
+			}
+		}
+	}
+}
+
+// tolerateTypos lets every plain word of the query match words a few edits
+// away, besides its other forms
+func (q *searchQuery) tolerateTypos() {
+	for _, t := range q.texts {
+		if t.kind == clauseTerm {
+			t.fuzziness = autoFuzziness(t.word)
+		}
+	}
+}
+
+// typeahead treats the word being typed at the end of query as a prefix
+func (q *searchQuery) typeahead(query string) {
+	if t := q.lastWord(query); t != nil && t.kind == clauseTerm {
+		t.kind = clausePrefix
+	}
+}
+
+// lastWord returns the word clause that ends the query, if any
+func (q *searchQuery) lastWord(query string) *textNode {
+	for _, t := range q.texts {
+		if t.end == len(query) && t.end > 0 {
+			return t
+		}
+	}
+	return nil
+}
+
+// matchesWords reports whether the clause matches words as written rather
+// than analyzed terms: wildcards would miss words whose stems are cut short,
+// and edits are counted on what was typed
+func (n *textNode) matchesWords() bool {
+	return n.kind == clausePrefix || n.kind == clauseWildcard || n.kind == clauseFuzzy
+}
+
+// matchWord reports whether a word as written matches a clause that
+// matches words, or the typo tolerance of a plain word
+func (n *textNode) matchWord(word string) bool {
+	switch n.kind {
+	case clauseWildcard:
+		return n.pattern.MatchString(word)
+	case clausePrefix:
+		return strings.HasPrefix(word, n.word)
+	case clauseFuzzy, clauseTerm:
+		return (n.kind == clauseFuzzy || n.fuzziness > 0) && withinEdits(word, n.word, n.fuzziness)
+	}
+	return false
+}
+
+// analyzer returns the analyzer of a language the query was analyzed for
+func (q *searchQuery) analyzer(lang string) analysis.Analyzer {
+	if q.analysis == nil {
+		return analyzer()
+	}
+	return q.analysis.analyzer(lang)
+}
+
+// wordsAnalyzer returns the analyzer wildcards are matched with
+func (q *searchQuery) wordsAnalyzer() analysis.Analyzer {
+	if q.analysis == nil {
+		return analyzer()
+	}
+	return q.analysis.words
+}
+
+// sequenceTerms lists analyzed terms by position from the first one, with
+// "" in the gaps stop words leave
+func sequenceTerms(tokens analysis.TokenStream) []string {
+	if len(tokens) == 0 {
+		return nil
+	}
+	first := tokens[0].Position
+	terms := make([]string, tokens[len(tokens)-1].Position-first+1)
+	for _, token := range tokens {
+		terms[token.Position-first] = string(token.Term)
+	}
+	return terms
+}
+
+func collectTexts(node queryNode, out *[]*textNode) {
+	switch n := node.(type) {
+	case *andNode:
+		for _, c := range n.children {
+			collectTexts(c, out)
+		}
+	case *orNode:
+		for _, c := range n.children {
+			collectTexts(c, out)
+		}
+	case *notNode:
+		collectTexts(n.child, out)
+	case *textNode:
+		*out = append(*out, n)
+	}
+}
+
+// positiveTexts are the text nodes a match can be credited to: those not
+// under a negation
+func (q *searchQuery) positiveTexts() []*textNode {
+	var out []*textNode
+	var walk func(node queryNode)
+	walk = func(node queryNode) {
+		switch n := node.(type) {
+		case *andNode:
+			for _, c := range n.children {
+				walk(c)
+			}
+		case *orNode:
+			for _, c := range n.children {
+				walk(c)
+			}
+		case *textNode:
+			out = append(out, n)
+		}
+	}
+	walk(q.root)
+	return out
+}
+
+// Query tokens
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokPhrase // "quoted", possibly after field:
+	tokLParen
+	tokRParen
+	tokNot // - or NOT
+	tokAnd
+	tokOr
+)
+
+type queryToken struct {
+	kind  tokenKind
+	text  string // word or phrase text
+	field string // for field:"phrase"
+	pos   int    // byte offset in the query
+}
+
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(query) {
+		r, size := utf8.DecodeRuneInString(query[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, pos: i})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, pos: i})
+			i++
+
+		case r == '-' && i+1 < len(query) && !unicode.IsSpace(rune(query[i+1])):
+			tokens = append(tokens, queryToken{kind: tokNot, pos: i})
+			i++
+
+		case r == '"':
+			text, next, err := lexPhrase(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{kind: tokPhrase, text: text, pos: i})
+			i = next
+
+		default:
+			start := i
+			for i < len(query) {
+				r, size := utf8.DecodeRuneInString(query[i:])
+				if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' {
+					break
+				}
+				i += size
+			}
+			word := query[start:i]
+
+			// field:"a phrase"
+			if strings.HasSuffix(word, ":") && i < len(query) && query[i] == '"' {
+				text, next, err := lexPhrase(query, i)
+				if err != nil {
+					return nil, err
+				}
+				tokens = append(tokens, queryToken{kind: tokPhrase, text: text, field: strings.TrimSuffix(word, ":"), pos: start})
+				i = next
+				continue
+			}
+
+			tok := queryToken{kind: tokWord, text: word, pos: start}
+			switch word {
+			case "AND":
+				tok.kind = tokAnd
+			case "OR":
+				tok.kind = tokOr
+			case "NOT":
+				tok.kind = tokNot
+			}
+			tokens = append(tokens, tok)
+		}
+	}
+	return append(tokens, queryToken{kind: tokEOF, pos: len(query)}), nil
+}
+
+// lexPhrase reads a quoted phrase starting at query[start] == '"'
+func lexPhrase(query string, start int) (string, int, error) {
+	end := strings.IndexByte(query[start+1:], '"')
+	if end < 0 {
+		return "", 0, queryError(query, start, "unterminated phrase")
+	}
+	return query[start+1 : start+1+end], start + end + 2, nil
+}
+
+// queryError reports a problem at a byte offset of the query
+func queryError(query string, pos int, format string, args ...interface{}) error {
+	column := utf8.RuneCountInString(query[:pos]) + 1
+	return newError(ErrInvalid, "invalid query at column %d: %s", column, fmt.Sprintf(format, args...))
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	query  string
+	depth  int
+}
+
+// maxQueryDepth bounds nesting so that hostile queries can't exhaust the stack
+const maxQueryDepth = 32
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) errorAt(tok queryToken, format string, args ...interface{}) error {
+	return queryError(p.query, tok.pos, format, args...)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var children []queryNode
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			children = append(children, node)
+		}
+		if p.peek().kind != tokOr {
+			break
+		}
+		tok := p.next()
+		if len(children) == 0 || !startsValue(p.peek()) {
+			return nil, p.errorAt(tok, "OR needs a term on both sides")
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return &orNode{children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var children []queryNode
+	for {
+		tok := p.peek()
+		if tok.kind == tokAnd {
+			p.next()
+			if len(children) == 0 || !startsValue(p.peek()) {
+				return nil, p.errorAt(tok, "AND needs a term on both sides")
+			}
+			continue
+		}
+		if !startsValue(tok) {
+			break
+		}
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			children = append(children, node)
+		}
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	}
+	return &andNode{children: children}, nil
+}
+
+// startsValue reports whether tok can begin an operand
+func startsValue(tok queryToken) bool {
+	switch tok.kind {
+	case tokWord, tokPhrase, tokLParen, tokNot:
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok := p.peek()
+	if tok.kind != tokNot {
+		return p.parsePrimary()
+	}
+
+	p.next()
+	if !startsValue(p.peek()) {
+		return nil, p.errorAt(tok, "nothing to exclude")
+	}
+	child, err := p.parseUnary()
+	if err != nil || child == nil {
+		return nil, err
+	}
+	if not, ok := child.(*notNode); ok {
+		return not.child, nil
+	}
+	return &notNode{child: child}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		if p.depth++; p.depth > maxQueryDepth {
+			return nil, p.errorAt(tok, "too many nested parentheses")
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.depth--
+		if p.peek().kind != tokRParen {
+			return nil, p.errorAt(tok, "missing ')'")
+		}
+		p.next()
+		return node, nil
+
+	case tokPhrase:
+		return p.fieldValue(tok, tok.field, tok.text, true)
+
+	case tokWord:
+		field, value, ok := strings.Cut(tok.text, ":")
+		if ok && isFieldName(field) && !strings.HasPrefix(value, "//") {
+			if value != "" {
+				return p.fieldValue(tok, field, value, false)
+			}
+			if isQueryField(field) {
+				return nil, p.errorAt(tok, "missing value after %s:", field)
+			}
+			// "Note:" in a sentence
+		}
+		return p.textValue(tok, "", tok.text, false)
+	}
+	return nil, p.errorAt(tok, "unexpected %q", tok.text)
+}
+
+// isQueryField reports whether name is a field the query language knows
+func isQueryField(name string) bool {
+	if _, ok := textFields[name]; ok {
+		return true
+	}
+	switch name {
+	case "format", "path", "modified", "size":
+		return true
+	}
+	return false
+}
+
+// isFieldName tells field:value apart from words that contain a colon,
+// such as times; URLs are told apart by the "//" after the colon
+func isFieldName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < 'a' || r > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *queryParser) fieldValue(tok queryToken, field, value string, quoted bool) (queryNode, error) {
+	if field == "" {
+		return p.textValue(tok, "", value, quoted)
+	}
+	if name, ok := textFields[field]; ok {
+		return p.textValue(tok, name, value, quoted)
+	}
+
+	source := field + ":" + value
+	var match func(doc Document) bool
+	var err error
+	switch field {
+	case "format":
+		match, err = formatMatcher(value)
+	case "path":
+		match = pathMatcher(value)
+	case "modified":
+		match, err = dateMatcher(value)
+	case "size":
+		match, err = sizeMatcher(value)
+	default:
+		msg := fmt.Sprintf("unknown field %q", field)
+		if close := ClosestMatches(field, queryFieldNames, 1); len(close) > 0 {
+			msg += fmt.Sprintf(" (did you mean %s?)", close[0])
+		} else {
+			msg += " (use " + strings.Join(queryFieldNames, ", ") + ")"
+		}
+		msg += `; quote the word to search for it literally`
+		return nil, p.errorAt(tok, "%s", msg)
+	}
+	if err != nil {
+		return nil, p.errorAt(tok, "%s: %v", field, err)
+	}
+	return &metaNode{source: source, match: match}, nil
+}
+
+// textValue builds the node for words to look for
+func (p *queryParser) textValue(tok queryToken, field, value string, quoted bool) (queryNode, error) {
+	node := &textNode{field: field, text: value}
+	if !quoted {
+		node.end = tok.pos + len(tok.text)
+		node.start = node.end - len(value)
+	}
+
+	switch {
+	case quoted:
+		node.kind = clausePhrase
+	case fuzzySuffix.MatchString(value):
+		node.kind = clauseFuzzy
+		i := strings.LastIndexByte(value, '~')
+		node.text = value[:i]
+		if node.fuzziness = autoFuzziness(node.text); i+1 < len(value) {
+			node.fuzziness = int(value[i+1] - '0')
+		}
+		if node.fuzziness > maxFuzziness {
+			return nil, p.errorAt(tok, "fuzzy words allow at most %d edits: %s", maxFuzziness, value)
+		}
+		if strings.ContainsAny(node.text, "*?~") {
+			return nil, p.errorAt(tok, "fuzzy words can't have wildcards: %s", value)
+		}
+	case strings.HasSuffix(value, "*") && !strings.ContainsAny(strings.TrimRight(value, "*"), "*?"):
+		node.kind = clausePrefix
+		node.text = strings.TrimRight(value, "*")
+	case strings.ContainsAny(value, "*?"):
+		node.kind = clauseWildcard
+	}
+
+	if node.kind == clausePrefix && node.text == "" {
+		return nil, p.errorAt(tok, "wildcard %q matches everything", value)
+	}
+	if node.kind == clauseWildcard {
+		pattern := strings.ToLower(value)
+		if strings.Trim(pattern, "*?") == "" {
+			return nil, p.errorAt(tok, "wildcard %q matches everything", value)
+		}
+		if len(analyzeTerms(strings.NewReplacer("*", "x", "?", "x").Replace(pattern))) != 1 {
+			return nil, p.errorAt(tok, "wildcards apply to single words: %s", value)
+		}
+		node.terms = []string{pattern}
+		node.pattern = wildcardRegexp(pattern)
+		return node, nil
+	}
+
+	node.terms = analyzeTerms(node.text)
+	switch {
+	case len(node.terms) == 0:
+		// Punctuation and the like: nothing to match
+		return nil, nil
+	case node.kind == clausePrefix && len(node.terms) > 1:
+		return nil, p.errorAt(tok, "wildcards apply to single words: %s", value)
+	case node.kind == clauseFuzzy && len(node.terms) > 1:
+		return nil, p.errorAt(tok, "fuzzy matching applies to single words: %s", value)
+	case node.kind == clauseTerm && len(node.terms) > 1:
+		// "foo-bar" matches like the phrase "foo bar"
+		node.kind = clausePhrase
+	case node.kind == clausePhrase && len(node.terms) == 1:
+		node.kind = clauseTerm
+	}
+	return node, nil
+}
+
+// fuzzySuffix ends a fuzzy word: kuberntes~ or kuberntes~1
+var fuzzySuffix = regexp.MustCompile(`[^~]~[0-9]?$`)
+
+// wildcardRegexp matches a whole term against a * and ? pattern
+func wildcardRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+func formatMatcher(value string) (func(Document) bool, error) {
+	formats := map[Format]bool{}
+	for _, name := range splitList([]string{value}) {
+		format, ok := formatNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown format %q (use org, markdown or text)", name)
+		}
+		formats[format] = true
+	}
+	return func(doc Document) bool { return formats[doc.Format] }, nil
+}
+
+// pathMatcher matches a path prefix, or a glob when the value has wildcards
+func pathMatcher(value string) func(Document) bool {
+	folder := strings.HasSuffix(value, "/")
+	value = strings.TrimPrefix(path.Clean("/"+value), "/")
+	if folder && value != "" {
+		value += "/"
+	}
+	if strings.ContainsAny(value, "*?[") {
+		return func(doc Document) bool { return matchGlob(value, slashPath(doc.Path)) }
+	}
+	return func(doc Document) bool { return strings.HasPrefix(slashPath(doc.Path), value) }
+}
+
+func slashPath(p string) string {
+	return strings.ReplaceAll(p, "\\", "/")
+}
+
+// dateMatcher accepts a date, a comparison (>, >=, <, <=) or a range a..b.
+// A date covers its whole year, month, day or instant: modified:2026-03 is
+// all of March.
+func dateMatcher(value string) (func(Document) bool, error) {
+	from, to, err := parseRange(value, parseDateSpan)
+	if err != nil {
+		return nil, err
+	}
+	return func(doc Document) bool {
+		t := doc.UpdatedAt
+		return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+	}, nil
+}
+
+// parseDateSpan returns the start and end of the period a date names
+func parseDateSpan(s string) (time.Time, time.Time, error) {
+	layouts := []struct {
+		layout string
+		add    func(time.Time) time.Time
+	}{
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	}
+	for _, l := range layouts {
+		if t, err := time.ParseInLocation(l.layout, s, time.Local); err == nil {
+			return t, l.add(t), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, t.Add(time.Nanosecond), nil
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q (use YYYY, YYYY-MM, YYYY-MM-DD or RFC 3339)", s)
+}
+
+func sizeMatcher(value string) (func(Document) bool, error) {
+	from, to, err := parseRange(value, func(s string) (int64, int64, error) {
+		n, err := parseSize(s)
+		return n, n + 1, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(doc Document) bool {
+		return doc.Size >= from && (to == 0 || doc.Size < to)
+	}, nil
+}
+
+// parseSize reads a byte count with an optional k, kb, m or mb suffix
+func parseSize(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{{"kb", 1 << 10}, {"k", 1 << 10}, {"mb", 1 << 20}, {"m", 1 << 20}, {"b", 1}} {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower, multiplier = strings.TrimSuffix(lower, unit.suffix), unit.factor
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q (use bytes or a k/m suffix)", s)
+	}
+	return n * multiplier, nil
+}
+
+// parseRange reads a comparison or a range into a half-open interval
+// [from, to); a zero bound is open. span gives the interval of one value.
+func parseRange[T int64 | time.Time](value string, span func(string) (T, T, error)) (T, T, error) {
+	var zero T
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		rest, ok := strings.CutPrefix(value, op)
+		if !ok {
+			continue
+		}
+		start, end, err := span(rest)
+		if err != nil {
+			return zero, zero, err
+		}
+		switch op {
+		case ">=":
+			return start, zero, nil
+		case ">":
+			return end, zero, nil
+		case "<=":
+			return zero, end, nil
+		default:
+			return zero, start, nil
+		}
+	}
+
+	if lo, hi, ok := strings.Cut(value, ".."); ok {
+		if lo == "" && hi == "" {
+			return zero, zero, fmt.Errorf("empty range")
+		}
+		var from, to T
+		if lo != "" {
+			start, _, err := span(lo)
+			if err != nil {
+				return zero, zero, err
+			}
+			from = start
+		}
+		if hi != "" {
+			_, end, err := span(hi)
+			if err != nil {
+				return zero, zero, err
+			}
+			to = end
+		}
+		return from, to, nil
+	}
+
+	return span(value)
+}
@@ -0,0 +1,106 @@
+package kb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`deploy rollback`, `(deploy AND rollback)`},
+		{`title:deploy OR heading:"rollback plan"`, `(title:deploy OR headers:"rollback plan")`},
+		{`a (b OR c) -d`, `(a AND (b OR c) AND -d)`},
+		{`NOT NOT a`, `a`},
+		{`kube* k?s`, `(kube* AND k?s)`},
+		{`foo-bar`, `"foo-bar"`},
+		{`path:work/ modified:>2026-01-01`, `(path:work/ AND modified:>2026-01-01)`},
+		{`https://example.com 10:30`, `("https://example.com" AND "10:30")`},
+		{`--- ()`, ``},
+		{`note: deploy`, `(note: AND deploy)`},
+	}
+
+	for _, tt := range tests {
+		q, err := parseSearchQuery(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		got := ""
+		if q.root != nil {
+			got = q.root.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestSearchQueryParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`deploy "rollback plan`, "column 8: unterminated phrase"},
+		{`(a OR b`, "column 1: missing ')'"},
+		{`a OR`, "column 3: OR needs a term on both sides"},
+		{`a)`, "column 2: unexpected ')'"},
+		{`tilte:deploy`, "did you mean title?"},
+		{`modified:>yesterday`, "invalid date"},
+		{`format:pdf`, "unknown format"},
+		{`size:lots`, "invalid size"},
+		{`title:`, "missing value"},
+		{`*`, "matches everything"},
+		{`-`, ""},
+	}
+
+	for _, tt := range tests {
+		_, err := parseSearchQuery(tt.query)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.query, err)
+			}
+			continue
+		}
+		if !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected an error containing %q, got %v", tt.query, tt.want, err)
+		}
+	}
+}
+
+func TestSearchQueryLanguage(t *testing.T) {
+	files := map[string]string{
+		"work/deploy.org":     "#+FILETAGS: :infra:\n* Deploy\n** Rollback plan\nRevert the release.\n",
+		"work/deploy-old.org": "#+FILETAGS: :infra:draft:\n* Deploy\n** Rollback plan\nOld draft.\n",
+		"work/deploy.md":      "# Deploy\nRollback plan: revert.\n",
+		"home/garden.org":     "* Garden\nDeploy the lawn sprinklers.\n",
+		"notes/kubernetes.md": "# Upgrades\nkubectl drain\n",
+	}
+
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		old := time.Date(2025, 6, 1, 0, 0, 0, 0, time.Local)
+		if err := os.Chtimes(filepath.Join(nav.BaseDir(), "work", "deploy.md"), old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		expectPaths(t, searchPaths(t, nav, `title:deploy tag:infra format:org path:work/ modified:>2026-01-01 "rollback plan" -draft`),
+			"work/deploy.org")
+		expectPaths(t, searchPaths(t, nav, `deploy modified:2025`), "work/deploy.md")
+		expectPaths(t, searchPaths(t, nav, `deploy modified:2025-01..2025-06`), "work/deploy.md")
+		expectPaths(t, searchPaths(t, nav, `sprinklers OR kubectl`), "notes/kubernetes.md", "home/garden.org")
+		expectPaths(t, searchPaths(t, nav, `deploy -(path:work/ OR tag:infra)`), "home/garden.org")
+		expectPaths(t, searchPaths(t, nav, `heading:rollback -format:md`), "work/deploy-old.org", "work/deploy.org")
+		expectPaths(t, searchPaths(t, nav, `k*netes`), "notes/kubernetes.md")
+		expectPaths(t, searchPaths(t, nav, `title:k?bernetes`), "notes/kubernetes.md")
+		expectPaths(t, searchPaths(t, nav, `path:*/garden.org`), "home/garden.org")
+		expectPaths(t, searchPaths(t, nav, `body:sprinklers`), "home/garden.org")
+		expectPaths(t, searchPaths(t, nav, `heading:sprinklers`))
+		expectPaths(t, searchPaths(t, nav, `size:<30 format:md`), "notes/kubernetes.md")
+	})
+}
@@ -0,0 +1,424 @@
+package kb
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blevesearch/bleve/v2/analysis"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	"github.com/blevesearch/bleve/v2/analysis/tokenizer/unicode"
+	"github.com/blevesearch/bleve/v2/registry"
+)
+
+// BM25 parameters, the same ones Bleve uses
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// searchFields lists the searchable fields with their boosts. Matches in a
+// note's title, headings or tags count for more than matches in its body.
+var searchFields = []struct {
+	name  string
+	boost float64
+}{
+	{"title", 3},
+	{"headers", 2},
+	{"tags", 2},
+	{"content", 1},
+}
+
+// analyzer returns the plain analyzer: words, lowercased, without stemming.
+// The query parser uses it to find words; language analyzers live in
+// language.go.
+var analyzer = sync.OnceValue(func() analysis.Analyzer {
+	cache := registry.NewCache()
+	a, err := cache.DefineAnalyzer("kbtext", map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     unicode.Name,
+		"token_filters": []string{lowercase.Name},
+	})
+	if err != nil {
+		panic(err)
+	}
+	return a
+})
+
+// analyzeTerms splits text into search terms
+func analyzeTerms(text string) []string {
+	var terms []string
+	for _, token := range analyzer().Analyze([]byte(text)) {
+		terms = append(terms, string(token.Term))
+	}
+	return terms
+}
+
+// searchUnit is the part of a document that is indexed and ranked on its
+// own: a heading with its text up to the first child heading, or the text
+// before the first heading.
+type searchUnit struct {
+	line     int          // zero-based first line
+	span     *sectionSpan // nil for the text before the first heading
+	text     string       // the unit's text for snippets
+	textLine int          // zero-based line text starts on
+	lang     string       // language code
+	fields   map[string]string
+}
+
+// documentUnits splits a document into search units. Every unit carries the
+// document's title and file tags; sections add their header path and the
+// tags of their headline and its parents. A document without headings is a
+// single unit.
+//
+// Each unit is analyzed in its language: the one the document declares,
+// else the one detected in the unit, or in the whole document when the unit
+// is too short to tell.
+func (ta *textAnalysis) documentUnits(doc *Document) []searchUnit {
+	title := strings.TrimSuffix(filepath.Base(doc.Path), filepath.Ext(doc.Path))
+	if declared := declaredTitle(doc.Content, doc.Format); declared != "" {
+		title += "\n" + declared
+	}
+	tags := fileTags(doc.Content, doc.Format)
+	lines := strings.Split(doc.Content, "\n")
+	spans := scanSections(doc.Content, doc.Format)
+
+	var units []searchUnit
+	first := len(lines)
+	if len(spans) > 0 {
+		first = spans[0].Line
+	}
+	if preamble := strings.Join(lines[:first], "\n"); len(spans) == 0 || strings.TrimSpace(preamble) != "" {
+		units = append(units, searchUnit{
+			text: preamble,
+			fields: map[string]string{
+				"title":   title,
+				"tags":    strings.Join(tags, " "),
+				"content": preamble,
+			},
+		})
+	}
+
+	var stack []int // indexes into spans of the enclosing headings
+	for i := range spans {
+		span := &spans[i]
+		for len(stack) > 0 && spans[stack[len(stack)-1]].Level >= span.Level {
+			stack = stack[:len(stack)-1]
+		}
+		unitTags := append([]string{}, tags...)
+		for _, parent := range stack {
+			unitTags = append(unitTags, spans[parent].Tags...)
+		}
+		unitTags = append(unitTags, span.Tags...)
+		stack = append(stack, i)
+
+		end := span.End
+		if i+1 < len(spans) && spans[i+1].Line < end {
+			end = spans[i+1].Line
+		}
+		body := strings.Join(lines[span.Line+1:end], "\n")
+		text, textLine := body, span.Line+1
+		if strings.TrimSpace(body) == "" {
+			text, textLine = lines[span.Line], span.Line
+		}
+		units = append(units, searchUnit{
+			line:     span.Line,
+			span:     span,
+			text:     text,
+			textLine: textLine,
+			fields: map[string]string{
+				"title":   title,
+				"headers": strings.Join(append(append([]string{}, span.Path...), span.Title), "\n"),
+				"tags":    strings.Join(unitTags, " "),
+				"content": body,
+			},
+		})
+	}
+
+	docLang := declaredLanguage(doc.Content, doc.Format)
+	declared := ta.analyzers[docLang] != nil
+	if !declared {
+		docLang = ta.detect(doc.Content)
+	}
+	for i := range units {
+		unit := &units[i]
+		unit.lang = docLang
+		if text := unit.fields["headers"] + "\n" + unit.fields["content"]; !declared && len(analyzeTerms(text)) >= minDetectWords {
+			unit.lang = ta.detect(text)
+		}
+		unit.fields["_type"] = unit.lang // selects the document mapping
+	}
+	return units
+}
+
+// unitID names a search unit in the index
+func unitID(path string, line int) string {
+	return filepath.ToSlash(path) + "#" + strconv.Itoa(line+1)
+}
+
+// parseUnitID splits a unit ID into a slash-separated path and a line
+func parseUnitID(id string) (string, int, bool) {
+	i := strings.LastIndexByte(id, '#')
+	if i < 0 {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(id[i+1:])
+	if err != nil || line < 1 {
+		return "", 0, false
+	}
+	return id[:i], line - 1, true
+}
+
+// declaredTitle is an Org #+TITLE or a Markdown front matter title
+func declaredTitle(content string, format Format) string {
+	switch format {
+	case FormatOrg:
+		for _, line := range strings.Split(content, "\n") {
+			if value, ok := cutKeyword(line, "#+title:"); ok {
+				return value
+			}
+		}
+	case FormatMarkdown:
+		if meta, _, err := ParseFrontMatter(content); err == nil {
+			title, _ := meta["title"].(string)
+			return title
+		}
+	}
+	return ""
+}
+
+// analyzedField records where each term occurs in a field, and where each
+// word does as written, for wildcards
+type analyzedField struct {
+	positions map[string][]int
+	length    int
+	words     map[string][]int
+	wordCount int
+}
+
+func analyzeField(text string, a, words analysis.Analyzer) analyzedField {
+	f := analyzedField{positions: map[string][]int{}, words: map[string][]int{}}
+	for _, token := range a.Analyze([]byte(text)) {
+		f.positions[string(token.Term)] = append(f.positions[string(token.Term)], token.Position)
+		f.length++
+	}
+	for _, token := range words.Analyze([]byte(text)) {
+		f.words[string(token.Term)] = append(f.words[string(token.Term)], token.Position)
+		f.wordCount++
+	}
+	return f
+}
+
+// fieldLength is the length of the field a clause is matched against
+func (f analyzedField) fieldLength(c *textNode) int {
+	if c.matchesWords() {
+		return f.wordCount
+	}
+	return f.length
+}
+
+// frequency counts the matches of a text clause in the field
+func (f analyzedField) frequency(c *textNode) int {
+	if c.matchesWords() {
+		n := 0
+		for word, positions := range f.words {
+			if c.matchWord(word) {
+				n += len(positions)
+			}
+		}
+		return n
+	}
+
+	// Positions are shared by terms and words, so a word matching both
+	// its forms and its typo tolerance counts once
+	matched := map[int]bool{}
+	for _, terms := range c.variants {
+		for _, start := range f.positions[terms[0]] {
+			if f.phraseAt(terms[1:], start+1) {
+				matched[start] = true
+			}
+		}
+	}
+	if c.fuzziness > 0 {
+		for word, positions := range f.words {
+			if c.matchWord(word) {
+				for _, p := range positions {
+					matched[p] = true
+				}
+			}
+		}
+	}
+	return len(matched)
+}
+
+// phraseAt reports whether terms follow each other from position on; ""
+// stands for any term
+func (f analyzedField) phraseAt(terms []string, position int) bool {
+	for i, term := range terms {
+		if term == "" {
+			continue
+		}
+		found := false
+		for _, p := range f.positions[term] {
+			if p == position+i {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// searchHit is a document, or one of its sections, matching a query
+type searchHit struct {
+	doc   Document
+	line  int         // first line of the section, -1 for a whole document
+	unit  *searchUnit // loaded lazily for index hits
+	score float64
+}
+
+// scanSearch ranks sections without an index: every document is read and
+// split into units, and BM25 statistics are computed over those units.
+func (n *Navigator) scanSearch(ctx context.Context, q *searchQuery, docs []Document, progress ProgressFunc) ([]searchHit, error) {
+	ta := n.textAnalysis()
+	type candidate struct {
+		hit    searchHit
+		fields []analyzedField
+	}
+
+	var candidates []candidate
+	totalLength := make([]float64, len(searchFields))
+	totalWords := make([]float64, len(searchFields))
+	for i, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(i, len(docs))
+		}
+
+		fullDoc, err := n.ReadDocument(doc.Path)
+		if err != nil {
+			n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+
+		for _, unit := range ta.documentUnits(fullDoc) {
+			c := candidate{hit: searchHit{doc: doc, line: unit.line, unit: &unit}}
+			a := ta.analyzer(unit.lang)
+			for j, f := range searchFields {
+				af := analyzeField(unit.fields[f.name], a, ta.words)
+				c.fields = append(c.fields, af)
+				totalLength[j] += float64(af.length)
+				totalWords[j] += float64(af.wordCount)
+			}
+			candidates = append(candidates, c)
+		}
+	}
+	if progress != nil {
+		progress(len(docs), len(docs))
+	}
+
+	total := float64(len(candidates))
+	avgLength := make([]float64, len(searchFields))
+	avgWords := make([]float64, len(searchFields))
+	for j := range searchFields {
+		if total > 0 {
+			avgLength[j] = totalLength[j] / total
+			avgWords[j] = totalWords[j] / total
+		}
+	}
+
+	// Scores per text clause and candidate; zero means no match
+	scores := make([][]float64, len(q.texts))
+	clauseIndex := map[*textNode]int{}
+	for ti, t := range q.texts {
+		clauseIndex[t] = ti
+		freqs := make([][]int, len(candidates))
+		docFreq := 0
+		for di, c := range candidates {
+			freqs[di] = make([]int, len(searchFields))
+			matched := false
+			for fi, f := range searchFields {
+				if t.field == "" || t.field == f.name {
+					freqs[di][fi] = c.fields[fi].frequency(t)
+					matched = matched || freqs[di][fi] > 0
+				}
+			}
+			if matched {
+				docFreq++
+			}
+		}
+		idf := math.Log(1 + (total-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+
+		avg := avgLength
+		if t.matchesWords() {
+			avg = avgWords
+		}
+		scores[ti] = make([]float64, len(candidates))
+		for di, c := range candidates {
+			for fi, f := range searchFields {
+				tf := float64(freqs[di][fi])
+				if tf == 0 || avg[fi] == 0 {
+					continue
+				}
+				norm := 1 - bm25B + bm25B*float64(c.fields[fi].fieldLength(t))/avg[fi]
+				scores[ti][di] += idf * f.boost * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+			}
+		}
+	}
+
+	// eval matches a candidate against the query tree; matching branches add
+	// up their scores
+	var eval func(node queryNode, di int) (bool, float64)
+	eval = func(node queryNode, di int) (bool, float64) {
+		switch n := node.(type) {
+		case *andNode:
+			total := 0.0
+			for _, child := range n.children {
+				ok, score := eval(child, di)
+				if !ok {
+					return false, 0
+				}
+				total += score
+			}
+			return true, total
+		case *orNode:
+			matched, total := false, 0.0
+			for _, child := range n.children {
+				if ok, score := eval(child, di); ok {
+					matched, total = true, total+score
+				}
+			}
+			return matched, total
+		case *notNode:
+			ok, _ := eval(n.child, di)
+			return !ok, 0
+		case *textNode:
+			if len(n.variants) == 0 {
+				return true, 0
+			}
+			score := scores[clauseIndex[n]][di]
+			return score > 0, score
+		case *metaNode:
+			return n.match(candidates[di].hit.doc), 0
+		}
+		return false, 0
+	}
+
+	var results []searchHit
+	for di, c := range candidates {
+		if ok, score := eval(q.root, di); ok {
+			c.hit.score = score
+			results = append(results, c.hit)
+		}
+	}
+	return results, nil
+}
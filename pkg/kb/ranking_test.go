@@ -0,0 +1,201 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchModes runs a test against both the index and the scan
+func searchModes(t *testing.T, files map[string]string, test func(t *testing.T, nav *Navigator)) {
+	for _, mode := range []SearchMode{SearchScan, SearchIndex} {
+		t.Run(string(mode), func(t *testing.T) {
+			nav := newTestNavigator(t, files)
+			if err := nav.SetSearchMode(mode, ""); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { nav.Close() })
+			test(t, nav)
+		})
+	}
+}
+
+func searchPaths(t *testing.T, nav *Navigator, query string) []string {
+	t.Helper()
+	page, err := nav.Search(context.Background(), query, SearchOptions{GroupByDocument: true}, nil)
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	var paths []string
+	for _, r := range page.Results {
+		paths = append(paths, filepath.ToSlash(r.DocumentPath))
+	}
+	return paths
+}
+
+func expectPaths(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("Expected %v, got %v", want, got)
+		}
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	files := map[string]string{
+		"infra/deploy.md": "# Deploy\nSteps to ship a release.\n",
+		"journal.md":      "# Monday\nLong day. We talked about how to deploy the new service, then lunch, then more meetings about budgets, hiring and the office move.\n",
+		"runbooks/db.org": "#+FILETAGS: :postgres:\n* Rollback plan\nRestore the snapshot, then plan the next rollback drill.\n",
+		"misc/notes.org":  "* Ideas\nA plan for the garden. Rollback is a word.\n",
+		"k8s.md":          "---\ntitle: Cluster\ntags: [infra]\n---\n# Kubernetes upgrades\nDrain nodes first.\n",
+	}
+
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		// A title match beats a passing mention in a long body
+		expectPaths(t, searchPaths(t, nav, "deploy"), "infra/deploy.md", "journal.md")
+
+		// Every word must match, in any order and any field
+		expectPaths(t, searchPaths(t, nav, "snapshot rollback"), "runbooks/db.org")
+
+		// Phrases need the words in sequence
+		expectPaths(t, searchPaths(t, nav, `"rollback plan"`), "runbooks/db.org")
+		expectPaths(t, searchPaths(t, nav, `"plan rollback"`))
+
+		// Prefixes, headings, front matter titles and tags
+		expectPaths(t, searchPaths(t, nav, "kube*"), "k8s.md")
+		expectPaths(t, searchPaths(t, nav, "cluster"), "k8s.md")
+		expectPaths(t, searchPaths(t, nav, "postgres"), "runbooks/db.org")
+
+		// Matching ignores case and punctuation
+		expectPaths(t, searchPaths(t, nav, "DRAIN, nodes!"), "k8s.md")
+	})
+}
+
+func TestSearchTokenizesUnicode(t *testing.T) {
+	files := map[string]string{
+		"ru.md": "# Развертывание\nПлан отката релиза.\n",
+		"en.md": "# Deploy\nRelease rollback plan.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		expectPaths(t, searchPaths(t, nav, "ОТКАТА"), "ru.md")
+		expectPaths(t, searchPaths(t, nav, "развер*"), "ru.md")
+	})
+}
+
+func TestSearchIndexFollowsChanges(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"a.md": "# A\nalpha\n",
+		"b.md": "# B\nalpha beta\n",
+	})
+	if err := nav.SetSearchMode(SearchIndex, filepath.Join(t.TempDir(), "index")); err != nil {
+		t.Fatal(err)
+	}
+	defer nav.Close()
+
+	expectPaths(t, searchPaths(t, nav, "alpha"), "a.md", "b.md")
+
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(filepath.Join(nav.BaseDir(), "a.md"), []byte("# A\ngamma\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(filepath.Join(nav.BaseDir(), "a.md"), later, later)
+	if err := os.Remove(filepath.Join(nav.BaseDir(), "b.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	expectPaths(t, searchPaths(t, nav, "alpha"))
+	expectPaths(t, searchPaths(t, nav, "gamma"), "a.md")
+
+	// Reopening the on-disk index keeps what was indexed
+	nav.Close()
+	expectPaths(t, searchPaths(t, nav, "gamma"), "a.md")
+}
+
+func TestSearchQueryErrors(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"a.md": "# A\n"})
+
+	for _, query := range []string{`"open phrase`, "foo-bar*"} {
+		if _, err := nav.Search(context.Background(), query, SearchOptions{}, nil); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected an invalid query error, got %v", query, err)
+		}
+	}
+	if err := nav.SetSearchMode("fast", ""); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected an unknown mode to be rejected, got %v", err)
+	}
+}
+
+func TestSearchSections(t *testing.T) {
+	files := map[string]string{
+		"notes/infra.org": "#+FILETAGS: :ops:\nOverview of the infrastructure.\n* Incidents\n** 2026-03 outage :postmortem:\nThe database failover stalled.\n** 2026-05 outage\nA certificate expired.\n* Runbooks\nRestart the database gently.\n",
+		"db.md":           "# Database\nPostgres notes.\n",
+	}
+
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		// The heading match ranks first; body matches follow, one per section
+		expectPaths(t, sectionLocations(t, nav, "database", SearchOptions{}),
+			"db.md › Database",
+			"notes/infra.org › Incidents › 2026-03 outage",
+			"notes/infra.org › Runbooks")
+
+		page, err := nav.Search(context.Background(), "database", SearchOptions{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hit := page.Results[1]
+		if hit.Header == nil || hit.Header.Title != "2026-03 outage" || hit.Header.Level != 2 || hit.Header.LineNum != 4 {
+			t.Errorf("Expected the section's header, got %+v", hit.Header)
+		}
+		if !strings.Contains(hit.Snippet, "failover") {
+			t.Errorf("Expected a snippet of the section, got %q", hit.Snippet)
+		}
+
+		// All words must match within one section; tags are inherited
+		expectPaths(t, sectionLocations(t, nav, "failover certificate", SearchOptions{}))
+		expectPaths(t, sectionLocations(t, nav, "tag:ops tag:postmortem", SearchOptions{}),
+			"notes/infra.org › Incidents › 2026-03 outage")
+		expectPaths(t, sectionLocations(t, nav, "infrastructure", SearchOptions{}), "notes/infra.org")
+
+		// Grouping returns documents with their best sections
+		grouped, err := nav.Search(context.Background(), "database OR outage", SearchOptions{GroupByDocument: true, Sections: 2}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if grouped.Total != 2 || len(grouped.Results) != 2 {
+			t.Fatalf("Expected 2 documents, got %+v", grouped.Results)
+		}
+		for _, r := range grouped.Results {
+			if r.Header != nil || len(r.Sections) == 0 || len(r.Sections) > 2 {
+				t.Errorf("Expected a document with up to 2 sections, got %+v", r)
+			}
+			for i := 1; i < len(r.Sections); i++ {
+				if r.Sections[i].Score > r.Sections[i-1].Score {
+					t.Errorf("Expected sections best first, got %+v", r.Sections)
+				}
+			}
+			if r.Score != r.Sections[0].Score {
+				t.Errorf("Expected a document to score as its best section, got %+v", r)
+			}
+		}
+	})
+}
+
+func sectionLocations(t *testing.T, nav *Navigator, query string, opts SearchOptions) []string {
+	t.Helper()
+	page, err := nav.Search(context.Background(), query, opts, nil)
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	var locations []string
+	for _, r := range page.Results {
+		locations = append(locations, r.Location())
+	}
+	return locations
+}
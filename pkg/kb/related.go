@@ -0,0 +1,242 @@
+package kb
+
+import (
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultRelatedLimit is the number of related notes returned by default
+const DefaultRelatedLimit = 10
+
+// relatedWeights weigh the signals in the score of a related note; they
+// add up to 1
+var relatedWeights = RelatedSignals{Terms: 0.5, Tags: 0.2, Links: 0.3}
+
+// relatedTerms is the number of shared terms reported per note
+const relatedTerms = 5
+
+// RelatedDocument is a note related to another one, with the reasons
+type RelatedDocument struct {
+	Path        string         `json:"path"`
+	Title       string         `json:"title"`
+	Score       float64        `json:"score"` // the weighted signals, from 0 to 1
+	Signals     RelatedSignals `json:"signals"`
+	SharedTerms []string       `json:"shared_terms,omitempty"` // the words weighing most in Signals.Terms
+	SharedTags  []string       `json:"shared_tags,omitempty"`
+	Link        string         `json:"link,omitempty"` // how the notes are linked, e.g. "links to"
+}
+
+// RelatedSignals are the scores, each from 0 to 1, a note is related by
+type RelatedSignals struct {
+	Terms float64 `json:"terms"` // TF-IDF cosine similarity of the texts
+	Tags  float64 `json:"tags"`  // shared tags over all tags of the two notes
+	Links float64 `json:"links"` // 1 when one links to the other, 0.5 through a note both link with
+}
+
+// relatedNote is what a document is compared by
+type relatedNote struct {
+	doc   Document
+	terms map[string]float64 // term frequencies, then TF-IDF weights
+	words map[string]string  // a term as first written
+	tags  map[string]bool
+	norm  float64
+}
+
+// RelatedDocuments returns up to limit notes related to the one at
+// relativePath, most related first: by the words they share, weighted by
+// TF-IDF; by their tags; and by links between them, directly or through a
+// note both link with. Notes sharing nothing are left out.
+func (n *Navigator) RelatedDocuments(relativePath string, limit int) ([]RelatedDocument, error) {
+	if limit <= 0 {
+		limit = DefaultRelatedLimit
+	}
+	source, err := n.ReadDocument(relativePath)
+	if err != nil {
+		return nil, err
+	}
+	sourceKey := strings.ToLower(filepath.ToSlash(filepath.Clean(source.Path)))
+
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	ta := n.textAnalysis()
+	resolver := newLinkResolver(docs)
+	notes := map[string]*relatedNote{}
+	links := map[string]map[string]int{} // key -> linked key -> 1 outgoing, 2 incoming, 3 both
+	link := func(from, to string, direction int) {
+		if links[from] == nil {
+			links[from] = map[string]int{}
+		}
+		links[from][to] |= direction
+	}
+	docFreq := map[string]int{}
+	for _, doc := range docs {
+		fullDoc, err := n.ReadDocument(doc.Path)
+		if err != nil {
+			n.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+		key := strings.ToLower(filepath.ToSlash(doc.Path))
+		note := ta.relatedNote(fullDoc)
+		note.doc = doc
+		notes[key] = note
+		for term := range note.terms {
+			docFreq[term]++
+		}
+		for _, l := range parseLinks(fullDoc.Content, fullDoc.Format) {
+			if target, ok := resolver.resolve(doc.Path, l); ok && target != key {
+				link(key, target, 1)
+				link(target, key, 2)
+			}
+		}
+	}
+
+	src, ok := notes[sourceKey]
+	if !ok {
+		return nil, newError(ErrNotFound, "document not found: %s", relativePath)
+	}
+	total := float64(len(notes))
+	for _, note := range notes {
+		var sum float64
+		for term, tf := range note.terms {
+			df := float64(docFreq[term])
+			w := (1 + math.Log(tf)) * math.Log(1+(total-df+0.5)/(df+0.5))
+			note.terms[term] = w
+			sum += w * w
+		}
+		note.norm = math.Sqrt(sum)
+	}
+
+	related := []RelatedDocument{}
+	for key, note := range notes {
+		if key == sourceKey {
+			continue
+		}
+		r := RelatedDocument{Path: note.doc.Path, Title: note.doc.Title}
+		r.Signals.Terms, r.SharedTerms = src.similarity(note)
+		r.Signals.Tags, r.SharedTags = src.sharedTags(note)
+		r.Signals.Links, r.Link = linkProximity(links, sourceKey, key, notes)
+		r.Score = relatedWeights.Terms*r.Signals.Terms + relatedWeights.Tags*r.Signals.Tags + relatedWeights.Links*r.Signals.Links
+		if r.Score > 0 {
+			related = append(related, r)
+		}
+	}
+	sort.Slice(related, func(i, j int) bool {
+		if related[i].Score != related[j].Score {
+			return related[i].Score > related[j].Score
+		}
+		return related[i].Path < related[j].Path
+	})
+	if len(related) > limit {
+		related = related[:limit]
+	}
+	return related, nil
+}
+
+// relatedNote counts the terms of a document, in its title once and in
+// the headings and text of each section, along with its tags
+func (ta *textAnalysis) relatedNote(doc *Document) *relatedNote {
+	note := &relatedNote{terms: map[string]float64{}, words: map[string]string{}, tags: map[string]bool{}}
+	add := func(text, lang string) {
+		for _, token := range ta.analyzer(lang).Analyze([]byte(text)) {
+			term := string(token.Term)
+			note.terms[term]++
+			if _, ok := note.words[term]; !ok && token.End <= len(text) {
+				note.words[term] = strings.ToLower(text[token.Start:token.End])
+			}
+		}
+	}
+	for i, unit := range ta.documentUnits(doc) {
+		if i == 0 {
+			add(unit.fields["title"], unit.lang)
+		}
+		add(unit.fields["headers"], unit.lang)
+		add(unit.fields["content"], unit.lang)
+	}
+	for _, tag := range documentTags(doc.Content, doc.Format) {
+		note.tags[strings.ToLower(strings.Trim(tag, ":#"))] = true
+	}
+	return note
+}
+
+// similarity is the cosine similarity of two notes' TF-IDF weights, with
+// the words contributing most to it
+func (a *relatedNote) similarity(b *relatedNote) (float64, []string) {
+	if a.norm == 0 || b.norm == 0 {
+		return 0, nil
+	}
+	type contribution struct {
+		term  string
+		value float64
+	}
+	var shared []contribution
+	var dot float64
+	for term, w := range a.terms {
+		if other, ok := b.terms[term]; ok && w*other > 0 {
+			dot += w * other
+			shared = append(shared, contribution{term, w * other})
+		}
+	}
+	sort.Slice(shared, func(i, j int) bool {
+		if shared[i].value != shared[j].value {
+			return shared[i].value > shared[j].value
+		}
+		return shared[i].term < shared[j].term
+	})
+	var words []string
+	for i := 0; i < len(shared) && i < relatedTerms; i++ {
+		words = append(words, a.words[shared[i].term])
+	}
+	return dot / (a.norm * b.norm), words
+}
+
+// sharedTags is the Jaccard index of two notes' tags, with the shared ones
+func (a *relatedNote) sharedTags(b *relatedNote) (float64, []string) {
+	var shared []string
+	union := len(b.tags)
+	for tag := range a.tags {
+		if b.tags[tag] {
+			shared = append(shared, tag)
+		} else {
+			union++
+		}
+	}
+	if len(shared) == 0 {
+		return 0, nil
+	}
+	sort.Strings(shared)
+	return float64(len(shared)) / float64(union), shared
+}
+
+// linkProximity scores how closely two notes are linked: directly, or
+// through a note linking with both
+func linkProximity(links map[string]map[string]int, from, to string, notes map[string]*relatedNote) (float64, string) {
+	switch links[from][to] {
+	case 1:
+		return 1, "links to"
+	case 2:
+		return 1, "linked from"
+	case 3:
+		return 1, "linked both ways"
+	}
+
+	var via []string
+	for middle := range links[from] {
+		if links[middle][to] != 0 {
+			via = append(via, middle)
+		}
+	}
+	if len(via) == 0 {
+		return 0, ""
+	}
+	sort.Strings(via)
+	name := via[0]
+	if note, ok := notes[via[0]]; ok {
+		name = filepath.ToSlash(note.doc.Path)
+	}
+	return 0.5, "through " + name
+}
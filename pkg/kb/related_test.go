@@ -0,0 +1,87 @@
+package kb
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLinks(t *testing.T) {
+	md := "See [the plan](../plans/q3%20plan.md#goals), [[Kubernetes|k8s]] and [[ops/Runbook#Drain]].\n" +
+		"Not [a site](https://example.com) nor [an anchor](#top).\n"
+	var got []string
+	for _, l := range parseLinks(md, FormatMarkdown) {
+		got = append(got, l.target)
+	}
+	if strings.Join(got, "|") != "../plans/q3 plan.md|Kubernetes|ops/Runbook" {
+		t.Errorf("Unexpected Markdown links: %v", got)
+	}
+
+	org := "* Links\n[[file:infra/k8s.org][Kubernetes]] and [[file:../todo.org::*Today]], not [[https://example.com][web]]\n"
+	got = nil
+	for _, l := range parseLinks(org, FormatOrg) {
+		got = append(got, l.target)
+	}
+	if strings.Join(got, "|") != "infra/k8s.org|../todo.org" {
+		t.Errorf("Unexpected Org links: %v", got)
+	}
+}
+
+func TestRelatedDocuments(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"ops/deploy.md":        "---\ntags: [infra, release]\n---\n# Deploy\nRolling deploys of the API. Rollback with the previous image. See [[Kubernetes]].\n",
+		"ops/rollback.md":      "---\ntags: [release]\n---\n# Rollback\nRollback a bad deploy by redeploying the previous image.\n",
+		"infra/kubernetes.org": "#+FILETAGS: :infra:\n* Kubernetes\nNodes and pods. [[file:dns.org][DNS]]\n",
+		"infra/dns.org":        "* DNS\nRecords and zones.\n",
+		"garden.md":            "# Garden\nWater the lawn.\n",
+	})
+
+	related, err := nav.RelatedDocuments("ops/deploy.md", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range related {
+		paths = append(paths, r.Path)
+	}
+	// A link weighs more than similar wording
+	expectPaths(t, paths, "infra/kubernetes.org", "ops/rollback.md", "infra/dns.org")
+
+	k8s, rollback, dns := related[0], related[1], related[2]
+	if rollback.Signals.Terms == 0 || rollback.Signals.Tags != 0.5 || rollback.Signals.Links != 0 ||
+		strings.Join(rollback.SharedTags, ",") != "release" || len(rollback.SharedTerms) == 0 {
+		t.Errorf("Expected rollback to share words and a tag, got %+v", rollback)
+	}
+	if !strings.Contains(strings.Join(rollback.SharedTerms, " "), "rollback") {
+		t.Errorf("Expected rollback among the shared words, got %v", rollback.SharedTerms)
+	}
+	if k8s.Signals.Links != 1 || k8s.Link != "links to" || k8s.Signals.Tags != 0.5 {
+		t.Errorf("Expected kubernetes to be linked and share a tag, got %+v", k8s)
+	}
+	if dns.Signals.Links != 0.5 || dns.Link != "through infra/kubernetes.org" || dns.Signals.Terms != 0 {
+		t.Errorf("Expected dns to be linked through kubernetes, got %+v", dns)
+	}
+
+	// Links count both ways
+	related, err = nav.RelatedDocuments("infra/kubernetes.org", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(related) != 1 || related[0].Link == "" {
+		t.Errorf("Expected a single linked note, got %+v", related)
+	}
+
+	// A note with nothing in common has an empty list, not null
+	related, err = nav.RelatedDocuments("garden.md", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := json.Marshal(related); string(out) != "[]" {
+		t.Errorf("Expected no related notes as [], got %s", out)
+	}
+
+	if _, err := nav.RelatedDocuments("missing.md", 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a missing note to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package kb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// savedNameRe is what saved search names may look like, so that they fit
+// in URLs and resource URIs as they are
+var savedNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// SavedSearch is a search kept under a name in the KB's saved searches
+// file. Its fields are those of a search request.
+type SavedSearch struct {
+	Name        string   `yaml:"name" json:"name"`
+	Description string   `yaml:"description" json:"description,omitempty"`
+	Query       string   `yaml:"query" json:"query"` // may be empty: the filters alone select notes
+	Folder      string   `yaml:"folder" json:"folder,omitempty"`
+	Formats     yamlList `yaml:"format" json:"format,omitempty"`
+	Tags        yamlList `yaml:"tag" json:"tag,omitempty"`
+	Since       string   `yaml:"since" json:"since,omitempty"` // a date, or a time ago such as -14d
+	Until       string   `yaml:"until" json:"until,omitempty"`
+	Glob        string   `yaml:"glob" json:"glob,omitempty"`
+	Sort        string   `yaml:"sort" json:"sort,omitempty"`
+	Order       string   `yaml:"order" json:"order,omitempty"`
+	Limit       int      `yaml:"limit" json:"limit,omitempty"`
+	Group       bool     `yaml:"group" json:"group,omitempty"`
+	Fuzzy       bool     `yaml:"fuzzy" json:"fuzzy,omitempty"`
+}
+
+// yamlList accepts one string or a list of them
+type yamlList []string
+
+func (l *yamlList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*l = yamlList{node.Value}
+		return nil
+	}
+	var items []string
+	if err := node.Decode(&items); err != nil {
+		return err
+	}
+	*l = items
+	return nil
+}
+
+// ListQuery returns the search request of s, to adjust and run with Search
+func (s SavedSearch) ListQuery() ListQuery {
+	return ListQuery{
+		Folder:  s.Folder,
+		Formats: s.Formats,
+		Tags:    s.Tags,
+		Since:   s.Since,
+		Until:   s.Until,
+		Glob:    s.Glob,
+		Sort:    s.Sort,
+		Order:   s.Order,
+		Limit:   s.Limit,
+		Group:   s.Group,
+		Fuzzy:   s.Fuzzy,
+	}
+}
+
+// ParseSavedSearches reads a saved searches file:
+//
+//	searches:
+//	  - name: oncall
+//	    description: Notes tagged oncall, latest first
+//	    query: tag:oncall
+//	    sort: modified
+//	    order: desc
+//
+// Every search must have a unique name and a valid query and options.
+func ParseSavedSearches(data []byte) ([]SavedSearch, error) {
+	var file struct {
+		Searches []SavedSearch `yaml:"searches"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, newError(ErrInvalid, "saved searches: %v", err)
+	}
+
+	seen := map[string]bool{}
+	for i, s := range file.Searches {
+		switch {
+		case !savedNameRe.MatchString(s.Name):
+			return nil, newError(ErrInvalid, "saved search %d: invalid name %q (use letters, digits, '-', '_' and '.')", i+1, s.Name)
+		case seen[strings.ToLower(s.Name)]:
+			return nil, newError(ErrInvalid, "saved search %s: duplicate name", s.Name)
+		}
+		seen[strings.ToLower(s.Name)] = true
+		if _, err := parseSearchQuery(s.Query); err != nil {
+			return nil, newError(ErrInvalid, "saved search %s: %v", s.Name, err)
+		}
+		query := s.ListQuery()
+		query.Limit = max(query.Limit, 1)
+		if _, err := query.SearchOptions(); err != nil {
+			return nil, newError(ErrInvalid, "saved search %s: %v", s.Name, err)
+		}
+	}
+	return file.Searches, nil
+}
+
+// savedSearchSource serves the saved searches file, rereading it whenever
+// it changes
+type savedSearchSource struct {
+	file string
+
+	mu          sync.Mutex
+	fingerprint string
+	searches    []SavedSearch
+	err         error
+}
+
+func (s *savedSearchSource) current() ([]SavedSearch, error) {
+	if s == nil || s.file == "" {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fingerprint := ""
+	info, err := os.Stat(s.file)
+	if err == nil {
+		fingerprint = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if fingerprint != s.fingerprint {
+		s.fingerprint = fingerprint
+		s.searches, s.err = nil, nil
+		if fingerprint != "" {
+			var data []byte
+			if data, s.err = os.ReadFile(s.file); s.err == nil {
+				s.searches, s.err = ParseSavedSearches(data)
+			}
+		}
+	}
+	return s.searches, s.err
+}
+
+// SetSavedSearches sets the file saved searches are kept in, reread
+// whenever it changes. A relative file is taken from the KB root; ""
+// means none.
+func (n *Navigator) SetSavedSearches(file string) {
+	if file != "" && !filepath.IsAbs(file) {
+		file = filepath.Join(n.baseDir, file)
+	}
+	n.search.mu.Lock()
+	n.search.saved = &savedSearchSource{file: file}
+	n.search.mu.Unlock()
+}
+
+// SavedSearches returns the saved searches, in the order of the file. A
+// missing file means none; an invalid one is an error.
+func (n *Navigator) SavedSearches() ([]SavedSearch, error) {
+	n.search.mu.Lock()
+	source := n.search.saved
+	n.search.mu.Unlock()
+	return source.current()
+}
+
+// SavedSearch returns the saved search called name, ignoring case
+func (n *Navigator) SavedSearch(name string) (*SavedSearch, error) {
+	searches, err := n.SavedSearches()
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := range searches {
+		if strings.EqualFold(searches[i].Name, name) {
+			s := searches[i]
+			return &s, nil
+		}
+		names = append(names, searches[i].Name)
+	}
+	msg := fmt.Sprintf("saved search not found: %s", name)
+	if close := ClosestMatches(name, names, 1); len(close) > 0 {
+		msg += fmt.Sprintf(". Did you mean %q?", close[0])
+	}
+	return nil, newError(ErrNotFound, "%s", msg)
+}
+
+// RunSavedSearch runs the saved search called name. The cursor, limit and
+// marker of paging, when set, replace those of the search; with neither
+// limit the page holds DefaultPageSize results.
+func (n *Navigator) RunSavedSearch(ctx context.Context, name string, paging ListQuery) (*SavedSearch, *SearchPage, error) {
+	s, err := n.SavedSearch(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := s.ListQuery()
+	query.Cursor, query.Marker = paging.Cursor, paging.Marker
+	if paging.Limit != 0 {
+		query.Limit = paging.Limit
+	}
+	if query.Limit == 0 {
+		query.Limit = DefaultPageSize
+	}
+	opts, err := query.SearchOptions()
+	if err != nil {
+		return nil, nil, err
+	}
+	page, err := n.Search(ctx, s.Query, opts, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, page, nil
+}
@@ -0,0 +1,136 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSavedSearches(t *testing.T) {
+	searches, err := ParseSavedSearches([]byte(`searches:
+  - name: oncall
+    description: Oncall notes, latest first
+    query: runbook
+    tag: oncall
+    sort: modified
+    order: desc
+  - name: sprint
+    format: [org, markdown]
+    since: -2w
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(searches) != 2 || searches[0].Name != "oncall" || searches[1].Name != "sprint" {
+		t.Fatalf("Expected oncall and sprint, got %+v", searches)
+	}
+	if tags := searches[0].Tags; len(tags) != 1 || tags[0] != "oncall" {
+		t.Errorf("Expected a single tag to read as a list, got %v", tags)
+	}
+	if formats := searches[1].Formats; len(formats) != 2 {
+		t.Errorf("Expected two formats, got %v", formats)
+	}
+
+	for _, bad := range []string{
+		"searches:\n  - query: runbook\n",
+		"searches:\n  - name: on call\n",
+		"searches:\n  - name: a\n  - name: A\n",
+		"searches:\n  - name: a\n    query: '(runbook'\n",
+		"searches:\n  - name: a\n    sort: size-ish\n",
+		"searches:\n  - name: a\n    since: last week\n",
+		"searches:\n  - name: a\n    querry: runbook\n",
+	} {
+		if _, err := ParseSavedSearches([]byte(bad)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected an invalid saved searches error, got %v", bad, err)
+		}
+	}
+}
+
+func TestRunSavedSearch(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"ops/deploy.md":  "---\ntags: [oncall]\n---\n# Deploy runbook\nRoll back first.\n",
+		"ops/restore.md": "---\ntags: [oncall]\n---\n# Restore runbook\nCheck backups.\n",
+		"notes/idea.md":  "# Runbook ideas\nWrite more.\n",
+	})
+	file := filepath.Join(nav.BaseDir(), ".kbnavt", "saved-searches.yaml")
+	nav.SetSavedSearches(".kbnavt/saved-searches.yaml")
+	write := func(content string, age time.Duration) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(age)
+		os.Chtimes(file, modified, modified)
+	}
+
+	// A missing file means no saved searches
+	if searches, err := nav.SavedSearches(); err != nil || len(searches) != 0 {
+		t.Fatalf("Expected no saved searches, got %v, %v", searches, err)
+	}
+
+	write("searches:\n  - name: oncall\n    query: runbook\n    tag: oncall\n    sort: path\n    group: true\n", -time.Hour)
+	s, page, err := nav.RunSavedSearch(context.Background(), "OnCall", ListQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, r := range page.Results {
+		paths = append(paths, r.DocumentPath)
+	}
+	if s.Name != "oncall" || strings.Join(paths, " ") != "ops/deploy.md ops/restore.md" {
+		t.Errorf("Expected the oncall runbooks, got %s: %v", s.Name, paths)
+	}
+
+	_, page, err = nav.RunSavedSearch(context.Background(), "oncall", ListQuery{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 1 || page.NextCursor == "" {
+		t.Errorf("Expected one result and a next page, got %d results, cursor %q", len(page.Results), page.NextCursor)
+	}
+
+	_, _, err = nav.RunSavedSearch(context.Background(), "oncal", ListQuery{})
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), `"oncall"`) {
+		t.Errorf("Expected not found with a suggestion, got %v", err)
+	}
+
+	// Edits are picked up, and an invalid file is reported
+	write("searches:\n  - name: oncall\n    query: runbook\n  - name: ideas\n    folder: notes\n", 0)
+	if searches, err := nav.SavedSearches(); err != nil || len(searches) != 2 {
+		t.Errorf("Expected the edited searches, got %v, %v", searches, err)
+	}
+	write("searches:\n  - name: oncall\n    sort: sideways\n", time.Hour)
+	if _, err := nav.SavedSearches(); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "oncall") {
+		t.Errorf("Expected the invalid search named, got %v", err)
+	}
+}
+
+func TestRelativeDates(t *testing.T) {
+	year, month, day := time.Now().Date()
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"-0d", time.Date(year, month, day, 0, 0, 0, 0, time.Local)},
+		{"-14d", time.Date(year, month, day-14, 0, 0, 0, 0, time.Local)},
+		{"-2w", time.Date(year, month, day-14, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := parseDate("since", tt.value)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: expected %v, got %v, %v", tt.value, tt.want, got, err)
+		}
+	}
+	for _, bad := range []string{"14d", "-2m", "-d"} {
+		if _, err := parseDate("since", bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected an invalid date error, got %v", bad, err)
+		}
+	}
+}
@@ -1,88 +1,541 @@
 package kb
 
 import (
+    "context"
+    "encoding/json"
     "fmt"
     "log/slog"
+    "os"
+    "path/filepath"
+    "sync"
 
     "github.com/blevesearch/bleve/v2"
+    "github.com/blevesearch/bleve/v2/search/query"
 )
 
+// indexVersion changes whenever the mapping does; older indexes are rebuilt.
+// The analysis signature is stored along with it, so that changing the
+// languages rebuilds the index too.
+const indexVersion = "5"
+
+// Keys of the index's internal storage
+var (
+    versionKey  = []byte("kbnavt:version")
+    manifestKey = []byte("kbnavt:manifest")
+)
+
+// indexBatchSize is the number of documents written per batch
+const indexBatchSize = 100
+
 // SearchEngine handles full-text indexing and searching
 type SearchEngine struct {
-    index  bleve.Index
-    logger *slog.Logger
+    index    bleve.Index
+    analysis *textAnalysis
+    logger   *slog.Logger
+
+    // mu serializes syncs; manifest records what the index holds
+    mu       sync.Mutex
+    manifest map[string]indexStamp
 }
 
-// NewSearchEngine creates a new search engine
-func NewSearchEngine(indexPath string, logger *slog.Logger) (*SearchEngine, error) {
-    // Try to open existing index
-    index, err := bleve.Open(indexPath)
-    if err == nil {
-        return &SearchEngine{
-            index:  index,
-            logger: logger,
-        }, nil
+// indexStamp identifies the version of a document that was indexed, and
+// the sections it was indexed as
+type indexStamp struct {
+    Modified int64 `json:"m"`
+    Size     int64 `json:"s"`
+    Units    []int `json:"u,omitempty"` // first lines of the units
+}
+
+func (s indexStamp) sameVersion(other indexStamp) bool {
+    return s.Modified == other.Modified && s.Size == other.Size
+}
+
+// NewSearchEngine opens the index at indexPath, creating it if needed. An
+// empty path keeps the index in memory. Text is analyzed as configured by
+// analysis.
+func NewSearchEngine(indexPath string, analysis Analysis, logger *slog.Logger) (*SearchEngine, error) {
+    ta, err := newTextAnalysis(analysis)
+    if err != nil {
+        return nil, err
     }
+    return newSearchEngine(indexPath, ta, logger)
+}
 
-    // Create new index if doesn't exist
-    mapping := bleve.NewIndexMapping()
-    index, err = bleve.NewUsing(indexPath, mapping, "scorch", "mmap", nil)
+func newSearchEngine(indexPath string, ta *textAnalysis, logger *slog.Logger) (*SearchEngine, error) {
+    im := ta.mapping
+    version := indexVersion + "/" + ta.signature
+
+    var index bleve.Index
+    var err error
+    if indexPath == "" {
+        index, err = bleve.NewMemOnly(im)
+    } else if index, err = bleve.Open(indexPath); err == nil {
+        // Try the existing index, unless it was built with another mapping
+        if stored, _ := index.GetInternal(versionKey); string(stored) != version {
+            logger.Info("rebuilding search index", "path", indexPath)
+            index.Close()
+            if err := os.RemoveAll(indexPath); err != nil {
+                return nil, fmt.Errorf("failed to remove outdated search index: %w", err)
+            }
+            index, err = bleve.NewUsing(indexPath, im, "scorch", "scorch", nil)
+        }
+    } else {
+        // Create new index if doesn't exist
+        if err := os.MkdirAll(filepath.Dir(indexPath), 0o755); err != nil {
+            return nil, fmt.Errorf("failed to create search index: %w", err)
+        }
+        index, err = bleve.NewUsing(indexPath, im, "scorch", "scorch", nil)
+    }
     if err != nil {
         return nil, fmt.Errorf("failed to create search index: %w", err)
     }
 
-    return &SearchEngine{
-        index:  index,
-        logger: logger,
-    }, nil
+    se := &SearchEngine{
+        index:    index,
+        analysis: ta,
+        logger:   logger,
+        manifest: map[string]indexStamp{},
+    }
+    if data, _ := index.GetInternal(manifestKey); data != nil {
+        if err := json.Unmarshal(data, &se.manifest); err != nil {
+            logger.Warn("ignoring damaged search index manifest", "error", err)
+        }
+    }
+    if err := index.SetInternal(versionKey, []byte(version)); err != nil {
+        index.Close()
+        return nil, fmt.Errorf("failed to create search index: %w", err)
+    }
+    return se, nil
 }
 
 // IndexDocument adds or updates a document in the index
 func (se *SearchEngine) IndexDocument(doc *Document) error {
-    err := se.index.Index(doc.Path, map[string]interface{}{
-        "title":   doc.Title,
-        "content": doc.Content,
-        "path":    doc.Path,
-        "format":  doc.Format,
-    })
+    se.mu.Lock()
+    defer se.mu.Unlock()
+
+    key := filepath.ToSlash(doc.Path)
+    batch := se.index.NewBatch()
+    stamp, err := se.indexUnits(batch, key, doc)
+    if err == nil {
+        err = se.index.Batch(batch)
+    }
     if err != nil {
         se.logger.Error("failed to index document", "path", doc.Path, "error", err)
         return err
     }
-    return nil
+    se.manifest[key] = stamp
+    return se.saveManifest()
+}
+
+// DeleteDocument removes a document from the index
+func (se *SearchEngine) DeleteDocument(path string) error {
+    se.mu.Lock()
+    defer se.mu.Unlock()
+
+    key := filepath.ToSlash(path)
+    batch := se.index.NewBatch()
+    se.deleteUnits(batch, key)
+    if err := se.index.Batch(batch); err != nil {
+        return err
+    }
+    delete(se.manifest, key)
+    return se.saveManifest()
+}
+
+// indexUnits replaces the units of the document stored under key
+func (se *SearchEngine) indexUnits(batch *bleve.Batch, key string, doc *Document) (indexStamp, error) {
+    se.deleteUnits(batch, key)
+    stamp := indexStamp{Modified: doc.UpdatedAt.UnixNano(), Size: doc.Size}
+    for _, unit := range se.analysis.documentUnits(doc) {
+        if err := batch.Index(unitID(key, unit.line), facetDocument(unit)); err != nil {
+            return stamp, fmt.Errorf("failed to index %s: %w", doc.Path, err)
+        }
+        stamp.Units = append(stamp.Units, unit.line)
+    }
+    return stamp, nil
+}
+
+// documentUnitIDs returns the IDs of the indexed units of a document; the
+// caller holds se.mu
+func (se *SearchEngine) documentUnitIDs(path string) []string {
+    var ids []string
+    key := filepath.ToSlash(path)
+    for _, line := range se.manifest[key].Units {
+        ids = append(ids, unitID(key, line))
+    }
+    return ids
+}
+
+// deleteUnits removes the indexed units of the document stored under key
+func (se *SearchEngine) deleteUnits(batch *bleve.Batch, key string) {
+    for _, line := range se.manifest[key].Units {
+        batch.Delete(unitID(key, line))
+    }
+}
+
+func (se *SearchEngine) saveManifest() error {
+    data, _ := json.Marshal(se.manifest)
+    return se.index.SetInternal(manifestKey, data)
+}
+
+// sync brings the index up to date with docs, the complete list of
+// documents: new and modified documents are (re)indexed and deleted ones
+// removed. read loads a document's content.
+func (se *SearchEngine) sync(ctx context.Context, docs []Document, read func(path string) (*Document, error), progress ProgressFunc) error {
+    se.mu.Lock()
+    defer se.mu.Unlock()
+
+    current := make(map[string]indexStamp, len(docs))
+    var changed []Document
+    for _, doc := range docs {
+        key := filepath.ToSlash(doc.Path)
+        stamp := indexStamp{Modified: doc.UpdatedAt.UnixNano(), Size: doc.Size}
+        if old, ok := se.manifest[key]; ok && old.sameVersion(stamp) {
+            current[key] = old
+        } else {
+            current[key] = stamp
+            changed = append(changed, doc)
+        }
+    }
+
+    var removed []string
+    for key := range se.manifest {
+        if _, ok := current[key]; !ok {
+            removed = append(removed, key)
+        }
+    }
+    if len(changed) == 0 && len(removed) == 0 {
+        return nil
+    }
+    se.logger.Debug("updating search index", "changed", len(changed), "removed", len(removed))
+
+    batch := se.index.NewBatch()
+    for _, key := range removed {
+        se.deleteUnits(batch, key)
+    }
+    for i, doc := range changed {
+        if err := ctx.Err(); err != nil {
+            return err
+        }
+        if progress != nil {
+            progress(i, len(changed))
+        }
+
+        key := filepath.ToSlash(doc.Path)
+        fullDoc, err := read(doc.Path)
+        if err != nil {
+            // Unreadable documents (too large, say) are left out of the index
+            se.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+            se.deleteUnits(batch, key)
+        } else if current[key], err = se.indexUnits(batch, key, fullDoc); err != nil {
+            return err
+        }
+
+        if batch.Size() >= indexBatchSize {
+            if err := se.index.Batch(batch); err != nil {
+                return fmt.Errorf("failed to update search index: %w", err)
+            }
+            batch.Reset()
+        }
+    }
+    if err := se.index.Batch(batch); err != nil {
+        return fmt.Errorf("failed to update search index: %w", err)
+    }
+    if progress != nil {
+        progress(len(changed), len(changed))
+    }
+
+    se.manifest = current
+    return se.saveManifest()
 }
 
-// Search performs a full-text search
-func (se *SearchEngine) Search(query string, limit int) ([]*SearchResult, error) {
-    searchQuery := bleve.NewQueryStringQuery(query)
-    search := bleve.NewSearchRequestOptions(searchQuery, limit, 0, false)
-    search.Fields = []string{"title", "content", "path"}
+// search returns the score of every indexed unit matching q, by unit ID.
+// docs are the documents metadata fields are checked against.
+func (se *SearchEngine) search(ctx context.Context, q *searchQuery, docs []Document) (map[string]float64, error) {
+    count, err := se.index.DocCount()
+    if err != nil {
+        return nil, err
+    }
+
+    se.mu.Lock()
+    units := func(doc Document) []string {
+        return se.documentUnitIDs(doc.Path)
+    }
+    compiled := compileQuery(q.root, docs, units)
+    se.mu.Unlock()
 
-    results, err := se.index.Search(search)
+    request := bleve.NewSearchRequestOptions(compiled, int(count), 0, false)
+    results, err := se.index.SearchInContext(ctx, request)
     if err != nil {
-        se.logger.Error("search failed", "query", query, "error", err)
+        se.logger.Error("search failed", "error", err)
         return nil, err
     }
 
-    var searchResults []*SearchResult
+    scores := make(map[string]float64, len(results.Hits))
     for _, hit := range results.Hits {
-        result := &SearchResult{
-            DocumentID:   hit.ID,
-            DocumentPath: hit.ID,
-            Score:        hit.Score,
+        scores[hit.ID] = hit.Score
+    }
+    return scores, nil
+}
+
+// compileQuery turns a query tree into a Bleve query. Text clauses search
+// their fields with the fields' boosts; metadata clauses are evaluated here,
+// the same way the scan does, and select the units of the matching
+// documents by ID without scoring.
+func compileQuery(node queryNode, docs []Document, units func(Document) []string) query.Query {
+    switch n := node.(type) {
+    case *andNode:
+        var children []query.Query
+        for _, child := range n.children {
+            children = append(children, compileQuery(child, docs, units))
+        }
+        return query.NewConjunctionQuery(children)
+
+    case *orNode:
+        var children []query.Query
+        for _, child := range n.children {
+            children = append(children, compileQuery(child, docs, units))
+        }
+        return query.NewDisjunctionQuery(children)
+
+    case *notNode:
+        all := query.NewMatchAllQuery()
+        all.SetBoost(0)
+        return query.NewBooleanQuery([]query.Query{all}, nil, []query.Query{compileQuery(n.child, docs, units)})
+
+    case *metaNode:
+        ids := []string{}
+        for _, doc := range docs {
+            if n.match(doc) {
+                ids = append(ids, units(doc)...)
+            }
         }
+        q := query.NewDocIDQuery(ids)
+        q.SetBoost(0)
+        return q
 
-        if fragments, ok := hit.Fragments["content"]; ok && len(fragments) > 0 {
-            result.Snippet = fragments[0] // TODO: check
+    case *textNode:
+        if len(n.variants) == 0 {
+            // Stop words only: nothing to look for
+            all := query.NewMatchAllQuery()
+            all.SetBoost(0)
+            return all
         }
+        var fields []query.Query
+        for _, f := range searchFields {
+            if n.field != "" && n.field != f.name {
+                continue
+            }
+            fields = append(fields, textQuery(n, f.name, f.boost))
+        }
+        return query.NewDisjunctionQuery(fields)
+    }
+    return query.NewMatchNoneQuery()
+}
+
+// textQuery searches one field for a text clause, in any of its variants
+func textQuery(n *textNode, field string, boost float64) query.Query {
+    switch n.kind {
+    case clausePrefix:
+        q := query.NewPrefixQuery(n.variants[0][0])
+        q.SetField(wordsField(field))
+        q.SetBoost(boost)
+        return q
+    case clauseWildcard:
+        q := query.NewWildcardQuery(n.variants[0][0])
+        q.SetField(wordsField(field))
+        q.SetBoost(boost)
+        return q
+    case clauseFuzzy:
+        return fuzzyQuery(n, field, boost)
+    }
+
+    var variants []query.Query
+    for _, terms := range n.variants {
+        if len(terms) > 1 {
+            q := query.NewPhraseQuery(terms, field)
+            q.SetBoost(boost)
+            variants = append(variants, q)
+            continue
+        }
+        q := query.NewTermQuery(terms[0])
+        q.SetField(field)
+        q.SetBoost(boost)
+        variants = append(variants, q)
+    }
+    if n.fuzziness > 0 {
+        variants = append(variants, fuzzyQuery(n, field, boost))
+    }
+    if len(variants) == 1 {
+        return variants[0]
+    }
+    return query.NewDisjunctionQuery(variants)
+}
+
+// fuzzyQuery matches the words of a field up to the clause's fuzziness
+// edits away
+func fuzzyQuery(n *textNode, field string, boost float64) query.Query {
+    q := query.NewFuzzyQuery(n.word)
+    q.SetFuzziness(n.fuzziness)
+    q.SetField(wordsField(field))
+    q.SetBoost(boost)
+    return q
+}
 
-        searchResults = append(searchResults, result)
+// vocabulary reads the index's term dictionaries: words as written, with
+// the number of units they occur in per field, and analyzed terms
+func (se *SearchEngine) vocabulary() (*vocabulary, error) {
+    vocab := &vocabulary{words: map[string]int{}, terms: map[string]bool{}}
+    for _, f := range searchFields {
+        err := se.readDict(wordsField(f.name), func(term string, count int) {
+            vocab.words[term] += count
+        })
+        if err == nil {
+            err = se.readDict(f.name, func(term string, _ int) {
+                vocab.terms[term] = true
+            })
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to read search vocabulary: %w", err)
+        }
     }
+    return vocab, nil
+}
 
-    return searchResults, nil
+func (se *SearchEngine) readDict(field string, visit func(term string, count int)) error {
+    dict, err := se.index.FieldDict(field)
+    if err != nil {
+        return err
+    }
+    defer dict.Close()
+    for {
+        entry, err := dict.Next()
+        if err != nil || entry == nil {
+            return err
+        }
+        visit(entry.Term, int(entry.Count))
+    }
 }
 
 // Close closes the search index
 func (se *SearchEngine) Close() error {
     return se.index.Close()
 }
+
+// SearchMode chooses how the navigator searches
+type SearchMode string
+
+const (
+    SearchAuto  SearchMode = "auto"  // scan small KBs, index larger ones
+    SearchIndex SearchMode = "index" // keep a Bleve index, updated before each search
+    SearchScan  SearchMode = "scan"  // read every document on each search
+)
+
+// autoIndexThreshold is the KB size from which auto mode uses the index
+const autoIndexThreshold = 200
+
+// searchState is shared by a navigator and its scoped copies
+type searchState struct {
+    mode     SearchMode
+    indexDir string
+
+    mu       sync.Mutex
+    engine   *SearchEngine
+    analysis *textAnalysis
+    synonyms *synonymSource
+    semantic Semantic
+    vectors  *vectorIndex // opened on the first search with an embedder
+    saved    *savedSearchSource
+}
+
+// SetSearchMode selects the search mode. indexDir keeps the index on disk
+// between runs; when empty the index lives in memory.
+func (n *Navigator) SetSearchMode(mode SearchMode, indexDir string) error {
+    switch mode {
+    case "":
+        mode = SearchAuto
+    case SearchAuto, SearchIndex, SearchScan:
+    default:
+        return newError(ErrInvalid, "unknown search mode: %s (use auto, index or scan)", mode)
+    }
+    n.search.mode = mode
+    n.search.indexDir = indexDir
+    return nil
+}
+
+// SetAnalysis configures how text is analyzed for search. An open index is
+// closed, and rebuilt on the next search if it was built another way.
+func (n *Navigator) SetAnalysis(analysis Analysis) error {
+    ta, err := newTextAnalysis(analysis)
+    if err != nil {
+        return err
+    }
+    n.search.mu.Lock()
+    defer n.search.mu.Unlock()
+    n.search.analysis = ta
+    if n.search.engine == nil {
+        return nil
+    }
+    err = n.search.engine.Close()
+    n.search.engine = nil
+    return err
+}
+
+// textAnalysis returns the configured analysis, DefaultAnalysis unless
+// SetAnalysis was called
+func (n *Navigator) textAnalysis() *textAnalysis {
+    n.search.mu.Lock()
+    defer n.search.mu.Unlock()
+    if n.search.analysis == nil {
+        ta, err := newTextAnalysis(DefaultAnalysis())
+        if err != nil {
+            panic(err) // the defaults are valid
+        }
+        n.search.analysis = ta
+    }
+    return n.search.analysis
+}
+
+// Close releases the search index, if one was opened
+func (n *Navigator) Close() error {
+    n.search.mu.Lock()
+    defer n.search.mu.Unlock()
+    if n.search.engine == nil {
+        return nil
+    }
+    err := n.search.engine.Close()
+    n.search.engine = nil
+    return err
+}
+
+// searchEngine returns the up-to-date index, or nil when documents should
+// be scanned instead.
+func (n *Navigator) searchEngine(ctx context.Context, progress ProgressFunc) (*SearchEngine, error) {
+    if n.search.mode == SearchScan {
+        return nil, nil
+    }
+
+    // The index covers the whole KB whatever this navigator's scope
+    whole := *n
+    whole.scope = nil
+    docs, err := whole.ListDocuments()
+    if err != nil {
+        return nil, err
+    }
+    if n.search.mode != SearchIndex && len(docs) < autoIndexThreshold {
+        return nil, nil
+    }
+
+    ta := n.textAnalysis()
+    n.search.mu.Lock()
+    if n.search.engine == nil {
+        n.search.engine, err = newSearchEngine(n.search.indexDir, ta, n.logger)
+    }
+    engine := n.search.engine
+    n.search.mu.Unlock()
+    if err != nil {
+        return nil, err
+    }
+
+    return engine, engine.sync(ctx, docs, whole.ReadDocument, progress)
+}
@@ -0,0 +1,138 @@
+package kb
+
+import (
+	"regexp"
+	"strings"
+)
+
+// orgTodoKeywords are the TODO states recognised at the start of an Org headline
+var orgTodoKeywords = map[string]bool{
+	"TODO":      true,
+	"NEXT":      true,
+	"WAITING":   true,
+	"DONE":      true,
+	"CANCELLED": true,
+	"CANCELED":  true,
+}
+
+var (
+	orgHeadlineRe = regexp.MustCompile(`^(\*+)\s+(.*)$`)
+	orgTagsRe     = regexp.MustCompile(`\s+(:[\w@#%:]+:)\s*$`)
+	orgPriorityRe = regexp.MustCompile(`^\[#[A-Za-z0-9]\]\s*`)
+	mdHeadingRe   = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdFenceRe     = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// sectionSpan locates a heading and the lines its subtree covers
+type sectionSpan struct {
+	Level int
+	Title string
+	Todo  string
+	Tags  []string
+	Path  []string // titles of enclosing headings, outermost first
+	Line  int      // zero-based line of the heading itself
+	End   int      // exclusive end line of the subtree
+}
+
+// scanSections finds all headings in content and computes their line ranges
+func scanSections(content string, format Format) []sectionSpan {
+	lines := strings.Split(content, "\n")
+
+	var spans []sectionSpan
+	var stack []int // indexes into spans of currently open headings
+	inFence := false
+
+	for i, line := range lines {
+		var span sectionSpan
+		var ok bool
+
+		switch format {
+		case FormatOrg:
+			span, ok = parseOrgHeadline(line)
+		default:
+			if mdFenceRe.MatchString(line) {
+				inFence = !inFence
+				continue
+			}
+			if inFence {
+				continue
+			}
+			span, ok = parseMarkdownHeading(line)
+		}
+		if !ok {
+			continue
+		}
+
+		// Close every open heading at the same or a deeper level
+		for len(stack) > 0 && spans[stack[len(stack)-1]].Level >= span.Level {
+			spans[stack[len(stack)-1]].End = i
+			stack = stack[:len(stack)-1]
+		}
+
+		for _, idx := range stack {
+			span.Path = append(span.Path, spans[idx].Title)
+		}
+		span.Line = i
+		spans = append(spans, span)
+		stack = append(stack, len(spans)-1)
+	}
+
+	for _, idx := range stack {
+		spans[idx].End = len(lines)
+	}
+
+	return spans
+}
+
+func parseOrgHeadline(line string) (sectionSpan, bool) {
+	m := orgHeadlineRe.FindStringSubmatch(line)
+	if m == nil {
+		return sectionSpan{}, false
+	}
+
+	span := sectionSpan{Level: len(m[1])}
+	title := m[2]
+
+	if first, rest, found := strings.Cut(title, " "); orgTodoKeywords[first] {
+		span.Todo = first
+		title = ""
+		if found {
+			title = rest
+		}
+	}
+	title = orgPriorityRe.ReplaceAllString(strings.TrimSpace(title), "")
+
+	if t := orgTagsRe.FindStringSubmatch(title); t != nil {
+		for _, tag := range strings.Split(strings.Trim(t[1], ":"), ":") {
+			if tag != "" {
+				span.Tags = append(span.Tags, tag)
+			}
+		}
+		title = strings.TrimSuffix(title, t[0])
+	}
+
+	span.Title = strings.TrimSpace(title)
+	return span, true
+}
+
+func parseMarkdownHeading(line string) (sectionSpan, bool) {
+	m := mdHeadingRe.FindStringSubmatch(line)
+	if m == nil {
+		return sectionSpan{}, false
+	}
+	return sectionSpan{
+		Level: len(m[1]),
+		Title: strings.TrimSpace(m[2]),
+	}, true
+}
+
+// findSection returns the first section whose title matches, ignoring case
+func findSection(spans []sectionSpan, title string) (sectionSpan, bool) {
+	title = strings.TrimSpace(title)
+	for _, span := range spans {
+		if strings.EqualFold(span.Title, title) {
+			return span, true
+		}
+	}
+	return sectionSpan{}, false
+}
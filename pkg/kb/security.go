@@ -1,7 +1,6 @@
 package kb
 
 import (
-	"fmt"
 	"path/filepath"
 	"strings"
 )
@@ -28,7 +27,7 @@ func (sm *SecurityManager) ValidatePath(requestPath string) (string, error) {
 
 	// Check if path attempts directory traversal
 	if strings.Contains(cleanPath, "..") {
-		return "", fmt.Errorf("path traversal detected: %s", requestPath)
+		return "", newError(ErrForbiddenPath, "path traversal detected: %s", requestPath)
 	}
 
 	// Try to resolve within each allowed root
@@ -44,7 +43,7 @@ func (sm *SecurityManager) ValidatePath(requestPath string) (string, error) {
 		}
 	}
 
-	return "", fmt.Errorf("path not in allowed roots: %s", requestPath)
+	return "", newError(ErrForbiddenPath, "path not in allowed roots: %s", requestPath)
 }
 
 // IsAllowedFile checks if file extension is allowed
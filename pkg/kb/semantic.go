@@ -0,0 +1,223 @@
+package kb
+
+import (
+	"context"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultMinSimilarity is the cosine similarity a section needs to match a
+// query by meaning, suited to the hash embedder
+const DefaultMinSimilarity = 0.3
+
+// semanticNeighbours is the number of sections taken from the vector index
+// per query, before fusion
+const semanticNeighbours = 50
+
+// rrfK damps the weight of the first ranks in reciprocal rank fusion
+const rrfK = 60
+
+// Semantic configures hybrid search: sections are also found by meaning,
+// through their embeddings, and both rankings are fused
+type Semantic struct {
+	Embedder      Embedder // nil turns hybrid search off
+	IndexDir      string   // where vectors are kept, relative to the KB root; "" keeps them in memory
+	MinSimilarity float64  // 0 means DefaultMinSimilarity
+}
+
+// SetSemantic configures hybrid search. Vectors made by another embedder
+// are discarded and the KB embedded again on the next search.
+func (n *Navigator) SetSemantic(semantic Semantic) {
+	if semantic.IndexDir != "" && !filepath.IsAbs(semantic.IndexDir) {
+		semantic.IndexDir = filepath.Join(n.baseDir, semantic.IndexDir)
+	}
+	if semantic.MinSimilarity == 0 {
+		semantic.MinSimilarity = DefaultMinSimilarity
+	}
+	n.search.mu.Lock()
+	defer n.search.mu.Unlock()
+	n.search.semantic = semantic
+	n.search.vectors = nil
+}
+
+// vectorIndex returns the up-to-date vector index, or nil without an
+// embedder
+func (n *Navigator) vectorIndex(ctx context.Context, progress ProgressFunc) (*vectorIndex, Semantic, error) {
+	n.search.mu.Lock()
+	semantic := n.search.semantic
+	if semantic.Embedder != nil && n.search.vectors == nil {
+		n.search.vectors = openVectorIndex(semantic.IndexDir, semantic.Embedder, n.logger)
+	}
+	vectors := n.search.vectors
+	n.search.mu.Unlock()
+	if vectors == nil {
+		return nil, semantic, nil
+	}
+
+	// The vectors cover the whole KB whatever this navigator's scope
+	whole := *n
+	whole.scope = nil
+	docs, err := whole.ListDocuments()
+	if err != nil {
+		return nil, semantic, err
+	}
+	return vectors, semantic, vectors.sync(ctx, docs, whole.ReadDocument, n.textAnalysis(), progress)
+}
+
+// hybridHits adds the sections of docs closest in meaning to text to the
+// keyword hits, and ranks them all by reciprocal rank fusion. Sections
+// found by meaning alone must still pass the metadata and negated clauses
+// at the top of the query. It returns whether vectors were used.
+func (n *Navigator) hybridHits(ctx context.Context, q *searchQuery, text string, docs []Document, hits []searchHit, progress ProgressFunc) ([]searchHit, bool, error) {
+	if strings.TrimSpace(text) == "" {
+		return hits, false, nil
+	}
+	vectors, semantic, err := n.vectorIndex(ctx, progress)
+	if err != nil || vectors == nil {
+		return hits, false, err
+	}
+	embedded, err := semantic.Embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, false, err
+	}
+	neighbours := vectors.search(embedded[0], docs, semantic.MinSimilarity, semanticNeighbours)
+
+	key := func(path string, line int) string { return unitID(path, line) }
+	fused := map[string]*searchHit{}
+	var order []string
+
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].score > hits[j].score })
+	for rank, hit := range hits {
+		hit.score = 1 / float64(rrfK+rank+1)
+		k := key(hit.doc.Path, hit.line)
+		fused[k] = &hit
+		order = append(order, k)
+	}
+
+	byPath := make(map[string]Document, len(docs))
+	for _, doc := range docs {
+		byPath[doc.Path] = doc
+	}
+	constraints := q.constraints()
+	units := n.unitLoader()
+	rank := 0
+	for _, neighbour := range neighbours {
+		k := key(neighbour.path, neighbour.line)
+		hit, found := fused[k]
+		if !found {
+			candidate := units(searchHit{doc: byPath[neighbour.path], line: neighbour.line})
+			if candidate.unit.fields == nil {
+				continue // the section is gone
+			}
+			if !q.satisfies(constraints, candidate.doc, candidate.unit) {
+				continue
+			}
+			hit = &candidate
+			fused[k] = hit
+			order = append(order, k)
+		}
+		rank++
+		hit.score += 1 / float64(rrfK+rank)
+	}
+
+	out := make([]searchHit, 0, len(order))
+	for _, k := range order {
+		out = append(out, *fused[k])
+	}
+	return out, true, nil
+}
+
+// semanticText is what a query means to find: the text of its clauses,
+// leaving out the negated ones
+func (q *searchQuery) semanticText() string {
+	var words []string
+	var collect func(node queryNode)
+	collect = func(node queryNode) {
+		switch n := node.(type) {
+		case *andNode:
+			for _, c := range n.children {
+				collect(c)
+			}
+		case *orNode:
+			for _, c := range n.children {
+				collect(c)
+			}
+		case *textNode:
+			words = append(words, n.text)
+		}
+	}
+	collect(q.root)
+	return strings.Join(words, " ")
+}
+
+// constraints are the clauses every result must satisfy, whatever its
+// words: the metadata and negated clauses the query's top level requires
+func (q *searchQuery) constraints() []queryNode {
+	top := []queryNode{q.root}
+	if and, ok := q.root.(*andNode); ok {
+		top = and.children
+	}
+	var out []queryNode
+	for _, node := range top {
+		switch node.(type) {
+		case *metaNode, *notNode:
+			out = append(out, node)
+		}
+	}
+	return out
+}
+
+// satisfies reports whether a unit of doc matches every node
+func (q *searchQuery) satisfies(nodes []queryNode, doc Document, unit *searchUnit) bool {
+	fields := map[string]analyzedField{}
+	field := func(name string) analyzedField {
+		f, ok := fields[name]
+		if !ok {
+			f = analyzeField(unit.fields[name], q.analyzer(unit.lang), q.wordsAnalyzer())
+			fields[name] = f
+		}
+		return f
+	}
+
+	var match func(node queryNode) bool
+	match = func(node queryNode) bool {
+		switch n := node.(type) {
+		case *andNode:
+			for _, c := range n.children {
+				if !match(c) {
+					return false
+				}
+			}
+			return true
+		case *orNode:
+			for _, c := range n.children {
+				if match(c) {
+					return true
+				}
+			}
+			return false
+		case *notNode:
+			return !match(n.child)
+		case *metaNode:
+			return n.match(doc)
+		case *textNode:
+			if len(n.variants) == 0 {
+				return true
+			}
+			for _, f := range searchFields {
+				if (n.field == "" || n.field == f.name) && field(f.name).frequency(n) > 0 {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for _, node := range nodes {
+		if !match(node) {
+			return false
+		}
+	}
+	return true
+}
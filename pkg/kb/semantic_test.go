@@ -0,0 +1,209 @@
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// conceptEmbedder places texts by the concepts their words belong to, so
+// that tests can tell which notes mean the same thing
+type conceptEmbedder struct {
+	mu       sync.Mutex
+	embedded int // texts embedded so far
+}
+
+var testConcepts = [][]string{
+	{"roll", "back", "rollback", "revert", "reversal", "undo"},
+	{"deploy", "release", "ship", "shipping"},
+	{"garden", "lawn", "water"},
+}
+
+func (e *conceptEmbedder) Name() string { return "concepts" }
+
+func (e *conceptEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.mu.Lock()
+	e.embedded += len(texts)
+	e.mu.Unlock()
+
+	var vectors [][]float32
+	for _, text := range texts {
+		v := make([]float32, len(testConcepts)+1)
+		v[len(testConcepts)] = 0.1 // no text is orthogonal to everything
+		for _, word := range strings.Fields(strings.ToLower(text)) {
+			for i, concept := range testConcepts {
+				for _, w := range concept {
+					if strings.Trim(word, ".,#") == w {
+						v[i]++
+					}
+				}
+			}
+		}
+		vectors = append(vectors, normalize(v))
+	}
+	return vectors, nil
+}
+
+func (e *conceptEmbedder) count() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.embedded
+}
+
+func TestHybridSearch(t *testing.T) {
+	files := map[string]string{
+		"deploy-reversal.md": "# Deploy reversal\nUndo a bad release by restoring the previous build.\n",
+		"work/shipping.md":   "# Shipping\nHow we ship on Fridays.\n",
+		"garden.md":          "# Garden\nWater the lawn.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		nav.SetSemantic(Semantic{Embedder: &conceptEmbedder{}, MinSimilarity: 0.4})
+		search := func(query string, opts SearchOptions) []string {
+			t.Helper()
+			opts.GroupByDocument = true
+			page, err := nav.Search(context.Background(), query, opts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var paths []string
+			for _, r := range page.Results {
+				paths = append(paths, filepath.ToSlash(r.DocumentPath))
+			}
+			return paths
+		}
+
+		// No keyword matches all the words, but the meaning does
+		expectPaths(t, search("how do we roll back a release", SearchOptions{}), "deploy-reversal.md", "work/shipping.md")
+		expectPaths(t, search("how do we roll back a release", SearchOptions{KeywordOnly: true}))
+
+		// Keyword and meaning agree on the best note
+		expectPaths(t, search("release", SearchOptions{}), "deploy-reversal.md", "work/shipping.md")
+
+		// Sections found by meaning obey filters, metadata and negations
+		expectPaths(t, search("roll back a release path:work/", SearchOptions{}), "work/shipping.md")
+		expectPaths(t, search("roll back a release -undo", SearchOptions{}), "work/shipping.md")
+		expectPaths(t, search("roll back a release", SearchOptions{ListOptions: ListOptions{Filter: DocumentFilter{Folder: "work"}}}), "work/shipping.md")
+
+		page, err := nav.Search(context.Background(), "roll back -undo", SearchOptions{Explain: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.Explain == nil || page.Explain.Semantic != "roll back" {
+			t.Errorf("Expected the text searched by meaning, got %+v", page.Explain)
+		}
+	})
+}
+
+func TestVectorIndexPersists(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"a.md": "# Deploy\nShip it.\n# Undo\nRoll back.\n",
+		"b.md": "# Garden\nWater the lawn.\n",
+	})
+	dir := filepath.Join(t.TempDir(), "vectors")
+	embedder := &conceptEmbedder{}
+	nav.SetSemantic(Semantic{Embedder: embedder, IndexDir: dir})
+
+	search := func(nav *Navigator) {
+		t.Helper()
+		if _, err := nav.Search(context.Background(), "release", SearchOptions{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	search(nav)
+	if got := embedder.count(); got != 4 { // three sections and the query
+		t.Fatalf("Expected 4 texts embedded, got %d", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, vectorsFile)); err != nil {
+		t.Fatalf("Expected the vectors on disk: %v", err)
+	}
+
+	// Another process finds them there
+	other := newTestNavigatorAt(t, nav.BaseDir())
+	embedder = &conceptEmbedder{}
+	other.SetSemantic(Semantic{Embedder: embedder, IndexDir: dir})
+	search(other)
+	if got := embedder.count(); got != 1 {
+		t.Errorf("Expected only the query embedded, got %d", got)
+	}
+
+	// Only changed documents are embedded again
+	file := filepath.Join(nav.BaseDir(), "b.md")
+	os.WriteFile(file, []byte("# Garden\nWater the lawn daily.\n"), 0o644)
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(file, later, later)
+	search(other)
+	if got := embedder.count(); got != 3 {
+		t.Errorf("Expected the changed section and the query embedded, got %d", got)
+	}
+}
+
+// newTestNavigatorAt opens a navigator on an existing KB
+func newTestNavigatorAt(t *testing.T, dir string) *Navigator {
+	t.Helper()
+	nav, err := NewNavigator(dir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nav
+}
+
+func TestHashEmbedder(t *testing.T) {
+	e := NewHashEmbedder(0)
+	vectors, err := e.Embed(context.Background(), []string{
+		"Deploying the new release",
+		"How to redeploy a release",
+		"Watering the garden",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vectors[0]) != DefaultHashDimensions || math.Abs(dot(vectors[0], vectors[0])-1) > 1e-6 {
+		t.Errorf("Expected unit vectors of %d dimensions", DefaultHashDimensions)
+	}
+	if related, unrelated := dot(vectors[0], vectors[1]), dot(vectors[0], vectors[2]); related <= unrelated || related < DefaultMinSimilarity {
+		t.Errorf("Expected shared words to bring texts closer: %.2f vs %.2f", related, unrelated)
+	}
+}
+
+func TestHTTPEmbedder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.Header.Get("Authorization") != "Bearer secret" || req.Model != "nomic-embed-text" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// Out of order, as the API allows
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": []map[string]interface{}{
+			{"index": 1, "embedding": []float32{0, 2}},
+			{"index": 0, "embedding": []float32{3, 4}},
+		}})
+	}))
+	defer server.Close()
+
+	vectors, err := NewHTTPEmbedder(server.URL, "nomic-embed-text", "secret").Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vectors[0][0] != 0.6 || vectors[1][1] != 1 {
+		t.Errorf("Expected normalized vectors in input order, got %v", vectors)
+	}
+
+	if _, err := NewHTTPEmbedder(server.URL, "other", "secret").Embed(context.Background(), []string{"a"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the service's error, got %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+package kb
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blevesearch/bleve/v2/analysis"
+)
+
+// Snippet defaults
+const (
+	DefaultSnippetSize  = 150 // characters per fragment
+	DefaultSnippetCount = 3   // fragments per hit
+)
+
+// MarkerStyle says how matches are marked in Fragment.Marked
+type MarkerStyle string
+
+const (
+	MarkPlain MarkerStyle = "plain" // no markers; clients use Fragment.Matches
+	MarkHTML  MarkerStyle = "html"  // <mark>…</mark> around matches, text escaped
+	MarkANSI  MarkerStyle = "ansi"  // bold red matches for terminals
+)
+
+// markers are the opening and closing markers of each style
+var markers = map[MarkerStyle][2]string{
+	MarkHTML: {"<mark>", "</mark>"},
+	MarkANSI: {"\x1b[1;31m", "\x1b[0m"},
+}
+
+// parseMarkerStyle accepts a marker style name, "" meaning plain
+func parseMarkerStyle(name string) (MarkerStyle, error) {
+	switch style := MarkerStyle(strings.ToLower(name)); style {
+	case "":
+		return MarkPlain, nil
+	case MarkPlain, MarkHTML, MarkANSI:
+		return style, nil
+	}
+	return "", newError(ErrInvalid, "unknown marker style: %s (use plain, html or ansi)", name)
+}
+
+// SnippetOptions controls the fragments shown for each search hit
+type SnippetOptions struct {
+	Size   int         // characters per fragment; 0 means DefaultSnippetSize
+	Count  int         // fragments per hit; 0 means DefaultSnippetCount
+	Marker MarkerStyle // "" means MarkPlain
+}
+
+// Fragment is a piece of a hit's text around one or more matches
+type Fragment struct {
+	Text      string  `json:"text"`
+	Marked    string  `json:"marked,omitempty"` // Text with matches marked, unless the style is plain
+	StartLine int     `json:"start_line"`       // one-based line numbers in the document
+	EndLine   int     `json:"end_line"`
+	Matches   []Match `json:"matches,omitempty"`
+}
+
+// Match locates a match in Fragment.Text, in characters (Unicode code points)
+type Match struct {
+	Start int `json:"start"`
+	End   int `json:"end"` // exclusive
+}
+
+// snippets cuts up to opts.Count fragments of text around the matches of q,
+// in text order, preferring the fragments with the most matches. firstLine
+// is the zero-based document line text starts on, and lang the language it
+// is analyzed in. The joined fragments are returned as well, as a single
+// snippet string.
+func (q *searchQuery) snippets(text string, firstLine int, lang string, opts SnippetOptions) ([]Fragment, string) {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSnippetSize
+	}
+	if opts.Count <= 0 {
+		opts.Count = DefaultSnippetCount
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, ""
+	}
+
+	runes := []rune(text)
+	matches := q.matchRanges(text, q.analyzer(lang))
+
+	// Each window starts at the first match the previous ones left out
+	type window struct {
+		start, end int
+		matches    []Match
+	}
+	var windows []window
+	if len(matches) == 0 {
+		// Nothing to show in particular: the text starts the snippet
+		first := strings.IndexFunc(text, func(r rune) bool { return !unicode.IsSpace(r) })
+		first = utf8.RuneCountInString(text[:first])
+		var w window
+		w.start, w.end = cutWindow(runes, first, first, first, opts.Size)
+		windows = append(windows, w)
+	}
+	for i, prevEnd := 0, 0; i < len(matches); {
+		var w window
+		w.start, w.end = cutWindow(runes, prevEnd, matches[i].Start, matches[i].End, opts.Size)
+		for ; i < len(matches) && matches[i].End <= w.end; i++ {
+			w.matches = append(w.matches, matches[i])
+		}
+		windows = append(windows, w)
+		prevEnd = w.end
+	}
+
+	sort.SliceStable(windows, func(i, j int) bool { return len(windows[i].matches) > len(windows[j].matches) })
+	if len(windows) > opts.Count {
+		windows = windows[:opts.Count]
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i].start < windows[j].start })
+
+	var fragments []Fragment
+	var snippet strings.Builder
+	for _, w := range windows {
+		f := Fragment{
+			Text:      string(runes[w.start:w.end]),
+			StartLine: firstLine + 1 + countLines(runes[:w.start]),
+		}
+		f.EndLine = f.StartLine + countLines(runes[w.start:w.end])
+		for _, m := range w.matches {
+			f.Matches = append(f.Matches, Match{Start: m.Start - w.start, End: m.End - w.start})
+		}
+		if opts.Marker != MarkPlain && opts.Marker != "" {
+			f.Marked = markMatches(f.Text, f.Matches, opts.Marker)
+		}
+		fragments = append(fragments, f)
+
+		if snippet.Len() > 0 {
+			snippet.WriteString(" ")
+		}
+		if !onlySpace(runes[:w.start]) {
+			snippet.WriteString("...")
+		}
+		if f.Marked != "" {
+			snippet.WriteString(f.Marked)
+		} else {
+			snippet.WriteString(f.Text)
+		}
+		if !onlySpace(runes[w.end:]) {
+			snippet.WriteString("...")
+		}
+	}
+	return fragments, snippet.String()
+}
+
+// matchRanges finds the matches of the query's positive text clauses in
+// text, as merged character ranges in order. Words and phrases are matched
+// against the terms of a, wildcards against words as written.
+func (q *searchQuery) matchRanges(text string, a analysis.Analyzer) []Match {
+	var terms, words []*textNode
+	for _, t := range q.positiveTexts() {
+		if !t.matchesWords() {
+			terms = append(terms, t)
+		}
+		if t.matchesWords() || t.fuzziness > 0 {
+			words = append(words, t)
+		}
+	}
+
+	// Byte ranges of the matches, from either token stream
+	var ranges [][2]int
+	collect := func(a analysis.Analyzer, clauses []*textNode, matchAt func(c *textNode, tokens analysis.TokenStream, i int) int) {
+		if len(clauses) == 0 {
+			return
+		}
+		tokens := a.Analyze([]byte(text))
+		for i, token := range tokens {
+			length := 0
+			for _, c := range clauses {
+				length = max(length, matchAt(c, tokens, i))
+			}
+			if length > 0 {
+				ranges = append(ranges, [2]int{token.Start, tokens[i+length-1].End})
+			}
+		}
+	}
+	collect(a, terms, (*textNode).matchAt)
+	collect(q.wordsAnalyzer(), words, func(c *textNode, tokens analysis.TokenStream, i int) int {
+		if c.matchWord(string(tokens[i].Term)) {
+			return 1
+		}
+		return 0
+	})
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	var matches []Match
+	offset, runeOffset := 0, 0
+	runeAt := func(byteOffset int) int {
+		// Ranges come in order, so counting can resume where it stopped
+		runeOffset += utf8.RuneCountInString(text[offset:byteOffset])
+		offset = byteOffset
+		return runeOffset
+	}
+	for _, r := range ranges {
+		start := runeAt(r[0])
+		end := start + utf8.RuneCountInString(text[r[0]:r[1]])
+		if n := len(matches); n > 0 && start <= matches[n-1].End {
+			matches[n-1].End = max(matches[n-1].End, end)
+		} else {
+			matches = append(matches, Match{Start: start, End: end})
+		}
+	}
+	return matches
+}
+
+// matchAt returns the number of tokens a word or phrase clause matches from
+// tokens[i], or 0 when it doesn't match there
+func (c *textNode) matchAt(tokens analysis.TokenStream, i int) int {
+	term := string(tokens[i].Term)
+
+	// Stop words leave gaps in positions, so phrases are followed by
+	// position rather than by token
+	longest := 0
+	for _, terms := range c.variants {
+		if terms[0] != term {
+			continue
+		}
+		last := i
+		for j := 1; j < len(terms) && last >= 0; j++ {
+			if terms[j] == "" {
+				continue
+			}
+			position, next := tokens[i].Position+j, -1
+			for k := last + 1; k < len(tokens) && tokens[k].Position <= position; k++ {
+				if tokens[k].Position == position && string(tokens[k].Term) == terms[j] {
+					next = k
+					break
+				}
+			}
+			last = next
+		}
+		if last >= 0 {
+			longest = max(longest, last-i+1)
+		}
+	}
+	return longest
+}
+
+// cutWindow places a window of about size characters around the match
+// [start, end), not before floor, and moves its edges to word boundaries
+func cutWindow(runes []rune, floor, start, end, size int) (int, int) {
+	from := max(floor, start-(size-(end-start))/3)
+	to := from + size
+	if to > len(runes) {
+		to = len(runes)
+		from = max(floor, min(start, to-size))
+	}
+	to = max(to, end)
+
+	// Don't cut words in half, unless the match itself is the edge
+	if from > 0 && !unicode.IsSpace(runes[from-1]) {
+		for i := from; i < start; i++ {
+			if unicode.IsSpace(runes[i]) {
+				from = i + 1
+				break
+			}
+		}
+	}
+	if to < len(runes) && !unicode.IsSpace(runes[to]) {
+		for i := to - 1; i >= end; i-- {
+			if unicode.IsSpace(runes[i]) {
+				to = i
+				break
+			}
+		}
+	}
+
+	for from < start && unicode.IsSpace(runes[from]) {
+		from++
+	}
+	for to > end && unicode.IsSpace(runes[to-1]) {
+		to--
+	}
+	return from, to
+}
+
+// onlySpace reports whether runes, cut off a fragment, hold no text
+func onlySpace(runes []rune) bool {
+	for _, r := range runes {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func countLines(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		if r == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+// markMatches wraps the matches of text in the style's markers
+func markMatches(text string, matches []Match, style MarkerStyle) string {
+	escape := func(s string) string { return s }
+	if style == MarkHTML {
+		escape = html.EscapeString
+	}
+
+	runes := []rune(text)
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(escape(string(runes[last:m.Start])))
+		b.WriteString(markers[style][0])
+		b.WriteString(escape(string(runes[m.Start:m.End])))
+		b.WriteString(markers[style][1])
+		last = m.End
+	}
+	b.WriteString(escape(string(runes[last:])))
+	return b.String()
+}
@@ -0,0 +1,142 @@
+package kb
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func snippetsFor(t *testing.T, query, text string, opts SnippetOptions) ([]Fragment, string) {
+	t.Helper()
+	q, err := parseSearchQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q.snippets(text, 10, "", opts)
+}
+
+// matched returns the text of each match of a fragment
+func matched(f Fragment) []string {
+	runes := []rune(f.Text)
+	var out []string
+	for _, m := range f.Matches {
+		out = append(out, string(runes[m.Start:m.End]))
+	}
+	return out
+}
+
+func TestSnippetFragments(t *testing.T) {
+	filler := strings.Repeat("слово ", 40)
+	text := "План отката релиза.\n" + filler + "\nВторой откат и третий Откат.\n" + filler + "\nКонец."
+
+	fragments, snippet := snippetsFor(t, "откат*", text, SnippetOptions{Size: 60})
+	if len(fragments) != 2 {
+		t.Fatalf("Expected 2 fragments, got %+v", fragments)
+	}
+	expectPaths(t, matched(fragments[0]), "отката")
+	expectPaths(t, matched(fragments[1]), "откат", "Откат")
+
+	// Lines are counted in the document, from the line the text starts on
+	if fragments[0].StartLine != 11 || fragments[1].StartLine != 12 || fragments[1].EndLine != 14 {
+		t.Errorf("Expected fragments on lines 11 and 12-14, got %+v", fragments)
+	}
+	for _, f := range fragments {
+		if n := len([]rune(f.Text)); n > 60 {
+			t.Errorf("Expected at most 60 characters, got %d: %q", n, f.Text)
+		}
+		if f.Marked != "" {
+			t.Errorf("Expected no markers in plain style, got %q", f.Marked)
+		}
+	}
+	if !strings.HasPrefix(snippet, "План отката") || !strings.Contains(snippet, "...") {
+		t.Errorf("Expected the fragments joined with ellipses, got %q", snippet)
+	}
+
+	// With one fragment, the one with the most matches wins
+	fragments, _ = snippetsFor(t, "откат*", text, SnippetOptions{Size: 60, Count: 1})
+	if len(fragments) != 1 || len(fragments[0].Matches) != 2 {
+		t.Errorf("Expected the fragment with two matches, got %+v", fragments)
+	}
+}
+
+func TestSnippetEllipses(t *testing.T) {
+	filler := strings.Repeat("word ", 20)
+	tests := map[string]string{
+		// Only whitespace cut off is no text left out
+		filler + "We ship the release.\n\n": "...ship the release.",
+		"\n\n  Release notes\n" + filler:    "Release notes...",
+	}
+	for text, want := range tests {
+		_, snippet := snippetsFor(t, "release", text, SnippetOptions{Size: 20})
+		if snippet != want {
+			t.Errorf("Expected %q, got %q", want, snippet)
+		}
+	}
+}
+
+func TestSnippetMatches(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`"rollback plan"`, []string{"rollback plan"}},
+		{`deploy OR plan -revert`, []string{"Deploy", "plan"}},
+		{`title:deploy`, []string{"Deploy"}},
+		{`r?llback`, []string{"rollback"}},
+		{`format:org`, nil},
+	}
+
+	text := "Deploy the rollback plan; revert if needed."
+	for _, tt := range tests {
+		fragments, _ := snippetsFor(t, tt.query, text, SnippetOptions{})
+		if len(fragments) != 1 || fragments[0].Text != text {
+			t.Fatalf("%s: expected the whole text, got %+v", tt.query, fragments)
+		}
+		if got := matched(fragments[0]); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: expected matches %v, got %v", tt.query, tt.want, got)
+		}
+	}
+}
+
+func TestSnippetMarkers(t *testing.T) {
+	text := "Use <b>kubectl</b> & drain"
+	tests := []struct {
+		marker MarkerStyle
+		want   string
+	}{
+		{MarkHTML, "Use &lt;b&gt;<mark>kubectl</mark>&lt;/b&gt; &amp; <mark>drain</mark>"},
+		{MarkANSI, "Use <b>\x1b[1;31mkubectl\x1b[0m</b> & \x1b[1;31mdrain\x1b[0m"},
+	}
+	for _, tt := range tests {
+		fragments, snippet := snippetsFor(t, "kubectl drain", text, SnippetOptions{Marker: tt.marker})
+		if fragments[0].Marked != tt.want || snippet != tt.want {
+			t.Errorf("%s: expected %q, got %q (snippet %q)", tt.marker, tt.want, fragments[0].Marked, snippet)
+		}
+		if fragments[0].Text != text {
+			t.Errorf("%s: expected the text unmarked, got %q", tt.marker, fragments[0].Text)
+		}
+	}
+
+	if _, err := (ListQuery{Marker: "bold"}).SearchOptions(); err == nil {
+		t.Error("Expected an unknown marker style to be rejected")
+	}
+}
+
+func TestSearchFragments(t *testing.T) {
+	files := map[string]string{
+		"notes.org": "* Intro\nNothing here.\n* Deploy\nFirst line.\nThe rollback plan.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		page, err := nav.Search(context.Background(), "rollback", SearchOptions{Snippets: SnippetOptions{Marker: MarkHTML}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Results) != 1 || len(page.Results[0].Fragments) != 1 {
+			t.Fatalf("Expected one hit with one fragment, got %+v", page.Results)
+		}
+		f := page.Results[0].Fragments[0]
+		if f.StartLine != 4 || f.EndLine != 5 || f.Marked != "First line.\nThe <mark>rollback</mark> plan." {
+			t.Errorf("Expected the section body on lines 4-5, got %+v", f)
+		}
+	})
+}
@@ -0,0 +1,216 @@
+package kb
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultSuggestLimit is the number of corrections offered per word, and of
+// completions
+const DefaultSuggestLimit = 5
+
+// Suggestions are corrections and completions for a search query, drawn
+// from the words of the KB
+type Suggestions struct {
+	Query       string       `json:"query"`
+	DidYouMean  string       `json:"did_you_mean,omitempty"` // the query with unknown words corrected
+	Corrections []Correction `json:"corrections,omitempty"`
+	Completions []string     `json:"completions,omitempty"` // the query with its last word completed
+}
+
+// Correction offers words of the KB for a word that isn't in it
+type Correction struct {
+	Word        string           `json:"word"`
+	Suggestions []TermSuggestion `json:"suggestions"`
+}
+
+// TermSuggestion is a word of the KB
+type TermSuggestion struct {
+	Term     string `json:"term"`
+	Count    int    `json:"count"`    // sections it occurs in, per field
+	Distance int    `json:"distance"` // edits away from the word typed
+}
+
+// Suggest proposes corrections for the words of query that occur nowhere in
+// the KB, closest and most common first, and completions of the word being
+// typed at its end. limit bounds both; 0 means DefaultSuggestLimit.
+func (n *Navigator) Suggest(ctx context.Context, query string, limit int) (*Suggestions, error) {
+	if limit <= 0 {
+		limit = DefaultSuggestLimit
+	}
+	q, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	q.analyze(n.textAnalysis())
+
+	vocab, err := n.vocabulary(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := vocab.suggest(query, q, limit)
+
+	if last := q.lastWord(query); last != nil && (last.kind == clauseTerm || last.kind == clausePrefix) {
+		for _, word := range vocab.completions(last.word, limit) {
+			s.Completions = append(s.Completions, query[:last.start]+word)
+		}
+	}
+	return s, nil
+}
+
+// didYouMean corrects a query that found nothing, or returns ""
+func (n *Navigator) didYouMean(ctx context.Context, query string, q *searchQuery) string {
+	vocab, err := n.vocabulary(ctx)
+	if err != nil {
+		n.logger.Debug("failed to load the search vocabulary", "error", err)
+		return ""
+	}
+	return vocab.suggest(query, q, 1).DidYouMean
+}
+
+// vocabulary holds the words of the searchable documents
+type vocabulary struct {
+	words map[string]int  // words as written, folded, by the sections they occur in
+	terms map[string]bool // analyzed terms
+}
+
+// vocabulary reads the words of the KB from the index's term dictionaries,
+// or from the documents when there is no index. A navigator limited to some
+// folders always reads its documents, so that words from elsewhere aren't
+// offered.
+func (n *Navigator) vocabulary(ctx context.Context) (*vocabulary, error) {
+	engine, err := n.searchEngine(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if engine != nil && n.scope == nil {
+		return engine.vocabulary()
+	}
+
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+	ta := n.textAnalysis()
+	vocab := &vocabulary{words: map[string]int{}, terms: map[string]bool{}}
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		fullDoc, err := n.ReadDocument(doc.Path)
+		if err != nil {
+			continue
+		}
+		for _, unit := range ta.documentUnits(fullDoc) {
+			a := ta.analyzer(unit.lang)
+			for _, f := range searchFields {
+				text := []byte(unit.fields[f.name])
+				seen := map[string]bool{}
+				for _, token := range ta.words.Analyze(text) {
+					if word := string(token.Term); !seen[word] {
+						seen[word] = true
+						vocab.words[word]++
+					}
+				}
+				for _, token := range a.Analyze(text) {
+					vocab.terms[string(token.Term)] = true
+				}
+			}
+		}
+	}
+	return vocab, nil
+}
+
+// suggest corrects the positive words of q that the KB doesn't know, in
+// neither their written nor their analyzed forms
+func (v *vocabulary) suggest(query string, q *searchQuery, limit int) *Suggestions {
+	s := &Suggestions{Query: query}
+	corrected := query
+	shift := 0 // how much corrections so far moved the rest of the query
+	for _, t := range q.positiveTexts() {
+		if t.kind != clauseTerm || t.end == 0 || v.known(t) {
+			continue
+		}
+		candidates := v.closest(t.word, autoFuzziness(t.word), limit)
+		if len(candidates) == 0 {
+			continue
+		}
+		s.Corrections = append(s.Corrections, Correction{Word: t.text, Suggestions: candidates})
+		best := candidates[0].Term
+		corrected = corrected[:t.start+shift] + best + corrected[t.end+shift:]
+		shift += len(best) - (t.end - t.start)
+	}
+	if len(s.Corrections) > 0 {
+		s.DidYouMean = corrected
+	}
+	return s
+}
+
+func (v *vocabulary) known(t *textNode) bool {
+	if v.words[t.word] > 0 {
+		return true
+	}
+	for _, terms := range t.variants {
+		if v.terms[terms[0]] {
+			return true
+		}
+	}
+	return false
+}
+
+// closest returns the words at most edits away from word, closest and
+// most common first
+func (v *vocabulary) closest(word string, edits, limit int) []TermSuggestion {
+	if edits == 0 {
+		return nil
+	}
+	var out []TermSuggestion
+	for w, count := range v.words {
+		if w != word && withinEdits(word, w, edits) {
+			out = append(out, TermSuggestion{Term: w, Count: count, Distance: levenshtein(word, w)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Distance != out[j].Distance {
+			return out[i].Distance < out[j].Distance
+		}
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Term < out[j].Term
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+// completions returns the words starting with prefix, most common first
+func (v *vocabulary) completions(prefix string, limit int) []string {
+	var words []string
+	for w := range v.words {
+		if w != prefix && strings.HasPrefix(w, prefix) {
+			words = append(words, w)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if ci, cj := v.words[words[i]], v.words[words[j]]; ci != cj {
+			return ci > cj
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > limit {
+		words = words[:limit]
+	}
+	return words
+}
+
+// withinEdits reports whether a and b are at most max edits apart
+func withinEdits(a, b string, max int) bool {
+	if d := utf8.RuneCountInString(a) - utf8.RuneCountInString(b); d > max || -d > max {
+		return false
+	}
+	return levenshtein(a, b) <= max
+}
@@ -0,0 +1,125 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseFuzzyQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`kuberntes~`, `kuberntes~2`},
+		{`title:postgress~1`, `title:postgress~1`},
+		{`dbs~`, `dbs~1`},
+		{`go~0`, `go~0`},
+		{`a~b`, `"a~b"`},
+	}
+	for _, tt := range tests {
+		q, err := parseSearchQuery(tt.query)
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if got := q.root.String(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.query, tt.want, got)
+		}
+	}
+
+	for _, query := range []string{`kube~3`, `kube*~`, `foo-bar~`} {
+		if _, err := parseSearchQuery(query); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected an invalid query error, got %v", query, err)
+		}
+	}
+}
+
+func TestSearchFuzzy(t *testing.T) {
+	files := map[string]string{
+		"kubernetes.md": "# Kubernetes\nDrain the nodes before upgrades.\n",
+		"postgres.org":  "* Postgres\nVacuum tables weekly.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		expectPaths(t, searchPaths(t, nav, "kuberntes~"), "kubernetes.md")
+		expectPaths(t, searchPaths(t, nav, "kuberntes~1"), "kubernetes.md")
+		expectPaths(t, searchPaths(t, nav, "kubrntes~1"))
+
+		search := func(query string, opts SearchOptions) *SearchPage {
+			t.Helper()
+			page, err := nav.Search(context.Background(), query, opts, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return page
+		}
+
+		// Typo tolerance applies to every plain word
+		if page := search("postgress vacuum", SearchOptions{Fuzzy: true}); page.Total != 1 {
+			t.Errorf("Expected a fuzzy match, got %+v", page)
+		}
+
+		// Without it, nothing matches and a correction is offered
+		page := search("postgress vacuum", SearchOptions{})
+		if page.Total != 0 || page.DidYouMean != "postgres vacuum" {
+			t.Errorf("Expected a suggestion for postgress, got %+v", page)
+		}
+
+		// The word being typed matches as a prefix
+		if page := search("drain kuber", SearchOptions{Typeahead: true}); page.Total != 1 {
+			t.Errorf("Expected a typeahead match, got %+v", page)
+		}
+		if page := search("drain kuber ", SearchOptions{Typeahead: true}); page.Total != 0 {
+			t.Errorf("Expected no match once the word is complete, got %+v", page)
+		}
+
+		// Fuzzy matches are marked in snippets
+		page = search("tabels~", SearchOptions{})
+		if len(page.Results) != 1 || !strings.Contains(page.Results[0].Snippet, "tables") {
+			t.Errorf("Expected a snippet around tables, got %+v", page.Results)
+		}
+		if got := matched(page.Results[0].Fragments[0]); len(got) != 1 || got[0] != "tables" {
+			t.Errorf("Expected tables to be matched, got %v", got)
+		}
+	})
+}
+
+func TestSuggest(t *testing.T) {
+	files := map[string]string{
+		"kubernetes.md": "# Kubernetes\nKubectl drains nodes.\n",
+		"kube.md":       "# Kubelet\nKubelet logs.\n",
+		"deploy.org":    "* Deploy\nDeploying on Fridays.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		s, err := nav.Suggest(context.Background(), "deploying kuberntes", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.DidYouMean != "deploying kubernetes" {
+			t.Errorf("Expected a corrected query, got %+v", s)
+		}
+		if len(s.Corrections) != 1 || s.Corrections[0].Word != "kuberntes" ||
+			s.Corrections[0].Suggestions[0].Term != "kubernetes" || s.Corrections[0].Suggestions[0].Distance != 1 {
+			t.Errorf("Expected kuberntes to be corrected, got %+v", s.Corrections)
+		}
+
+		// Words known in another form aren't corrected
+		s, err = nav.Suggest(context.Background(), "deploys title:kube", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.DidYouMean != "" {
+			t.Errorf("Expected no correction, got %+v", s)
+		}
+		expectPaths(t, s.Completions, "deploys title:kubelet", "deploys title:kubernetes", "deploys title:kubectl")
+
+		s, err = nav.Suggest(context.Background(), "kube ", 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(s.Completions) != 0 {
+			t.Errorf("Expected no completions after a space, got %v", s.Completions)
+		}
+	})
+}
@@ -0,0 +1,167 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// DocumentExists reports whether a path names a readable document
+func (n *Navigator) DocumentExists(relativePath string) bool {
+	fullPath, err := n.validatePath(relativePath)
+	if err != nil {
+		return false
+	}
+	info, err := os.Stat(fullPath)
+	return err == nil && !info.IsDir() && n.security.IsAllowedFile(info.Name())
+}
+
+// SectionTitles returns the titles of all headings in a document
+func (n *Navigator) SectionTitles(relativePath string) ([]string, error) {
+	fullPath, err := n.validatePath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var titles []string
+	for _, span := range scanSections(string(content), detectFormat(fullPath)) {
+		titles = append(titles, span.Title)
+	}
+	return titles, nil
+}
+
+// SuggestPaths returns up to limit document paths that look like a
+// mistyped or misplaced relativePath, best match first.
+func (n *Navigator) SuggestPaths(relativePath string, limit int) []string {
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, doc := range docs {
+		paths = append(paths, filepath.ToSlash(doc.Path))
+	}
+	return suggestPaths(filepath.ToSlash(relativePath), paths, limit)
+}
+
+func suggestPaths(query string, paths []string, limit int) []string {
+	stem := func(p string) string {
+		base := strings.ToLower(filepath.Base(p))
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	queryStem := stem(query)
+	queryLower := strings.ToLower(query)
+	maxDist := max(2, utf8.RuneCountInString(queryStem)/3)
+
+	type candidate struct {
+		path     string
+		sameStem bool
+		stemDist int
+		pathDist int
+	}
+	var candidates []candidate
+	for _, p := range paths {
+		c := candidate{
+			path:     p,
+			sameStem: stem(p) == queryStem,
+			stemDist: levenshtein(stem(p), queryStem),
+			pathDist: levenshtein(strings.ToLower(p), queryLower),
+		}
+		if c.sameStem || c.stemDist <= maxDist {
+			candidates = append(candidates, c)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.sameStem != b.sameStem {
+			return a.sameStem
+		}
+		if a.stemDist != b.stemDist {
+			return a.stemDist < b.stemDist
+		}
+		if a.pathDist != b.pathDist {
+			return a.pathDist < b.pathDist
+		}
+		return a.path < b.path
+	})
+
+	var out []string
+	for _, c := range candidates {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, c.path)
+	}
+	return out
+}
+
+// ClosestMatches returns up to limit candidates within a small edit distance
+// of target, ignoring case, best match first.
+func ClosestMatches(target string, candidates []string, limit int) []string {
+	target = strings.ToLower(target)
+	maxDist := max(2, utf8.RuneCountInString(target)/3)
+
+	type match struct {
+		value string
+		dist  int
+	}
+	var matches []match
+	for _, c := range candidates {
+		lower := strings.ToLower(c)
+		d := levenshtein(lower, target)
+		if strings.Contains(lower, target) || strings.Contains(target, lower) {
+			d = min(d, 1)
+		}
+		if d <= maxDist {
+			matches = append(matches, match{c, d})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].dist < matches[j].dist })
+
+	var out []string
+	for _, m := range matches {
+		if len(out) == limit {
+			break
+		}
+		out = append(out, m.value)
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b in runes
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 {
+		return len(rb)
+	}
+	if len(rb) == 0 {
+		return len(ra)
+	}
+
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
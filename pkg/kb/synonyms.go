@@ -0,0 +1,280 @@
+package kb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Synonyms maps query words and phrases onto others they also match. Each
+// rule is a line:
+//
+//	k8s, kubernetes            two-way: each one finds the others
+//	okr => objectives, goals   one-way: okr also finds the right side
+//
+// Matching ignores case and diacritics; an entry of several words matches
+// the same words quoted as a phrase. Blank lines and lines starting with #
+// are skipped.
+type Synonyms struct {
+	expand map[string][]string // by synonymKey, the entries as written
+}
+
+// ParseSynonyms reads synonym rules, one per line
+func ParseSynonyms(r io.Reader) (*Synonyms, error) {
+	s := &Synonyms{expand: map[string][]string{}}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if err := s.addRule(scanner.Text()); err != nil {
+			return nil, newError(ErrInvalid, "synonyms line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Synonyms) addRule(rule string) error {
+	rule = strings.TrimSpace(rule)
+	if rule == "" || strings.HasPrefix(rule, "#") {
+		return nil
+	}
+
+	from, to, oneWay := strings.Cut(rule, "=>")
+	left, err := synonymEntries(from)
+	if err != nil {
+		return err
+	}
+	right := left
+	if oneWay {
+		if right, err = synonymEntries(to); err != nil {
+			return err
+		}
+	} else if len(left) < 2 {
+		return fmt.Errorf("a rule needs at least two synonyms: %s", rule)
+	}
+
+	for _, word := range left {
+		key := synonymKey(word)
+		for _, other := range right {
+			if synonymKey(other) != key && !containsFold(s.expand[key], other) {
+				s.expand[key] = append(s.expand[key], other)
+			}
+		}
+	}
+	return nil
+}
+
+// synonymEntries splits a comma-separated list of words and phrases
+func synonymEntries(list string) ([]string, error) {
+	var entries []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.Join(strings.Fields(entry), " ")
+		if synonymKey(entry) == "" {
+			return nil, fmt.Errorf("empty synonym in %q", strings.TrimSpace(list))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// synonymKey normalizes a word or phrase for lookup
+func synonymKey(text string) string {
+	return termsKey(analyzeTerms(text))
+}
+
+func termsKey(terms []string) string {
+	folded := make([]string, len(terms))
+	for i, term := range terms {
+		folded[i] = foldText(term)
+	}
+	return strings.Join(folded, " ")
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the synonyms of analyzed terms
+func (s *Synonyms) lookup(terms []string) []string {
+	if s == nil {
+		return nil
+	}
+	return s.expand[termsKey(terms)]
+}
+
+// merge returns the rules of s and other together
+func (s *Synonyms) merge(other *Synonyms) *Synonyms {
+	if s == nil {
+		return other
+	}
+	if other == nil {
+		return s
+	}
+	merged := &Synonyms{expand: map[string][]string{}}
+	for _, source := range []*Synonyms{s, other} {
+		for key, words := range source.expand {
+			for _, word := range words {
+				if !containsFold(merged.expand[key], word) {
+					merged.expand[key] = append(merged.expand[key], word)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// Expansion records the synonyms a word or phrase of a query was expanded
+// with
+type Expansion struct {
+	Text     string   `json:"text"`
+	Synonyms []string `json:"synonyms"`
+}
+
+// expandSynonyms lets each word and phrase of the query also match its
+// synonyms, as alternatives, and returns what was expanded
+func (q *searchQuery) expandSynonyms(s *Synonyms) []Expansion {
+	var expansions []Expansion
+	seen := map[string]bool{}
+
+	var rewrite func(node queryNode) queryNode
+	rewrite = func(node queryNode) queryNode {
+		switch n := node.(type) {
+		case *andNode:
+			for i, c := range n.children {
+				n.children[i] = rewrite(c)
+			}
+		case *orNode:
+			for i, c := range n.children {
+				n.children[i] = rewrite(c)
+			}
+		case *notNode:
+			n.child = rewrite(n.child)
+		case *textNode:
+			if n.kind != clauseTerm && n.kind != clausePhrase {
+				return n
+			}
+			synonyms := s.lookup(n.terms)
+			if len(synonyms) == 0 {
+				return n
+			}
+			or := &orNode{children: []queryNode{n}}
+			for _, synonym := range synonyms {
+				alt := &textNode{field: n.field, kind: clauseTerm, text: synonym, terms: analyzeTerms(synonym)}
+				if len(alt.terms) > 1 {
+					alt.kind = clausePhrase
+				}
+				or.children = append(or.children, alt)
+			}
+			if key := termsKey(n.terms); !seen[key] {
+				seen[key] = true
+				expansions = append(expansions, Expansion{Text: n.text, Synonyms: synonyms})
+			}
+			return or
+		}
+		return node
+	}
+
+	if s == nil || q.root == nil {
+		return nil
+	}
+	q.root = rewrite(q.root)
+	q.texts = nil
+	collectTexts(q.root, &q.texts)
+	return expansions
+}
+
+// synonymSource serves the configured synonyms, reloading the synonyms
+// file whenever it changes
+type synonymSource struct {
+	file   string    // "" for none
+	rules  *Synonyms // from the configuration
+	logger *slog.Logger
+
+	mu          sync.Mutex
+	fingerprint string
+	loaded      *Synonyms // from the file
+}
+
+// current returns the synonyms in effect. A file that fails to parse
+// leaves the previous version in place.
+func (s *synonymSource) current() *Synonyms {
+	if s == nil {
+		return nil
+	}
+	if s.file == "" {
+		return s.rules
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fingerprint := ""
+	info, err := os.Stat(s.file)
+	if err == nil {
+		fingerprint = fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+	} else if !os.IsNotExist(err) {
+		s.logger.Warn("failed to read synonyms", "file", s.file, "error", err)
+		return s.rules.merge(s.loaded)
+	}
+
+	if fingerprint != s.fingerprint {
+		s.fingerprint = fingerprint
+		if fingerprint == "" {
+			s.loaded = nil // removed
+		} else if loaded, err := s.load(); err != nil {
+			s.logger.Warn("ignoring invalid synonyms", "file", s.file, "error", err)
+		} else {
+			s.loaded = loaded
+			s.logger.Debug("synonyms loaded", "file", s.file, "words", len(loaded.expand))
+		}
+	}
+	return s.rules.merge(s.loaded)
+}
+
+func (s *synonymSource) load() (*Synonyms, error) {
+	f, err := os.Open(s.file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSynonyms(f)
+}
+
+// SetSynonyms configures the synonyms queries are expanded with: rules in
+// the Synonyms syntax, and a file of them that is reread whenever it
+// changes. A relative file is taken from the KB root; "" means none.
+func (n *Navigator) SetSynonyms(file string, rules []string) error {
+	var parsed *Synonyms
+	if len(rules) > 0 {
+		var err error
+		if parsed, err = ParseSynonyms(strings.NewReader(strings.Join(rules, "\n"))); err != nil {
+			return err
+		}
+	}
+	if file != "" && !filepath.IsAbs(file) {
+		file = filepath.Join(n.baseDir, file)
+	}
+	n.search.mu.Lock()
+	n.search.synonyms = &synonymSource{file: file, rules: parsed, logger: n.logger}
+	n.search.mu.Unlock()
+	return nil
+}
+
+// synonyms returns the synonyms in effect, if any
+func (n *Navigator) synonyms() *Synonyms {
+	n.search.mu.Lock()
+	source := n.search.synonyms
+	n.search.mu.Unlock()
+	return source.current()
+}
@@ -0,0 +1,121 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSynonyms(t *testing.T) {
+	s, err := ParseSynonyms(strings.NewReader(`# team jargon
+K8s, kubernetes
+pg, postgres, PostgreSQL
+
+okr => objectives, key results
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"k8s", []string{"kubernetes"}},
+		{"Kubernetes", []string{"K8s"}},
+		{"postgresql", []string{"pg", "postgres"}},
+		{"OKR", []string{"objectives", "key results"}},
+		{"objectives", nil},
+		{"key results", nil},
+	}
+	for _, tt := range tests {
+		got := s.lookup(analyzeTerms(tt.text))
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: expected %v, got %v", tt.text, tt.want, got)
+		}
+	}
+
+	for _, bad := range []string{"k8s\n", "a,, b\n", "# ok\nokr =>\n"} {
+		if _, err := ParseSynonyms(strings.NewReader(bad)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected an invalid synonyms error, got %v", bad, err)
+		}
+	}
+	if _, err := ParseSynonyms(strings.NewReader("# ok\nokr =>\n")); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Expected the line of the error, got %v", err)
+	}
+}
+
+func TestSearchSynonyms(t *testing.T) {
+	files := map[string]string{
+		"kubernetes.md": "# Kubernetes\nDrain nodes first.\n",
+		"k8s.org":       "* K8s cheatsheet\nkubectl get pods\n",
+		"goals.md":      "# Objectives\nShip the search.\n",
+		"okr.md":        "# OKR review\nQuarterly.\n",
+		"results.md":    "# Quarter\nKey results were met.\n",
+	}
+	searchModes(t, files, func(t *testing.T, nav *Navigator) {
+		if err := nav.SetSynonyms("", []string{"k8s, kubernetes", "okr => objectives, key results"}); err != nil {
+			t.Fatal(err)
+		}
+
+		expectPaths(t, searchPaths(t, nav, "k8s"), "kubernetes.md", "k8s.org")
+		expectPaths(t, searchPaths(t, nav, "kubernetes"), "kubernetes.md", "k8s.org")
+		expectPaths(t, searchPaths(t, nav, "title:k8s drain"), "kubernetes.md")
+		expectPaths(t, searchPaths(t, nav, "k8s -kubectl"), "kubernetes.md")
+
+		// One-way rules don't find their way back
+		expectPaths(t, searchPaths(t, nav, "okr"), "okr.md", "goals.md", "results.md")
+		expectPaths(t, searchPaths(t, nav, "objectives"), "goals.md")
+
+		page, err := nav.Search(context.Background(), "okr ship", SearchOptions{Explain: true}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `((okr OR objectives OR "key results") AND ship)`
+		if page.Explain == nil || page.Explain.Query != want || len(page.Explain.Expansions) != 1 ||
+			page.Explain.Expansions[0].Text != "okr" {
+			t.Errorf("Expected the expansion explained, got %+v", page.Explain)
+		}
+	})
+}
+
+func TestSynonymsFileReloads(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"database.md": "# Postgres\nVacuum.\n",
+	})
+	file := filepath.Join(nav.BaseDir(), ".kbnavt", "synonyms.txt")
+	if err := nav.SetSynonyms(".kbnavt/synonyms.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	write := func(content string, age time.Duration) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(age)
+		os.Chtimes(file, modified, modified)
+	}
+
+	expectPaths(t, searchPaths(t, nav, "pg"))
+
+	write("pg, postgres\n", -time.Hour)
+	expectPaths(t, searchPaths(t, nav, "pg"), "database.md")
+
+	// An invalid edit keeps the last good version
+	write("pg\n", 0)
+	expectPaths(t, searchPaths(t, nav, "pg"), "database.md")
+
+	os.Remove(file)
+	expectPaths(t, searchPaths(t, nav, "pg"))
+
+	// The synonyms file isn't a document
+	write("pg, postgres\n", time.Hour)
+	expectPaths(t, searchPaths(t, nav, "synonyms"))
+}
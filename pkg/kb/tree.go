@@ -0,0 +1,142 @@
+package kb
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Tree returns the folder hierarchy of the KB. Counts and sizes cover all
+// documents below a folder; depth limits how many levels of children are
+// included (0 means unlimited).
+func (n *Navigator) Tree(depth int) (*FolderNode, error) {
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	root := buildTree(docs)
+	if depth > 0 {
+		pruneTree(root, depth)
+	}
+	return root, nil
+}
+
+// ListFolder returns the direct subfolders and documents of dir, a path
+// relative to the KB root ("" or "." for the root itself).
+func (n *Navigator) ListFolder(dir string) (*FolderListing, error) {
+	dir = strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/")
+	if dir == "." {
+		dir = ""
+	}
+	if dir != "" {
+		fullPath, err := n.validatePath(dir)
+		if err != nil {
+			return nil, err
+		}
+		if info, err := os.Stat(fullPath); err != nil || !info.IsDir() {
+			return nil, newError(ErrNotFound, "folder not found: %s", dir)
+		}
+	}
+
+	docs, err := n.ListDocuments()
+	if err != nil {
+		return nil, err
+	}
+
+	node := buildTree(docs)
+	if dir != "" {
+		for _, name := range strings.Split(dir, "/") {
+			node = childNamed(node, name)
+			if node == nil {
+				// The folder exists but holds no documents
+				return &FolderListing{Path: dir, Folders: []*FolderNode{}, Documents: []Document{}}, nil
+			}
+		}
+	}
+
+	listing := &FolderListing{Path: dir, Folders: []*FolderNode{}, Documents: []Document{}}
+	for _, child := range node.Children {
+		folder := *child
+		folder.Children = nil
+		listing.Folders = append(listing.Folders, &folder)
+	}
+	for _, doc := range docs {
+		if path.Dir(filepath.ToSlash(doc.Path)) == orDot(dir) {
+			listing.Documents = append(listing.Documents, doc)
+		}
+	}
+	sort.Slice(listing.Documents, func(i, j int) bool {
+		return listing.Documents[i].Path < listing.Documents[j].Path
+	})
+	return listing, nil
+}
+
+// buildTree aggregates documents into folders, sorted by name
+func buildTree(docs []Document) *FolderNode {
+	root := &FolderNode{Name: "", Path: ""}
+	for _, doc := range docs {
+		node := root
+		node.add(doc)
+
+		dir := path.Dir(filepath.ToSlash(doc.Path))
+		if dir == "." {
+			continue
+		}
+		for _, name := range strings.Split(dir, "/") {
+			child := childNamed(node, name)
+			if child == nil {
+				child = &FolderNode{Name: name, Path: path.Join(node.Path, name)}
+				node.Children = append(node.Children, child)
+			}
+			node = child
+			node.add(doc)
+		}
+	}
+	sortTree(root)
+	return root
+}
+
+func (f *FolderNode) add(doc Document) {
+	f.Documents++
+	f.Size += doc.Size
+	if doc.UpdatedAt.After(f.UpdatedAt) {
+		f.UpdatedAt = doc.UpdatedAt
+	}
+}
+
+func childNamed(node *FolderNode, name string) *FolderNode {
+	for _, child := range node.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func sortTree(node *FolderNode) {
+	sort.Slice(node.Children, func(i, j int) bool { return node.Children[i].Name < node.Children[j].Name })
+	for _, child := range node.Children {
+		sortTree(child)
+	}
+}
+
+// pruneTree drops children more than depth levels below node
+func pruneTree(node *FolderNode, depth int) {
+	if depth == 0 {
+		node.Children = nil
+		return
+	}
+	for _, child := range node.Children {
+		pruneTree(child, depth-1)
+	}
+}
+
+func orDot(dir string) string {
+	if dir == "" {
+		return "."
+	}
+	return dir
+}
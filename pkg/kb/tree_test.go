@@ -0,0 +1,101 @@
+package kb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"index.md":            "# Index\n",
+		"2025/notes.org":      "* Notes\n",
+		"2025/q1/plan.md":     "# Plan\n",
+		"work/projA/todo.org": "* TODO Ship\n",
+		".kbnavt/hidden.md":   "# Hidden\n",
+	})
+
+	tree, err := nav.Tree(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Documents != 4 {
+		t.Errorf("Expected 4 documents in the KB, got %d", tree.Documents)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Name != "2025" || tree.Children[1].Name != "work" {
+		t.Fatalf("Expected folders 2025 and work, got %+v", tree.Children)
+	}
+
+	y2025 := tree.Children[0]
+	if y2025.Documents != 2 || y2025.Size != int64(len("* Notes\n")+len("# Plan\n")) {
+		t.Errorf("Expected 2025 to total 2 documents and their size, got %d/%d", y2025.Documents, y2025.Size)
+	}
+	if len(y2025.Children) != 1 || y2025.Children[0].Path != "2025/q1" {
+		t.Errorf("Expected nested folder 2025/q1, got %+v", y2025.Children)
+	}
+
+	shallow, err := nav.Tree(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(shallow.Children) != 2 || shallow.Children[0].Children != nil {
+		t.Errorf("Expected depth 1 to stop below the top-level folders, got %+v", shallow.Children[0])
+	}
+	if shallow.Children[1].Documents != 1 {
+		t.Errorf("Expected pruned folders to keep their totals, got %d", shallow.Children[1].Documents)
+	}
+}
+
+func TestListFolder(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"index.md":        "# Index\n",
+		"2025/notes.org":  "* Notes\n",
+		"2025/q1/plan.md": "# Plan\n",
+	})
+	if err := os.MkdirAll(filepath.Join(nav.baseDir, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	listing, err := nav.ListFolder("2025")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Folders) != 1 || listing.Folders[0].Path != "2025/q1" || listing.Folders[0].Children != nil {
+		t.Errorf("Expected subfolder 2025/q1 without children, got %+v", listing.Folders)
+	}
+	if len(listing.Documents) != 1 || filepath.ToSlash(listing.Documents[0].Path) != "2025/notes.org" {
+		t.Errorf("Expected only the direct document, got %+v", listing.Documents)
+	}
+
+	root, err := nav.ListFolder("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(root.Documents) != 1 || len(root.Folders) != 1 {
+		t.Errorf("Expected index.md and folder 2025 at the root, got %+v", root)
+	}
+
+	if empty, err := nav.ListFolder("empty"); err != nil || len(empty.Documents) != 0 {
+		t.Errorf("Expected empty listing for an empty folder, got %+v, %v", empty, err)
+	}
+	if _, err := nav.ListFolder("missing"); err == nil {
+		t.Error("Expected error for a missing folder")
+	}
+	if _, err := nav.ListFolder("../outside"); err == nil {
+		t.Error("Expected error for a folder outside the KB")
+	}
+}
+
+func TestReadSectionOrg(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"plan.org": "* Plan/Goals\ngoals\n** Detail\nmore\n* Other\nrest\n",
+	})
+
+	got, err := nav.ReadSection("plan.org", "plan/goals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "goals\n** Detail\nmore" {
+		t.Errorf("Expected section body with subsections, got %q", got)
+	}
+}
@@ -1,6 +1,8 @@
 package kb
 
 import (
+    "path/filepath"
+    "strings"
     "time"
 )
 
@@ -15,6 +17,7 @@ type Document struct {
     CreatedAt time.Time `json:"created_at"`
     UpdatedAt time.Time `json:"updated_at"`
     Size      int64     `json:"size"`
+    Hash      string    `json:"hash,omitempty"`
 }
 
 // Header represents a section/heading in a document
@@ -36,13 +39,65 @@ const (
     FormatText     Format = "text"
 )
 
-// SearchResult represents a full-text search result
+// SearchResult represents a full-text search result: a section of a
+// document, or a whole document when results are grouped
 type SearchResult struct {
     DocumentID string  `json:"document_id"`
     DocumentPath string `json:"document_path"`
     Score      float64 `json:"score"`
-    Snippet    string  `json:"snippet"`
+    Snippet    string  `json:"snippet"` // the fragments, joined
+    Fragments  []Fragment `json:"fragments,omitempty"`
     Header     *Header `json:"header,omitempty"`
+    HeaderPath []string `json:"header_path,omitempty"` // titles down to Header, outermost first
+    Sections   []SearchResult `json:"sections,omitempty"` // best sections of a grouped document
+}
+
+// Location names the result for display, e.g. "notes/infra.org › Incidents › 2026-03 outage"
+func (r SearchResult) Location() string {
+    return strings.Join(append([]string{filepath.ToSlash(r.DocumentPath)}, r.HeaderPath...), HeaderPathSeparator)
+}
+
+// FolderNode is a directory of the KB with totals over everything below it
+type FolderNode struct {
+    Name      string        `json:"name"`
+    Path      string        `json:"path"`
+    Documents int           `json:"documents"`
+    Size      int64         `json:"size"`
+    UpdatedAt time.Time     `json:"updated_at"`
+    Children  []*FolderNode `json:"children,omitempty"`
+}
+
+// FolderListing is the content of a single directory
+type FolderListing struct {
+    Path      string        `json:"path"`
+    Folders   []*FolderNode `json:"folders"`
+    Documents []Document    `json:"documents"`
+}
+
+// AgendaEntry is an Org headline carrying a planning timestamp
+type AgendaEntry struct {
+    Path    string    `json:"path"`
+    Title   string    `json:"title"`
+    Todo    string    `json:"todo,omitempty"`
+    Kind    string    `json:"kind"` // scheduled, deadline or closed
+    Date    time.Time `json:"date"`
+    Content string    `json:"content"`
+}
+
+// WriteOptions controls how a write operation is applied
+type WriteOptions struct {
+    DryRun       bool   `json:"dry_run"`
+    ExpectedHash string `json:"expected_hash,omitempty"`
+}
+
+// WriteResult describes the outcome (or preview) of a write operation
+type WriteResult struct {
+    Path     string `json:"path"`
+    OldPath  string `json:"old_path,omitempty"`
+    BaseHash string `json:"base_hash,omitempty"`
+    Hash     string `json:"hash"`
+    Diff     string `json:"diff"`
+    Applied  bool   `json:"applied"`
 }
 
 // Resource represents an MCP resource URI
@@ -51,6 +106,7 @@ type Resource struct {
     Name      string `json:"name"`
     MimeType  string `json:"mime_type"`
     DocumentID string `json:"document_id"`
+    Description string `json:"description,omitempty"`
 }
 
 // ContentParams for MCP read_resource
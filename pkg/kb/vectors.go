@@ -0,0 +1,254 @@
+package kb
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// vectorsVersion changes whenever the file layout or the embedded text does
+const vectorsVersion = "1"
+
+// vectorsFile is the name of the vector index in its directory
+const vectorsFile = "vectors.gob"
+
+// embedBatchSize is the number of texts sent to the embedder at once
+const embedBatchSize = 32
+
+// maxEmbedChars bounds the text embedded per section
+const maxEmbedChars = 2000
+
+// vectorIndex keeps an embedding of every search unit, by document. It is
+// kept up to date the same way as the search index, and searched by brute
+// force, which is fast enough for a personal KB.
+type vectorIndex struct {
+	path     string // "" keeps the vectors in memory
+	embedder Embedder
+	logger   *slog.Logger
+
+	mu   sync.Mutex
+	docs map[string]vectorDoc // by slash-separated path
+}
+
+// vectorDoc holds the vectors of one version of a document
+type vectorDoc struct {
+	Modified int64
+	Size     int64
+	Units    []vectorUnit
+}
+
+type vectorUnit struct {
+	Line   int // zero-based first line, as in searchUnit
+	Vector []float32
+}
+
+// vectorData is what is written to disk
+type vectorData struct {
+	Version  string
+	Embedder string
+	Docs     map[string]vectorDoc
+}
+
+// vectorHit is a unit close to a query
+type vectorHit struct {
+	path       string
+	line       int
+	similarity float64
+}
+
+// openVectorIndex loads the vectors stored in dir, if any were made by the
+// same embedder
+func openVectorIndex(dir string, embedder Embedder, logger *slog.Logger) *vectorIndex {
+	vi := &vectorIndex{embedder: embedder, logger: logger, docs: map[string]vectorDoc{}}
+	if dir == "" {
+		return vi
+	}
+	vi.path = filepath.Join(dir, vectorsFile)
+
+	f, err := os.Open(vi.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warn("failed to read vector index", "path", vi.path, "error", err)
+		}
+		return vi
+	}
+	defer f.Close()
+
+	var data vectorData
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		logger.Warn("ignoring damaged vector index", "path", vi.path, "error", err)
+		return vi
+	}
+	if data.Version != vectorsVersion || data.Embedder != embedder.Name() {
+		logger.Info("rebuilding vector index", "path", vi.path, "embedder", embedder.Name())
+		return vi
+	}
+	if data.Docs != nil {
+		vi.docs = data.Docs
+	}
+	return vi
+}
+
+// sync brings the vectors up to date with docs, the complete list of
+// documents, embedding the units of new and modified documents
+func (vi *vectorIndex) sync(ctx context.Context, docs []Document, read func(path string) (*Document, error), ta *textAnalysis, progress ProgressFunc) error {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+
+	current := make(map[string]vectorDoc, len(docs))
+	var changed []Document
+	for _, doc := range docs {
+		key := filepath.ToSlash(doc.Path)
+		old, ok := vi.docs[key]
+		if ok && old.Modified == doc.UpdatedAt.UnixNano() && old.Size == doc.Size {
+			current[key] = old
+		} else {
+			changed = append(changed, doc)
+		}
+	}
+	if len(changed) == 0 && len(current) == len(vi.docs) {
+		return nil
+	}
+	vi.logger.Debug("updating vector index", "changed", len(changed), "removed", len(vi.docs)-len(current))
+
+	// Units are embedded in batches across documents
+	type pending struct {
+		key  string
+		line int
+		text string
+	}
+	var batch []pending
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		texts := make([]string, len(batch))
+		for i, p := range batch {
+			texts[i] = p.text
+		}
+		vectors, err := vi.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		if len(vectors) != len(texts) {
+			return fmt.Errorf("embedder returned %d vectors for %d texts", len(vectors), len(texts))
+		}
+		for i, p := range batch {
+			doc := current[p.key]
+			doc.Units = append(doc.Units, vectorUnit{Line: p.line, Vector: vectors[i]})
+			current[p.key] = doc
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	for i, doc := range changed {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(i, len(changed))
+		}
+
+		key := filepath.ToSlash(doc.Path)
+		current[key] = vectorDoc{Modified: doc.UpdatedAt.UnixNano(), Size: doc.Size}
+		fullDoc, err := read(doc.Path)
+		if err != nil {
+			// Unreadable documents (too large, say) have no vectors
+			vi.logger.Debug("failed to read document", "path", doc.Path, "error", err)
+			continue
+		}
+		for _, unit := range ta.documentUnits(fullDoc) {
+			batch = append(batch, pending{key: key, line: unit.line, text: embedText(unit)})
+			if len(batch) == embedBatchSize {
+				if err := flush(); err != nil {
+					return fmt.Errorf("failed to embed %s: %w", doc.Path, err)
+				}
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("failed to embed documents: %w", err)
+	}
+	if progress != nil {
+		progress(len(changed), len(changed))
+	}
+
+	vi.docs = current
+	return vi.save()
+}
+
+// embedText is what is embedded for a unit: its title, header path and
+// text, cut to maxEmbedChars
+func embedText(unit searchUnit) string {
+	text := strings.Join([]string{unit.fields["title"], unit.fields["headers"], unit.fields["content"]}, "\n")
+	if utf8.RuneCountInString(text) > maxEmbedChars {
+		text = string([]rune(text)[:maxEmbedChars])
+	}
+	return text
+}
+
+// save writes the vectors next to a temporary file first, so that an
+// interrupted write leaves the previous version
+func (vi *vectorIndex) save() error {
+	if vi.path == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(vi.path), 0o755); err != nil {
+		return fmt.Errorf("failed to save vector index: %w", err)
+	}
+	tmp := vi.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to save vector index: %w", err)
+	}
+	err = gob.NewEncoder(f).Encode(vectorData{Version: vectorsVersion, Embedder: vi.embedder.Name(), Docs: vi.docs})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, vi.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to save vector index: %w", err)
+	}
+	return nil
+}
+
+// search returns the units of docs at least minSimilarity close to vector,
+// closest first, at most limit of them
+func (vi *vectorIndex) search(vector []float32, docs []Document, minSimilarity float64, limit int) []vectorHit {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+
+	var hits []vectorHit
+	for _, doc := range docs {
+		key := filepath.ToSlash(doc.Path)
+		for _, unit := range vi.docs[key].Units {
+			if similarity := dot(vector, unit.Vector); similarity >= minSimilarity {
+				hits = append(hits, vectorHit{path: doc.Path, line: unit.Line, similarity: similarity})
+			}
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].similarity != hits[j].similarity {
+			return hits[i].similarity > hits[j].similarity
+		}
+		if hits[i].path != hits[j].path {
+			return hits[i].path < hits[j].path
+		}
+		return hits[i].line < hits[j].line
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
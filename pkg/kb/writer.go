@@ -0,0 +1,428 @@
+package kb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplatesDir holds note templates, relative to the KB root
+const TemplatesDir = ".kbnavt/templates"
+
+var mdTaskRe = regexp.MustCompile(`^(\s*[-*+]\s+)\[([ xX])\](\s+)(.*)$`)
+
+// ContentHash returns the hash used for optimistic concurrency checks
+func ContentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateNote writes a new document; it fails if the path already exists
+func (n *Navigator) CreateNote(relativePath, content string, opts WriteOptions) (*WriteResult, error) {
+	fullPath, err := n.writablePath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(fullPath); err == nil {
+		return nil, newError(ErrConflict, "document already exists: %s", relativePath)
+	}
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	result := &WriteResult{
+		Path: relativePath,
+		Hash: ContentHash(content),
+		Diff: UnifiedDiff("/dev/null", "b/"+relativePath, "", content),
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	// Created exclusively, so that a document appearing since the check
+	// above isn't overwritten
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, newError(ErrConflict, "document already exists: %s", relativePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write document: %w", err)
+	}
+	if _, err := f.WriteString(content); err != nil {
+		f.Close()
+		os.Remove(fullPath)
+		return nil, fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(fullPath)
+		return nil, fmt.Errorf("failed to write document: %w", err)
+	}
+
+	n.logger.Info("document created", "path", relativePath)
+	result.Applied = true
+	return result, nil
+}
+
+// AppendToSection adds text at the end of a section's subtree.
+// An empty section appends to the end of the document.
+func (n *Navigator) AppendToSection(relativePath, section, text string, opts WriteOptions) (*WriteResult, error) {
+	return n.modifyDocument(relativePath, opts, func(content string, format Format) (string, error) {
+		lines := strings.Split(content, "\n")
+		end := len(lines)
+		if section != "" {
+			span, ok := findSection(scanSections(content, format), section)
+			if !ok {
+				return "", newError(ErrSectionNotFound, "header not found: %s", section)
+			}
+			end = span.End
+		}
+
+		// Insert before trailing blank lines so spacing between sections survives
+		insert := end
+		for insert > 0 && strings.TrimSpace(lines[insert-1]) == "" {
+			insert--
+		}
+
+		added := strings.Split(strings.TrimRight(text, "\n"), "\n")
+		out := make([]string, 0, len(lines)+len(added))
+		out = append(out, lines[:insert]...)
+		out = append(out, added...)
+		out = append(out, lines[insert:]...)
+
+		result := strings.Join(out, "\n")
+		if !strings.HasSuffix(result, "\n") {
+			result += "\n"
+		}
+		return result, nil
+	})
+}
+
+// ReplaceSection replaces the body of a section, keeping its heading line
+func (n *Navigator) ReplaceSection(relativePath, section, text string, opts WriteOptions) (*WriteResult, error) {
+	return n.modifyDocument(relativePath, opts, func(content string, format Format) (string, error) {
+		span, ok := findSection(scanSections(content, format), section)
+		if !ok {
+			return "", newError(ErrSectionNotFound, "header not found: %s", section)
+		}
+
+		lines := strings.Split(content, "\n")
+		body := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+		tail := lines[span.End:]
+		if len(tail) > 0 && tail[0] != "" && span.End < len(lines) {
+			// Keep a blank line before the next heading
+			body = append(body, "")
+		}
+
+		out := make([]string, 0, len(lines))
+		out = append(out, lines[:span.Line+1]...)
+		out = append(out, body...)
+		out = append(out, tail...)
+
+		result := strings.Join(out, "\n")
+		if !strings.HasSuffix(result, "\n") {
+			result += "\n"
+		}
+		return result, nil
+	})
+}
+
+// SetTodoState changes the TODO keyword of an Org headline or toggles a
+// Markdown task list checkbox. An empty state clears the Org keyword.
+func (n *Navigator) SetTodoState(relativePath, item, state string, opts WriteOptions) (*WriteResult, error) {
+	state = strings.ToUpper(strings.TrimSpace(state))
+	if state != "" && !orgTodoKeywords[state] {
+		return nil, newError(ErrInvalid, "unknown todo state: %s", state)
+	}
+
+	return n.modifyDocument(relativePath, opts, func(content string, format Format) (string, error) {
+		lines := strings.Split(content, "\n")
+
+		if format == FormatOrg {
+			span, ok := findSection(scanSections(content, format), item)
+			if !ok {
+				return "", newError(ErrSectionNotFound, "header not found: %s", item)
+			}
+			stars := strings.Repeat("*", span.Level)
+			rest := strings.TrimSpace(strings.TrimPrefix(lines[span.Line], stars))
+			if span.Todo != "" {
+				rest = strings.TrimSpace(strings.TrimPrefix(rest, span.Todo))
+			}
+			if state != "" {
+				rest = state + " " + rest
+			}
+			lines[span.Line] = stars + " " + rest
+			return strings.Join(lines, "\n"), nil
+		}
+
+		idx := findTask(lines, item)
+		if idx < 0 {
+			return "", newError(ErrSectionNotFound, "task not found: %s", item)
+		}
+		mark := " "
+		if isDoneState(state) {
+			mark = "x"
+		}
+		m := mdTaskRe.FindStringSubmatch(lines[idx])
+		lines[idx] = m[1] + "[" + mark + "]" + m[3] + m[4]
+		return strings.Join(lines, "\n"), nil
+	})
+}
+
+// RenameNote moves a document to a new path inside the KB
+func (n *Navigator) RenameNote(oldPath, newPath string, opts WriteOptions) (*WriteResult, error) {
+	oldFull, err := n.writablePath(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newFull, err := n.writablePath(newPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := n.statDocument(oldFull, oldPath); err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(oldFull)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if _, err := os.Stat(newFull); err == nil {
+		return nil, newError(ErrConflict, "document already exists: %s", newPath)
+	}
+
+	hash := ContentHash(string(content))
+	if opts.ExpectedHash != "" && opts.ExpectedHash != hash {
+		return nil, newError(ErrConflict, "document changed since it was read: %s", oldPath)
+	}
+
+	result := &WriteResult{
+		Path:     newPath,
+		OldPath:  oldPath,
+		BaseHash: hash,
+		Hash:     hash,
+		Diff:     fmt.Sprintf("rename from %s\nrename to %s\n", oldPath, newPath),
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(newFull), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create folder: %w", err)
+	}
+	// A link fails if the new path exists by now, where a rename would
+	// replace it
+	if err := os.Link(oldFull, newFull); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, newError(ErrConflict, "document already exists: %s", newPath)
+		}
+		return nil, fmt.Errorf("failed to rename document: %w", err)
+	}
+	if err := os.Remove(oldFull); err != nil {
+		os.Remove(newFull)
+		return nil, fmt.Errorf("failed to rename document: %w", err)
+	}
+
+	n.logger.Info("document renamed", "from", oldPath, "to", newPath)
+	result.Applied = true
+	return result, nil
+}
+
+// RenderTemplate fills a note template from TemplatesDir with data.
+// The variables date, time and any keys in data are available to the template.
+func (n *Navigator) RenderTemplate(name string, data map[string]string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, ".") {
+		return "", newError(ErrInvalid, "invalid template name: %s", name)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(n.baseDir, TemplatesDir, name+".*"))
+	var source []byte
+	for _, match := range matches {
+		if n.security.IsAllowedFile(match) {
+			var err error
+			if source, err = os.ReadFile(match); err != nil {
+				return "", fmt.Errorf("failed to read template: %w", err)
+			}
+			break
+		}
+	}
+	if source == nil {
+		return "", newError(ErrNotFound, "template not found: %s", name)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(string(source))
+	if err != nil {
+		return "", wrapError(ErrInvalid, err, "template error")
+	}
+
+	now := time.Now()
+	vars := map[string]string{
+		"date": now.Format("2006-01-02"),
+		"time": now.Format("15:04"),
+	}
+	for k, v := range data {
+		vars[k] = v
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, vars); err != nil {
+		return "", wrapError(ErrInvalid, err, "template error")
+	}
+	return out.String(), nil
+}
+
+// modifyDocument reads a document, applies edit and writes the result back
+// unless opts asks for a dry run or the content hash no longer matches.
+func (n *Navigator) modifyDocument(relativePath string, opts WriteOptions, edit func(content string, format Format) (string, error)) (*WriteResult, error) {
+	fullPath, err := n.writablePath(relativePath)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := n.statDocument(fullPath, relativePath)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := os.ReadFile(fullPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	content := string(raw)
+
+	baseHash := ContentHash(content)
+	if opts.ExpectedHash != "" && opts.ExpectedHash != baseHash {
+		return nil, newError(ErrConflict, "document changed since it was read: %s", relativePath)
+	}
+
+	updated, err := edit(content, detectFormat(info.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WriteResult{
+		Path:     relativePath,
+		BaseHash: baseHash,
+		Hash:     ContentHash(updated),
+		Diff:     UnifiedDiff("a/"+relativePath, "b/"+relativePath, content, updated),
+	}
+	if opts.DryRun || updated == content {
+		return result, nil
+	}
+
+	if err := writeFileAtomic(fullPath, []byte(updated), info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+
+	n.logger.Info("document updated", "path", relativePath)
+	result.Applied = true
+	return result, nil
+}
+
+// writablePath validates a path that is about to be written. Symbolic
+// links are resolved too, so that a linked folder can't lead a write out
+// of the KB.
+func (n *Navigator) writablePath(relativePath string) (string, error) {
+	fullPath, err := n.validatePath(relativePath)
+	if err == nil {
+		err = n.checkResolvedPath(fullPath, relativePath)
+	}
+	if err != nil {
+		n.logger.Warn("path validation failed", "path", relativePath, "error", err)
+		return "", err
+	}
+	if !n.security.IsAllowedFile(fullPath) {
+		return "", newError(ErrUnsupportedFormat, "unsupported file type: %s", relativePath)
+	}
+	return fullPath, nil
+}
+
+// checkResolvedPath resolves the symbolic links of the deepest existing
+// part of fullPath and checks that it is still inside the KB root
+func (n *Navigator) checkResolvedPath(fullPath, relativePath string) error {
+	root, err := filepath.EvalSymlinks(n.baseDir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve KB root: %w", err)
+	}
+	existing := fullPath
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return newError(ErrForbiddenPath, "path can't be resolved: %s", relativePath)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return newError(ErrForbiddenPath, "path leads out of the KB: %s", relativePath)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces a file via a temporary file in the same folder
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write document: %w", err)
+	}
+	return nil
+}
+
+// findTask returns the line index of the Markdown task matching item
+func findTask(lines []string, item string) int {
+	item = strings.ToLower(strings.TrimSpace(item))
+	partial := -1
+	for i, line := range lines {
+		m := mdTaskRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		text := strings.ToLower(strings.TrimSpace(m[4]))
+		if text == item {
+			return i
+		}
+		if partial < 0 && strings.Contains(text, item) {
+			partial = i
+		}
+	}
+	return partial
+}
+
+func isDoneState(state string) bool {
+	return state == "DONE" || state == "CANCELLED" || state == "CANCELED"
+}
@@ -0,0 +1,263 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestNavigator(t *testing.T, files map[string]string) *Navigator {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	nav, err := NewNavigator(dir, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return nav
+}
+
+func readTestFile(t *testing.T, nav *Navigator, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(nav.baseDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+const orgNote = `#+TITLE: Daily
+
+* Meetings
+** Standup
+Discussed deploys.
+
+* TODO Write report :work:
+Draft is in progress.
+`
+
+func TestAppendToSection(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"daily.org": orgNote})
+
+	result, err := nav.AppendToSection("daily.org", "Meetings", "** Retro\nWent well.", WriteOptions{})
+	if err != nil {
+		t.Fatalf("AppendToSection failed: %v", err)
+	}
+	if !result.Applied {
+		t.Error("Expected change to be applied")
+	}
+
+	got := readTestFile(t, nav, "daily.org")
+	want := "Discussed deploys.\n** Retro\nWent well.\n\n* TODO Write report"
+	if !strings.Contains(got, want) {
+		t.Errorf("Expected appended text before next section, got:\n%s", got)
+	}
+}
+
+func TestReplaceSectionDryRun(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"daily.org": orgNote})
+
+	result, err := nav.ReplaceSection("daily.org", "Standup", "Nothing to report.", WriteOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("ReplaceSection failed: %v", err)
+	}
+	if result.Applied {
+		t.Error("Expected dry run not to apply changes")
+	}
+	if !strings.Contains(result.Diff, "-Discussed deploys.") || !strings.Contains(result.Diff, "+Nothing to report.") {
+		t.Errorf("Unexpected diff:\n%s", result.Diff)
+	}
+	if got := readTestFile(t, nav, "daily.org"); got != orgNote {
+		t.Errorf("Expected file to be unchanged, got:\n%s", got)
+	}
+}
+
+func TestWriteHashMismatch(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"daily.org": orgNote})
+
+	_, err := nav.AppendToSection("daily.org", "", "late note", WriteOptions{ExpectedHash: ContentHash("stale")})
+	if err == nil {
+		t.Fatal("Expected error for stale hash")
+	}
+
+	result, err := nav.AppendToSection("daily.org", "", "late note", WriteOptions{ExpectedHash: ContentHash(orgNote)})
+	if err != nil {
+		t.Fatalf("Expected matching hash to succeed: %v", err)
+	}
+	if result.Hash != ContentHash(readTestFile(t, nav, "daily.org")) {
+		t.Error("Expected result hash to match written content")
+	}
+}
+
+func TestSetTodoState(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		"daily.org": orgNote,
+		"tasks.md":  "# Tasks\n\n- [ ] Buy milk\n- [ ] Ship release\n",
+	})
+
+	if _, err := nav.SetTodoState("daily.org", "Write report", "done", WriteOptions{}); err != nil {
+		t.Fatalf("SetTodoState (org) failed: %v", err)
+	}
+	if got := readTestFile(t, nav, "daily.org"); !strings.Contains(got, "* DONE Write report :work:") {
+		t.Errorf("Expected DONE keyword, got:\n%s", got)
+	}
+
+	if _, err := nav.SetTodoState("tasks.md", "ship release", "DONE", WriteOptions{}); err != nil {
+		t.Fatalf("SetTodoState (markdown) failed: %v", err)
+	}
+	if got := readTestFile(t, nav, "tasks.md"); !strings.Contains(got, "- [x] Ship release") || !strings.Contains(got, "- [ ] Buy milk") {
+		t.Errorf("Expected only the matching task to be checked, got:\n%s", got)
+	}
+
+	if _, err := nav.SetTodoState("daily.org", "Write report", "BOGUS", WriteOptions{}); err == nil {
+		t.Error("Expected error for unknown state")
+	}
+}
+
+func TestCreateAndRenameNote(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{
+		TemplatesDir + "/meeting.md": "# {{.title}}\n\nDate: {{.date}}\nAttendees: {{.attendees}}\n",
+	})
+
+	content, err := nav.RenderTemplate("meeting", map[string]string{"title": "Sync", "attendees": "ann, bob"})
+	if err != nil {
+		t.Fatalf("RenderTemplate failed: %v", err)
+	}
+	if !strings.HasPrefix(content, "# Sync\n") || !strings.Contains(content, "Attendees: ann, bob") {
+		t.Errorf("Unexpected template output:\n%s", content)
+	}
+
+	if _, err := nav.CreateNote("meetings/sync.md", content, WriteOptions{}); err != nil {
+		t.Fatalf("CreateNote failed: %v", err)
+	}
+	if _, err := nav.CreateNote("meetings/sync.md", content, WriteOptions{}); err == nil {
+		t.Error("Expected error when creating an existing note")
+	}
+
+	if _, err := nav.RenameNote("meetings/sync.md", "archive/sync.md", WriteOptions{}); err != nil {
+		t.Fatalf("RenameNote failed: %v", err)
+	}
+	if got := readTestFile(t, nav, "archive/sync.md"); got != content {
+		t.Errorf("Expected renamed note to keep its content, got:\n%s", got)
+	}
+
+	docs, err := nav.ListDocuments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Path != filepath.Join("archive", "sync.md") {
+		t.Errorf("Expected only archive/sync.md to be listed, got %v", docs)
+	}
+}
+
+func TestConcurrentWritesDoNotClobber(t *testing.T) {
+	files := map[string]string{}
+	for i := 0; i < 32; i++ {
+		files[fmt.Sprintf("draft%d.md", i)] = fmt.Sprintf("# Draft %d\n", i)
+	}
+	nav := newTestNavigator(t, files)
+
+	// Of writers racing for the same path, one wins and the others conflict
+	race := func(write func(i int) error) {
+		t.Helper()
+		errs := make([]error, 32)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = write(i)
+			}()
+		}
+		wg.Wait()
+		won := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				won++
+			case !errors.Is(err, ErrConflict):
+				t.Errorf("Expected a conflict, got %v", err)
+			}
+		}
+		if won != 1 {
+			t.Errorf("Expected one writer to win, got %d", won)
+		}
+	}
+	race(func(i int) error {
+		_, err := nav.CreateNote("new.md", fmt.Sprintf("# New %d\n", i), WriteOptions{})
+		return err
+	})
+	race(func(i int) error {
+		_, err := nav.RenameNote(fmt.Sprintf("draft%d.md", i), "final.md", WriteOptions{})
+		return err
+	})
+
+	docs, err := nav.ListDocuments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 33 {
+		t.Errorf("Expected no note to be lost, got %v", docs)
+	}
+}
+
+func TestWritesStayInsideSymlinkedKB(t *testing.T) {
+	nav := newTestNavigator(t, map[string]string{"notes/a.md": "# A\n"})
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "b.md"), []byte("# B\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(nav.baseDir, "link")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	if _, err := nav.CreateNote("link/x.md", "# X\n", WriteOptions{}); !errors.Is(err, ErrForbiddenPath) {
+		t.Errorf("Expected creating a note through the link to be forbidden, got %v", err)
+	}
+	if _, err := nav.CreateNote("link/new/x.md", "# X\n", WriteOptions{}); !errors.Is(err, ErrForbiddenPath) {
+		t.Errorf("Expected creating a folder through the link to be forbidden, got %v", err)
+	}
+	if _, err := nav.RenameNote("notes/a.md", "link/a.md", WriteOptions{}); !errors.Is(err, ErrForbiddenPath) {
+		t.Errorf("Expected moving a note through the link to be forbidden, got %v", err)
+	}
+	if _, err := nav.ReplaceSection("link/b.md", "B", "changed", WriteOptions{}); !errors.Is(err, ErrForbiddenPath) {
+		t.Errorf("Expected editing a note through the link to be forbidden, got %v", err)
+	}
+
+	entries, _ := os.ReadDir(outside)
+	if len(entries) != 1 || readTestFile(t, nav, "notes/a.md") != "# A\n" {
+		t.Errorf("Expected nothing written outside the KB, got %v", entries)
+	}
+
+	// Links that stay inside the KB are followed
+	if err := os.Symlink(filepath.Join(nav.baseDir, "notes"), filepath.Join(nav.baseDir, "inside")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := nav.CreateNote("inside/c.md", "# C\n", WriteOptions{}); err != nil {
+		t.Errorf("Expected a link inside the KB to be writable, got %v", err)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	diff := UnifiedDiff("a/x", "b/x", "one\ntwo\nthree\n", "one\n2\nthree\n")
+	want := "--- a/x\n+++ b/x\n@@ -1,3 +1,3 @@\n one\n-two\n+2\n three\n"
+	if diff != want {
+		t.Errorf("Expected:\n%s\ngot:\n%s", want, diff)
+	}
+}